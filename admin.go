@@ -0,0 +1,106 @@
+package svcutil
+
+import (
+	"errors"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+var ErrRevisionMismatch = errors.New("revision mismatch")
+var ErrKeyOutsidePrefix = errors.New("key is outside the service prefix")
+
+// LockInfo describes a lock or lease key as stored in etcd
+type LockInfo struct {
+	Key            string
+	Value          string
+	Lease          int64
+	TTL            int64
+	CreateRevision int64
+	ModRevision    int64
+}
+
+// AdminListLocks lists mutex keys of the service including waiters. Every mutex is
+// stored as <key>/<lease>, the entry with the lowest create revision holds the lock.
+func (c *Service) AdminListLocks(ctx context.Context) ([]LockInfo, error) {
+	return c.adminList(ctx, c.adminLocksPrefix())
+}
+
+// AdminBreakLock force-releases a lock key of a crashed holder, the key is deleted only if
+// its create revision still matches, so a lock re-acquired in the meantime is never broken.
+// Keys not listed by AdminListLocks are refused with ErrKeyOutsidePrefix.
+func (c *Service) AdminBreakLock(ctx context.Context, key string, expectedRevision int64) error {
+	return c.adminBreak(ctx, c.adminLocksPrefix(), key, expectedRevision)
+}
+
+func (c *Service) adminLocksPrefix() string {
+	return c.options.locksPrefix + c.options.serviceName + c.options.mutexesPrefix
+}
+
+// AdminListLeases lists ID lease keys of the service
+func (c *Service) AdminListLeases(ctx context.Context) ([]LockInfo, error) {
+	return c.adminList(ctx, c.rangeKeyPrefix(RangeTypeID))
+}
+
+// AdminBreakLease force-releases an ID lease key guarded by its create revision.
+// A holder which is still alive notices the loss on its next lease check. Keys not listed
+// by AdminListLeases are refused with ErrKeyOutsidePrefix.
+func (c *Service) AdminBreakLease(ctx context.Context, key string, expectedRevision int64) error {
+	return c.adminBreak(ctx, c.rangeKeyPrefix(RangeTypeID), key, expectedRevision)
+}
+
+func (c *Service) adminList(ctx context.Context, prefix string) ([]LockInfo, error) {
+	resp, err := c.etcd.Get(ctx, prefix, clientv3.WithPrefix(),
+		clientv3.WithSort(clientv3.SortByCreateRevision, clientv3.SortAscend))
+	if err != nil {
+		return nil, err
+	}
+
+	locks := make([]LockInfo, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		info := LockInfo{
+			Key:            string(kv.Key),
+			Value:          string(kv.Value),
+			Lease:          kv.Lease,
+			TTL:            -1,
+			CreateRevision: kv.CreateRevision,
+			ModRevision:    kv.ModRevision,
+		}
+
+		if kv.Lease != 0 {
+			ttl, err := c.etcd.TimeToLive(ctx, clientv3.LeaseID(kv.Lease))
+			if err != nil {
+				return nil, err
+			}
+
+			info.TTL = ttl.TTL
+		}
+
+		locks = append(locks, info)
+	}
+
+	return locks, nil
+}
+
+// adminBreak deletes the key under the prefix, a mistyped key of another service or
+// of unrelated data is never touched
+func (c *Service) adminBreak(ctx context.Context, prefix, key string, expectedRevision int64) error {
+	if len(key) <= len(prefix) || !strings.HasPrefix(key, prefix) {
+		return ErrKeyOutsidePrefix
+	}
+
+	resp, err := c.etcd.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", expectedRevision)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	if err != nil {
+		return err
+	}
+
+	if !resp.Succeeded {
+		return ErrRevisionMismatch
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestAdminBreak(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	newService := func(name string) *Service {
+		svc, err := NewService(Name(name), LocalBackend(dir))
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		t.Cleanup(svc.Close)
+		return svc
+	}
+
+	svc := newService("api")
+	other := newService("billing")
+
+	if _, err := svc.AcquireLock(ctx, "job"); err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+	if _, err := other.AcquireLock(ctx, "job"); err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	r, _ := NewIDRange("1")
+	l := NewLeaseWithOptions(r, svc)
+	defer l.Close()
+	if _, err := l.Obtain(ctx); err != nil {
+		t.Fatalf("Obtain() error = %v", err)
+	}
+
+	locks, err := svc.AdminListLocks(ctx)
+	if err != nil || len(locks) != 1 {
+		t.Fatalf("AdminListLocks() = %v, %v, want the lock of the service", locks, err)
+	}
+	leases, err := svc.AdminListLeases(ctx)
+	if err != nil || len(leases) != 1 {
+		t.Fatalf("AdminListLeases() = %v, %v, want the lease of the service", leases, err)
+	}
+
+	foreign, err := other.AdminListLocks(ctx)
+	if err != nil || len(foreign) != 1 {
+		t.Fatalf("AdminListLocks() of another service = %v, %v", foreign, err)
+	}
+
+	lock, lease := locks[0], leases[0]
+	refused := []struct {
+		name string
+		do   func() error
+	}{
+		{"lock of another service", func() error {
+			return svc.AdminBreakLock(ctx, foreign[0].Key, foreign[0].CreateRevision)
+		}},
+		{"lease as a lock", func() error { return svc.AdminBreakLock(ctx, lease.Key, lease.CreateRevision) }},
+		{"lock as a lease", func() error { return svc.AdminBreakLease(ctx, lock.Key, lock.CreateRevision) }},
+		{"the prefix itself", func() error { return svc.AdminBreakLease(ctx, svc.rangeKeyPrefix(RangeTypeID), 0) }},
+	}
+	for _, tt := range refused {
+		if err := tt.do(); err != ErrKeyOutsidePrefix {
+			t.Errorf("break %s error = %v, want %v", tt.name, err, ErrKeyOutsidePrefix)
+		}
+	}
+
+	if err := svc.AdminBreakLock(ctx, lock.Key, lock.CreateRevision+1); err != ErrRevisionMismatch {
+		t.Errorf("AdminBreakLock() with a stale revision error = %v, want %v", err, ErrRevisionMismatch)
+	}
+
+	if err := svc.AdminBreakLock(ctx, lock.Key, lock.CreateRevision); err != nil {
+		t.Errorf("AdminBreakLock() error = %v", err)
+	}
+	if err := svc.AdminBreakLease(ctx, lease.Key, lease.CreateRevision); err != nil {
+		t.Errorf("AdminBreakLease() error = %v", err)
+	}
+
+	if locks, _ := svc.AdminListLocks(ctx); len(locks) != 0 {
+		t.Errorf("AdminListLocks() after the break = %v, want none", locks)
+	}
+	if leases, _ := svc.AdminListLeases(ctx); len(leases) != 0 {
+		t.Errorf("AdminListLeases() after the break = %v, want none", leases)
+	}
+	if foreign, _ := other.AdminListLocks(ctx); len(foreign) != 1 {
+		t.Errorf("AdminListLocks() of another service = %v, want its lock kept", foreign)
+	}
+}
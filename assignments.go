@@ -0,0 +1,266 @@
+package svcutil
+
+import (
+	"maps"
+	"sync"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// Assignments returns the holder of every taken member of the range, the instance name
+// or the metadata set with LeaseWithMetadata, and the revision the map was read at
+func (i *Lease) Assignments(ctx context.Context) (map[string]string, int64, error) {
+	prefix := i.keyPrefix()
+	resp, err := i.client.etcd.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, &LeaseError{Key: prefix, Op: "assignments", Err: etcdError(err)}
+	}
+
+	members := i.members()
+	assignments := make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if value, ok := i.member(members, prefix, kv); ok {
+			assignments[value] = i.holderOf(kv)
+		}
+	}
+
+	return assignments, resp.Header.Revision, nil
+}
+
+func (i *Lease) members() map[string]struct{} {
+	members := make(map[string]struct{}, len(i.r.Values))
+	for _, value := range i.r.Values {
+		members[value] = struct{}{}
+	}
+
+	return members
+}
+
+// member returns the range member of a key under the prefix
+func (i *Lease) member(members map[string]struct{}, prefix string, kv *mvccpb.KeyValue) (string, bool) {
+	value := string(kv.Key[len(prefix):])
+	_, ok := members[value]
+	return value, ok
+}
+
+// legacyLeaseValue is stored in lease keys by versions which didn't record the holder
+const legacyLeaseValue = "locked"
+
+// holderOf decodes the holder stored in a lease key, the raw value if it can't be decoded
+// and an empty string if the holder is unknown
+func (i *Lease) holderOf(kv *mvccpb.KeyValue) string {
+	if string(kv.Value) == legacyLeaseValue {
+		return ""
+	}
+
+	if payload, err := i.decodeValue(kv.Value); err == nil {
+		return string(payload)
+	}
+
+	return string(kv.Value)
+}
+
+// AssignmentMap is a local copy of the assignments of a range kept up to date with a
+// watch, e.g. for routers sending traffic to the owner of each shard
+type AssignmentMap struct {
+	mu          sync.RWMutex
+	assignments map[string]string
+	revision    int64
+	// changes are closed once the holder of their value changes
+	changes map[string]chan struct{}
+	// done is closed once the map is no longer updated
+	done    chan struct{}
+	stopped bool
+}
+
+func newAssignmentMap() *AssignmentMap {
+	return &AssignmentMap{done: make(chan struct{})}
+}
+
+// Done returns a channel closed once the map is no longer updated, when the context of
+// WatchAssignments is done or the service is closed
+func (m *AssignmentMap) Done() <-chan struct{} {
+	return m.done
+}
+
+// Assignments returns a copy of the assignments and the revision they reflect
+func (m *AssignmentMap) Assignments() (map[string]string, int64) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return maps.Clone(m.assignments), m.revision
+}
+
+// Holder returns the holder of the member, false if it is not taken
+func (m *AssignmentMap) Holder(value string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	holder, ok := m.assignments[value]
+	return holder, ok
+}
+
+// Changed returns a channel closed once the holder of the member changes or the map is no
+// longer updated, see Done
+func (m *AssignmentMap) Changed(value string) <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopped {
+		return m.done
+	}
+
+	if m.changes == nil {
+		m.changes = make(map[string]chan struct{})
+	}
+
+	ch, ok := m.changes[value]
+	if !ok {
+		ch = make(chan struct{})
+		m.changes[value] = ch
+	}
+
+	return ch
+}
+
+// notify closes the change channel of the value, the lock must be held
+func (m *AssignmentMap) notify(value string) {
+	if ch, ok := m.changes[value]; ok {
+		close(ch)
+		delete(m.changes, value)
+	}
+}
+
+// stop closes the change channels and Done once the watch ends, waiters must not wait for
+// changes which are never going to be seen
+func (m *AssignmentMap) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for value := range m.changes {
+		m.notify(value)
+	}
+
+	m.stopped = true
+	close(m.done)
+}
+
+func (m *AssignmentMap) reset(assignments map[string]string, revision int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for value, holder := range m.assignments {
+		if current, ok := assignments[value]; !ok || current != holder {
+			m.notify(value)
+		}
+	}
+	for value := range assignments {
+		if _, ok := m.assignments[value]; !ok {
+			m.notify(value)
+		}
+	}
+
+	m.assignments = assignments
+	m.revision = revision
+}
+
+func (m *AssignmentMap) apply(value, holder string, deleted bool, revision int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.assignments[value]
+	m.revision = revision
+
+	if deleted {
+		delete(m.assignments, value)
+		if ok {
+			m.notify(value)
+		}
+		return
+	}
+
+	m.assignments[value] = holder
+	if !ok || current != holder {
+		m.notify(value)
+	}
+}
+
+// WatchAssignments reads the assignments of the range and keeps them up to date until
+// ctx is done or the service is closed, the map is closed then (see AssignmentMap.Done).
+// After a compaction or a failed watch the map is read again, it keeps its last state in
+// the meantime.
+func (i *Lease) WatchAssignments(ctx context.Context) (*AssignmentMap, error) {
+	assignments, rev, err := i.Assignments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m := newAssignmentMap()
+	m.reset(assignments, rev)
+
+	c := i.client
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer m.stop()
+
+		prefix := i.keyPrefix()
+		members := i.members()
+
+		for failures := 0; ctx.Err() == nil; {
+			if rev == 0 {
+				assignments, r, err := i.Assignments(ctx)
+				if err != nil {
+					failures++
+					if !c.sleepWatchRetry(ctx.Done(), failures) {
+						return
+					}
+					continue
+				}
+
+				rev = r
+				m.reset(assignments, rev)
+			}
+
+			wctx, cancel := context.WithCancel(ctx)
+			watchChan := c.etcd.Watch(wctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+
+			for alive := true; alive; {
+				select {
+				case <-c.stopper:
+					cancel()
+					return
+				case wresp, ok := <-watchChan:
+					if !ok || wresp.Err() != nil {
+						// compacted or canceled, start over with a fresh read
+						rev = 0
+						alive = false
+						continue
+					}
+
+					if len(wresp.Events) > 0 {
+						failures = 0
+					}
+
+					for _, ev := range wresp.Events {
+						rev = ev.Kv.ModRevision
+						if value, ok := i.member(members, prefix, ev.Kv); ok {
+							m.apply(value, i.holderOf(ev.Kv), ev.Type == clientv3.EventTypeDelete, rev)
+						}
+					}
+				}
+			}
+			cancel()
+
+			// don't spin if the watch keeps failing right away
+			failures++
+			if !c.sleepWatchRetry(ctx.Done(), failures) {
+				return
+			}
+		}
+	}()
+
+	return m, nil
+}
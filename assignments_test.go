@@ -0,0 +1,132 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestWatchAssignments(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	router, err := NewService(Name("billing"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer router.Close()
+
+	worker, err := NewService(Name("billing"), Instance("worker-1"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer worker.Close()
+
+	r, _ := NewIDRange("1-2")
+	held := NewLeaseWithOptions(r, worker)
+	id, err := held.Obtain(ctx)
+	if err != nil {
+		t.Fatalf("Obtain() error = %v", err)
+	}
+
+	observer := NewLeaseWithOptions(r, router)
+	assignments, rev, err := observer.Assignments(ctx)
+	if err != nil || rev == 0 || len(assignments) != 1 || assignments[id] != "worker-1" {
+		t.Fatalf("Assignments() = %v, %d, %v, want %s held by worker-1", assignments, rev, err, id)
+	}
+
+	m, err := observer.WatchAssignments(ctx)
+	if err != nil {
+		t.Fatalf("WatchAssignments() error = %v", err)
+	}
+
+	if holder, ok := m.Holder(id); !ok || holder != "worker-1" {
+		t.Errorf("Holder(%s) = %q, %v, want worker-1", id, holder, ok)
+	}
+
+	held.Close()
+
+	for {
+		if _, ok := m.Holder(id); !ok {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatal("released value is still assigned")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if current, latest := m.Assignments(); len(current) != 0 || latest <= rev {
+		t.Errorf("Assignments() = %v at %d, want none after %d", current, latest, rev)
+	}
+}
+
+func TestAssignmentMapChanged(t *testing.T) {
+	m := newAssignmentMap()
+	m.reset(map[string]string{"1": "a", "2": "b"}, 1)
+
+	one, two, three := m.Changed("1"), m.Changed("2"), m.Changed("3")
+
+	m.apply("2", "b", false, 2)
+	m.reset(map[string]string{"2": "b", "3": "c"}, 3)
+
+	select {
+	case <-one:
+	default:
+		t.Error("removed value is not notified")
+	}
+
+	select {
+	case <-three:
+	default:
+		t.Error("added value is not notified")
+	}
+
+	select {
+	case <-two:
+		t.Error("unchanged value is notified")
+	default:
+	}
+
+	m.apply("2", "", true, 4)
+	select {
+	case <-two:
+	default:
+		t.Error("deleted value is not notified")
+	}
+}
+
+func TestAssignmentMapStopped(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("billing"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	r, _ := NewIDRange("1")
+	wctx, stop := context.WithCancel(ctx)
+	m, err := NewLeaseWithOptions(r, svc).WatchAssignments(wctx)
+	if err != nil {
+		t.Fatalf("WatchAssignments() error = %v", err)
+	}
+
+	changed := m.Changed("1")
+	stop()
+
+	// waiters are released once the watch ends, later ones don't block
+	for _, ch := range []<-chan struct{}{changed, m.Done(), m.Changed("1")} {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			t.Fatal("the channel is not closed after the watch ended")
+		}
+	}
+}
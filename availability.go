@@ -0,0 +1,96 @@
+package svcutil
+
+import (
+	"fmt"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// Availability describes the state of the range values
+type Availability struct {
+	Total    int
+	Taken    int
+	Reserved int
+	// Holders maps holder instances to the values they hold
+	Holders map[string][]string
+	// NearestValue is the held value whose lease expires first unless renewed
+	NearestValue  string
+	NearestExpiry time.Duration
+}
+
+// String summarizes the availability, e.g. to log it next to ErrNoAvailableIDs
+func (a Availability) String() string {
+	msg := fmt.Sprintf("%d of %d taken by %d holders, %d reserved", a.Taken, a.Total, len(a.Holders), a.Reserved)
+	if a.NearestValue != "" {
+		msg += fmt.Sprintf(", %s expires first in %s", a.NearestValue, a.NearestExpiry)
+	}
+
+	return msg
+}
+
+// Availability reports how many values of the range are taken or reserved, by whom,
+// and which lease expires first, e.g. after Obtain returned ErrNoAvailableIDs. Values held
+// by versions which didn't record their holder are listed under an empty holder.
+func (i *Lease) Availability(ctx context.Context) (Availability, error) {
+	av := Availability{
+		Total:   len(i.r.Values),
+		Holders: make(map[string][]string),
+	}
+
+	members := i.members()
+
+	prefix := i.keyPrefix()
+	resp, err := i.client.etcd.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return av, err
+	}
+
+	ttls := make(map[int64]int64)
+	for _, kv := range resp.Kvs {
+		value := string(kv.Key[len(prefix):])
+		if _, ok := members[value]; !ok {
+			continue
+		}
+
+		av.Taken++
+		holder := i.holderOf(kv)
+		av.Holders[holder] = append(av.Holders[holder], value)
+
+		if kv.Lease == 0 {
+			continue
+		}
+
+		ttl, ok := ttls[kv.Lease]
+		if !ok {
+			ttlResp, err := i.client.etcd.TimeToLive(ctx, clientv3.LeaseID(kv.Lease))
+			if err != nil {
+				return av, err
+			}
+
+			ttl = ttlResp.TTL
+			ttls[kv.Lease] = ttl
+		}
+
+		expiry := time.Duration(ttl) * time.Second
+		if ttl >= 0 && (av.NearestValue == "" || expiry < av.NearestExpiry) {
+			av.NearestValue = value
+			av.NearestExpiry = expiry
+		}
+	}
+
+	reservationsPrefix := i.client.shadowKey(i.client.options.reservationsPrefix, prefix)
+	resp, err = i.client.etcd.Get(ctx, reservationsPrefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return av, err
+	}
+
+	for _, kv := range resp.Kvs {
+		if _, ok := members[string(kv.Key[len(reservationsPrefix):])]; ok {
+			av.Reserved++
+		}
+	}
+
+	return av, nil
+}
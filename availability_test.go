@@ -0,0 +1,90 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestAvailabilityString(t *testing.T) {
+	tests := []struct {
+		name string
+		av   Availability
+		want string
+	}{
+		{
+			name: "empty range",
+			av:   Availability{Holders: map[string][]string{}},
+			want: "0 of 0 taken by 0 holders, 0 reserved",
+		},
+		{
+			name: "taken",
+			av: Availability{
+				Total:         3,
+				Taken:         2,
+				Reserved:      1,
+				Holders:       map[string][]string{"a": {"1", "2"}},
+				NearestValue:  "2",
+				NearestExpiry: 4 * time.Second,
+			},
+			want: "2 of 3 taken by 1 holders, 1 reserved, 2 expires first in 4s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.av.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObtainNoAvailableIDs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("api"), Instance("worker"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	r, _ := NewIDRange("1-2")
+	held := NewLeaseWithOptions(r, svc)
+	defer held.Close()
+	value, err := held.Obtain(ctx)
+	if err != nil {
+		t.Fatalf("Obtain() error = %v", err)
+	}
+
+	legacy := "1"
+	if value == legacy {
+		legacy = "2"
+	}
+
+	// a value held by a version which didn't record the holder
+	if _, err := svc.etcd.Put(ctx, held.keyPrefix()+legacy, legacyLeaseValue); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	l := NewLeaseWithOptions(r, svc)
+	defer l.Close()
+	if _, err := l.Obtain(ctx); err != ErrNoAvailableIDs {
+		t.Fatalf("Obtain() error = %v, want %v", err, ErrNoAvailableIDs)
+	}
+
+	av, err := l.Availability(ctx)
+	if err != nil {
+		t.Fatalf("Availability() error = %v", err)
+	}
+	if av.Total != 2 || av.Taken != 2 || len(av.Holders["worker"]) != 1 || len(av.Holders[""]) != 1 {
+		t.Errorf("Availability() = %+v, want 2 taken by worker and an unknown holder", av)
+	}
+
+	holder, err := l.Holder(ctx, legacy)
+	if err != nil || holder == nil || len(holder) != 0 {
+		t.Errorf("Holder() of a legacy value = %q, %v, want an empty holder", holder, err)
+	}
+}
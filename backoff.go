@@ -0,0 +1,31 @@
+package svcutil
+
+import "time"
+
+// BackoffPolicy returns the minimum delay between the given failed attempt and the next one,
+// attempts are numbered from 1
+type BackoffPolicy func(attempt int) time.Duration
+
+// ConstantBackoff waits the same delay after every failed attempt
+func ConstantBackoff(d time.Duration) BackoffPolicy {
+	return func(int) time.Duration {
+		return d
+	}
+}
+
+// ExponentialBackoff doubles the delay after every failed attempt starting with min,
+// the delay never exceeds max
+func ExponentialBackoff(min, max time.Duration) BackoffPolicy {
+	return func(attempt int) time.Duration {
+		d := min
+		for n := 1; n < attempt && d < max; n++ {
+			d *= 2
+		}
+
+		if d > max {
+			d = max
+		}
+
+		return d
+	}
+}
@@ -0,0 +1,36 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff(100*time.Millisecond, time.Second)
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 100 * time.Millisecond},
+		{attempt: 2, want: 200 * time.Millisecond},
+		{attempt: 4, want: 800 * time.Millisecond},
+		{attempt: 5, want: time.Second},
+		{attempt: 1000, want: time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := b(tt.attempt); got != tt.want {
+			t.Errorf("attempt %d: got %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestConstantBackoff(t *testing.T) {
+	b := ConstantBackoff(time.Second)
+	for _, attempt := range []int{1, 2, 100} {
+		if got := b(attempt); got != time.Second {
+			t.Errorf("attempt %d: got %v, want %v", attempt, got, time.Second)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package svcutil
+
+import (
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// defaultObtainBatch is the number of candidate values Obtain tries in one transaction
+const defaultObtainBatch = 8
+
+func (i *Lease) batchSize() int {
+	if i.options.batch > 0 {
+		return i.options.batch
+	}
+
+	return defaultObtainBatch
+}
+
+// maxBatchSize is the number of candidates fitting a single transaction. etcd limits a
+// transaction together with the transactions nested in it to maxTxnOps operations, every
+// nesting level takes as many as the larger of its compares and puts.
+func (i *Lease) maxBatchSize(tombstone clientv3.LeaseID) int {
+	perCandidate := max(len(i.obtainCmps("")), 1+len(i.tombstoneOps("", tombstone)))
+	return max(1, maxTxnOps/perCandidate)
+}
+
+// candidateOps builds a transaction putting the first key whose obtain compares hold,
+// every following candidate is tried in a transaction nested in the else branch. The
+// takeover tombstone is written along with the key unless tombstone is zero.
+func (i *Lease) candidateOps(keys []string, holder string, lease, tombstone clientv3.LeaseID) ([]clientv3.Cmp, []clientv3.Op, []clientv3.Op) {
+	cmps := i.obtainCmps(keys[0])
+	thens := append([]clientv3.Op{clientv3.OpPut(keys[0], holder, clientv3.WithLease(lease))}, i.tombstoneOps(keys[0], tombstone)...)
+
+	var elses []clientv3.Op
+	if len(keys) > 1 {
+		c, t, e := i.candidateOps(keys[1:], holder, lease, tombstone)
+		elses = []clientv3.Op{clientv3.OpTxn(c, t, e)}
+	}
+
+	return cmps, thens, elses
+}
+
+// obtainedCandidate returns the index of the candidate put by a transaction built
+// with candidateOps or -1 if all of them were taken
+func obtainedCandidate(resp *clientv3.TxnResponse) int {
+	for n := 0; ; n++ {
+		if resp.Succeeded {
+			return n
+		}
+
+		if len(resp.Responses) == 0 {
+			return -1
+		}
+
+		nested := resp.Responses[0].GetResponseTxn()
+		if nested == nil {
+			return -1
+		}
+
+		resp = (*clientv3.TxnResponse)(nested)
+	}
+}
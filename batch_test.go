@@ -0,0 +1,173 @@
+package svcutil
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// nestedResponse builds the response of a candidate transaction where the candidate
+// at index succeeded, -1 means all candidates were taken
+func nestedResponse(candidates, succeeded int) *etcdserverpb.TxnResponse {
+	var resp *etcdserverpb.TxnResponse
+	for n := candidates - 1; n >= 0; n-- {
+		cur := &etcdserverpb.TxnResponse{Succeeded: n == succeeded}
+		if !cur.Succeeded && resp != nil {
+			cur.Responses = []*etcdserverpb.ResponseOp{{Response: &etcdserverpb.ResponseOp_ResponseTxn{ResponseTxn: resp}}}
+		}
+
+		resp = cur
+	}
+
+	return resp
+}
+
+func TestObtainedCandidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates int
+		succeeded  int
+	}{
+		{name: "first", candidates: 4, succeeded: 0},
+		{name: "nested", candidates: 4, succeeded: 2},
+		{name: "last", candidates: 4, succeeded: 3},
+		{name: "single", candidates: 1, succeeded: 0},
+		{name: "taken", candidates: 4, succeeded: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := (*clientv3.TxnResponse)(nestedResponse(tt.candidates, tt.succeeded))
+			if got := obtainedCandidate(resp); got != tt.succeeded {
+				t.Errorf("obtainedCandidate() = %d, want %d", got, tt.succeeded)
+			}
+		})
+	}
+}
+
+func TestCandidateOps(t *testing.T) {
+	svc := &Service{options: NewOptions()}
+	l := NewLeaseWithOptions(nil, svc)
+
+	keys := []string{"/lock/svc/id/1", "/lock/svc/id/2", "/lock/svc/id/3"}
+	cmps, thens, elses := l.candidateOps(keys, "worker", 1, 0)
+
+	for depth := range keys {
+		if len(cmps) == 0 || string(cmps[0].Key) != keys[depth] {
+			t.Fatalf("depth %d: unexpected compares %v", depth, cmps)
+		}
+
+		if len(thens) != 1 || string(thens[0].KeyBytes()) != keys[depth] {
+			t.Fatalf("depth %d: unexpected puts %v", depth, thens)
+		}
+
+		if depth == len(keys)-1 {
+			if len(elses) != 0 {
+				t.Fatalf("depth %d: unexpected else branch", depth)
+			}
+			break
+		}
+
+		if len(elses) != 1 || !elses[0].IsTxn() {
+			t.Fatalf("depth %d: else branch is not a nested transaction", depth)
+		}
+
+		cmps, thens, elses = elses[0].Txn()
+	}
+}
+
+// txnOps counts the operations of a transaction the way etcd checks them against
+// --max-txn-ops, nested transactions add up with their parents
+func txnOps(cmps []clientv3.Cmp, thens, elses []clientv3.Op) int {
+	n := max(len(cmps), len(thens), len(elses))
+	for _, op := range append(thens, elses...) {
+		if op.IsTxn() {
+			c, t, e := op.Txn()
+			n += txnOps(c, t, e)
+		}
+	}
+
+	return n
+}
+
+func TestMaxBatchSize(t *testing.T) {
+	for _, takeover := range []bool{false, true} {
+		svc := &Service{options: NewOptions()}
+		var tombstone clientv3.LeaseID
+		if takeover {
+			svc.options.takeoverDelay = time.Second
+			tombstone = 2
+		}
+		l := NewLeaseWithOptions(nil, svc)
+
+		size := l.maxBatchSize(tombstone)
+		keys := make([]string, size+1)
+		for n := range keys {
+			keys[n] = fmt.Sprintf("/lock/svc/id/%d", n)
+		}
+
+		if ops := txnOps(l.candidateOps(keys[:size], "worker", 1, tombstone)); ops > maxTxnOps {
+			t.Errorf("takeover %v: %d candidates take %d operations, want at most %d", takeover, size, ops, maxTxnOps)
+		}
+		if ops := txnOps(l.candidateOps(keys, "worker", 1, tombstone)); ops <= maxTxnOps {
+			t.Errorf("takeover %v: %d candidates fit %d operations, the batch could be larger", takeover, size+1, ops)
+		}
+	}
+}
+
+func TestObtainWeighted(t *testing.T) {
+	svc, err := NewService(Name("billing"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	r, err := NewWeightedIDRange("1-4,5=3,6=2")
+	if err != nil {
+		t.Fatalf("NewWeightedIDRange() error = %v", err)
+	}
+
+	for _, want := range []string{"5", "6"} {
+		l := NewLeaseWithOptions(r, svc, LeaseWithBatchSize(2))
+		defer l.Close()
+
+		id, err := l.Obtain(context.Background())
+		if err != nil || id != want {
+			t.Fatalf("Obtain() = %q, %v, want %q", id, err, want)
+		}
+	}
+}
+
+func TestObtainExcluded(t *testing.T) {
+	svc, err := NewService(Name("billing"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	r, err := NewIDRange("1-3")
+	if err != nil {
+		t.Fatalf("NewIDRange() error = %v", err)
+	}
+
+	l := NewLeaseWithOptions(r, svc, LeaseWithExcludedValues([]string{"1"}))
+	defer l.Close()
+	l.Exclude("3")
+
+	id, err := l.Obtain(context.Background())
+	if err != nil || id != "2" {
+		t.Fatalf("Obtain() = %q, %v, want %q", id, err, "2")
+	}
+
+	other := NewLeaseWithOptions(r, svc, LeaseWithExcludedValues([]string{"1", "3"}))
+	defer other.Close()
+
+	if _, err := other.Obtain(context.Background()); !errors.Is(err, ErrNoAvailableIDs) {
+		t.Errorf("Obtain() with the rest excluded error = %v, want %v", err, ErrNoAvailableIDs)
+	}
+}
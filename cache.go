@@ -0,0 +1,196 @@
+package svcutil
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// cacheEntry is a cached value read at revision, an invalid entry only records the
+// revision of the last change seen by the watch
+type cacheEntry struct {
+	value    []byte
+	found    bool
+	fetched  time.Time
+	revision int64
+	invalid  bool
+}
+
+// kvCache is a read-through cache of configuration keys invalidated by etcd watches,
+// entries older than the staleness bound are fetched again even if no change was observed
+type kvCache struct {
+	mu        sync.RWMutex
+	entries   map[string]cacheEntry
+	staleness time.Duration
+	prefixes  []string
+	// generation changes on every clear, reads started before are not stored
+	generation uint64
+}
+
+func newKVCache(staleness time.Duration, prefixes ...string) *kvCache {
+	return &kvCache{
+		entries:   make(map[string]cacheEntry),
+		staleness: staleness,
+		prefixes:  prefixes,
+	}
+}
+
+func (kc *kvCache) covers(key string) bool {
+	for _, prefix := range kc.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (kc *kvCache) lookup(key string) (cacheEntry, bool) {
+	kc.mu.RLock()
+	defer kc.mu.RUnlock()
+
+	entry, ok := kc.entries[key]
+	if !ok || entry.invalid || time.Since(entry.fetched) > kc.staleness {
+		return cacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+// gen returns the generation to pass to store for a read started now
+func (kc *kvCache) gen() uint64 {
+	kc.mu.RLock()
+	defer kc.mu.RUnlock()
+
+	return kc.generation
+}
+
+// store caches the entry unless the cache was cleared since the read started or the
+// entry is older than a change already seen, a read racing with a change must not
+// bring back the previous value
+func (kc *kvCache) store(key string, entry cacheEntry, gen uint64) {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+
+	if gen != kc.generation {
+		return
+	}
+	if cur, ok := kc.entries[key]; ok && cur.revision > entry.revision {
+		return
+	}
+
+	kc.entries[key] = entry
+}
+
+// invalidate drops the entry of the key changed at revision
+func (kc *kvCache) invalidate(key string, revision int64) {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+
+	if cur, ok := kc.entries[key]; ok && cur.revision > revision {
+		return
+	}
+
+	kc.entries[key] = cacheEntry{revision: revision, invalid: true}
+}
+
+func (kc *kvCache) clear() {
+	kc.mu.Lock()
+	kc.entries = make(map[string]cacheEntry)
+	kc.generation++
+	kc.mu.Unlock()
+}
+
+// get reads a single key going through the cache when it is enabled
+func (c *Service) get(ctx context.Context, key string) ([]byte, bool, error) {
+	if c.cache == nil || !c.cache.covers(key) {
+		return c.fetch(ctx, key)
+	}
+
+	if entry, ok := c.cache.lookup(key); ok {
+		return entry.value, entry.found, nil
+	}
+
+	gen := c.cache.gen()
+	resp, err := c.etcd.Get(ctx, key, c.readOptions(ctx)...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	value, found := getValue(resp)
+	c.cache.store(key, cacheEntry{value: value, found: found, fetched: time.Now(), revision: resp.Header.Revision}, gen)
+
+	return value, found, nil
+}
+
+func (c *Service) fetch(ctx context.Context, key string) ([]byte, bool, error) {
+	resp, err := c.etcd.Get(ctx, key, c.readOptions(ctx)...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	value, found := getValue(resp)
+	return value, found, nil
+}
+
+func getValue(resp *clientv3.GetResponse) ([]byte, bool) {
+	if len(resp.Kvs) == 0 {
+		return nil, false
+	}
+
+	return resp.Kvs[0].Value, true
+}
+
+func (c *Service) cacheInvalidator(prefix string) {
+	defer c.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-c.stopper:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for failures := 0; ; {
+		if c.watchInvalidations(ctx, prefix) {
+			failures = 0
+		}
+
+		// changes might have been missed while the watch was down
+		c.cache.clear()
+
+		failures++
+		if !c.sleepWatchRetry(ctx.Done(), failures) {
+			return
+		}
+	}
+}
+
+// watchInvalidations invalidates entries of keys changed under the prefix until the watch
+// fails or closes, it reports whether any change was seen
+func (c *Service) watchInvalidations(ctx context.Context, prefix string) bool {
+	// a failed watch is canceled, so its watcher is not kept until the service is closed
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	seen := false
+	for wresp := range c.etcd.Watch(wctx, prefix, clientv3.WithPrefix()) {
+		if wresp.Err() != nil {
+			break
+		}
+
+		for _, ev := range wresp.Events {
+			c.cache.invalidate(string(ev.Kv.Key), ev.Kv.ModRevision)
+			seen = true
+		}
+	}
+
+	return seen
+}
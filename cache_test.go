@@ -0,0 +1,66 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKVCache(t *testing.T) {
+	kc := newKVCache(time.Minute, "/config/", "/host/")
+
+	if !kc.covers("/config/svc/port") || kc.covers("/lock/svc/id/1") {
+		t.Fatalf("covers() does not match configured prefixes")
+	}
+
+	kc.store("/config/svc/port", cacheEntry{value: []byte("80"), found: true, fetched: time.Now(), revision: 10}, kc.gen())
+	if entry, ok := kc.lookup("/config/svc/port"); !ok || string(entry.value) != "80" {
+		t.Errorf("lookup() = %q, %v, want \"80\", true", entry.value, ok)
+	}
+
+	kc.invalidate("/config/svc/port", 11)
+	if _, ok := kc.lookup("/config/svc/port"); ok {
+		t.Errorf("lookup() found invalidated entry")
+	}
+
+	kc.store("/config/svc/stale", cacheEntry{found: false, fetched: time.Now().Add(-2 * time.Minute)}, kc.gen())
+	if _, ok := kc.lookup("/config/svc/stale"); ok {
+		t.Errorf("lookup() returned entry older than staleness bound")
+	}
+
+	kc.store("/config/svc/port", cacheEntry{value: []byte("80"), found: true, fetched: time.Now(), revision: 12}, kc.gen())
+	kc.clear()
+	if _, ok := kc.lookup("/config/svc/port"); ok {
+		t.Errorf("lookup() found entry after clear()")
+	}
+}
+
+func TestKVCacheStaleRead(t *testing.T) {
+	kc := newKVCache(time.Minute, "/config/")
+
+	// a read at revision 10 completes after the watch reported a change at revision 11
+	gen := kc.gen()
+	kc.invalidate("/config/svc/port", 11)
+	kc.store("/config/svc/port", cacheEntry{value: []byte("80"), found: true, fetched: time.Now(), revision: 10}, gen)
+	if entry, ok := kc.lookup("/config/svc/port"); ok {
+		t.Errorf("lookup() = %q, want the value read before the change not cached", entry.value)
+	}
+
+	kc.store("/config/svc/port", cacheEntry{value: []byte("81"), found: true, fetched: time.Now(), revision: 11}, gen)
+	if entry, ok := kc.lookup("/config/svc/port"); !ok || string(entry.value) != "81" {
+		t.Errorf("lookup() = %q, %v, want \"81\", true", entry.value, ok)
+	}
+
+	// an older read never replaces a newer one
+	kc.store("/config/svc/port", cacheEntry{value: []byte("80"), found: true, fetched: time.Now(), revision: 10}, gen)
+	if entry, _ := kc.lookup("/config/svc/port"); string(entry.value) != "81" {
+		t.Errorf("lookup() = %q, want \"81\"", entry.value)
+	}
+
+	// a read started before the watch went down may have missed a change
+	gen = kc.gen()
+	kc.clear()
+	kc.store("/config/svc/host", cacheEntry{value: []byte("a"), found: true, fetched: time.Now(), revision: 20}, gen)
+	if _, ok := kc.lookup("/config/svc/host"); ok {
+		t.Errorf("lookup() found entry read before clear()")
+	}
+}
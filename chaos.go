@@ -0,0 +1,214 @@
+package svcutil
+
+import (
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+var ErrChaosInjected = errors.New("chaos fault injected")
+
+// ChaosOp identifies the operations faults are injected into
+type ChaosOp int
+
+const (
+	ChaosOpGet ChaosOp = iota
+	ChaosOpPut
+	ChaosOpDelete
+	// ChaosOpTxn is the commit of a transaction, used by locks, leases and config history
+	ChaosOpTxn
+	// ChaosOpKeepAlive is a keep-alive of a lease, a failed keep-alive ends it the way a
+	// lost connection does, e.g. the service session is lost
+	ChaosOpKeepAlive
+	// ChaosOpUnlock is the release of a lock acquired with AcquireLock
+	ChaosOpUnlock
+)
+
+func (op ChaosOp) String() string {
+	switch op {
+	case ChaosOpGet:
+		return "get"
+	case ChaosOpPut:
+		return "put"
+	case ChaosOpDelete:
+		return "delete"
+	case ChaosOpTxn:
+		return "txn"
+	case ChaosOpKeepAlive:
+		return "keepalive"
+	case ChaosOpUnlock:
+		return "unlock"
+	}
+
+	return "unknown"
+}
+
+// ChaosRule delays and/or fails the operation with the given probability (0 to 1). A
+// failing rule returns Err, ErrChaosInjected if it is nil.
+type ChaosRule struct {
+	Op          ChaosOp
+	Probability float64
+	Delay       time.Duration
+	Fail        bool
+	Err         error
+}
+
+// ChaosInjector injects faults into etcd operations of a service for testing its
+// behavior under etcd flakiness, see the Chaos option. The seed makes the sequence of
+// injected faults reproducible.
+type ChaosInjector struct {
+	rules    []ChaosRule
+	disabled atomic.Bool
+	injected [ChaosOpUnlock + 1]atomic.Int64
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func NewChaosInjector(seed uint64, rules ...ChaosRule) *ChaosInjector {
+	return &ChaosInjector{
+		rules: rules,
+		rnd:   rand.New(rand.NewPCG(seed, seed)),
+	}
+}
+
+// SetEnabled turns the injection on and off, e.g. to let a service start cleanly first
+func (ci *ChaosInjector) SetEnabled(enabled bool) {
+	ci.disabled.Store(!enabled)
+}
+
+// Injected returns the number of faults injected into the operation so far
+func (ci *ChaosInjector) Injected(op ChaosOp) int64 {
+	if op < 0 || int(op) >= len(ci.injected) {
+		return 0
+	}
+
+	return ci.injected[op].Load()
+}
+
+// roll returns the rules of the operation triggered by this call
+func (ci *ChaosInjector) roll(op ChaosOp) []ChaosRule {
+	if ci.disabled.Load() {
+		return nil
+	}
+
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	var triggered []ChaosRule
+	for _, r := range ci.rules {
+		if r.Op == op && ci.rnd.Float64() < r.Probability {
+			triggered = append(triggered, r)
+		}
+	}
+
+	return triggered
+}
+
+// inject applies the triggered rules of the operation, delays are cut short once ctx is done
+func (ci *ChaosInjector) inject(ctx context.Context, op ChaosOp) error {
+	triggered := ci.roll(op)
+	if len(triggered) == 0 {
+		return nil
+	}
+	ci.injected[op].Add(1)
+
+	for _, r := range triggered {
+		if r.Delay > 0 {
+			select {
+			case <-time.After(r.Delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	for _, r := range triggered {
+		if r.Fail {
+			if r.Err != nil {
+				return r.Err
+			}
+			return ErrChaosInjected
+		}
+	}
+
+	return nil
+}
+
+func chaosOp(op clientv3.Op) ChaosOp {
+	switch {
+	case op.IsPut():
+		return ChaosOpPut
+	case op.IsDelete():
+		return ChaosOpDelete
+	case op.IsTxn():
+		return ChaosOpTxn
+	}
+
+	return ChaosOpGet
+}
+
+// middleware injects faults into key-value requests, it goes last in the middleware
+// chain so user middleware (e.g. retries) observe the faults
+func (ci *ChaosInjector) middleware(next Operation) Operation {
+	return func(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+		if err := ci.inject(ctx, chaosOp(op)); err != nil {
+			return clientv3.OpResponse{}, err
+		}
+
+		return next(ctx, op)
+	}
+}
+
+// chaosLease injects faults into lease keep-alives
+type chaosLease struct {
+	clientv3.Lease
+	ci *ChaosInjector
+}
+
+func (l *chaosLease) KeepAliveOnce(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseKeepAliveResponse, error) {
+	if err := l.ci.inject(ctx, ChaosOpKeepAlive); err != nil {
+		return nil, err
+	}
+
+	return l.Lease.KeepAliveOnce(ctx, id)
+}
+
+// KeepAlive delays keep-alive responses and ends the keep-alive on a failure, which is
+// what the holder of the lease observes when etcd is unreachable
+func (l *chaosLease) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	if err := l.ci.inject(ctx, ChaosOpKeepAlive); err != nil {
+		return nil, err
+	}
+
+	kctx, cancel := context.WithCancel(ctx)
+	in, err := l.Lease.KeepAlive(kctx, id)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	out := make(chan *clientv3.LeaseKeepAliveResponse)
+	go func() {
+		defer close(out)
+		defer cancel()
+
+		for resp := range in {
+			if err := l.ci.inject(ctx, ChaosOpKeepAlive); err != nil {
+				return
+			}
+
+			select {
+			case out <- resp:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return out, nil
+}
@@ -0,0 +1,155 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+func TestChaosMiddleware(t *testing.T) {
+	errTxn := errors.New("txn failed")
+	ci := NewChaosInjector(1,
+		ChaosRule{Op: ChaosOpTxn, Probability: 1, Fail: true, Err: errTxn},
+		ChaosRule{Op: ChaosOpPut, Probability: 0, Fail: true},
+	)
+
+	fake := &fakeKV{}
+	kv := newMiddlewareKV(fake, []MiddlewareFunc{ci.middleware})
+	ctx := context.Background()
+
+	if _, err := kv.Txn(ctx).Commit(); err != errTxn {
+		t.Errorf("Commit() error = %v, want %v", err, errTxn)
+	}
+
+	if _, err := kv.Put(ctx, "/a", "1"); err != nil {
+		t.Errorf("Put() error = %v", err)
+	}
+
+	if len(fake.ops) != 1 || !fake.ops[0].IsPut() {
+		t.Errorf("ops reaching etcd = %v, want the put only", fake.ops)
+	}
+
+	if ci.Injected(ChaosOpTxn) != 1 || ci.Injected(ChaosOpPut) != 0 {
+		t.Errorf("Injected() = txn %d, put %d", ci.Injected(ChaosOpTxn), ci.Injected(ChaosOpPut))
+	}
+
+	ci.SetEnabled(false)
+	if _, err := kv.Txn(ctx).Commit(); err != nil {
+		t.Errorf("Commit() with chaos disabled error = %v", err)
+	}
+}
+
+func TestChaosDelay(t *testing.T) {
+	ci := NewChaosInjector(1, ChaosRule{Op: ChaosOpGet, Probability: 1, Delay: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := ci.inject(ctx, ChaosOpGet); err != context.DeadlineExceeded {
+		t.Errorf("inject() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestChaosProbability(t *testing.T) {
+	ci := NewChaosInjector(42, ChaosRule{Op: ChaosOpDelete, Probability: 0.25, Fail: true})
+
+	failed := 0
+	for range 1000 {
+		if ci.inject(context.Background(), ChaosOpDelete) != nil {
+			failed++
+		}
+	}
+
+	if failed < 200 || failed > 300 {
+		t.Errorf("%d of 1000 operations failed, want about 250", failed)
+	}
+
+	replay := NewChaosInjector(42, ChaosRule{Op: ChaosOpDelete, Probability: 0.25, Fail: true})
+	for range 1000 {
+		replay.inject(context.Background(), ChaosOpDelete)
+	}
+
+	if replay.Injected(ChaosOpDelete) != int64(failed) {
+		t.Errorf("replay with the same seed injected %d faults, want %d", replay.Injected(ChaosOpDelete), failed)
+	}
+}
+
+type fakeKeepAliveLease struct {
+	clientv3.Lease
+	responses int
+}
+
+func (f *fakeKeepAliveLease) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	ch := make(chan *clientv3.LeaseKeepAliveResponse)
+	go func() {
+		defer close(ch)
+		for range f.responses {
+			select {
+			case ch <- &clientv3.LeaseKeepAliveResponse{ID: id, TTL: 10}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		<-ctx.Done()
+	}()
+
+	return ch, nil
+}
+
+func TestChaosKeepAlive(t *testing.T) {
+	ci := NewChaosInjector(1, ChaosRule{Op: ChaosOpKeepAlive, Probability: 1, Fail: true})
+	ci.SetEnabled(false)
+
+	lease := &chaosLease{Lease: &fakeKeepAliveLease{responses: 3}, ci: ci}
+	ch, err := lease.KeepAlive(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("KeepAlive() error = %v", err)
+	}
+
+	if resp := <-ch; resp == nil || resp.ID != 7 {
+		t.Fatalf("first keep-alive = %v", resp)
+	}
+
+	// a following keep-alive fails and ends the channel as a lost connection would,
+	// the response read before enabling may still be delivered
+	ci.SetEnabled(true)
+	<-ch
+
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("keep-alive channel delivers after an injected failure")
+		}
+	case <-time.After(time.Second):
+		t.Error("keep-alive channel is not closed after an injected failure")
+	}
+}
+
+func TestChaosUnlock(t *testing.T) {
+	ci := NewChaosInjector(1, ChaosRule{Op: ChaosOpUnlock, Probability: 1, Fail: true})
+	ci.SetEnabled(false)
+
+	svc, err := NewService(Name("billing"), LocalBackend(t.TempDir()), Chaos(ci))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	ctx := context.Background()
+	if _, err := svc.AcquireLock(ctx, "migration"); err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	ci.SetEnabled(true)
+	if err := svc.ReleaseLock(ctx, "migration"); !errors.Is(err, ErrChaosInjected) {
+		t.Errorf("ReleaseLock() error = %v, want %v", err, ErrChaosInjected)
+	}
+
+	ci.SetEnabled(false)
+	if err := svc.ReleaseLock(ctx, "migration"); err != nil {
+		t.Errorf("ReleaseLock() error = %v", err)
+	}
+}
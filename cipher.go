@@ -0,0 +1,142 @@
+package svcutil
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+
+	"golang.org/x/net/context"
+)
+
+// encryptedPrefix marks configuration values encrypted with the ConfigCipher
+const encryptedPrefix = "@enc:"
+
+var ErrConfigCipherMissing = errors.New("config value is encrypted but no cipher is configured")
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// Cipher encrypts configuration values at rest, implementations can delegate to a KMS.
+// The additional data is the etcd key of the value, it must be authenticated (e.g. as
+// AEAD additional data or a KMS encryption context) so a ciphertext copied to another
+// key fails to decrypt.
+type Cipher interface {
+	Encrypt(plaintext, additionalData []byte) ([]byte, error)
+	Decrypt(ciphertext, additionalData []byte) ([]byte, error)
+}
+
+type aesGCMCipher struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCMCipher creates a Cipher using AES-GCM with the given 16, 24 or 32 byte key,
+// a random nonce is generated for every value and stored in front of the ciphertext
+func NewAESGCMCipher(key []byte) (Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &aesGCMCipher{aead: aead}, nil
+}
+
+func (c *aesGCMCipher) Encrypt(plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return c.aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func (c *aesGCMCipher) Decrypt(ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < c.aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+
+	nonce, sealed := ciphertext[:c.aead.NonceSize()], ciphertext[c.aead.NonceSize():]
+	return c.aead.Open(nil, nonce, sealed, additionalData)
+}
+
+// encryptConfigValue encrypts the value bound to the etcd key it is written to
+func encryptConfigValue(c Cipher, key, value string) (string, error) {
+	sealed, err := c.Encrypt([]byte(value), []byte(key))
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptConfigValue decrypts values written with a cipher, plaintext values are returned as is
+// so configurations can be migrated to encryption gradually. The key is the etcd key the value
+// was read from.
+func decryptConfigValue(c Cipher, key string, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(encryptedPrefix)) {
+		return data, nil
+	}
+
+	if c == nil {
+		return nil, ErrConfigCipherMissing
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(string(data[len(encryptedPrefix):]))
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+
+	return c.Decrypt(sealed, []byte(key))
+}
+
+// encryptConfig encrypts the values to be written under the configuration path
+func (c *Service) encryptConfig(path string, values map[string]string) (map[string]string, error) {
+	if c.options.cipher == nil {
+		return values, nil
+	}
+
+	encrypted := make(map[string]string, len(values))
+	for key, value := range values {
+		sealed, err := encryptConfigValue(c.options.cipher, configKey(path, key), value)
+		if err != nil {
+			return nil, err
+		}
+
+		encrypted[key] = sealed
+	}
+
+	return encrypted, nil
+}
+
+// getConfig reads a configuration key and decrypts its value
+func (c *Service) getConfig(ctx context.Context, key string) ([]byte, bool, error) {
+	data, found, err := c.get(ctx, key)
+	if err != nil {
+		return nil, false, &ConfigError{Key: key, Op: "get", Err: etcdError(err)}
+	}
+
+	if !found {
+		return nil, false, nil
+	}
+
+	data, err = c.decryptConfig(key, data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return data, true, nil
+}
+
+func (c *Service) decryptConfig(key string, data []byte) ([]byte, error) {
+	data, err := decryptConfigValue(c.options.cipher, key, data)
+	if err != nil {
+		return nil, &ConfigError{Key: key, Op: "decrypt", Err: err}
+	}
+
+	return data, nil
+}
@@ -0,0 +1,99 @@
+package svcutil
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAESGCMCipher(t *testing.T) {
+	c, err := NewAESGCMCipher(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatalf("NewAESGCMCipher() error = %v", err)
+	}
+
+	key := []byte("/config/billing/db")
+
+	first, err := c.Encrypt([]byte("secret"), key)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+
+	second, _ := c.Encrypt([]byte("secret"), key)
+	if bytes.Equal(first, second) {
+		t.Error("Encrypt() produced identical ciphertexts for the same plaintext")
+	}
+
+	plain, err := c.Decrypt(first, key)
+	if err != nil || string(plain) != "secret" {
+		t.Errorf("Decrypt() = %q, %v, want %q", plain, err, "secret")
+	}
+
+	// the ciphertext is bound to the key it was written to
+	if _, err := c.Decrypt(first, []byte("/config/billing/other")); err == nil {
+		t.Error("Decrypt() with another key succeeded")
+	}
+
+	first[len(first)-1] ^= 1
+	if _, err := c.Decrypt(first, key); err == nil {
+		t.Error("Decrypt() of tampered ciphertext succeeded")
+	}
+
+	if _, err := c.Decrypt([]byte{1}, key); !errors.Is(err, ErrInvalidCiphertext) {
+		t.Errorf("Decrypt() of short input error = %v, want %v", err, ErrInvalidCiphertext)
+	}
+
+	if _, err := NewAESGCMCipher([]byte("short")); err == nil {
+		t.Error("NewAESGCMCipher() accepted an invalid key size")
+	}
+}
+
+func TestConfigValueEncryption(t *testing.T) {
+	c, _ := NewAESGCMCipher(bytes.Repeat([]byte{7}, 16))
+
+	sealed, err := encryptConfigValue(c, "/config/billing/db", "postgres://db")
+	if err != nil {
+		t.Fatalf("encryptConfigValue() error = %v", err)
+	}
+
+	if !strings.HasPrefix(sealed, encryptedPrefix) || strings.Contains(sealed, "postgres") {
+		t.Errorf("encryptConfigValue() = %q, want an opaque %q value", sealed, encryptedPrefix)
+	}
+
+	// a value copied to another key does not decrypt
+	if _, err := decryptConfigValue(c, "/config/billing/public", []byte(sealed)); err == nil {
+		t.Error("decryptConfigValue() of a value moved to another key succeeded")
+	}
+
+	tests := []struct {
+		name    string
+		cipher  Cipher
+		key     string
+		data    string
+		want    string
+		wantErr error
+	}{
+		{name: "encrypted", cipher: c, key: "/config/billing/db", data: sealed, want: "postgres://db"},
+		{name: "plaintext", cipher: c, data: "plain", want: "plain"},
+		{name: "plaintext without cipher", data: "plain", want: "plain"},
+		{name: "encrypted without cipher", data: sealed, wantErr: ErrConfigCipherMissing},
+		{name: "invalid encoding", cipher: c, data: encryptedPrefix + "!!", wantErr: ErrInvalidCiphertext},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decryptConfigValue(tt.cipher, tt.key, []byte(tt.data))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("decryptConfigValue() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil || string(got) != tt.want {
+				t.Errorf("decryptConfigValue() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
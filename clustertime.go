@@ -0,0 +1,117 @@
+package svcutil
+
+import (
+	"cmp"
+	"fmt"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+const clockSegment = "/clock"
+
+// ClusterTimestamp orders records across instances regardless of skewed clocks. Timestamps
+// are ordered by the etcd revision observed when they were taken, then by their sequence
+// within the revision. The sequence is counted by each instance (Service), so it is unique
+// per instance only. Records stamped after another one was written to etcd, and observed,
+// are always ordered after it. Timestamps of different instances sharing a revision are
+// concurrent and ordered by the instance name.
+type ClusterTimestamp struct {
+	Revision int64  `json:"revision"`
+	Sequence int64  `json:"sequence"`
+	Instance string `json:"instance"`
+	// Time is the local clock of the instance when the timestamp was taken, it gives the
+	// approximate time but doesn't take part in ordering
+	Time time.Time `json:"time"`
+}
+
+// Compare returns -1 if t is ordered before u, 1 if after and 0 if they are equal
+func (t ClusterTimestamp) Compare(u ClusterTimestamp) int {
+	if c := cmp.Compare(t.Revision, u.Revision); c != 0 {
+		return c
+	}
+
+	if c := cmp.Compare(t.Sequence, u.Sequence); c != 0 {
+		return c
+	}
+
+	return cmp.Compare(t.Instance, u.Instance)
+}
+
+// Before reports whether t is ordered before u
+func (t ClusterTimestamp) Before(u ClusterTimestamp) bool {
+	return t.Compare(u) < 0
+}
+
+// String formats the timestamp so the strings sort in the order of the timestamps, e.g.
+// for keys of audit records
+func (t ClusterTimestamp) String() string {
+	return fmt.Sprintf("%020d.%06d.%s", t.Revision, t.Sequence, t.Instance)
+}
+
+// ClusterStamped is implemented by records stamped with Service.Stamp
+type ClusterStamped interface {
+	SetClusterTime(ts ClusterTimestamp)
+}
+
+func (c *Service) clockKey() string {
+	return c.options.locksPrefix + c.options.serviceName + clockSegment
+}
+
+// ClusterTime returns a timestamp ordering events across instances by the current etcd
+// revision instead of the local clocks, see ClusterTimestamp. Timestamps returned by the
+// service only grow, it takes a single read of etcd.
+func (c *Service) ClusterTime(ctx context.Context) (ClusterTimestamp, error) {
+	ts, err := c.clusterTimes(ctx, 1)
+	if err != nil {
+		return ClusterTimestamp{}, err
+	}
+
+	return ts[0], nil
+}
+
+// Stamp sets consecutive cluster timestamps of the records, e.g. audit entries or events
+// recorded together, with a single read of etcd
+func (c *Service) Stamp(ctx context.Context, records ...ClusterStamped) error {
+	ts, err := c.clusterTimes(ctx, len(records))
+	if err != nil {
+		return err
+	}
+
+	for n, r := range records {
+		r.SetClusterTime(ts[n])
+	}
+
+	return nil
+}
+
+func (c *Service) clusterTimes(ctx context.Context, n int) ([]ClusterTimestamp, error) {
+	resp, err := c.etcd.Get(ctx, c.clockKey(), clientv3.WithCountOnly())
+	if err != nil {
+		return nil, etcdError(err)
+	}
+
+	now := time.Now()
+
+	c.clockMu.Lock()
+	defer c.clockMu.Unlock()
+
+	// a revision behind the last one is read from a lagging member, keep counting
+	if rev := resp.Header.Revision; rev > c.clock.Revision {
+		c.clock = ClusterTimestamp{Revision: rev, Sequence: -1}
+	}
+
+	ts := make([]ClusterTimestamp, n)
+	for i := range ts {
+		c.clock.Sequence++
+		ts[i] = ClusterTimestamp{
+			Revision: c.clock.Revision,
+			Sequence: c.clock.Sequence,
+			Instance: c.options.instance,
+			Time:     now,
+		}
+	}
+
+	return ts, nil
+}
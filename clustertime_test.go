@@ -0,0 +1,69 @@
+package svcutil
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type auditRecord struct {
+	action string
+	ts     ClusterTimestamp
+}
+
+func (r *auditRecord) SetClusterTime(ts ClusterTimestamp) {
+	r.ts = ts
+}
+
+func TestClusterTime(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	a, err := NewService(Name("api"), Instance("a"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer a.Close()
+
+	b, err := NewService(Name("api"), Instance("b"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer b.Close()
+
+	first, err := a.ClusterTime(ctx)
+	if err != nil {
+		t.Fatalf("ClusterTime() error = %v", err)
+	}
+
+	second, _ := a.ClusterTime(ctx)
+	if !first.Before(second) || second.Revision != first.Revision {
+		t.Errorf("ClusterTime() = %v then %v, want a later sequence", first, second)
+	}
+
+	// a write observed by b orders b's timestamps after a's, whatever the clocks say
+	if _, err := a.etcd.Put(ctx, "/audit/1", "x"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	records := []*auditRecord{{action: "create"}, {action: "update"}}
+	if err := b.Stamp(ctx, records[0], records[1]); err != nil {
+		t.Fatalf("Stamp() error = %v", err)
+	}
+
+	if !second.Before(records[0].ts) || !records[0].ts.Before(records[1].ts) || records[1].ts.Instance != "b" {
+		t.Errorf("Stamp() = %v, %v after %v", records[0].ts, records[1].ts, second)
+	}
+
+	stamps := []string{records[1].ts.String(), second.String(), records[0].ts.String(), first.String()}
+	sort.Strings(stamps)
+	want := []string{first.String(), second.String(), records[0].ts.String(), records[1].ts.String()}
+	for n := range want {
+		if stamps[n] != want[n] {
+			t.Fatalf("sorted timestamps = %v, want %v", stamps, want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package svcutil
+
+import (
+	"golang.org/x/net/context"
+)
+
+// ValueCodec encodes the payload stored in lease keys, so deployments can keep protobuf
+// or encrypted payloads there while the lease lifecycle is still managed by svcutil.
+// The payload is the instance name or the metadata set with LeaseWithMetadata.
+type ValueCodec interface {
+	Encode(payload []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+func (i *Lease) encodeValue(payload string) (string, error) {
+	if i.options.codec == nil {
+		return payload, nil
+	}
+
+	data, err := i.options.codec.Encode([]byte(payload))
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func (i *Lease) decodeValue(data []byte) ([]byte, error) {
+	if i.options.codec == nil {
+		return data, nil
+	}
+
+	return i.options.codec.Decode(data)
+}
+
+// Holder returns the decoded payload stored by the current holder of the value
+// or nil if the value is not held by anyone
+func (i *Lease) Holder(ctx context.Context, value string) ([]byte, error) {
+	key := i.keyPrefix() + value
+	resp, err := i.client.etcd.Get(ctx, key)
+	if err != nil {
+		return nil, &LeaseError{Key: key, Op: "holder", Err: etcdError(err)}
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+
+	if string(resp.Kvs[0].Value) == legacyLeaseValue {
+		// held by a version which didn't record the holder
+		return []byte{}, nil
+	}
+
+	payload, err := i.decodeValue(resp.Kvs[0].Value)
+	if err != nil {
+		return nil, &LeaseError{Key: key, Op: "decode", Err: err}
+	}
+
+	return payload, nil
+}
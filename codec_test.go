@@ -0,0 +1,62 @@
+package svcutil
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type prefixCodec struct{}
+
+func (prefixCodec) Encode(payload []byte) ([]byte, error) {
+	return append([]byte("enc:"), payload...), nil
+}
+
+func (prefixCodec) Decode(data []byte) ([]byte, error) {
+	payload, ok := bytes.CutPrefix(data, []byte("enc:"))
+	if !ok {
+		return nil, errors.New("not encoded")
+	}
+
+	return payload, nil
+}
+
+func TestLeaseValueCodec(t *testing.T) {
+	svc := &Service{options: Instance("worker-1")(NewOptions())}
+
+	tests := []struct {
+		name    string
+		options []LeaseOption
+		want    string
+		payload string
+	}{
+		{name: "instance", want: "worker-1", payload: "worker-1"},
+		{name: "metadata", options: []LeaseOption{LeaseWithMetadata("shard")}, want: "shard", payload: "shard"},
+		{name: "codec", options: []LeaseOption{LeaseWithCodec(prefixCodec{})}, want: "enc:worker-1", payload: "worker-1"},
+		{name: "codec and metadata", options: []LeaseOption{LeaseWithCodec(prefixCodec{}), LeaseWithMetadata("shard")}, want: "enc:shard", payload: "shard"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLeaseWithOptions(nil, svc, tt.options...)
+
+			got, err := l.holderValue()
+			if err != nil {
+				t.Fatalf("holderValue() error = %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("holderValue() = %q, want %q", got, tt.want)
+			}
+
+			payload, err := l.decodeValue([]byte(got))
+			if err != nil {
+				t.Fatalf("decodeValue(%q) error = %v", got, err)
+			}
+
+			if string(payload) != tt.payload {
+				t.Errorf("decodeValue(%q) = %q, want %q", got, payload, tt.payload)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package svcutil
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+const commandAckSegment = "/ack/"
+
+// Command is a record broadcast to all instances of the service
+type Command struct {
+	ID     string    `json:"-"`
+	Name   string    `json:"name"`
+	Args   []string  `json:"args,omitempty"`
+	Issuer string    `json:"issuer"`
+	Time   time.Time `json:"time"`
+}
+
+// CommandAck confirms that an instance handled a command, Err is the error returned by the handler
+type CommandAck struct {
+	Instance string    `json:"instance"`
+	Time     time.Time `json:"time"`
+	Err      string    `json:"err,omitempty"`
+}
+
+// CommandHandler handles a command received by the instance
+type CommandHandler func(ctx context.Context, cmd Command) error
+
+func (c *Service) commandPrefix() string {
+	return c.options.commandsPrefix + c.options.serviceName + "/"
+}
+
+// parseCommandKey splits a key under the command prefix into the command id and,
+// for ack keys, the acknowledging instance
+func parseCommandKey(prefix, key string) (id, instance string, ok bool) {
+	rest, found := strings.CutPrefix(key, prefix)
+	if !found || rest == "" {
+		return "", "", false
+	}
+
+	id, instance, isAck := strings.Cut(rest, commandAckSegment)
+	if !isAck && strings.Contains(rest, "/") {
+		return "", "", false
+	}
+
+	return id, instance, true
+}
+
+func newCommandID(now time.Time) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+
+	return fmt.Sprintf("%020d-%s", now.UnixNano(), hex.EncodeToString(suffix))
+}
+
+// Command broadcasts a command to all instances of the service which registered a handler
+// with OnCommand and returns its id. The record and acks expire after TopicRetention.
+func (c *Service) Command(ctx context.Context, name string, args ...string) (string, error) {
+	now := time.Now()
+	data, err := json.Marshal(Command{Name: name, Args: args, Issuer: c.options.instance, Time: now})
+	if err != nil {
+		return "", err
+	}
+
+	grant, err := c.etcd.Grant(ctx, c.topicTTL())
+	if err != nil {
+		return "", etcdError(err)
+	}
+
+	id := newCommandID(now)
+	if _, err := c.etcd.Put(ctx, c.commandPrefix()+id, string(data), clientv3.WithLease(grant.ID)); err != nil {
+		return "", etcdError(err)
+	}
+
+	return id, nil
+}
+
+// CommandAcks returns acknowledgements of the command by instances, sorted by instance
+func (c *Service) CommandAcks(ctx context.Context, id string) ([]CommandAck, error) {
+	resp, err := c.etcd.Get(ctx, c.commandPrefix()+id+commandAckSegment, clientv3.WithPrefix())
+	if err != nil {
+		return nil, etcdError(err)
+	}
+
+	acks := make([]CommandAck, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var ack CommandAck
+		if err := json.Unmarshal(kv.Value, &ack); err != nil {
+			continue
+		}
+
+		acks = append(acks, ack)
+	}
+
+	sort.Slice(acks, func(a, b int) bool { return acks[a].Instance < acks[b].Instance })
+
+	return acks, nil
+}
+
+// OnCommand registers the handler of commands issued after the call, the handler is called
+// sequentially from an internal goroutine and its result is acknowledged under the command.
+// Commands are received until the service is closed, registering another handler replaces it.
+func (c *Service) OnCommand(handler CommandHandler) error {
+	resp, err := c.etcd.Get(context.Background(), c.commandPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		return etcdError(err)
+	}
+
+	c.commandMu.Lock()
+	first := c.commandHandler == nil
+	c.commandHandler = handler
+	c.commandMu.Unlock()
+
+	if first {
+		c.wg.Add(1)
+		go c.commandWatcher(resp.Header.Revision)
+	}
+
+	return nil
+}
+
+func (c *Service) commandWatcher(rev int64) {
+	defer c.wg.Done()
+
+	watchContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	prefix := c.commandPrefix()
+	watchChan := c.etcd.Watch(watchContext, prefix, clientv3.WithPrefix(), clientv3.WithFilterDelete(), clientv3.WithRev(rev+1))
+
+	failures := 0
+	for {
+		select {
+		case <-c.stopper:
+			return
+		case wresp, ok := <-watchChan:
+			if !ok || wresp.Err() != nil {
+				failures++
+				if !c.sleepWatchRetry(watchContext.Done(), failures) {
+					return
+				}
+
+				if wresp.CompactRevision > rev {
+					// the commands issued since rev may be compacted away, handle the ones
+					// still pending and resume after the listing
+					listed, err := c.pendingCommands(watchContext, prefix, rev)
+					if err != nil {
+						watchChan = c.etcd.Watch(watchContext, prefix, clientv3.WithPrefix(), clientv3.WithFilterDelete(), clientv3.WithRev(wresp.CompactRevision))
+						continue
+					}
+					rev = listed
+				}
+
+				watchChan = c.etcd.Watch(watchContext, prefix, clientv3.WithPrefix(), clientv3.WithFilterDelete(), clientv3.WithRev(rev+1))
+				continue
+			}
+			failures = 0
+
+			for _, ev := range wresp.Events {
+				rev = ev.Kv.ModRevision
+
+				id, instance, ok := parseCommandKey(prefix, string(ev.Kv.Key))
+				if !ok || instance != "" {
+					continue
+				}
+
+				var cmd Command
+				if err := json.Unmarshal(ev.Kv.Value, &cmd); err != nil {
+					continue
+				}
+				cmd.ID = id
+
+				c.handleCommand(cmd, clientv3.LeaseID(ev.Kv.Lease))
+			}
+		}
+	}
+}
+
+// pendingCommands handles the commands issued after rev which this instance did not
+// acknowledge yet and returns the revision of the listing
+func (c *Service) pendingCommands(ctx context.Context, prefix string, rev int64) (int64, error) {
+	resp, err := c.etcd.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByModRevision, clientv3.SortAscend))
+	if err != nil {
+		return 0, etcdError(err)
+	}
+
+	acked := make(map[string]bool)
+	for _, kv := range resp.Kvs {
+		if id, instance, ok := parseCommandKey(prefix, string(kv.Key)); ok && instance == c.options.instance {
+			acked[id] = true
+		}
+	}
+
+	for _, kv := range resp.Kvs {
+		id, instance, ok := parseCommandKey(prefix, string(kv.Key))
+		if !ok || instance != "" || kv.ModRevision <= rev || acked[id] {
+			continue
+		}
+
+		var cmd Command
+		if err := json.Unmarshal(kv.Value, &cmd); err != nil {
+			continue
+		}
+		cmd.ID = id
+
+		c.handleCommand(cmd, clientv3.LeaseID(kv.Lease))
+	}
+
+	return resp.Header.Revision, nil
+}
+
+func (c *Service) handleCommand(cmd Command, lease clientv3.LeaseID) {
+	c.commandMu.Lock()
+	handler := c.commandHandler
+	c.commandMu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.stopper:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ack := CommandAck{Instance: c.options.instance}
+	if err := callCommandHandler(ctx, handler, cmd); err != nil {
+		ack.Err = err.Error()
+		if _, panicked := err.(commandPanic); panicked {
+			c.emit(Event{Type: EventTypeHandlerPanic, Key: "command", Value: cmd.Name, Err: err})
+		}
+	}
+	ack.Time = time.Now()
+
+	data, err := json.Marshal(ack)
+	if err != nil {
+		return
+	}
+
+	actx, acancel := context.WithTimeout(ctx, c.options.etcdDialTimeout)
+	defer acancel()
+
+	// the ack shares the lease of the command so both expire together
+	c.etcd.Put(actx, c.commandPrefix()+cmd.ID+commandAckSegment+c.options.instance, string(data), clientv3.WithLease(lease))
+}
+
+type commandPanic struct {
+	value any
+}
+
+func (p commandPanic) Error() string {
+	return fmt.Sprintf("command handler panic: %v", p.value)
+}
+
+func callCommandHandler(ctx context.Context, handler CommandHandler, cmd Command) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = commandPanic{value: r}
+		}
+	}()
+
+	return handler(ctx, cmd)
+}
@@ -0,0 +1,111 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestParseCommandKey(t *testing.T) {
+	prefix := "/command/billing/"
+
+	tests := []struct {
+		key      string
+		id       string
+		instance string
+		ok       bool
+	}{
+		{key: "/command/billing/0001-ab", id: "0001-ab", ok: true},
+		{key: "/command/billing/0001-ab/ack/host-a", id: "0001-ab", instance: "host-a", ok: true},
+		{key: "/command/billing/0001-ab/other", ok: false},
+		{key: "/command/billing/", ok: false},
+		{key: "/command/auth/0001-ab", ok: false},
+	}
+
+	for _, tt := range tests {
+		id, instance, ok := parseCommandKey(prefix, tt.key)
+		if id != tt.id || instance != tt.instance || ok != tt.ok {
+			t.Errorf("parseCommandKey(%q) = %q, %q, %v, want %q, %q, %v", tt.key, id, instance, ok, tt.id, tt.instance, tt.ok)
+		}
+	}
+}
+
+func TestNewCommandID(t *testing.T) {
+	now := time.Now()
+	a, b := newCommandID(now), newCommandID(now)
+	if a == b {
+		t.Errorf("newCommandID() returned %q twice", a)
+	}
+
+	if later := newCommandID(now.Add(time.Nanosecond)); later <= a && later <= b {
+		t.Errorf("newCommandID() = %q is not ordered after %q and %q", later, a, b)
+	}
+}
+
+func TestCallCommandHandler(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	err := callCommandHandler(context.Background(), func(ctx context.Context, cmd Command) error {
+		return errFailed
+	}, Command{})
+	if err != errFailed {
+		t.Errorf("callCommandHandler() error = %v, want %v", err, errFailed)
+	}
+
+	err = callCommandHandler(context.Background(), func(ctx context.Context, cmd Command) error {
+		panic("boom")
+	}, Command{})
+	if _, ok := err.(commandPanic); !ok {
+		t.Errorf("callCommandHandler() error = %v, want commandPanic", err)
+	}
+}
+
+func TestPendingCommands(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("billing"), Instance("worker-1"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	var handled []string
+	svc.commandHandler = func(ctx context.Context, cmd Command) error {
+		handled = append(handled, cmd.Name)
+		return nil
+	}
+
+	before, _ := svc.Command(ctx, "before")
+	resp, err := svc.etcd.Get(ctx, svc.commandPrefix()+before)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	rev := resp.Kvs[0].ModRevision
+
+	svc.Command(ctx, "reload")
+	acked, _ := svc.Command(ctx, "acked")
+	svc.Command(ctx, "flush")
+	svc.handleCommand(Command{ID: acked, Name: "acked"}, 0)
+	handled = nil
+
+	// the commands issued after rev and not acknowledged by the instance are handled in order
+	listed, err := svc.pendingCommands(ctx, svc.commandPrefix(), rev)
+	if err != nil {
+		t.Fatalf("pendingCommands() error = %v", err)
+	}
+	if len(handled) != 2 || handled[0] != "reload" || handled[1] != "flush" {
+		t.Errorf("handled %v, want [reload flush]", handled)
+	}
+	if listed <= rev {
+		t.Errorf("pendingCommands() revision = %d, want above %d", listed, rev)
+	}
+
+	// handled commands are acknowledged and not handled again
+	handled = nil
+	if _, err := svc.pendingCommands(ctx, svc.commandPrefix(), rev); err != nil || len(handled) != 0 {
+		t.Errorf("second pendingCommands() handled %v, %v", handled, err)
+	}
+}
@@ -0,0 +1,205 @@
+package svcutil
+
+import (
+	"strings"
+	"sync"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/context"
+)
+
+// compositeAttempts bounds the retries of a composite obtain racing other instances
+const compositeAttempts = 3
+
+// CompositeLease obtains one value from each of several ranges under a single etcd
+// lease, e.g. a shard ID together with a VIP. Either all values are obtained or none.
+// Unlike Lease, an expired composite lease is not reacquired, Done gets closed instead.
+type CompositeLease struct {
+	client *Service
+	ranges []*Lease
+
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	stopper   chan struct{}
+	donec     chan struct{}
+
+	lease    clientv3.LeaseID
+	revision int64
+	values   []string
+}
+
+func NewCompositeLease(etcd *Service, ranges ...*Range) *CompositeLease {
+	leases := make([]*Lease, 0, len(ranges))
+	for _, r := range ranges {
+		leases = append(leases, NewLeaseWithOptions(r, etcd))
+	}
+
+	return &CompositeLease{
+		client:  etcd,
+		ranges:  leases,
+		stopper: make(chan struct{}),
+		donec:   make(chan struct{}),
+	}
+}
+
+// Obtain obtains one value from each range, values are returned in the order of ranges
+func (cl *CompositeLease) Obtain(ctx context.Context) ([]string, error) {
+	ctx, span := cl.client.startSpan(ctx, "CompositeLease.Obtain", attribute.Int("svcutil.ranges", len(cl.ranges)))
+	values, err := cl.obtain(ctx)
+	endSpan(span, err)
+
+	return values, err
+}
+
+// compositeKey names all keys of a composite lease in errors
+func compositeKey(keys []string) string {
+	return strings.Join(keys, ",")
+}
+
+func (cl *CompositeLease) obtain(ctx context.Context) ([]string, error) {
+	prefixes := make([]string, len(cl.ranges))
+	for n, l := range cl.ranges {
+		prefixes[n] = l.keyPrefix()
+	}
+
+	grant, err := cl.client.etcd.Grant(ctx, int64(cl.client.options.etcdLeaseTTL))
+	if err != nil {
+		return nil, &LeaseError{Key: compositeKey(prefixes), Op: "grant", Err: etcdError(err)}
+	}
+
+	for attempt := 0; attempt < compositeAttempts; attempt++ {
+		values, keys, err := cl.pick(ctx)
+		if err != nil {
+			cl.client.revoke(grant.ID)
+			return nil, err
+		}
+
+		var cmps []clientv3.Cmp
+		ops := make([]clientv3.Op, 0, len(keys))
+		for n, key := range keys {
+			cmps = append(cmps, cl.ranges[n].obtainCmps(key)...)
+			ops = append(ops, clientv3.OpPut(key, cl.client.options.instance, clientv3.WithLease(grant.ID)))
+		}
+
+		txnResp, err := cl.client.etcd.Txn(ctx).If(cmps...).Then(ops...).Commit()
+		if err != nil {
+			cl.client.revoke(grant.ID)
+			return nil, &LeaseError{Key: compositeKey(keys), Op: "obtain", Err: etcdError(err)}
+		}
+
+		if !txnResp.Succeeded {
+			continue
+		}
+
+		keepAliveContext, cancel := context.WithCancel(context.Background())
+		kl, err := cl.client.etcd.KeepAlive(keepAliveContext, grant.ID)
+		if err != nil {
+			cancel()
+			cl.client.revoke(grant.ID)
+			return nil, &LeaseError{Key: compositeKey(keys), Op: "keepalive", Err: etcdError(err)}
+		}
+
+		cl.lease = grant.ID
+		cl.revision = txnResp.Header.Revision
+		cl.values = values
+
+		cl.wg.Add(1)
+		go cl.worker(kl, cancel)
+
+		return values, nil
+	}
+
+	cl.client.revoke(grant.ID)
+	return nil, ErrNoAvailableIDs
+}
+
+// pick chooses a value of every range Lease.Obtain would take, one not held, reserved or
+// guarded by a tombstone, ranges sharing a key prefix get distinct values
+func (cl *CompositeLease) pick(ctx context.Context) ([]string, []string, error) {
+	values := make([]string, len(cl.ranges))
+	keys := make([]string, len(cl.ranges))
+	taken := make(map[string]bool)
+
+	for n, l := range cl.ranges {
+		prefix := l.keyPrefix()
+		unavailable, _, err := l.unavailable(ctx, prefix)
+		if err != nil {
+			return nil, nil, &LeaseError{Key: prefix, Op: "obtain", Err: err}
+		}
+
+		for key := range unavailable {
+			taken[key] = true
+		}
+
+		for _, value := range l.candidates() {
+			if taken[prefix+value] {
+				continue
+			}
+
+			values[n] = value
+			keys[n] = prefix + value
+			taken[keys[n]] = true
+			break
+		}
+
+		if keys[n] == "" {
+			return nil, nil, ErrNoAvailableIDs
+		}
+	}
+
+	return values, keys, nil
+}
+
+func (cl *CompositeLease) worker(kl <-chan *clientv3.LeaseKeepAliveResponse, cancel context.CancelFunc) {
+	defer cl.wg.Done()
+
+	lost := false
+	select {
+	case <-cl.stopper:
+	case <-drained(kl):
+		lost = true
+	}
+
+	cancel()
+	close(cl.donec)
+
+	if !lost {
+		cl.client.revoke(cl.lease)
+	}
+}
+
+// drained returns a channel closed once the keep-alive channel is closed
+func drained(kl <-chan *clientv3.LeaseKeepAliveResponse) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		for range kl {
+		}
+		close(done)
+	}()
+
+	return done
+}
+
+// Values returns the obtained values in the order of ranges
+func (cl *CompositeLease) Values() []string {
+	return cl.values
+}
+
+// Revision returns the fencing revision shared by all obtained values
+func (cl *CompositeLease) Revision() int64 {
+	return cl.revision
+}
+
+// Done returns the channel that gets closed once the values are lost or released
+func (cl *CompositeLease) Done() <-chan struct{} {
+	return cl.donec
+}
+
+// Close releases all values at once
+func (cl *CompositeLease) Close() {
+	cl.closeOnce.Do(func() {
+		close(cl.stopper)
+	})
+	cl.wg.Wait()
+}
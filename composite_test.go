@@ -0,0 +1,61 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+func TestCompositeLease(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("edge"), LocalBackend(t.TempDir()), TakeoverDelay(time.Minute))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	ids, _ := NewIDRange("1-3")
+	vlans, _ := NewVLANRange("100-101")
+
+	// a reserved and a tombstoned value are skipped like Lease.Obtain skips them
+	reserved, _ := NewIDRange("2")
+	if err := svc.ReserveIDs(ctx, reserved, "maintenance", 0); err != nil {
+		t.Fatalf("ReserveIDs() error = %v", err)
+	}
+	l := NewLeaseWithOptions(ids, svc)
+	if _, err := svc.etcd.Put(ctx, l.tombstoneKey(l.keyPrefix()+"3"), "crashed"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	first := NewCompositeLease(svc, ids, vlans)
+	values, err := first.Obtain(ctx)
+	if err != nil || len(values) != 2 || values[0] != "1" {
+		t.Fatalf("Obtain() = %v, %v, want ID 1", values, err)
+	}
+	defer first.Close()
+
+	if _, err := NewCompositeLease(svc, ids, vlans).Obtain(ctx); !errors.Is(err, ErrNoAvailableIDs) {
+		t.Errorf("Obtain() of an exhausted range error = %v, want %v", err, ErrNoAvailableIDs)
+	}
+
+	// releasing frees all values at once
+	first.Close()
+	resp, err := svc.etcd.Get(ctx, l.keyPrefix()+"1", clientv3.WithCountOnly())
+	if err != nil || resp.Count != 0 {
+		t.Errorf("released value still held: %v, %v", resp, err)
+	}
+
+	// errors name the keys of the lease
+	canceled, cancelNow := context.WithCancel(ctx)
+	cancelNow()
+	_, err = NewCompositeLease(svc, ids, vlans).Obtain(canceled)
+	var leaseErr *LeaseError
+	if !errors.As(err, &leaseErr) || leaseErr.Key != l.keyPrefix()+","+svc.rangeKeyPrefix(RangeTypeVLAN) {
+		t.Errorf("Obtain() error = %v, want a LeaseError naming the prefixes", err)
+	}
+}
@@ -0,0 +1,253 @@
+package svcutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/context"
+)
+
+var ErrConfigRevisionNotFound = errors.New("config revision not found")
+var ErrTooManyConfigValues = errors.New("too many config values")
+
+// ConfigRevision is a single config write recorded in the history
+type ConfigRevision struct {
+	Revision   int64             `json:"-"`
+	Time       time.Time         `json:"time"`
+	Writer     string            `json:"writer"`
+	RollbackOf int64             `json:"rollback_of,omitempty"`
+	Values     map[string]string `json:"values"`
+}
+
+func encodeConfig(cfg any) (map[string]string, error) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return nil, ErrInvalidConfigPointer
+	}
+
+	keys := getConfigKeys(cfg)
+	if len(keys) == 0 {
+		return nil, ErrInvalidConfigPointer
+	}
+
+	values := make(map[string]string, len(keys))
+	for fieldName, key := range keys {
+		field := v.FieldByName(fieldName)
+
+		switch field.Kind() {
+		case reflect.String:
+			values[key] = field.String()
+		case reflect.Int, reflect.Int64:
+			values[key] = strconv.FormatInt(field.Int(), 10)
+		case reflect.Bool:
+			values[key] = strconv.FormatBool(field.Bool())
+		default:
+		}
+	}
+
+	return values, nil
+}
+
+// LoadConfigMap returns all keys under the configuration path relative to it, for
+// dynamic configurations which can't be expressed as a fixed struct
+func (c *Service) LoadConfigMap(ctx context.Context, ct ConfigurationType) (map[string]string, error) {
+	path := c.configPath(ct)
+
+	ctx, span := c.startSpan(ctx, "LoadConfigMap", attribute.String("svcutil.key", path))
+	resp, err := c.etcd.Get(ctx, path, append(c.readOptions(ctx), clientv3.WithPrefix())...)
+	if err != nil {
+		err = &ConfigError{Key: path, Op: "load", Err: etcdError(err)}
+		endSpan(span, err)
+		return nil, err
+	}
+
+	values, err := configMap(path, resp.Kvs, c.options.cipher)
+	endSpan(span, err)
+
+	return values, err
+}
+
+func configMap(path string, kvs []*mvccpb.KeyValue, cipher Cipher) (map[string]string, error) {
+	values := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		key := strings.TrimPrefix(string(kv.Key), path)
+		if key == "" {
+			continue
+		}
+
+		value, err := decryptConfigValue(cipher, string(kv.Key), kv.Value)
+		if err != nil {
+			return nil, &ConfigError{Key: string(kv.Key), Op: "decrypt", Err: err}
+		}
+
+		values[key] = string(value)
+	}
+
+	return values, nil
+}
+
+// historyPath is the history prefix of the config path, the history prefix carries the
+// tenant root already, so the path is taken relative to it
+func (c *Service) historyPath(path string) string {
+	if c.options.tenant != "" {
+		path = strings.TrimPrefix(path, "/"+c.options.tenant)
+	}
+
+	return c.options.configHistoryPrefix + strings.TrimPrefix(path, "/")
+}
+
+// SaveConfig writes the json-tagged fields of cfg in the same layout LoadConfig reads them,
+// every write is recorded in the config history. Writes beyond ConfigHistoryLimit are
+// dropped from the history. The values and the history record are written in a single
+// etcd transaction, so up to maxTxnOps-1 (127) values are accepted.
+func (c *Service) SaveConfig(ctx context.Context, ct ConfigurationType, cfg any) error {
+	path := c.configPath(ct)
+
+	values, err := encodeConfig(cfg)
+	if err != nil {
+		return &ConfigError{Key: path, Op: "save", Err: err}
+	}
+
+	values, err = c.encryptConfig(path, values)
+	if err != nil {
+		return &ConfigError{Key: path, Op: "encrypt", Err: err}
+	}
+
+	ctx, span := c.startSpan(ctx, "SaveConfig", attribute.String("svcutil.key", path))
+	err = c.saveConfig(ctx, path, values, 0)
+	if err != nil {
+		err = &ConfigError{Key: path, Op: "save", Err: etcdError(err)}
+	}
+	endSpan(span, err)
+
+	return err
+}
+
+func (c *Service) saveConfig(ctx context.Context, path string, values map[string]string, rollbackOf int64) error {
+	// the history record takes one operation
+	if len(values) >= maxTxnOps {
+		return ErrTooManyConfigValues
+	}
+
+	if c.options.dryRun {
+		c.dryRun(path, fmt.Sprintf("save config: %d values", len(values)))
+		return nil
+	}
+
+	record, err := json.Marshal(ConfigRevision{
+		Time:       time.Now(),
+		Writer:     c.options.instance,
+		RollbackOf: rollbackOf,
+		Values:     values,
+	})
+	if err != nil {
+		return err
+	}
+
+	ops := make([]clientv3.Op, 0, len(values)+1)
+	for key, value := range values {
+		ops = append(ops, clientv3.OpPut(configKey(path, key), value))
+	}
+
+	historyKey := fmt.Sprintf("%s%020d", c.historyPath(path), time.Now().UnixNano())
+	ops = append(ops, clientv3.OpPut(historyKey, string(record)))
+
+	if _, err = c.etcd.Txn(ctx).Then(ops...).Commit(); err != nil {
+		return err
+	}
+
+	// the write is saved already, a failed trim is repeated by the next write
+	c.trimHistory(ctx, c.historyPath(path))
+	return nil
+}
+
+// trimHistory deletes the writes under the history prefix beyond the history limit,
+// history keys sort by their write time
+func (c *Service) trimHistory(ctx context.Context, prefix string) error {
+	limit := c.options.configHistoryLimit
+	if limit == 0 {
+		return nil
+	}
+
+	// the newest write to delete is the one after the kept ones
+	resp, err := c.etcd.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly(),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortDescend), clientv3.WithLimit(int64(limit)+1))
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) <= limit {
+		return nil
+	}
+
+	end := string(resp.Kvs[limit].Key) + "\x00"
+	_, err = c.etcd.Delete(ctx, prefix, clientv3.WithRange(end))
+	return err
+}
+
+// History lists config writes of the given configuration type, oldest first
+func (c *Service) History(ctx context.Context, ct ConfigurationType) ([]ConfigRevision, error) {
+	path := c.historyPath(c.configPath(ct))
+	resp, err := c.etcd.Get(ctx, path, clientv3.WithPrefix(),
+		clientv3.WithSort(clientv3.SortByCreateRevision, clientv3.SortAscend))
+	if err != nil {
+		return nil, &ConfigError{Key: path, Op: "history", Err: etcdError(err)}
+	}
+
+	history := make([]ConfigRevision, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var rev ConfigRevision
+		if err := json.Unmarshal(kv.Value, &rev); err != nil {
+			continue
+		}
+
+		rev.Revision = kv.CreateRevision
+		history = append(history, rev)
+	}
+
+	return history, nil
+}
+
+// RollbackConfig restores the values written at the given history revision,
+// the rollback itself is recorded in the history as a new write
+func (c *Service) RollbackConfig(ctx context.Context, ct ConfigurationType, toRevision int64) error {
+	path := c.configPath(ct)
+
+	ctx, span := c.startSpan(ctx, "RollbackConfig", attribute.String("svcutil.key", path), attribute.Int64("svcutil.revision", toRevision))
+	err := c.rollbackConfig(ctx, ct, path, toRevision)
+	if err != nil {
+		var ce *ConfigError
+		if !errors.As(err, &ce) {
+			err = &ConfigError{Key: path, Op: "rollback", Err: etcdError(err)}
+		}
+	}
+	endSpan(span, err)
+
+	return err
+}
+
+func (c *Service) rollbackConfig(ctx context.Context, ct ConfigurationType, path string, toRevision int64) error {
+	history, err := c.History(ctx, ct)
+	if err != nil {
+		return err
+	}
+
+	for _, rev := range history {
+		if rev.Revision == toRevision {
+			return c.saveConfig(ctx, path, rev.Values, toRevision)
+		}
+	}
+
+	return ErrConfigRevisionNotFound
+}
@@ -0,0 +1,165 @@
+package svcutil
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+func TestEncodeConfig(t *testing.T) {
+	type Config struct {
+		Name    string `json:"name"`
+		Port    int    `json:"port"`
+		Limit   int64  `json:"limit"`
+		Enabled bool   `json:"enabled"`
+		Ratio   float64
+		Skipped []string `json:"skipped"`
+	}
+
+	values, err := encodeConfig(&Config{Name: "svc", Port: 8080, Limit: -1, Enabled: true, Ratio: 0.5})
+	if err != nil {
+		t.Fatalf("encodeConfig() error = %v", err)
+	}
+
+	expected := map[string]string{
+		"name":    "svc",
+		"port":    "8080",
+		"limit":   "-1",
+		"enabled": "true",
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("encodeConfig() = %v, want %v", values, expected)
+	}
+
+	if _, err := encodeConfig("not a struct"); err != ErrInvalidConfigPointer {
+		t.Errorf("encodeConfig() error = %v, want %v", err, ErrInvalidConfigPointer)
+	}
+}
+
+func TestConfigMap(t *testing.T) {
+	kvs := []*mvccpb.KeyValue{
+		{Key: []byte("/config/svc/"), Value: []byte("root")},
+		{Key: []byte("/config/svc/plugins"), Value: []byte("a,b")},
+		{Key: []byte("/config/svc/customers/acme/limit"), Value: []byte("10")},
+	}
+
+	expected := map[string]string{
+		"plugins":              "a,b",
+		"customers/acme/limit": "10",
+	}
+	if got, err := configMap("/config/svc/", kvs, nil); err != nil || !reflect.DeepEqual(got, expected) {
+		t.Errorf("configMap() = %v, %v, want %v", got, err, expected)
+	}
+}
+
+func TestConfigHistoryLimit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("api"), LocalBackend(t.TempDir()), ConfigHistoryLimit(2))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	type config struct {
+		Level string `json:"level"`
+	}
+
+	for _, level := range []string{"debug", "info", "warn"} {
+		if err := svc.SaveConfig(ctx, ConfigurationTypeService, &config{Level: level}); err != nil {
+			t.Fatalf("SaveConfig() error = %v", err)
+		}
+	}
+
+	history, err := svc.History(ctx, ConfigurationTypeService)
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+
+	var levels []string
+	for _, rev := range history {
+		levels = append(levels, rev.Values["level"])
+	}
+	if want := []string{"info", "warn"}; !reflect.DeepEqual(levels, want) {
+		t.Errorf("History() levels = %v, want %v", levels, want)
+	}
+}
+
+func TestConfigHistoryTenant(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("api"), Tenant("t1"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	type config struct {
+		Level string `json:"level"`
+	}
+
+	for _, level := range []string{"debug", "info"} {
+		if err := svc.SaveConfig(ctx, ConfigurationTypeService, &config{Level: level}); err != nil {
+			t.Fatalf("SaveConfig() error = %v", err)
+		}
+	}
+
+	// the tenant root is not repeated below the history prefix
+	resp, err := svc.etcd.Get(ctx, "/t1/configs-history/config/api/", clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil || resp.Count != 2 {
+		t.Fatalf("history keys of the tenant = %v, %v, want 2", resp, err)
+	}
+
+	history, err := svc.History(ctx, ConfigurationTypeService)
+	if err != nil || len(history) != 2 {
+		t.Fatalf("History() = %v, %v, want 2 writes", history, err)
+	}
+
+	if err := svc.RollbackConfig(ctx, ConfigurationTypeService, history[0].Revision); err != nil {
+		t.Fatalf("RollbackConfig() error = %v", err)
+	}
+
+	var loaded config
+	if err := svc.LoadConfig(ctx, ConfigurationTypeService, &loaded); err != nil || loaded.Level != "debug" {
+		t.Errorf("LoadConfig() after rollback = %+v, %v, want debug", loaded, err)
+	}
+
+	if history, err = svc.History(ctx, ConfigurationTypeService); err != nil || len(history) != 3 || history[2].RollbackOf != history[0].Revision {
+		t.Errorf("History() after rollback = %+v, %v", history, err)
+	}
+}
+
+func TestSaveConfigTooManyValues(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("api"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	path := svc.configPath(ConfigurationTypeService)
+	values := make(map[string]string)
+	for n := range maxTxnOps - 1 {
+		values[fmt.Sprintf("key%d", n)] = "value"
+	}
+
+	// the values and the history record fill the transaction
+	if err := svc.saveConfig(ctx, path, values, 0); err != nil {
+		t.Fatalf("saveConfig() of %d values error = %v", len(values), err)
+	}
+
+	values["one-more"] = "value"
+	if err := svc.saveConfig(ctx, path, values, 0); !errors.Is(err, ErrTooManyConfigValues) {
+		t.Errorf("saveConfig() of %d values error = %v, want %v", len(values), err, ErrTooManyConfigValues)
+	}
+}
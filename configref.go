@@ -0,0 +1,51 @@
+package svcutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+// configRefPrefix marks a configuration value referencing another key, e.g. "@ref:/config/shared/dsn"
+const configRefPrefix = "@ref:"
+
+// maxConfigRefDepth limits how many references are followed to resolve a single value
+const maxConfigRefDepth = 8
+
+var ErrConfigRefCycle = errors.New("config reference cycle")
+var ErrConfigRefDepth = errors.New("config reference depth exceeded")
+
+// configGetter reads a configuration key, errors are returned as *ConfigError
+type configGetter func(ctx context.Context, key string) ([]byte, bool, error)
+
+// resolveConfigRef follows references starting from the value of key until a plain value is found
+func resolveConfigRef(ctx context.Context, get configGetter, key string, data []byte) ([]byte, error) {
+	visited := map[string]struct{}{key: {}}
+
+	for depth := 0; bytes.HasPrefix(data, []byte(configRefPrefix)); depth++ {
+		if depth == maxConfigRefDepth {
+			return nil, &ConfigError{Key: key, Op: "resolve", Err: ErrConfigRefDepth}
+		}
+
+		ref := string(data[len(configRefPrefix):])
+		if _, ok := visited[ref]; ok {
+			return nil, &ConfigError{Key: key, Op: "resolve", Err: fmt.Errorf("%w: %s", ErrConfigRefCycle, ref)}
+		}
+		visited[ref] = struct{}{}
+
+		value, found, err := get(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		if !found {
+			return nil, &ConfigError{Key: ref, Op: "resolve", Err: ErrConfigKeyNotFound}
+		}
+
+		data = value
+	}
+
+	return data, nil
+}
@@ -0,0 +1,59 @@
+package svcutil
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestResolveConfigRef(t *testing.T) {
+	store := map[string]string{
+		"/config/shared/dsn": "postgres://db",
+		"/config/a/dsn":      "@ref:/config/shared/dsn",
+		"/config/b/dsn":      "@ref:/config/a/dsn",
+		"/config/c/x":        "@ref:/config/d/x",
+		"/config/d/x":        "@ref:/config/c/x",
+		"/config/e/x":        "@ref:/config/missing",
+	}
+	for i := 0; i < maxConfigRefDepth+1; i++ {
+		store[fmt.Sprintf("/chain/%d", i)] = fmt.Sprintf("@ref:/chain/%d", i+1)
+	}
+	store[fmt.Sprintf("/chain/%d", maxConfigRefDepth+1)] = "end"
+
+	get := func(ctx context.Context, key string) ([]byte, bool, error) {
+		v, ok := store[key]
+		return []byte(v), ok, nil
+	}
+
+	tests := []struct {
+		key     string
+		want    string
+		wantErr error
+	}{
+		{key: "/config/shared/dsn", want: "postgres://db"},
+		{key: "/config/a/dsn", want: "postgres://db"},
+		{key: "/config/b/dsn", want: "postgres://db"},
+		{key: "/config/c/x", wantErr: ErrConfigRefCycle},
+		{key: "/config/e/x", wantErr: ErrConfigKeyNotFound},
+		{key: "/chain/0", wantErr: ErrConfigRefDepth},
+		{key: "/chain/1", want: "end"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := resolveConfigRef(context.Background(), get, tt.key, []byte(store[tt.key]))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("resolveConfigRef() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil || string(got) != tt.want {
+				t.Errorf("resolveConfigRef() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
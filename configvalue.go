@@ -0,0 +1,160 @@
+package svcutil
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+var ErrConfigKeyNotFound = errors.New("config key not found")
+
+// GetConfigValue reads a single configuration key, decrypting it and following @ref:
+// references, and parses it into T. Strings are returned as stored, durations accept time.ParseDuration
+// syntax, other types are decoded as JSON (numbers, booleans, structs).
+func GetConfigValue[T any](ctx context.Context, svc *Service, ct ConfigurationType, key string) (T, error) {
+	var zero T
+
+	key = configKey(svc.configPath(ct), key)
+	data, found, err := svc.get(ctx, key)
+	if err != nil {
+		return zero, &ConfigError{Key: key, Op: "get", Err: etcdError(err)}
+	}
+
+	if !found {
+		return zero, &ConfigError{Key: key, Op: "get", Err: ErrConfigKeyNotFound}
+	}
+
+	return resolveConfigValue[T](ctx, svc, svc.getConfig, key, data)
+}
+
+// WatchConfigValue calls onChange with the current value of a configuration key and
+// again after every change until ctx is done, parsing the value like GetConfigValue.
+// Changes of keys referenced with @ref: are reported as changes of the value. A deleted
+// or missing key is reported with ErrConfigKeyNotFound.
+func WatchConfigValue[T any](ctx context.Context, svc *Service, ct ConfigurationType, key string, onChange func(T, error)) {
+	go watchConfigValue(ctx, svc, configKey(svc.configPath(ct), key), onChange)
+}
+
+func watchConfigValue[T any](ctx context.Context, svc *Service, key string, onChange func(T, error)) {
+	var zero T
+
+	for failures := 0; ctx.Err() == nil; {
+		// the keys the value was resolved from, any of them changing changes the value
+		keys := []string{key}
+		get := func(ctx context.Context, ref string) ([]byte, bool, error) {
+			keys = append(keys, ref)
+			return svc.getConfig(ctx, ref)
+		}
+
+		resp, err := svc.etcd.Get(ctx, key)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			onChange(zero, &ConfigError{Key: key, Op: "get", Err: etcdError(err)})
+
+			failures++
+			if !svc.sleepWatchRetry(ctx.Done(), failures) {
+				return
+			}
+			continue
+		}
+
+		if len(resp.Kvs) == 0 {
+			onChange(zero, &ConfigError{Key: key, Op: "get", Err: ErrConfigKeyNotFound})
+		} else {
+			onChange(resolveConfigValue[T](ctx, svc, get, key, resp.Kvs[0].Value))
+		}
+
+		// the value is read again after a change, or after the watch failed since changes
+		// might have been lost, e.g. to a compaction
+		if watchConfigKeys(ctx, svc, keys, resp.Header.Revision) {
+			failures = 0
+			continue
+		}
+
+		// don't spin if the watch keeps failing
+		failures++
+		if !svc.sleepWatchRetry(ctx.Done(), failures) {
+			return
+		}
+	}
+}
+
+// watchConfigKeys waits for a change of any of the keys after rev, it returns false if
+// a watch failed or closed first
+func watchConfigKeys(ctx context.Context, svc *Service, keys []string, rev int64) bool {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// every watch reports once, the buffer keeps the others from blocking
+	changed := make(chan bool, len(keys))
+	for _, key := range keys {
+		watchChan := svc.etcd.Watch(wctx, key, clientv3.WithRev(rev+1))
+		go func() {
+			for wresp := range watchChan {
+				if wresp.Err() != nil {
+					break
+				}
+
+				if len(wresp.Events) > 0 {
+					changed <- true
+					return
+				}
+			}
+			changed <- false
+		}()
+	}
+
+	select {
+	case ok := <-changed:
+		return ok
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func resolveConfigValue[T any](ctx context.Context, svc *Service, get configGetter, key string, data []byte) (T, error) {
+	var zero T
+
+	data, err := svc.decryptConfig(key, data)
+	if err != nil {
+		return zero, err
+	}
+
+	data, err = resolveConfigRef(ctx, get, key, data)
+	if err != nil {
+		return zero, err
+	}
+
+	return parseConfigValue[T](key, data)
+}
+
+func parseConfigValue[T any](key string, data []byte) (T, error) {
+	var v T
+
+	var err error
+	switch p := any(&v).(type) {
+	case *string:
+		*p = string(data)
+	case *time.Duration:
+		*p, err = time.ParseDuration(string(data))
+		if err != nil {
+			// plain numbers are nanoseconds, same as the JSON encoding of a duration
+			err = json.Unmarshal(data, p)
+		}
+	default:
+		err = json.Unmarshal(data, p)
+	}
+
+	if err != nil {
+		var zero T
+		return zero, &ConfigError{Key: key, Op: "parse", Err: err}
+	}
+
+	return v, nil
+}
@@ -0,0 +1,115 @@
+package svcutil
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestParseConfigValue(t *testing.T) {
+	type limits struct {
+		Max  int  `json:"max"`
+		Soft bool `json:"soft"`
+	}
+
+	if v, err := parseConfigValue[int]("k", []byte("42")); err != nil || v != 42 {
+		t.Errorf("int = %v, %v", v, err)
+	}
+
+	if v, err := parseConfigValue[bool]("k", []byte("true")); err != nil || !v {
+		t.Errorf("bool = %v, %v", v, err)
+	}
+
+	if v, err := parseConfigValue[string]("k", []byte("plain text")); err != nil || v != "plain text" {
+		t.Errorf("string = %q, %v", v, err)
+	}
+
+	if v, err := parseConfigValue[time.Duration]("k", []byte("1m30s")); err != nil || v != 90*time.Second {
+		t.Errorf("duration = %v, %v", v, err)
+	}
+
+	if v, err := parseConfigValue[time.Duration]("k", []byte("1000")); err != nil || v != time.Microsecond {
+		t.Errorf("numeric duration = %v, %v", v, err)
+	}
+
+	v, err := parseConfigValue[limits]("k", []byte(`{"max":10,"soft":true}`))
+	if err != nil || !reflect.DeepEqual(v, limits{Max: 10, Soft: true}) {
+		t.Errorf("struct = %+v, %v", v, err)
+	}
+
+	_, err = parseConfigValue[int]("k", []byte("ten"))
+	var ce *ConfigError
+	if !errors.As(err, &ce) || ce.Key != "k" || ce.Op != "parse" {
+		t.Errorf("invalid int error = %v, want parse ConfigError", err)
+	}
+}
+
+func TestWatchConfigValue(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("api"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	type change struct {
+		value string
+		err   error
+	}
+
+	changes := make(chan change, 10)
+	WatchConfigValue(ctx, svc, ConfigurationTypeService, "level", func(v string, err error) { changes <- change{v, err} })
+
+	next := func() change {
+		t.Helper()
+		select {
+		case ch := <-changes:
+			return ch
+		case <-ctx.Done():
+			t.Fatal("no change reported")
+			return change{}
+		}
+	}
+
+	if ch := next(); !errors.Is(ch.err, ErrConfigKeyNotFound) {
+		t.Errorf("missing key = %+v, want %v", ch, ErrConfigKeyNotFound)
+	}
+
+	key := configKey(svc.configPath(ConfigurationTypeService), "level")
+	if _, err := svc.etcd.Put(ctx, key, "debug"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if ch := next(); ch.err != nil || ch.value != "debug" {
+		t.Errorf("changed key = %+v, want debug", ch)
+	}
+
+	// a change of the referenced key changes the value
+	if _, err := svc.etcd.Put(ctx, "/shared/level", "info"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if _, err := svc.etcd.Put(ctx, key, "@ref:/shared/level"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if ch := next(); ch.err != nil || ch.value != "info" {
+		t.Errorf("referencing key = %+v, want info", ch)
+	}
+
+	if _, err := svc.etcd.Put(ctx, "/shared/level", "warn"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if ch := next(); ch.err != nil || ch.value != "warn" {
+		t.Errorf("changed referenced key = %+v, want warn", ch)
+	}
+
+	if _, err := svc.etcd.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if ch := next(); !errors.Is(ch.err, ErrConfigKeyNotFound) {
+		t.Errorf("deleted key = %+v, want %v", ch, ErrConfigKeyNotFound)
+	}
+}
@@ -0,0 +1,310 @@
+package svcutil
+
+import (
+	"io"
+	"reflect"
+	"sync"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+// connSwitch routes requests of a facade etcd client to the current connection, so the
+// connection can be rebuilt (e.g. with rotated credentials) while sessions, mutexes and
+// leases keep using the same client. Watches and lease keep-alives running on a replaced
+// connection are resumed on the new one.
+type connSwitch struct {
+	endpoints []string
+
+	mu      sync.RWMutex
+	conn    *clientv3.Client
+	swapped chan struct{}
+	closed  bool
+}
+
+// newSwitchedClient wraps the connection into a facade client whose requests go through a connSwitch
+func newSwitchedClient(conn *clientv3.Client, endpoints []string) (*clientv3.Client, *connSwitch) {
+	s := &connSwitch{
+		endpoints: endpoints,
+		conn:      conn,
+		swapped:   make(chan struct{}),
+	}
+
+	facade := clientv3.NewCtxClient(context.Background(), clientv3.WithZapLogger(zap.NewNop()))
+	facade.KV = switchKV{s}
+	facade.Lease = switchLease{s}
+	facade.Watcher = switchWatcher{s}
+	facade.Maintenance = switchMaintenance{s}
+
+	return facade, s
+}
+
+// current returns the connection and a channel closed once it is replaced
+func (s *connSwitch) current() (*clientv3.Client, <-chan struct{}) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.conn, s.swapped
+}
+
+// swap installs a new connection and returns the replaced one, nil if the switch is closed
+func (s *connSwitch) swap(conn *clientv3.Client) *clientv3.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	old := s.conn
+	s.conn = conn
+	close(s.swapped)
+	s.swapped = make(chan struct{})
+
+	return old
+}
+
+func (s *connSwitch) close() error {
+	s.mu.Lock()
+	s.closed = true
+	conn := s.conn
+	s.mu.Unlock()
+
+	return conn.Close()
+}
+
+// replaced reports whether the connection was replaced after the given swap channel was obtained
+func replaced(swapped <-chan struct{}) bool {
+	select {
+	case <-swapped:
+		return true
+	default:
+		return false
+	}
+}
+
+type switchKV struct {
+	s *connSwitch
+}
+
+func (k switchKV) kv() clientv3.KV {
+	conn, _ := k.s.current()
+	return conn.KV
+}
+
+func (k switchKV) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	return k.kv().Put(ctx, key, val, opts...)
+}
+
+func (k switchKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	return k.kv().Get(ctx, key, opts...)
+}
+
+func (k switchKV) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	return k.kv().Delete(ctx, key, opts...)
+}
+
+func (k switchKV) Compact(ctx context.Context, rev int64, opts ...clientv3.CompactOption) (*clientv3.CompactResponse, error) {
+	return k.kv().Compact(ctx, rev, opts...)
+}
+
+func (k switchKV) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+	return k.kv().Do(ctx, op)
+}
+
+func (k switchKV) Txn(ctx context.Context) clientv3.Txn {
+	return k.kv().Txn(ctx)
+}
+
+type switchLease struct {
+	s *connSwitch
+}
+
+func (l switchLease) lease() clientv3.Lease {
+	conn, _ := l.s.current()
+	return conn.Lease
+}
+
+func (l switchLease) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	return l.lease().Grant(ctx, ttl)
+}
+
+func (l switchLease) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	return l.lease().Revoke(ctx, id)
+}
+
+func (l switchLease) TimeToLive(ctx context.Context, id clientv3.LeaseID, opts ...clientv3.LeaseOption) (*clientv3.LeaseTimeToLiveResponse, error) {
+	return l.lease().TimeToLive(ctx, id, opts...)
+}
+
+func (l switchLease) Leases(ctx context.Context) (*clientv3.LeaseLeasesResponse, error) {
+	return l.lease().Leases(ctx)
+}
+
+func (l switchLease) KeepAliveOnce(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseKeepAliveResponse, error) {
+	return l.lease().KeepAliveOnce(ctx, id)
+}
+
+// KeepAlive keeps the lease alive on the current connection and moves the keep-alive
+// to the new connection when the current one is replaced
+func (l switchLease) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	conn, swapped := l.s.current()
+	in, err := conn.KeepAlive(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *clientv3.LeaseKeepAliveResponse)
+	go func() {
+		defer close(out)
+
+		for {
+			for resp := range in {
+				select {
+				case out <- resp:
+				case <-ctx.Done():
+				}
+			}
+
+			if ctx.Err() != nil || !replaced(swapped) {
+				return
+			}
+
+			conn, swapped = l.s.current()
+			if in, err = conn.KeepAlive(ctx, id); err != nil {
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// Close closes the current connection, it is called by Close of the facade client
+func (l switchLease) Close() error {
+	return l.s.close()
+}
+
+type switchWatcher struct {
+	s *connSwitch
+}
+
+// Watch watches on the current connection and resumes the watch after the last delivered
+// revision on the new connection when the current one is replaced. A watch without a start
+// revision is pinned to the revision in the header of its created response, so a
+// replacement before the first event doesn't lose events either. A watch replaced before
+// it was created can't be pinned, its channel is closed instead of resuming it with a gap.
+func (w switchWatcher) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	// rev is the last revision delivered to the caller, a watch with a start revision
+	// resumes from it until an event or progress moves rev past it
+	var rev int64
+	pinned := clientv3.OpGet(key, opts...).Rev() != 0
+	notify := watchCreatedNotify(opts)
+
+	wopts := opts
+	if !pinned && !notify {
+		wopts = append(opts[:len(opts):len(opts)], clientv3.WithCreatedNotify())
+	}
+
+	// the first watch is opened before returning, like Watch of the connection does, so
+	// requests sent after Watch returns are seen
+	conn, swapped := w.s.current()
+	in := conn.Watch(ctx, key, wopts...)
+
+	out := make(chan clientv3.WatchResponse)
+	go func() {
+		defer close(out)
+
+		for {
+			for resp := range in {
+				if resp.Created && !pinned {
+					pinned = true
+					rev = max(rev, resp.Header.Revision)
+					if !notify {
+						continue
+					}
+				}
+				if len(resp.Events) > 0 {
+					rev = max(rev, resp.Events[len(resp.Events)-1].Kv.ModRevision)
+				}
+				if resp.Err() == nil && !resp.Canceled {
+					// the header revision covers progress notifications as well
+					rev = max(rev, resp.Header.Revision)
+				}
+
+				select {
+				case out <- resp:
+				case <-ctx.Done():
+				}
+			}
+
+			if ctx.Err() != nil || !replaced(swapped) || !pinned {
+				return
+			}
+
+			wopts = opts
+			if rev > 0 {
+				wopts = append(opts[:len(opts):len(opts)], clientv3.WithRev(rev+1))
+			}
+
+			conn, swapped = w.s.current()
+			in = conn.Watch(ctx, key, wopts...)
+		}
+	}()
+
+	return out
+}
+
+// watchCreatedNotify reports whether the options ask for the created response of a watch,
+// the Op doesn't export it
+func watchCreatedNotify(opts []clientv3.OpOption) bool {
+	return reflect.ValueOf(clientv3.OpGet("", opts...)).FieldByName("createdNotify").Bool()
+}
+
+func (w switchWatcher) RequestProgress(ctx context.Context) error {
+	conn, _ := w.s.current()
+	return conn.RequestProgress(ctx)
+}
+
+// Close is a no-op, the connection is closed together with its leases by switchLease.Close
+func (w switchWatcher) Close() error {
+	return nil
+}
+
+type switchMaintenance struct {
+	s *connSwitch
+}
+
+func (m switchMaintenance) maintenance() clientv3.Maintenance {
+	conn, _ := m.s.current()
+	return conn.Maintenance
+}
+
+func (m switchMaintenance) AlarmList(ctx context.Context) (*clientv3.AlarmResponse, error) {
+	return m.maintenance().AlarmList(ctx)
+}
+
+func (m switchMaintenance) AlarmDisarm(ctx context.Context, am *clientv3.AlarmMember) (*clientv3.AlarmResponse, error) {
+	return m.maintenance().AlarmDisarm(ctx, am)
+}
+
+func (m switchMaintenance) Defragment(ctx context.Context, endpoint string) (*clientv3.DefragmentResponse, error) {
+	return m.maintenance().Defragment(ctx, endpoint)
+}
+
+func (m switchMaintenance) Status(ctx context.Context, endpoint string) (*clientv3.StatusResponse, error) {
+	return m.maintenance().Status(ctx, endpoint)
+}
+
+func (m switchMaintenance) HashKV(ctx context.Context, endpoint string, rev int64) (*clientv3.HashKVResponse, error) {
+	return m.maintenance().HashKV(ctx, endpoint, rev)
+}
+
+func (m switchMaintenance) Snapshot(ctx context.Context) (io.ReadCloser, error) {
+	return m.maintenance().Snapshot(ctx)
+}
+
+func (m switchMaintenance) MoveLeader(ctx context.Context, transfereeID uint64) (*clientv3.MoveLeaderResponse, error) {
+	return m.maintenance().MoveLeader(ctx, transfereeID)
+}
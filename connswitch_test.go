@@ -0,0 +1,151 @@
+package svcutil
+
+import (
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// chanWatcher serves a watch from a channel controlled by the test and records its options,
+// started receives a value once the watch is opened
+type chanWatcher struct {
+	clientv3.Watcher
+	ch      chan clientv3.WatchResponse
+	started chan struct{}
+	opts    []clientv3.OpOption
+}
+
+func newChanWatcher() *chanWatcher {
+	return &chanWatcher{ch: make(chan clientv3.WatchResponse), started: make(chan struct{}, 1)}
+}
+
+func (w *chanWatcher) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	w.opts = opts
+	w.started <- struct{}{}
+	return w.ch
+}
+
+func newWatchConn(w *chanWatcher) *clientv3.Client {
+	conn := clientv3.NewCtxClient(context.Background())
+	conn.Watcher = w
+	return conn
+}
+
+// createdResponse is the created response of a watch at the store revision
+func createdResponse(rev int64) clientv3.WatchResponse {
+	return clientv3.WatchResponse{Header: etcdserverpb.ResponseHeader{Revision: rev}, Created: true}
+}
+
+func TestConnSwitchWatchResume(t *testing.T) {
+	first, second := newChanWatcher(), newChanWatcher()
+
+	facade, sw := newSwitchedClient(newWatchConn(first), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := facade.Watch(ctx, "key")
+
+	// the created response pins the watch and is not passed to the caller
+	first.ch <- createdResponse(9)
+	if !watchCreatedNotify(first.opts) {
+		t.Error("watch without a start revision doesn't ask for its created response")
+	}
+	first.ch <- putResponse(10)
+	if resp := <-out; resp.Created || resp.Events[0].Kv.ModRevision != 10 {
+		t.Fatalf("first response = %+v, want the event at revision 10", resp)
+	}
+
+	if old := sw.swap(newWatchConn(second)); old == nil {
+		t.Fatal("swap() returned nil for an open switch")
+	}
+	close(first.ch)
+
+	second.ch <- clientv3.WatchResponse{Events: []*clientv3.Event{{Type: clientv3.EventTypePut, Kv: &mvccpb.KeyValue{ModRevision: 11}}}}
+	if resp := <-out; resp.Events[0].Kv.ModRevision != 11 {
+		t.Fatalf("resumed response revision = %d, want 11", resp.Events[0].Kv.ModRevision)
+	}
+
+	if rev := clientv3.OpGet("key", second.opts...).Rev(); rev != 11 {
+		t.Errorf("resumed watch starts at revision %d, want 11", rev)
+	}
+
+	// a watch closed without a swap is closed for the caller as well
+	close(second.ch)
+	if _, ok := <-out; ok {
+		t.Error("watch channel still open after the connection closed the watch")
+	}
+}
+
+func TestConnSwitchWatchResumeBeforeEvent(t *testing.T) {
+	first, second := newChanWatcher(), newChanWatcher()
+
+	facade, sw := newSwitchedClient(newWatchConn(first), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := facade.Watch(ctx, "key", clientv3.WithCreatedNotify())
+
+	// the caller asked for the created response, so it is passed on
+	first.ch <- createdResponse(9)
+	if resp := <-out; !resp.Created {
+		t.Fatalf("first response = %+v, want the created response", resp)
+	}
+
+	// the connection is replaced before the watch delivered any event
+	sw.swap(newWatchConn(second))
+	close(first.ch)
+
+	second.ch <- putResponse(10)
+	<-out
+
+	if rev := clientv3.OpGet("key", second.opts...).Rev(); rev != 10 {
+		t.Errorf("resumed watch starts at revision %d, want 10", rev)
+	}
+}
+
+func TestConnSwitchWatchNotPinned(t *testing.T) {
+	first, second := newChanWatcher(), newChanWatcher()
+
+	facade, sw := newSwitchedClient(newWatchConn(first), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := facade.Watch(ctx, "key")
+
+	// the connection is replaced before the watch was created, resuming it would lose
+	// the events in between
+	<-first.started
+	sw.swap(newWatchConn(second))
+	close(first.ch)
+
+	if _, ok := <-out; ok {
+		t.Error("watch channel still open after a swap before the watch was created")
+	}
+	select {
+	case <-second.started:
+		t.Error("watch resumed on the new connection without a start revision")
+	default:
+	}
+}
+
+func TestConnSwitchClosed(t *testing.T) {
+	_, sw := newSwitchedClient(clientv3.NewCtxClient(context.Background()), nil)
+
+	_, swapped := sw.current()
+	if replaced(swapped) {
+		t.Error("replaced() = true before any swap")
+	}
+
+	sw.swap(clientv3.NewCtxClient(context.Background()))
+	if !replaced(swapped) {
+		t.Error("replaced() = false after a swap")
+	}
+
+	sw.close()
+	if old := sw.swap(clientv3.NewCtxClient(context.Background())); old != nil {
+		t.Error("swap() of a closed switch returned the old connection")
+	}
+}
@@ -4,24 +4,43 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"sort"
 	"sync"
 	"syscall"
+	"time"
 )
 
+// DefaultShutdownHookTimeout is how long a shutdown hook may run unless
+// SetShutdownHookTimeout is called
+const DefaultShutdownHookTimeout = 10 * time.Second
+
 type ProcessContextScope string
 
 type ProcessContext struct {
 	wg       *sync.WaitGroup
 	ctx      context.Context
 	shutdown context.CancelFunc
+
+	hooksMu     sync.Mutex
+	hooks       []shutdownHook
+	hookTimeout time.Duration
+	hooksOnce   sync.Once
+	hooksDone   chan struct{}
+}
+
+type shutdownHook struct {
+	priority int
+	fn       func(ctx context.Context)
 }
 
 func NewProcessContext() *ProcessContext {
 	ctx, shutdown := context.WithCancel(context.Background())
 	return &ProcessContext{
-		ctx:      ctx,
-		shutdown: shutdown,
-		wg:       &sync.WaitGroup{},
+		ctx:         ctx,
+		shutdown:    shutdown,
+		wg:          &sync.WaitGroup{},
+		hookTimeout: DefaultShutdownHookTimeout,
+		hooksDone:   make(chan struct{}),
 	}
 }
 
@@ -37,8 +56,74 @@ func (b *ProcessContext) ComponentFinished() {
 	b.wg.Done()
 }
 
+// Shutdown cancels the process context. Once all components finished the shutdown hooks
+// run, see OnShutdown.
 func (b *ProcessContext) Shutdown() {
 	b.shutdown()
+	b.hooksOnce.Do(func() {
+		go b.runShutdownHooks()
+	})
+}
+
+// OnShutdown registers fn to run during the shutdown once all components finished, e.g.
+// closing the Service or flushing logs. Hooks run one by one in ascending priority order,
+// hooks of the same priority in the order of registration, so OnShutdown(10, closeService)
+// releases etcd resources before OnShutdown(100, flushLogs). The context of a hook expires
+// after the hook timeout, see SetShutdownHookTimeout, and the next hook runs then even if
+// the previous one didn't return. Hooks registered after the hooks started are not run.
+func (b *ProcessContext) OnShutdown(priority int, fn func(ctx context.Context)) {
+	b.hooksMu.Lock()
+	defer b.hooksMu.Unlock()
+
+	b.hooks = append(b.hooks, shutdownHook{priority: priority, fn: fn})
+}
+
+// SetShutdownHookTimeout sets how long each shutdown hook may run,
+// DefaultShutdownHookTimeout by default. A non-positive timeout would skip the hooks
+// and is ignored.
+func (b *ProcessContext) SetShutdownHookTimeout(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	b.hooksMu.Lock()
+	defer b.hooksMu.Unlock()
+
+	b.hookTimeout = d
+}
+
+// WaitForShutdownHooks waits until the shutdown hooks ran, it returns after Shutdown only
+func (b *ProcessContext) WaitForShutdownHooks() {
+	<-b.hooksDone
+}
+
+func (b *ProcessContext) runShutdownHooks() {
+	defer close(b.hooksDone)
+
+	b.wg.Wait()
+
+	b.hooksMu.Lock()
+	hooks := b.hooks
+	b.hooks = nil
+	timeout := b.hookTimeout
+	b.hooksMu.Unlock()
+
+	sort.SliceStable(hooks, func(i, j int) bool { return hooks[i].priority < hooks[j].priority })
+
+	for _, hook := range hooks {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		done := make(chan struct{})
+		go func(fn func(ctx context.Context)) {
+			defer close(done)
+			fn(ctx)
+		}(hook.fn)
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+		cancel()
+	}
 }
 
 func (b *ProcessContext) Done() <-chan struct{} {
@@ -62,4 +147,20 @@ func WaitForShutdown(processCtx *ProcessContext) {
 
 	processCtx.Shutdown()
 	processCtx.WaitForComponentsToFinish()
+	processCtx.WaitForShutdownHooks()
+}
+
+type serviceKey struct{}
+
+// WithService returns a copy of the context carrying the service, so code deep in the call
+// stack can reach its locks and config with FromContext
+func WithService(ctx context.Context, svc *Service) context.Context {
+	return context.WithValue(ctx, serviceKey{}, svc)
+}
+
+// FromContext returns the service bound to the context with WithService, ok is false if
+// there is none
+func FromContext(ctx context.Context) (svc *Service, ok bool) {
+	svc, ok = ctx.Value(serviceKey{}).(*Service)
+	return svc, ok && svc != nil
 }
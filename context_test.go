@@ -0,0 +1,91 @@
+package svcutil
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServiceContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Errorf("FromContext() of a context without a service ok = true")
+	}
+
+	if _, ok := FromContext(WithService(context.Background(), nil)); ok {
+		t.Errorf("FromContext() of a nil service ok = true")
+	}
+
+	svc := &Service{options: Name("api")(NewOptions())}
+	ctx := WithLockOwner(WithService(context.Background(), svc), "job")
+
+	got, ok := FromContext(ctx)
+	if !ok || got != svc {
+		t.Errorf("FromContext() = %p, %v, want %p", got, ok, svc)
+	}
+}
+
+func TestShutdownHooks(t *testing.T) {
+	pc := NewProcessContext()
+	pc.SetShutdownHookTimeout(50 * time.Millisecond)
+
+	var order []string
+	var mu sync.Mutex
+	record := func(name string) func(ctx context.Context) {
+		return func(ctx context.Context) {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+		}
+	}
+
+	pc.OnShutdown(100, record("flush logs"))
+	pc.OnShutdown(10, record("close service"))
+	pc.OnShutdown(10, record("release lease"))
+	pc.OnShutdown(50, func(ctx context.Context) {
+		// a stuck hook doesn't hold the following ones up
+		record("stuck")(ctx)
+		select {}
+	})
+
+	finished := make(chan struct{})
+	pc.ComponentStarted()
+	go func() {
+		defer pc.ComponentFinished()
+		<-pc.Done()
+		record("component")(context.Background())
+		close(finished)
+	}()
+
+	pc.Shutdown()
+	pc.Shutdown()
+	pc.WaitForShutdownHooks()
+	<-finished
+
+	want := []string{"component", "close service", "release lease", "stuck", "flush logs"}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("shutdown order = %v, want %v", order, want)
+	}
+}
+
+func TestShutdownHookTimeoutIgnoresNonPositive(t *testing.T) {
+	pc := NewProcessContext()
+	pc.SetShutdownHookTimeout(0)
+	pc.SetShutdownHookTimeout(-time.Second)
+
+	ran := false
+	pc.OnShutdown(0, func(ctx context.Context) {
+		// the default timeout still applies, the hook isn't skipped
+		ran = ctx.Err() == nil
+	})
+
+	pc.Shutdown()
+	pc.WaitForShutdownHooks()
+
+	if !ran {
+		t.Error("a hook ran with an expired context after a non-positive timeout")
+	}
+}
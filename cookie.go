@@ -3,12 +3,18 @@ package svcutil
 import (
 	cryptorand "crypto/rand"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/rand"
+	"slices"
 	"sync"
 	"time"
 )
 
+// ErrCookieSourceNeedsGenerator is returned for sources which cannot be created from a
+// CookieSource alone, use NewSeededCookieGen or WithGenerator for them
+var ErrCookieSourceNeedsGenerator = errors.New("cookie source needs a seed or a generator")
+
 const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
 const (
@@ -36,6 +42,8 @@ const (
 	CookieSourceCryptoRand
 	CookieSourceCustomSnowflake
 	CookieSourceIncremented
+	CookieSourceSeeded
+	CookieSourceCustom
 )
 
 func (cs CookieSource) String() string {
@@ -48,6 +56,10 @@ func (cs CookieSource) String() string {
 		return "CookieSourceCustomSnowflake"
 	case CookieSourceIncremented:
 		return "CookieSourceIncremented"
+	case CookieSourceSeeded:
+		return "CookieSourceSeeded"
+	case CookieSourceCustom:
+		return "CookieSourceCustom"
 	default:
 		return fmt.Sprintf("unknown CookieSource: %d", cs)
 	}
@@ -57,13 +69,22 @@ type generator interface {
 	getNext() int64
 }
 
+// Generator is a custom entropy source for CookieGen, e.g. backed by an HSM.
+// Int63 must return non-negative values, any rand.Source satisfies it.
+type Generator interface {
+	Int63() int64
+}
+
 type CookieGen struct {
 	m   sync.Mutex
 	gen generator
 	src CookieSource
+	// concurrent generators rely on sources safe for concurrent use instead of m
+	concurrent bool
 }
 
-// NewCookieGen creates new generator
+// NewCookieGen creates new generator, sources it cannot create (see NewCookieGenChecked)
+// default to cryptorand
 func NewCookieGen(src CookieSource, nodeID int64) *CookieGen {
 	switch src {
 	case CookieSourceIncremented:
@@ -78,8 +99,59 @@ func NewCookieGen(src CookieSource, nodeID int64) *CookieGen {
 	}
 }
 
+// NewCookieGenChecked creates new generator like NewCookieGen but returns
+// ErrCookieSourceNeedsGenerator for CookieSourceSeeded and CookieSourceCustom
+// instead of silently falling back to cryptorand
+func NewCookieGenChecked(src CookieSource, nodeID int64) (*CookieGen, error) {
+	if err := checkCookieSource(src); err != nil {
+		return nil, err
+	}
+
+	return NewCookieGen(src, nodeID), nil
+}
+
+// checkCookieSource rejects sources which need a seed or a generator
+func checkCookieSource(src CookieSource) error {
+	switch src {
+	case CookieSourceSeeded, CookieSourceCustom:
+		return ErrCookieSourceNeedsGenerator
+	default:
+		return nil
+	}
+}
+
 func NewSnowflakeCookieGen(epoch int64, nodeID int64) *CookieGen {
-	return newCookieSourceSnowflake(epoch, nodeID)
+	return newCookieSourceSnowflake(epoch, nodeID, NodeBits, StepBits)
+}
+
+// NewSnowflakeCookieGenWithBits creates snowflake generator with a custom Node/Step bit layout
+func NewSnowflakeCookieGenWithBits(epoch int64, nodeID int64, nodeBits uint8, stepBits uint8) *CookieGen {
+	return newCookieSourceSnowflake(epoch, nodeID, nodeBits, stepBits)
+}
+
+// NewSeededCookieGen creates pseudo random generator producing the same cookies
+// for the same seed, it is meant for reproducible tests
+func NewSeededCookieGen(seed int64) *CookieGen {
+	cookieGen := &CookieGen{}
+	gen := &pseudoRand{}
+	gen.pseudoRand = rand.NewSource(seed)
+	cookieGen.gen = gen
+	cookieGen.src = CookieSourceSeeded
+	return cookieGen
+}
+
+// WithGenerator creates generator drawing its values from the custom source,
+// calls to the source are serialized by the generator. A nil source returns
+// ErrCookieSourceNeedsGenerator.
+func WithGenerator(g Generator) (*CookieGen, error) {
+	if g == nil {
+		return nil, ErrCookieSourceNeedsGenerator
+	}
+
+	cookieGen := &CookieGen{}
+	cookieGen.gen = &customGen{g: g}
+	cookieGen.src = CookieSourceCustom
+	return cookieGen, nil
 }
 
 func (cg *CookieGen) String() string {
@@ -107,6 +179,14 @@ func newIncrementedSource(nodeID int64) *CookieGen {
 	return cookieGen
 }
 
+type customGen struct {
+	g Generator
+}
+
+func (cg *customGen) getNext() int64 {
+	return cg.g.Int63()
+}
+
 type snowGen struct {
 	snowGenerator *SnowflakeNode
 }
@@ -115,14 +195,11 @@ func (cg *snowGen) getNext() int64 {
 	return cg.snowGenerator.Generate().Int64()
 }
 
-func newCookieSourceSnowflake(epoch int64, nodeID int64) *CookieGen {
+func newCookieSourceSnowflake(epoch int64, nodeID int64, nodeBits uint8, stepBits uint8) *CookieGen {
 	cookieGen := &CookieGen{}
-	snowGenerator, err := NewSnowflakeNode(epoch, nodeID)
+	snowGenerator, err := NewSnowflakeNodeWithBits(epoch, nodeID, nodeBits, stepBits)
 	if err != nil {
-		gen := &pseudoRand{}
-		cookieGen.gen = gen
-		cookieGen.src = CookieSourcePseudoRand
-		return cookieGen
+		return newCookieSourcePseudoRand()
 	}
 
 	gen := &snowGen{}
@@ -174,6 +251,10 @@ func newCookieSourceCryptoRand() *CookieGen {
 }
 
 func (cg *CookieGen) getNext() int64 {
+	if cg.concurrent {
+		return cg.gen.getNext()
+	}
+
 	cg.m.Lock()
 	defer cg.m.Unlock()
 	return cg.gen.getNext()
@@ -181,11 +262,50 @@ func (cg *CookieGen) getNext() int64 {
 
 // Cookie produces new string cookie
 func (cg *CookieGen) Cookie() string {
-	b := make([]byte, defaultCookieLenK)
+	// fixed size buffer stays on the stack, the only allocation is the resulting string
+	var b [defaultCookieLenK]byte
+	cg.fillCookie(b[:])
+	return string(b[:])
+}
+
+// AppendCookie appends new string cookie to dst and returns the extended buffer
+func (cg *CookieGen) AppendCookie(dst []byte) []byte {
+	n := len(dst)
+	dst = slices.Grow(dst, defaultCookieLenK)[:n+defaultCookieLenK]
+	cg.fillCookie(dst[n:])
+	return dst
+}
 
-	for i, cache, remain := defaultCookieLenK-1, cg.getNext(), letterIdxMax; i >= 0; {
+// withGenerator runs f holding the generator, taking the lock or a sharded source once
+func (cg *CookieGen) withGenerator(f func(gen generator)) {
+	if cg.concurrent {
+		if s, ok := cg.gen.(*shardedRand); ok {
+			p := s.get()
+			defer s.put(p)
+			f(p)
+			return
+		}
+
+		f(cg.gen)
+		return
+	}
+
+	cg.m.Lock()
+	defer cg.m.Unlock()
+	f(cg.gen)
+}
+
+func (cg *CookieGen) fillCookie(b []byte) {
+	// the generator is taken once per cookie instead of once per random value
+	cg.withGenerator(func(gen generator) {
+		fillLetters(b, gen)
+	})
+}
+
+func fillLetters(b []byte, gen generator) {
+	for i, cache, remain := len(b)-1, gen.getNext(), letterIdxMax; i >= 0; {
 		if remain == 0 {
-			cache, remain = cg.getNext(), letterIdxMax
+			cache, remain = gen.getNext(), letterIdxMax
 		}
 		if idx := int(cache & letterIdxMask); idx < len(letterBytes) {
 			b[i] = letterBytes[idx]
@@ -194,8 +314,6 @@ func (cg *CookieGen) Cookie() string {
 		cache >>= letterIdxBits
 		remain--
 	}
-
-	return string(b)
 }
 
 // Int63 produces new int63 cookie packed in uint64
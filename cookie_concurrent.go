@@ -0,0 +1,100 @@
+package svcutil
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NewConcurrentCookieGen creates generator which does not serialize callers on a single
+// mutex. Pseudo random values come from per-P sharded sources, incremented values from
+// an atomic counter, crypto and snowflake sources are safe for concurrent use already.
+// Values of the pseudo random source are not reproducible across goroutines.
+// CookieSourceSeeded and CookieSourceCustom return ErrCookieSourceNeedsGenerator.
+func NewConcurrentCookieGen(src CookieSource, nodeID int64) (*CookieGen, error) {
+	if err := checkCookieSource(src); err != nil {
+		return nil, err
+	}
+
+	var cookieGen *CookieGen
+
+	switch src {
+	case CookieSourceIncremented:
+		cookieGen = &CookieGen{src: CookieSourceIncremented}
+		gen := &atomicIncrementedSource{}
+		gen.id.Store(uint64(incrementedSourceOffset * nodeID))
+		cookieGen.gen = gen
+	case CookieSourcePseudoRand:
+		cookieGen = &CookieGen{src: CookieSourcePseudoRand}
+		cookieGen.gen = newShardedRand()
+	default:
+		cookieGen = newCookieSourceCryptoRand()
+		// the fallback source is not safe for concurrent use
+		cookieGen.gen.(*cryptoRand).fallbackRand = newShardedRand()
+	}
+
+	cookieGen.concurrent = true
+	return cookieGen, nil
+}
+
+// NewConcurrentSnowflakeCookieGen creates snowflake generator without the CookieGen mutex,
+// the snowflake node serializes generation on its own
+func NewConcurrentSnowflakeCookieGen(epoch int64, nodeID int64) *CookieGen {
+	cookieGen := newCookieSourceSnowflake(epoch, nodeID, NodeBits, StepBits)
+	if cookieGen.src == CookieSourcePseudoRand {
+		cookieGen.gen = newShardedRand()
+	}
+
+	cookieGen.concurrent = true
+	return cookieGen
+}
+
+type atomicIncrementedSource struct {
+	id atomic.Uint64
+}
+
+func (cg *atomicIncrementedSource) getNext() int64 {
+	return int64(cg.id.Add(1))
+}
+
+// shardedRand keeps pseudo random sources in a sync.Pool, which caches them per P
+type shardedRand struct {
+	pool sync.Pool
+}
+
+func newShardedRand() *shardedRand {
+	s := &shardedRand{}
+	s.pool.New = func() any {
+		seed := time.Now().UnixNano()
+		if b, err := CryptoRand(8); err == nil {
+			seed = int64(binary.BigEndian.Uint64(b))
+		}
+
+		return &pseudoRand{pseudoRand: rand.NewSource(seed)}
+	}
+
+	return s
+}
+
+func (s *shardedRand) get() *pseudoRand {
+	return s.pool.Get().(*pseudoRand)
+}
+
+func (s *shardedRand) put(p *pseudoRand) {
+	s.pool.Put(p)
+}
+
+func (s *shardedRand) getNext() int64 {
+	p := s.get()
+	defer s.put(p)
+	return p.getNext()
+}
+
+// Int63 and Seed let the sharded source stand in for a rand.Source
+func (s *shardedRand) Int63() int64 {
+	return s.getNext()
+}
+
+func (s *shardedRand) Seed(int64) {}
@@ -0,0 +1,321 @@
+package svcutil
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// cookieLegacy is the original Cookie() implementation kept as a benchmark baseline
+func cookieLegacy(cg *CookieGen) string {
+	b := make([]byte, defaultCookieLenK)
+
+	for i, cache, remain := defaultCookieLenK-1, cg.getNext(), letterIdxMax; i >= 0; {
+		if remain == 0 {
+			cache, remain = cg.getNext(), letterIdxMax
+		}
+		if idx := int(cache & letterIdxMask); idx < len(letterBytes) {
+			b[i] = letterBytes[idx]
+			i--
+		}
+		cache >>= letterIdxBits
+		remain--
+	}
+
+	return string(b)
+}
+
+func isValidCookie(cookie string) bool {
+	if len(cookie) != defaultCookieLenK {
+		return false
+	}
+
+	for i := 0; i < len(cookie); i++ {
+		if !strings.ContainsRune(letterBytes, rune(cookie[i])) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestCookie(t *testing.T) {
+	sources := []CookieSource{
+		CookieSourcePseudoRand,
+		CookieSourceCryptoRand,
+		CookieSourceIncremented,
+	}
+
+	for _, src := range sources {
+		t.Run(src.String(), func(t *testing.T) {
+			cg := NewCookieGen(src, 1)
+			seen := make(map[string]struct{})
+			for i := 0; i < 1000; i++ {
+				cookie := cg.Cookie()
+				if !isValidCookie(cookie) {
+					t.Fatalf("Cookie() = %q is not a valid cookie", cookie)
+				}
+				seen[cookie] = struct{}{}
+			}
+			if src != CookieSourceIncremented && len(seen) != 1000 {
+				t.Errorf("Cookie() produced %d unique values out of 1000", len(seen))
+			}
+		})
+	}
+}
+
+func TestCookieMatchesLegacy(t *testing.T) {
+	current := NewCookieGen(CookieSourceIncremented, 1)
+	legacy := NewCookieGen(CookieSourceIncremented, 1)
+
+	for i := 0; i < 100; i++ {
+		if got, want := current.Cookie(), cookieLegacy(legacy); got != want {
+			t.Fatalf("Cookie() = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestAppendCookie(t *testing.T) {
+	cg := NewCookieGen(CookieSourceCryptoRand, 0)
+
+	dst := []byte("prefix:")
+	dst = cg.AppendCookie(dst)
+	if !strings.HasPrefix(string(dst), "prefix:") {
+		t.Fatalf("AppendCookie() dropped existing content: %q", dst)
+	}
+	if cookie := string(dst[len("prefix:"):]); !isValidCookie(cookie) {
+		t.Errorf("AppendCookie() appended invalid cookie %q", cookie)
+	}
+}
+
+func TestSeededCookieGen(t *testing.T) {
+	a := NewSeededCookieGen(42)
+	b := NewSeededCookieGen(42)
+	other := NewSeededCookieGen(43)
+
+	for i := 0; i < 100; i++ {
+		cookie := a.Cookie()
+		if !isValidCookie(cookie) {
+			t.Fatalf("Cookie() = %q is not a valid cookie", cookie)
+		}
+		if got := b.Cookie(); got != cookie {
+			t.Fatalf("same seed produced %q and %q", cookie, got)
+		}
+		if a.Int63() != b.Int63() {
+			t.Fatalf("same seed produced different Int63 values")
+		}
+		if other.Cookie() == cookie {
+			t.Fatalf("different seeds produced the same cookie %q", cookie)
+		}
+	}
+
+	if a.CookieSource() != CookieSourceSeeded {
+		t.Errorf("CookieSource() = %v, want %v", a.CookieSource(), CookieSourceSeeded)
+	}
+}
+
+type countingGenerator struct {
+	n int64
+}
+
+func (g *countingGenerator) Int63() int64 {
+	g.n++
+	return g.n
+}
+
+func TestWithGenerator(t *testing.T) {
+	cg, err := WithGenerator(&countingGenerator{})
+	if err != nil {
+		t.Fatalf("WithGenerator() error = %v", err)
+	}
+	legacy := NewCookieGen(CookieSourceIncremented, 0)
+
+	for i := 0; i < 10; i++ {
+		if got, want := cg.Cookie(), legacy.Cookie(); got != want {
+			t.Fatalf("Cookie() = %q, want %q", got, want)
+		}
+	}
+
+	if cg.String() != "CookieSourceCustom" {
+		t.Errorf("String() = %q, want CookieSourceCustom", cg.String())
+	}
+
+	if _, err := WithGenerator(nil); err != ErrCookieSourceNeedsGenerator {
+		t.Errorf("WithGenerator(nil) error = %v, want %v", err, ErrCookieSourceNeedsGenerator)
+	}
+}
+
+func TestCookieSourceNeedsGenerator(t *testing.T) {
+	for _, src := range []CookieSource{CookieSourceSeeded, CookieSourceCustom} {
+		if _, err := NewCookieGenChecked(src, 0); err != ErrCookieSourceNeedsGenerator {
+			t.Errorf("NewCookieGenChecked(%v) error = %v, want %v", src, err, ErrCookieSourceNeedsGenerator)
+		}
+		if _, err := NewConcurrentCookieGen(src, 0); err != ErrCookieSourceNeedsGenerator {
+			t.Errorf("NewConcurrentCookieGen(%v) error = %v, want %v", src, err, ErrCookieSourceNeedsGenerator)
+		}
+	}
+
+	cg, err := NewCookieGenChecked(CookieSourceIncremented, 0)
+	if err != nil {
+		t.Fatalf("NewCookieGenChecked() error = %v", err)
+	}
+	if cg.String() != "CookieSourceIncremented" {
+		t.Errorf("String() = %q, want CookieSourceIncremented", cg.String())
+	}
+}
+
+func TestConcurrentCookieGen(t *testing.T) {
+	sources := []CookieSource{
+		CookieSourcePseudoRand,
+		CookieSourceCryptoRand,
+		CookieSourceIncremented,
+	}
+
+	for _, src := range sources {
+		t.Run(src.String(), func(t *testing.T) {
+			cg, err := NewConcurrentCookieGen(src, 1)
+			if err != nil {
+				t.Fatalf("NewConcurrentCookieGen() error = %v", err)
+			}
+
+			const workers, perWorker = 8, 200
+			results := make(chan string, workers*perWorker)
+
+			var wg sync.WaitGroup
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < perWorker; i++ {
+						results <- cg.Cookie()
+					}
+				}()
+			}
+			wg.Wait()
+			close(results)
+
+			seen := make(map[string]struct{})
+			for cookie := range results {
+				if !isValidCookie(cookie) {
+					t.Fatalf("Cookie() = %q is not a valid cookie", cookie)
+				}
+				seen[cookie] = struct{}{}
+			}
+			if src != CookieSourceIncremented && len(seen) != workers*perWorker {
+				t.Errorf("Cookie() produced %d unique values out of %d", len(seen), workers*perWorker)
+			}
+		})
+	}
+}
+
+func TestConcurrentIncrementedInt63(t *testing.T) {
+	cg, err := NewConcurrentCookieGen(CookieSourceIncremented, 2)
+	if err != nil {
+		t.Fatalf("NewConcurrentCookieGen() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 250; i++ {
+				cg.Int63()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, want := cg.Int63(), uint64(2*incrementedSourceOffset+1001); got != want {
+		t.Errorf("Int63() = %d, want %d", got, want)
+	}
+}
+
+var (
+	benchCookieSink string
+	benchBytesSink  []byte
+)
+
+func BenchmarkCookieLegacy(b *testing.B) {
+	cg := NewCookieGen(CookieSourcePseudoRand, 0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchCookieSink = cookieLegacy(cg)
+	}
+}
+
+func BenchmarkCookie(b *testing.B) {
+	cg := NewCookieGen(CookieSourcePseudoRand, 0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchCookieSink = cg.Cookie()
+	}
+}
+
+// cookiePooled builds the cookie in a buffer taken from a sync.Pool, kept as a baseline
+// showing pooling doesn't beat the stack buffer of Cookie()
+func cookiePooled(cg *CookieGen, pool *sync.Pool) string {
+	b := pool.Get().(*[]byte)
+	defer pool.Put(b)
+
+	cg.fillCookie(*b)
+	return string(*b)
+}
+
+func BenchmarkCookiePooled(b *testing.B) {
+	cg := NewCookieGen(CookieSourcePseudoRand, 0)
+	pool := &sync.Pool{New: func() any {
+		buf := make([]byte, defaultCookieLenK)
+		return &buf
+	}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchCookieSink = cookiePooled(cg, pool)
+	}
+}
+
+func BenchmarkAppendCookie(b *testing.B) {
+	cg := NewCookieGen(CookieSourcePseudoRand, 0)
+	buf := make([]byte, 0, defaultCookieLenK)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = cg.AppendCookie(buf[:0])
+	}
+	benchBytesSink = buf
+}
+
+func BenchmarkCookieParallel(b *testing.B) {
+	cg := NewCookieGen(CookieSourcePseudoRand, 0)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			benchCookieSink = cg.Cookie()
+		}
+	})
+}
+
+func BenchmarkConcurrentCookieParallel(b *testing.B) {
+	cg, err := NewConcurrentCookieGen(CookieSourcePseudoRand, 0)
+	if err != nil {
+		b.Fatalf("NewConcurrentCookieGen() error = %v", err)
+	}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			benchCookieSink = cg.Cookie()
+		}
+	})
+}
+
+func BenchmarkConcurrentIncrementedParallel(b *testing.B) {
+	cg, err := NewConcurrentCookieGen(CookieSourceIncremented, 0)
+	if err != nil {
+		b.Fatalf("NewConcurrentCookieGen() error = %v", err)
+	}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			benchCookieSink = cg.Cookie()
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package svcutil
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// UpdateCredentials reconnects all etcd clients of the service with the new credentials
+// without a restart. New connections are established and verified first, so invalid
+// credentials leave the service untouched. Requests issued afterwards use the new
+// connections, watches and lease keep-alives are moved to them, so the session and the
+// locks and leases held on it are preserved. Replaced connections are closed after the
+// dial timeout to let in-flight requests finish.
+func (c *Service) UpdateCredentials(username, password string) error {
+	c.credMu.Lock()
+	defer c.credMu.Unlock()
+
+	conns := make([]*clientv3.Client, 0, len(c.switches))
+	closeAll := func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+
+	for _, sw := range c.switches {
+		cfg := c.etcdConfig(sw.endpoints)
+		cfg.Username = username
+		cfg.Password = password
+
+		conn, err := clientv3.New(cfg)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		conns = append(conns, conn)
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.options.etcdDialTimeout)
+		_, err = conn.Get(ctx, c.options.locksPrefix, clientv3.WithCountOnly())
+		cancel()
+		if err != nil {
+			closeAll()
+			return etcdError(err)
+		}
+	}
+
+	c.options.username = username
+	c.options.password = password
+
+	for n, sw := range c.switches {
+		old := sw.swap(conns[n])
+		if old == nil {
+			// the service is closing
+			conns[n].Close()
+			continue
+		}
+
+		time.AfterFunc(c.options.etcdDialTimeout, func() { old.Close() })
+	}
+
+	return nil
+}
+
+// readPasswordFile returns the trimmed content of the password or token file
+func readPasswordFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// passwordFileWatcher re-reads the password file every interval and updates the
+// credentials once its content changes
+func (c *Service) passwordFileWatcher() {
+	defer c.wg.Done()
+
+	tk := time.NewTicker(c.options.passwordFileInterval)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-c.stopper:
+			return
+		case <-tk.C:
+		}
+
+		password, err := readPasswordFile(c.options.passwordFile)
+		if err != nil {
+			c.emit(Event{Type: EventTypeCredentialsUpdated, Key: c.options.passwordFile, Err: err})
+			continue
+		}
+
+		c.credMu.Lock()
+		changed := password != c.options.password
+		username := c.options.username
+		c.credMu.Unlock()
+
+		if !changed {
+			continue
+		}
+
+		err = c.UpdateCredentials(username, password)
+		c.emit(Event{Type: EventTypeCredentialsUpdated, Key: c.options.passwordFile, Err: err})
+	}
+}
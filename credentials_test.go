@@ -0,0 +1,94 @@
+package svcutil
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+func TestReadPasswordFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(path, []byte("  s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := readPasswordFile(path); err != nil || got != "s3cret" {
+		t.Errorf("readPasswordFile() = %q, %v, want %q", got, err, "s3cret")
+	}
+
+	if _, err := readPasswordFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("readPasswordFile() of a missing file succeeded")
+	}
+}
+
+func TestUpdateCredentialsKeepsLeasesAndWatches(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	// a short dial timeout closes the replaced connection soon after the rotation
+	svc, err := NewService(Name("api"), Instance("worker"), LocalBackend(t.TempDir()), LeaseTTL(2), DialTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	r, _ := NewIDRange("1")
+	l := NewLeaseWithOptions(r, svc)
+	defer l.Close()
+	if _, err := l.Obtain(ctx); err != nil {
+		t.Fatalf("Obtain() error = %v", err)
+	}
+
+	events := svc.etcd.Watch(ctx, "/watched/", clientv3.WithPrefix())
+
+	put := func(key string) {
+		t.Helper()
+		if _, err := svc.etcd.Put(ctx, "/watched/"+key, key); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	put("1")
+	if err := svc.UpdateCredentials("rotated", "s3cret"); err != nil {
+		t.Fatalf("UpdateCredentials() error = %v", err)
+	}
+	put("2")
+	time.Sleep(400 * time.Millisecond)
+	put("3")
+
+	var got []string
+	for len(got) < 3 {
+		select {
+		case wresp := <-events:
+			if err := wresp.Err(); err != nil {
+				t.Fatalf("watch error = %v", err)
+			}
+			for _, ev := range wresp.Events {
+				got = append(got, string(ev.Kv.Value))
+			}
+		case <-ctx.Done():
+			t.Fatalf("watched %v, want 1, 2 and 3", got)
+		}
+	}
+	if !reflect.DeepEqual(got, []string{"1", "2", "3"}) {
+		t.Errorf("watched %v, want 1, 2 and 3 exactly once", got)
+	}
+
+	// the keep-alive moved to the new connection keeps the lease past its TTL
+	time.Sleep(3 * time.Second)
+
+	select {
+	case <-l.Done():
+		t.Fatalf("lease lost after the credentials were rotated")
+	default:
+	}
+
+	if ok, err := l.Verify(ctx); err != nil || !ok {
+		t.Errorf("Verify() = %v, %v after the credentials were rotated, want true", ok, err)
+	}
+}
@@ -0,0 +1,111 @@
+package svcutil
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+var ErrServiceNotReady = errors.New("service not ready")
+
+// countInstances counts live instances from the heartbeat and status keys of a service.
+// Instances publishing a status are counted individually, a host with a heartbeat but no
+// status counts as a single instance.
+func countInstances(heartbeatPrefix string, heartbeats []*mvccpb.KeyValue, statusPrefix string, statuses []*mvccpb.KeyValue) int {
+	perHost := make(map[string]int)
+	for _, kv := range statuses {
+		rest := strings.TrimPrefix(string(kv.Key), statusPrefix)
+		if isStatusKey(rest) {
+			host, _, _ := strings.Cut(rest, "/")
+			perHost[host]++
+		}
+	}
+
+	count := 0
+	for _, n := range perHost {
+		count += n
+	}
+
+	for _, kv := range heartbeats {
+		host := strings.TrimPrefix(string(kv.Key), heartbeatPrefix)
+		if host != "" && !strings.Contains(host, "/") && perHost[host] == 0 {
+			count++
+		}
+	}
+
+	return count
+}
+
+// WaitForService blocks until the named service has at least minInstances live instances,
+// which are discovered from status keys (SetStatus) and heartbeats (StartHeartbeat). Every
+// change of the instance count is reported as EventTypeDependencyWaiting. Once ctx is done
+// an error matching ErrServiceNotReady and the context error is returned.
+func (c *Service) WaitForService(ctx context.Context, serviceName string, minInstances int) error {
+	heartbeatPrefix := c.heartbeatPrefix(serviceName)
+	statusPrefix := c.statusPrefix(serviceName)
+	last, closed := -1, 0
+
+	for {
+		resp, err := c.etcd.Txn(ctx).Then(
+			clientv3.OpGet(heartbeatPrefix, clientv3.WithPrefix(), clientv3.WithKeysOnly()),
+			clientv3.OpGet(statusPrefix, clientv3.WithPrefix(), clientv3.WithKeysOnly()),
+		).Commit()
+		if err != nil {
+			if ctx.Err() != nil {
+				return wrapCause(ErrServiceNotReady, ctx.Err())
+			}
+			return etcdError(err)
+		}
+
+		heartbeats := resp.Responses[0].GetResponseRange().Kvs
+		statuses := resp.Responses[1].GetResponseRange().Kvs
+
+		count := countInstances(heartbeatPrefix, heartbeats, statusPrefix, statuses)
+		if count != last {
+			last = count
+			c.emit(Event{Type: EventTypeDependencyWaiting, Key: serviceName, Value: fmt.Sprintf("%d/%d", count, minInstances)})
+		}
+
+		if count >= minInstances {
+			return nil
+		}
+
+		err = c.waitKeysChange(ctx, []string{heartbeatPrefix, statusPrefix}, resp.Header.Revision, clientv3.WithPrefix())
+		if err := c.retryWatch(ctx, err, &closed); err != nil {
+			return fmt.Errorf("%w: %s has %d of %d instances: %w", ErrServiceNotReady, serviceName, count, minInstances, err)
+		}
+	}
+}
+
+// waitChange waits for any change of the key, or under the prefix with WithPrefix, after
+// the revision. A watch failing or closing first, e.g. after a compaction, returns
+// errWatchClosed, see retryWatch.
+func (c *Service) waitChange(ctx context.Context, key string, rev int64, opts ...clientv3.OpOption) error {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	watchChan := c.etcd.Watch(wctx, key, append(opts, clientv3.WithRev(rev+1))...)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.stopper:
+			return context.Canceled
+		case wresp, ok := <-watchChan:
+			if !ok || wresp.Err() != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return errWatchClosed
+			}
+
+			if len(wresp.Events) > 0 {
+				return nil
+			}
+		}
+	}
+}
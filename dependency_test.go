@@ -0,0 +1,97 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"golang.org/x/net/context"
+)
+
+func TestCountInstances(t *testing.T) {
+	keys := func(prefix string, names ...string) []*mvccpb.KeyValue {
+		kvs := make([]*mvccpb.KeyValue, 0, len(names))
+		for _, name := range names {
+			kvs = append(kvs, &mvccpb.KeyValue{Key: []byte(prefix + name)})
+		}
+		return kvs
+	}
+
+	heartbeat := func(names ...string) []*mvccpb.KeyValue { return keys("/heartbeat/billing/", names...) }
+	status := func(names ...string) []*mvccpb.KeyValue { return keys("/status/billing/", names...) }
+
+	tests := []struct {
+		name       string
+		heartbeats []*mvccpb.KeyValue
+		statuses   []*mvccpb.KeyValue
+		want       int
+	}{
+		{name: "empty", want: 0},
+		{name: "malformed status", statuses: status("host-a", "host-a/nested/i1"), want: 0},
+		{name: "heartbeats", heartbeats: heartbeat("host-a", "host-b"), want: 2},
+		{name: "statuses", statuses: status("host-a/i1", "host-a/i2"), want: 2},
+		{
+			name:       "heartbeat and statuses of the same host",
+			heartbeats: heartbeat("host-a", "host-b"),
+			statuses:   status("host-a/i1", "host-a/i2"),
+			want:       3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countInstances("/heartbeat/billing/", tt.heartbeats, "/status/billing/", tt.statuses); got != tt.want {
+				t.Errorf("countInstances() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitChangeClosed(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("billing"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	first, err := svc.etcd.Put(ctx, "/key", "1")
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	last, err := svc.etcd.Put(ctx, "/key", "2")
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if _, err := svc.etcd.Compact(ctx, last.Header.Revision); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+
+	// a watch from a compacted revision closes without a change, it's not reported as one
+	err = svc.waitChange(ctx, "/key", first.Header.Revision)
+	if !errors.Is(err, errWatchClosed) {
+		t.Fatalf("waitChange() from a compacted revision error = %v, want %v", err, errWatchClosed)
+	}
+
+	closed := 0
+	started := time.Now()
+	for range 3 {
+		if err := svc.retryWatch(ctx, errWatchClosed, &closed); err != nil {
+			t.Fatalf("retryWatch() error = %v", err)
+		}
+	}
+	if elapsed := time.Since(started); closed != 3 || elapsed < watchRetryBackoff(1)+watchRetryBackoff(2)+watchRetryBackoff(3) {
+		t.Errorf("retryWatch() of 3 closures = %d closures in %v, want a backoff", closed, elapsed)
+	}
+
+	if err := svc.retryWatch(ctx, nil, &closed); err != nil || closed != 0 {
+		t.Errorf("retryWatch() of a change = %v, %d closures, want them reset", err, closed)
+	}
+
+	if err := svc.retryWatch(ctx, context.Canceled, &closed); err != context.Canceled {
+		t.Errorf("retryWatch() of an error = %v, want it returned", err)
+	}
+}
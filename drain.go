@@ -0,0 +1,255 @@
+package svcutil
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"golang.org/x/net/context"
+)
+
+// states published by Drain, see SetStatus
+const (
+	StateDraining = "draining"
+	StateDrained  = "drained"
+)
+
+const drainSegment = "/drain/"
+
+func (c *Service) drainPrefix() string {
+	return c.options.locksPrefix + c.options.serviceName + drainSegment
+}
+
+// drainAckKey is the prefix of the acks of the draining instance
+func (c *Service) drainAckKey(instance string) string {
+	return c.drainPrefix() + "ack/" + instance + "/"
+}
+
+func (c *Service) routerKey(name string) string {
+	return c.drainPrefix() + "router/" + name
+}
+
+// Drain takes the instance out of the fleet for a clean restart: it publishes the
+// "draining" status, waits until every router registered with AcknowledgeDrains stopped
+// sending new traffic to the instance or DrainTimeout passes, then closes the leases, so
+// their values move to other instances, and publishes the "drained" status.
+func (c *Service) Drain(ctx context.Context, leases ...*Lease) error {
+	if err := c.SetStatus(ctx, StateDraining, nil); err != nil {
+		return err
+	}
+
+	wctx, cancel := context.WithTimeout(ctx, c.options.drainTimeout)
+	err := c.waitDrainAcks(wctx)
+	cancel()
+
+	// routers which didn't acknowledge in time don't hold the drain up
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	for _, l := range leases {
+		l.Close()
+	}
+
+	return c.SetStatus(ctx, StateDrained, nil)
+}
+
+// waitDrainAcks waits until every registered router acknowledged the draining instance
+func (c *Service) waitDrainAcks(ctx context.Context) error {
+	routers := c.routerKey("")
+	acks := c.drainAckKey(c.options.instance)
+	closed := 0
+
+	for {
+		resp, err := c.etcd.Txn(ctx).Then(
+			clientv3.OpGet(routers, clientv3.WithPrefix(), clientv3.WithKeysOnly()),
+			clientv3.OpGet(acks, clientv3.WithPrefix(), clientv3.WithKeysOnly()),
+		).Commit()
+		if err != nil {
+			return etcdError(err)
+		}
+
+		acked := make(map[string]bool)
+		for _, kv := range resp.Responses[1].GetResponseRange().Kvs {
+			acked[strings.TrimPrefix(string(kv.Key), acks)] = true
+		}
+
+		pending := false
+		for _, kv := range resp.Responses[0].GetResponseRange().Kvs {
+			if !acked[strings.TrimPrefix(string(kv.Key), routers)] {
+				pending = true
+			}
+		}
+
+		if !pending {
+			return nil
+		}
+
+		// a router that goes away counts as acknowledged, acks and routers are both watched
+		err = c.waitChange(ctx, c.drainPrefix(), resp.Header.Revision, clientv3.WithPrefix())
+		if err := c.retryWatch(ctx, err, &closed); err != nil {
+			return err
+		}
+	}
+}
+
+// AcknowledgeDrains registers the router under the name until ctx is done and calls
+// onDrain for every instance of the service that starts draining (see Drain). Once
+// onDrain returns, e.g. after the instance was removed from the load balancer, the drain
+// is acknowledged. The registration and the acks are attached to the service session and
+// made again on the new session once a lost one is recreated.
+func (c *Service) AcknowledgeDrains(ctx context.Context, name string, onDrain func(instance string)) error {
+	c.lock.Lock()
+	session := c.session
+	c.lock.Unlock()
+
+	if session == nil {
+		return ErrSessionNotAvailable
+	}
+
+	if _, err := c.etcd.Put(ctx, c.routerKey(name), c.options.instance, clientv3.WithLease(session.Lease())); err != nil {
+		return etcdError(err)
+	}
+
+	c.wg.Add(1)
+	go c.acknowledgeDrains(ctx, name, session, onDrain)
+
+	return nil
+}
+
+// nextSession waits until the lost session is replaced, it returns nil once ctx is done
+// or the service is closed
+func (c *Service) nextSession(ctx context.Context, lost *concurrency.Session) *concurrency.Session {
+	for {
+		c.lock.Lock()
+		session := c.session
+		c.lock.Unlock()
+
+		if session != nil && session != lost && !sessionDone(session) {
+			return session
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.stopper:
+			return nil
+		case <-time.After(c.options.retryInterval):
+		}
+	}
+}
+
+func (c *Service) acknowledgeDrains(ctx context.Context, name string, session *concurrency.Session, onDrain func(instance string)) {
+	defer c.wg.Done()
+
+	prefix := c.statusPrefix(c.options.serviceName)
+	acked := make(map[string]bool)
+
+	handle := func(key string, value []byte) {
+		if !isStatusKey(strings.TrimPrefix(key, prefix)) {
+			return
+		}
+
+		var status InstanceStatus
+		if value != nil && json.Unmarshal(value, &status) != nil {
+			return
+		}
+
+		instance := key[strings.LastIndex(key, "/")+1:]
+		if status.State != StateDraining {
+			// a later drain of the instance is acknowledged again
+			if acked[instance] {
+				c.etcd.Delete(ctx, c.drainAckKey(instance)+name)
+				delete(acked, instance)
+			}
+			return
+		}
+
+		if acked[instance] {
+			return
+		}
+
+		onDrain(instance)
+		if _, err := c.etcd.Put(ctx, c.drainAckKey(instance)+name, "", clientv3.WithLease(session.Lease())); err == nil {
+			acked[instance] = true
+		}
+	}
+
+	var rev int64
+	failures := 0
+	for ctx.Err() == nil {
+		if sessionDone(session) {
+			// the registration and the acks expired with the session
+			if session = c.nextSession(ctx, session); session == nil {
+				return
+			}
+
+			if _, err := c.etcd.Put(ctx, c.routerKey(name), c.options.instance, clientv3.WithLease(session.Lease())); err != nil {
+				continue
+			}
+			for instance := range acked {
+				c.etcd.Put(ctx, c.drainAckKey(instance)+name, "", clientv3.WithLease(session.Lease()))
+			}
+		}
+
+		if rev == 0 {
+			resp, err := c.etcd.Get(ctx, prefix, clientv3.WithPrefix())
+			if err != nil {
+				select {
+				case <-ctx.Done():
+				case <-c.stopper:
+					return
+				case <-time.After(c.options.retryInterval):
+				}
+				continue
+			}
+
+			rev = resp.Header.Revision
+			for _, kv := range resp.Kvs {
+				handle(string(kv.Key), kv.Value)
+			}
+		}
+
+		wctx, cancel := context.WithCancel(ctx)
+		watchChan := c.etcd.Watch(wctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+
+		failed := false
+	watchLoop:
+		for {
+			select {
+			case <-c.stopper:
+				cancel()
+				return
+			case <-session.Done():
+				break watchLoop
+			case wresp, ok := <-watchChan:
+				if !ok || wresp.Err() != nil {
+					// compacted or canceled, start over with a fresh read
+					failed = true
+					rev = 0
+					break watchLoop
+				}
+				failures = 0
+
+				for _, ev := range wresp.Events {
+					rev = ev.Kv.ModRevision
+					if ev.Type == clientv3.EventTypeDelete {
+						handle(string(ev.Kv.Key), nil)
+					} else {
+						handle(string(ev.Kv.Key), ev.Kv.Value)
+					}
+				}
+			}
+		}
+		cancel()
+
+		if failed {
+			failures++
+			if !c.sleepWatchRetry(ctx.Done(), failures) {
+				return
+			}
+		}
+	}
+}
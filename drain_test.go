@@ -0,0 +1,138 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestDrain(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	newService := func(instance string, opts ...func(*options) *options) *Service {
+		svc, err := NewService(append([]func(*options) *options{Name("api"), Instance(instance), LocalBackend(dir)}, opts...)...)
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		t.Cleanup(svc.Close)
+		return svc
+	}
+
+	router := newService("router")
+	drained := make(chan string, 10)
+	if err := router.AcknowledgeDrains(ctx, "lb", func(instance string) { drained <- instance }); err != nil {
+		t.Fatalf("AcknowledgeDrains() error = %v", err)
+	}
+
+	worker := newService("worker")
+	r, _ := NewIDRange("1")
+	l := NewLeaseWithOptions(r, worker)
+	if _, err := l.Obtain(ctx); err != nil {
+		t.Fatalf("Obtain() error = %v", err)
+	}
+
+	if err := worker.Drain(ctx, l); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+
+	select {
+	case instance := <-drained:
+		if instance != "worker" {
+			t.Errorf("drained %s, want worker", instance)
+		}
+	default:
+		t.Fatalf("Drain() returned before the router acknowledged it")
+	}
+
+	successor := NewLeaseWithOptions(r, router)
+	defer successor.Close()
+	if _, err := successor.Obtain(ctx); err != nil {
+		t.Errorf("Obtain() of the drained value error = %v", err)
+	}
+
+	fleet, _ := router.FleetStatus(ctx)
+	for _, status := range fleet {
+		if status.Instance == "worker" && status.State != StateDrained {
+			t.Errorf("status of the drained instance = %s, want %s", status.State, StateDrained)
+		}
+	}
+
+	// a router that doesn't acknowledge holds the drain up to the timeout only
+	stuck := make(chan struct{})
+	defer close(stuck)
+	if err := router.AcknowledgeDrains(ctx, "stuck", func(string) { <-stuck }); err != nil {
+		t.Fatalf("AcknowledgeDrains() error = %v", err)
+	}
+
+	slow := newService("slow", DrainTimeout(200*time.Millisecond))
+	started := time.Now()
+	if err := slow.Drain(ctx); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	if elapsed := time.Since(started); elapsed < 200*time.Millisecond {
+		t.Errorf("Drain() took %v, want the timeout", elapsed)
+	}
+}
+
+func TestDrainSessionRestored(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	newService := func(instance string) *Service {
+		svc, err := NewService(Name("api"), Instance(instance), LocalBackend(dir), LeaseTTL(3), RetryInterval(50*time.Millisecond), DrainTimeout(10*time.Second))
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		t.Cleanup(svc.Close)
+		return svc
+	}
+
+	router := newService("router")
+	drained := make(chan string, 10)
+	if err := router.AcknowledgeDrains(ctx, "lb", func(instance string) { drained <- instance }); err != nil {
+		t.Fatalf("AcknowledgeDrains() error = %v", err)
+	}
+
+	router.lock.Lock()
+	lost := router.session.Lease()
+	router.lock.Unlock()
+
+	// the registration goes away with the session and comes back on the new one
+	if _, err := router.etcd.Revoke(ctx, lost); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+
+	for {
+		resp, err := router.etcd.Get(ctx, router.routerKey("lb"))
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if len(resp.Kvs) == 1 && resp.Kvs[0].Lease != int64(lost) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatal("the router was not registered on the new session")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	worker := newService("worker")
+	if err := worker.Drain(ctx); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+
+	select {
+	case instance := <-drained:
+		if instance != "worker" {
+			t.Errorf("drained %s, want worker", instance)
+		}
+	default:
+		t.Fatal("Drain() returned before the router acknowledged it")
+	}
+}
@@ -0,0 +1,45 @@
+package svcutil
+
+import (
+	"golang.org/x/net/context"
+)
+
+// dryRun reports a write skipped in dry-run mode
+func (c *Service) dryRun(key, op string) {
+	c.emit(Event{Type: EventTypeDryRun, Key: key, Value: op})
+}
+
+// obtainDryRun picks the value Obtain would take, the first candidate not held by another
+// instance, reserved or guarded by a tombstone, without leasing it. The value is kept until
+// the lease is closed.
+func (i *Lease) obtainDryRun(ctx context.Context, key string) (string, int64, error) {
+	taken, rev, err := i.unavailable(ctx, key)
+	if err != nil {
+		return "", 0, &LeaseError{Key: key, Op: "obtain", Err: err}
+	}
+
+	for _, id := range i.candidates() {
+		if taken[key+id] {
+			continue
+		}
+
+		i.value = id
+		i.leaseKey = key + id
+		i.client.dryRun(i.leaseKey, "obtain lease")
+
+		i.wg.Add(1)
+		go func() {
+			defer i.wg.Done()
+			<-i.stopper
+			close(i.donec)
+		}()
+
+		if i.options.process != nil {
+			i.attachProcess(i.options.process)
+		}
+
+		return id, rev, nil
+	}
+
+	return "", rev, ErrNoAvailableIDs
+}
@@ -0,0 +1,119 @@
+package svcutil
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+func TestDryRun(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+
+	live, err := NewService(Name("api"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer live.Close()
+
+	var mu sync.Mutex
+	var skipped []string
+	dry, err := NewService(Name("api"), LocalBackend(dir), DryRun(), OnEvents(EventsFunc(func(ev Event) {
+		if ev.Type == EventTypeDryRun {
+			mu.Lock()
+			skipped = append(skipped, ev.Value)
+			mu.Unlock()
+		}
+	})))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer dry.Close()
+
+	donec, err := dry.AcquireLock(ctx, "migration")
+	if err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	// the lock is not taken in etcd
+	if _, err := live.AcquireLock(ctx, "migration"); err != nil {
+		t.Errorf("AcquireLock() of the live service error = %v", err)
+	}
+
+	if err := dry.ReleaseLock(ctx, "migration"); err != nil {
+		t.Fatalf("ReleaseLock() error = %v", err)
+	}
+
+	select {
+	case <-donec:
+	default:
+		t.Error("lock channel is not closed after ReleaseLock()")
+	}
+
+	r, _ := NewIDRange("1-2")
+	held := NewLeaseWithOptions(r, live)
+	defer held.Close()
+	heldValue, err := held.Obtain(ctx)
+	if err != nil {
+		t.Fatalf("Obtain() error = %v", err)
+	}
+
+	// the dry run skips the value held by the live service
+	lease := NewLeaseWithOptions(r, dry)
+	value, err := lease.Obtain(ctx)
+	if err != nil || value == heldValue {
+		t.Fatalf("dry-run Obtain() = %q, %v, want the value not held (%q is)", value, err, heldValue)
+	}
+
+	resp, err := live.etcd.Get(ctx, lease.keyPrefix(), clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil || resp.Count != 1 {
+		t.Errorf("leased keys = %d, %v, want only the live one", resp.Count, err)
+	}
+
+	lease.Close()
+	select {
+	case <-lease.Done():
+	default:
+		t.Error("lease is not done after Close()")
+	}
+
+	// a reserved value is skipped as Obtain would skip it
+	free, _ := NewIDRange(value)
+	if err := live.ReserveIDs(ctx, free, "maintenance", 0); err != nil {
+		t.Fatalf("ReserveIDs() error = %v", err)
+	}
+	if value, err := NewLeaseWithOptions(r, dry).Obtain(ctx); !errors.Is(err, ErrNoAvailableIDs) {
+		t.Errorf("dry-run Obtain() of a reserved value = %q, %v, want %v", value, err, ErrNoAvailableIDs)
+	}
+
+	type config struct {
+		Level string `json:"level"`
+	}
+
+	if err := dry.SaveConfig(ctx, ConfigurationTypeService, &config{Level: "debug"}); err != nil {
+		t.Fatalf("SaveConfig() error = %v", err)
+	}
+
+	if values, err := live.LoadConfigMap(ctx, ConfigurationTypeService); err != nil || len(values) != 0 {
+		t.Errorf("LoadConfigMap() = %v, %v, want no saved values", values, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	want := []string{"acquire lock", "release lock", "obtain lease", "save config: 1 values"}
+	if len(skipped) != len(want) {
+		t.Fatalf("skipped = %q, want %q", skipped, want)
+	}
+	for n := range want {
+		if skipped[n] != want[n] {
+			t.Errorf("skipped[%d] = %q, want %q", n, skipped[n], want[n])
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package svcutil
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"go.etcd.io/etcd/client/pkg/v3/srv"
+)
+
+// srvScheme marks endpoints discovered with DNS SRV records of the domain,
+// the same scheme etcdctl accepts
+const srvScheme = "dns+srv://"
+
+// parseEndpoints splits a comma-separated endpoint list dropping blank entries
+func parseEndpoints(s string) []string {
+	var endpoints []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			endpoints = append(endpoints, e)
+		}
+	}
+
+	return endpoints
+}
+
+// lookupSRVEndpoints discovers client endpoints of the domain from the
+// _etcd-client-ssl._tcp and _etcd-client._tcp SRV records
+func lookupSRVEndpoints(domain string) ([]string, error) {
+	clients, err := srv.GetClient("etcd-client", domain, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return clients.Endpoints, nil
+}
+
+// resolveEndpoints expands SRV discovery entries and validates the rest
+func resolveEndpoints(endpoints []string, lookup func(domain string) ([]string, error)) ([]string, error) {
+	var resolved []string
+	for _, e := range endpoints {
+		if domain, ok := strings.CutPrefix(e, srvScheme); ok {
+			discovered, err := lookup(domain)
+			if err != nil {
+				return nil, wrapCause(ErrWrongEtcdAddress, err)
+			}
+
+			resolved = append(resolved, discovered...)
+			continue
+		}
+
+		if !validEndpoint(e) {
+			return nil, fmt.Errorf("%w: %q", ErrWrongEtcdAddress, e)
+		}
+
+		resolved = append(resolved, e)
+	}
+
+	if len(resolved) == 0 {
+		return nil, ErrWrongEtcdAddress
+	}
+
+	return resolved, nil
+}
+
+func validEndpoint(e string) bool {
+	if strings.Contains(e, "://") {
+		u, err := url.Parse(e)
+		if err != nil {
+			return false
+		}
+
+		// unix sockets are addressed by a path, e.g. unix:///run/etcd.sock, or by a
+		// name in the host part, e.g. unix://localhost:2379
+		if u.Scheme == "unix" || u.Scheme == "unixs" {
+			return u.Host != "" || u.Path != ""
+		}
+		return u.Host != ""
+	}
+
+	host, _, err := net.SplitHostPort(e)
+	return err == nil && host != ""
+}
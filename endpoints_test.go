@@ -0,0 +1,74 @@
+package svcutil
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseEndpoints(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{name: "empty", in: "", want: nil},
+		{name: "blanks", in: " , ,", want: nil},
+		{name: "single", in: "localhost:2379", want: []string{"localhost:2379"}},
+		{name: "spaces", in: " etcd1:2379 ,etcd2:2379,", want: []string{"etcd1:2379", "etcd2:2379"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseEndpoints(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseEndpoints(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveEndpoints(t *testing.T) {
+	lookup := func(domain string) ([]string, error) {
+		if domain == "example.com" {
+			return []string{"https://etcd1.example.com:2379", "https://etcd2.example.com:2379"}, nil
+		}
+
+		return nil, errors.New("no such host")
+	}
+
+	tests := []struct {
+		name    string
+		in      []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "plain", in: []string{"localhost:2379", "http://10.0.0.1:2379"}, want: []string{"localhost:2379", "http://10.0.0.1:2379"}},
+		{name: "srv", in: []string{"dns+srv://example.com"}, want: []string{"https://etcd1.example.com:2379", "https://etcd2.example.com:2379"}},
+		{name: "unix socket", in: []string{"unix:///run/etcd.sock", "unixs://localhost:2379"}, want: []string{"unix:///run/etcd.sock", "unixs://localhost:2379"}},
+		{name: "unix without path", in: []string{"unix://"}, wantErr: true},
+		{name: "srv failure", in: []string{"dns+srv://unknown.com"}, wantErr: true},
+		{name: "missing port", in: []string{"localhost"}, wantErr: true},
+		{name: "missing host", in: []string{"http://"}, wantErr: true},
+		{name: "empty", in: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveEndpoints(tt.in, lookup)
+			if tt.wantErr {
+				if !errors.Is(err, ErrWrongEtcdAddress) {
+					t.Errorf("resolveEndpoints(%v) error = %v, want ErrWrongEtcdAddress", tt.in, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("resolveEndpoints(%v) error = %v", tt.in, err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveEndpoints(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package svcutil
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"golang.org/x/net/context"
+)
+
+// LockError describes a failed lock operation, Err matches the package sentinel errors
+// and the underlying etcd error with errors.Is and errors.As
+type LockError struct {
+	Key string
+	Op  string
+	Err error
+}
+
+func (e *LockError) Error() string {
+	return "lock " + e.Op + " " + e.Key + ": " + e.Err.Error()
+}
+
+func (e *LockError) Unwrap() error {
+	return e.Err
+}
+
+// lockSentinels are returned by the lock methods as they are, callers compare them with ==
+var lockSentinels = []error{ErrSessionNotAvailable, ErrMutexAlreadyAcquired, ErrLockWaitTimeout, ErrLockQueueFull}
+
+// lockError wraps err in a LockError unless it is one of lockSentinels
+func lockError(key, op string, err error) error {
+	if err == nil || slices.Contains(lockSentinels, err) {
+		return err
+	}
+
+	return &LockError{Key: key, Op: op, Err: err}
+}
+
+// LeaseError describes a failed range lease operation
+type LeaseError struct {
+	Key string
+	Op  string
+	Err error
+}
+
+func (e *LeaseError) Error() string {
+	return "lease " + e.Op + " " + e.Key + ": " + e.Err.Error()
+}
+
+func (e *LeaseError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigError describes a failed configuration operation
+type ConfigError struct {
+	Key string
+	Op  string
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return "config " + e.Op + " " + e.Key + ": " + e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// wrapCause makes err match both the sentinel and the cause
+func wrapCause(sentinel, cause error) error {
+	return fmt.Errorf("%w: %w", sentinel, cause)
+}
+
+// etcdError maps an expired deadline to ErrEtcdTimeout keeping the cause
+func etcdError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return wrapCause(ErrEtcdTimeout, err)
+	}
+
+	return err
+}
+
+// ListError describes a failed listing of keys under a prefix
+type ListError struct {
+	Prefix string
+	Err    error
+}
+
+func (e *ListError) Error() string {
+	return "list " + e.Prefix + ": " + e.Err.Error()
+}
+
+func (e *ListError) Unwrap() error {
+	return e.Err
+}
+
+// TransactionError describes a failed two-phase commit operation
+type TransactionError struct {
+	ID  string
+	Op  string
+	Err error
+}
+
+func (e *TransactionError) Error() string {
+	return "transaction " + e.Op + " " + e.ID + ": " + e.Err.Error()
+}
+
+func (e *TransactionError) Unwrap() error {
+	return e.Err
+}
+
+// WorkflowError describes a failed workflow step or a failed checkpoint of its progress
+type WorkflowError struct {
+	Key  string
+	Step string
+	Err  error
+}
+
+func (e *WorkflowError) Error() string {
+	return "workflow step " + e.Step + " " + e.Key + ": " + e.Err.Error()
+}
+
+func (e *WorkflowError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,78 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestErrorsWrapCause(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		targets []error
+	}{
+		{
+			name:    "lock timeout",
+			err:     &LockError{Key: "/lock/svc/mutex/a", Op: "acquire", Err: etcdError(context.DeadlineExceeded)},
+			targets: []error{ErrEtcdTimeout, context.DeadlineExceeded},
+		},
+		{
+			name:    "lock cycle",
+			err:     &LockError{Key: "/lock/svc/mutex/a", Op: "acquire", Err: &DeadlockError{Cycle: []LockWait{{Owner: "a", Key: "x"}}, Err: ErrLockCycle}},
+			targets: []error{ErrLockCycle, ErrMutexAlreadyAcquired},
+		},
+		{
+			name:    "lease",
+			err:     &LeaseError{Key: "/lock/svc/id/1", Op: "obtain", Err: etcdError(context.Canceled)},
+			targets: []error{context.Canceled},
+		},
+		{
+			name:    "config",
+			err:     &ConfigError{Key: "/configs/svc/", Op: "load", Err: ErrInvalidConfigPointer},
+			targets: []error{ErrInvalidConfigPointer},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, target := range tt.targets {
+				if !errors.Is(tt.err, target) {
+					t.Errorf("errors.Is(%v, %v) = false", tt.err, target)
+				}
+			}
+
+			if errors.Is(tt.err, ErrNoAvailableIDs) {
+				t.Errorf("errors.Is(%v, ErrNoAvailableIDs) = true", tt.err)
+			}
+		})
+	}
+
+	var lockErr *LockError
+	err := error(&LockError{Key: "k", Op: "release", Err: ErrEtcdTimeout})
+	if !errors.As(err, &lockErr) || lockErr.Key != "k" {
+		t.Errorf("errors.As(%v, *LockError) failed", err)
+	}
+
+	if got, want := err.Error(), "lock release k: etcd timeout"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestLockErrorKeepsSentinels(t *testing.T) {
+	for _, sentinel := range []error{ErrSessionNotAvailable, ErrMutexAlreadyAcquired, ErrLockWaitTimeout, ErrLockQueueFull} {
+		if err := lockError("k", "acquire", sentinel); err != sentinel {
+			t.Errorf("lockError(%v) = %v, want the sentinel as is", sentinel, err)
+		}
+	}
+
+	var lockErr *LockError
+	if err := lockError("k", "acquire", etcdError(context.DeadlineExceeded)); !errors.As(err, &lockErr) || !errors.Is(err, ErrEtcdTimeout) {
+		t.Errorf("lockError() of an etcd error = %v, want a *LockError", err)
+	}
+
+	if err := lockError("k", "acquire", nil); err != nil {
+		t.Errorf("lockError(nil) = %v, want nil", err)
+	}
+}
@@ -0,0 +1,170 @@
+package svcutil
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+type EventType int
+
+const (
+	EventTypeSessionLost EventType = iota
+	EventTypeSessionRestored
+	EventTypeRebalanceAdvice
+	EventTypeRebalanceRequested
+	EventTypeLockHoldTimeout
+	EventTypeStats
+	EventTypeHandlerPanic
+	EventTypeCompacted
+	EventTypeAlarm
+	EventTypeAlarmCleared
+	EventTypeDependencyWaiting
+	EventTypeCredentialsUpdated
+	EventTypeLockSlow
+	EventTypeLockContention
+	EventTypeDegradedMode
+	EventTypeConfigFallback
+	EventTypeDuplicateInstance
+	EventTypeDryRun
+	EventTypeHostnameCollision
+	EventTypeLeadershipAcquired
+	EventTypeLeadershipLost
+	EventTypeLockLost
+	EventTypeRecordFailed
+)
+
+func (et EventType) String() string {
+	switch et {
+	case EventTypeSessionLost:
+		return "EventTypeSessionLost"
+	case EventTypeSessionRestored:
+		return "EventTypeSessionRestored"
+	case EventTypeRebalanceAdvice:
+		return "EventTypeRebalanceAdvice"
+	case EventTypeRebalanceRequested:
+		return "EventTypeRebalanceRequested"
+	case EventTypeLockHoldTimeout:
+		return "EventTypeLockHoldTimeout"
+	case EventTypeStats:
+		return "EventTypeStats"
+	case EventTypeHandlerPanic:
+		return "EventTypeHandlerPanic"
+	case EventTypeCompacted:
+		return "EventTypeCompacted"
+	case EventTypeAlarm:
+		return "EventTypeAlarm"
+	case EventTypeAlarmCleared:
+		return "EventTypeAlarmCleared"
+	case EventTypeDependencyWaiting:
+		return "EventTypeDependencyWaiting"
+	case EventTypeCredentialsUpdated:
+		return "EventTypeCredentialsUpdated"
+	case EventTypeLockSlow:
+		return "EventTypeLockSlow"
+	case EventTypeLockContention:
+		return "EventTypeLockContention"
+	case EventTypeDegradedMode:
+		return "EventTypeDegradedMode"
+	case EventTypeConfigFallback:
+		return "EventTypeConfigFallback"
+	case EventTypeDuplicateInstance:
+		return "EventTypeDuplicateInstance"
+	case EventTypeDryRun:
+		return "EventTypeDryRun"
+	case EventTypeHostnameCollision:
+		return "EventTypeHostnameCollision"
+	case EventTypeLeadershipAcquired:
+		return "EventTypeLeadershipAcquired"
+	case EventTypeLeadershipLost:
+		return "EventTypeLeadershipLost"
+	case EventTypeLockLost:
+		return "EventTypeLockLost"
+	case EventTypeRecordFailed:
+		return "EventTypeRecordFailed"
+	default:
+		return fmt.Sprintf("unknown EventType: %d", et)
+	}
+}
+
+// Event describes a state change observed by the Service or one of its components
+type Event struct {
+	Type     EventType
+	Key      string
+	Value    string
+	Instance string
+	Err      error
+	// Stats is set for EventTypeStats
+	Stats *Stats
+}
+
+// Events receives notifications from the Service, it is called synchronously
+// from internal goroutines so implementations should not block
+type Events interface {
+	OnEvent(ev Event)
+}
+
+// EventsFunc is an adapter to use ordinary functions as Events
+type EventsFunc func(ev Event)
+
+func (f EventsFunc) OnEvent(ev Event) {
+	f(ev)
+}
+
+// eventsHandler holds the current handler so it can be swapped while events are emitted
+type eventsHandler struct {
+	p atomic.Pointer[Events]
+}
+
+func (h *eventsHandler) load() Events {
+	if p := h.p.Load(); p != nil {
+		return *p
+	}
+
+	return nil
+}
+
+func (h *eventsHandler) store(e Events) {
+	if e == nil {
+		h.p.Store(nil)
+		return
+	}
+
+	h.p.Store(&e)
+}
+
+// SetEvents replaces the handler set with the OnEvents option, nil disables events.
+// It is safe to call while events are being emitted.
+func (c *Service) SetEvents(e Events) {
+	c.events.store(e)
+}
+
+func (c *Service) emit(ev Event) {
+	h := c.events.load()
+	if h == nil {
+		return
+	}
+
+	if ev.Instance == "" {
+		ev.Instance = c.options.instance
+	}
+
+	dispatch(h, ev)
+}
+
+// dispatch calls the handler recovering from its panics so internal goroutines keep
+// running, a panic is reported to the same handler as EventTypeHandlerPanic with Key
+// naming the type of the event being dispatched
+func dispatch(h Events, ev Event) {
+	defer func() {
+		if r := recover(); r != nil && ev.Type != EventTypeHandlerPanic {
+			dispatch(h, Event{
+				Type:     EventTypeHandlerPanic,
+				Key:      ev.Type.String(),
+				Instance: ev.Instance,
+				Err:      fmt.Errorf("events handler panic: %v", r),
+			})
+		}
+	}()
+
+	h.OnEvent(ev)
+}
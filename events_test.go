@@ -0,0 +1,81 @@
+package svcutil
+
+import (
+	"testing"
+)
+
+func TestDispatchRecoversPanics(t *testing.T) {
+	tests := []struct {
+		name       string
+		panicOn    map[EventType]bool
+		wantEvents []EventType
+	}{
+		{
+			name:       "no panic",
+			wantEvents: []EventType{EventTypeSessionLost},
+		},
+		{
+			name:       "reported",
+			panicOn:    map[EventType]bool{EventTypeSessionLost: true},
+			wantEvents: []EventType{EventTypeSessionLost, EventTypeHandlerPanic},
+		},
+		{
+			name:       "report panics too",
+			panicOn:    map[EventType]bool{EventTypeSessionLost: true, EventTypeHandlerPanic: true},
+			wantEvents: []EventType{EventTypeSessionLost, EventTypeHandlerPanic},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []Event
+			h := EventsFunc(func(ev Event) {
+				got = append(got, ev)
+				if tt.panicOn[ev.Type] {
+					panic("boom")
+				}
+			})
+
+			dispatch(h, Event{Type: EventTypeSessionLost})
+
+			if len(got) != len(tt.wantEvents) {
+				t.Fatalf("got %d events, want %d", len(got), len(tt.wantEvents))
+			}
+
+			for n, ev := range got {
+				if ev.Type != tt.wantEvents[n] {
+					t.Errorf("event %d = %v, want %v", n, ev.Type, tt.wantEvents[n])
+				}
+			}
+
+			if len(got) > 1 && (got[1].Key != "EventTypeSessionLost" || got[1].Err == nil) {
+				t.Errorf("unexpected panic event %+v", got[1])
+			}
+		})
+	}
+}
+
+func TestSetEvents(t *testing.T) {
+	c := &Service{options: Instance("worker-1")(NewOptions())}
+
+	// no handler yet
+	c.emit(Event{Type: EventTypeSessionLost})
+
+	var first, second []Event
+	c.SetEvents(EventsFunc(func(ev Event) { first = append(first, ev) }))
+	c.emit(Event{Type: EventTypeSessionLost})
+
+	c.SetEvents(EventsFunc(func(ev Event) { second = append(second, ev) }))
+	c.emit(Event{Type: EventTypeSessionRestored})
+
+	c.SetEvents(nil)
+	c.emit(Event{Type: EventTypeSessionLost})
+
+	if len(first) != 1 || first[0].Type != EventTypeSessionLost || first[0].Instance != "worker-1" {
+		t.Errorf("first handler got %+v", first)
+	}
+
+	if len(second) != 1 || second[0].Type != EventTypeSessionRestored {
+		t.Errorf("second handler got %+v", second)
+	}
+}
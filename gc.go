@@ -0,0 +1,198 @@
+package svcutil
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// gcSuffix names the key under the service locks namespace recording GC checkpoints
+const gcSuffix = "/gc"
+
+// maxGCCheckpoints limits how many GC runs are remembered
+const maxGCCheckpoints = 64
+
+// gcCheckpoint maps a store revision to the time it was observed, etcd does not keep
+// modification times so the age of a key is derived from its revision
+type gcCheckpoint struct {
+	Time     time.Time `json:"time"`
+	Revision int64     `json:"revision"`
+}
+
+// gcRevision returns the newest checkpoint revision observed at least olderThan ago,
+// keys not modified after it are older than olderThan. Zero means no key is old enough.
+func gcRevision(checkpoints []gcCheckpoint, now time.Time, olderThan time.Duration) int64 {
+	var rev int64
+	for _, cp := range checkpoints {
+		if !cp.Time.After(now.Add(-olderThan)) && cp.Revision > rev {
+			rev = cp.Revision
+		}
+	}
+
+	return rev
+}
+
+// addGCCheckpoint appends a checkpoint dropping the oldest ones above the limit
+func addGCCheckpoint(checkpoints []gcCheckpoint, cp gcCheckpoint) []gcCheckpoint {
+	checkpoints = append(checkpoints, cp)
+	sort.Slice(checkpoints, func(a, b int) bool { return checkpoints[a].Revision < checkpoints[b].Revision })
+
+	if len(checkpoints) > maxGCCheckpoints {
+		checkpoints = checkpoints[len(checkpoints)-maxGCCheckpoints:]
+	}
+
+	return checkpoints
+}
+
+// gcPrefixes are the prefixes under the locks namespace of the service, and the shared
+// shadows of custom lease prefixes, whose keys are always attached to a lease or session,
+// an unleased key there is left over by a crashed process.
+// Other keys, e.g. reservations, subnet allocations or workflow checkpoints, legitimately
+// live without a lease and are never collected.
+func (c *Service) gcPrefixes() []string {
+	base := c.options.locksPrefix + c.options.serviceName
+	return []string{
+		base + c.options.mutexesPrefix,
+		base + c.options.idsPrefix,
+		base + c.options.hostsPrefix,
+		base + c.options.inventoryPrefix,
+		base + c.options.macsPrefix,
+		base + c.options.vlansPrefix,
+		base + c.options.loadPrefix,
+		base + c.options.rebalancePrefix,
+		base + c.options.tombstonesPrefix,
+		base + c.options.waitersPrefix,
+		base + c.options.transfersPrefix,
+		base + c.options.electionsPrefix,
+		base + presenceSegment,
+		base + drainSegment,
+		c.instanceKVPrefix(),
+		c.hostLocksPrefix(),
+		c.sharedShadowsPrefix() + c.options.tombstonesPrefix,
+		c.sharedShadowsPrefix() + c.options.waitersPrefix,
+		c.sharedShadowsPrefix() + c.options.transfersPrefix,
+		c.sharedShadowsPrefix() + c.options.loadPrefix,
+		c.sharedShadowsPrefix() + c.options.rebalancePrefix,
+	}
+}
+
+// GC finds keys of locks and leases of the service (see gcPrefixes) which are not attached
+// to a lease and were not modified for at least olderThan, such keys are left by crashed
+// processes of older versions. Unless dryRun is set the keys are deleted, a key modified in
+// the meantime is kept.
+//
+// etcd does not record modification times, so every GC run stores a checkpoint mapping the
+// current revision to the time and the age of a key is derived from those checkpoints. The
+// first run only records a checkpoint unless olderThan is zero, run GC periodically
+// (e.g. from a cron job) to collect keys.
+func (c *Service) GC(ctx context.Context, olderThan time.Duration, dryRun bool) ([]LockInfo, error) {
+	gcKey := c.options.locksPrefix + c.options.serviceName + gcSuffix
+
+	checkpoints, _, current, err := c.loadGCCheckpoints(ctx, gcKey)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	rev := current
+	if olderThan > 0 {
+		rev = gcRevision(checkpoints, now, olderThan)
+	}
+
+	var orphans []LockInfo
+	for _, prefix := range c.gcPrefixes() {
+		if rev == 0 {
+			// no key is old enough yet
+			break
+		}
+
+		err = c.WalkKeys(ctx, prefix, ListOptions{}, func(kv KeyValue) error {
+			if kv.Lease != 0 || kv.ModRevision > rev {
+				return nil
+			}
+
+			orphans = append(orphans, LockInfo{
+				Key:            kv.Key,
+				Value:          string(kv.Value),
+				TTL:            -1,
+				CreateRevision: kv.CreateRevision,
+				ModRevision:    kv.ModRevision,
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !dryRun {
+		deleted := orphans[:0]
+		for _, orphan := range orphans {
+			txn, err := c.etcd.Txn(ctx).
+				If(clientv3.Compare(clientv3.ModRevision(orphan.Key), "=", orphan.ModRevision)).
+				Then(clientv3.OpDelete(orphan.Key)).
+				Commit()
+			if err != nil {
+				return deleted, etcdError(err)
+			}
+
+			if txn.Succeeded {
+				deleted = append(deleted, orphan)
+			}
+		}
+		orphans = deleted
+	}
+
+	return orphans, c.saveGCCheckpoint(ctx, gcKey, gcCheckpoint{Time: now, Revision: current})
+}
+
+// loadGCCheckpoints returns the checkpoints, the mod revision of their key and the current
+// store revision
+func (c *Service) loadGCCheckpoints(ctx context.Context, gcKey string) ([]gcCheckpoint, int64, int64, error) {
+	resp, err := c.etcd.Get(ctx, gcKey)
+	if err != nil {
+		return nil, 0, 0, etcdError(err)
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, 0, resp.Header.Revision, nil
+	}
+
+	var checkpoints []gcCheckpoint
+	if err := json.Unmarshal(resp.Kvs[0].Value, &checkpoints); err != nil {
+		return nil, 0, 0, err
+	}
+
+	return checkpoints, resp.Kvs[0].ModRevision, resp.Header.Revision, nil
+}
+
+// saveGCCheckpoint adds the checkpoint, checkpoints added by concurrent GC runs are merged
+func (c *Service) saveGCCheckpoint(ctx context.Context, gcKey string, cp gcCheckpoint) error {
+	for {
+		checkpoints, modRev, _, err := c.loadGCCheckpoints(ctx, gcKey)
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(addGCCheckpoint(checkpoints, cp))
+		if err != nil {
+			return err
+		}
+
+		// a missing key has the mod revision zero
+		resp, err := c.etcd.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(gcKey), "=", modRev)).
+			Then(clientv3.OpPut(gcKey, string(data))).
+			Commit()
+		if err != nil {
+			return etcdError(err)
+		}
+
+		if resp.Succeeded {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package svcutil
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestGCRevision(t *testing.T) {
+	now := time.Now()
+	checkpoints := []gcCheckpoint{
+		{Time: now.Add(-3 * time.Hour), Revision: 100},
+		{Time: now.Add(-2 * time.Hour), Revision: 200},
+		{Time: now.Add(-time.Hour), Revision: 300},
+	}
+
+	tests := []struct {
+		olderThan time.Duration
+		want      int64
+	}{
+		{olderThan: 30 * time.Minute, want: 300},
+		{olderThan: time.Hour, want: 300},
+		{olderThan: 90 * time.Minute, want: 200},
+		{olderThan: 3 * time.Hour, want: 100},
+		{olderThan: 4 * time.Hour, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := gcRevision(checkpoints, now, tt.olderThan); got != tt.want {
+			t.Errorf("gcRevision(%s) = %d, want %d", tt.olderThan, got, tt.want)
+		}
+	}
+
+	if got := gcRevision(nil, now, time.Minute); got != 0 {
+		t.Errorf("gcRevision() without checkpoints = %d, want 0", got)
+	}
+}
+
+func TestAddGCCheckpoint(t *testing.T) {
+	var checkpoints []gcCheckpoint
+	for rev := int64(maxGCCheckpoints + 10); rev > 0; rev-- {
+		checkpoints = addGCCheckpoint(checkpoints, gcCheckpoint{Revision: rev})
+	}
+
+	if len(checkpoints) != maxGCCheckpoints {
+		t.Fatalf("len(checkpoints) = %d, want %d", len(checkpoints), maxGCCheckpoints)
+	}
+
+	for i := 1; i < len(checkpoints); i++ {
+		if checkpoints[i-1].Revision >= checkpoints[i].Revision {
+			t.Fatalf("checkpoints not sorted at %d: %v", i, checkpoints)
+		}
+	}
+}
+
+func TestGCAllowlist(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("api"), Instance("worker"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	orphan := "/lock/api/mutex/crashed/1"
+	kept := []string{
+		"/lock/api/reservation/id/7",
+		"/lock/api/unknown/state",
+	}
+	for _, key := range append([]string{orphan}, kept...) {
+		if _, err := svc.etcd.Put(ctx, key, "x"); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	collected, err := svc.GC(ctx, 0, false)
+	if err != nil {
+		t.Fatalf("GC() error = %v", err)
+	}
+	if len(collected) != 1 || collected[0].Key != orphan {
+		t.Errorf("GC() collected %v, want only %s", collected, orphan)
+	}
+
+	for _, key := range kept {
+		if resp, _ := svc.etcd.Get(ctx, key); len(resp.Kvs) != 1 {
+			t.Errorf("GC() deleted %s outside the lock and lease prefixes", key)
+		}
+	}
+}
+
+func TestGCCheckpoints(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("api"), Instance("worker"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	// concurrent runs don't overwrite each other's checkpoints
+	const runs = 5
+	var wg sync.WaitGroup
+	for n := 0; n < runs; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := svc.GC(ctx, time.Hour, true); err != nil {
+				t.Errorf("GC() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	gcKey := "/lock/api" + gcSuffix
+	checkpoints, _, _, err := svc.loadGCCheckpoints(ctx, gcKey)
+	if err != nil {
+		t.Fatalf("loadGCCheckpoints() error = %v", err)
+	}
+	if len(checkpoints) != runs {
+		t.Errorf("checkpoints = %d, want %d", len(checkpoints), runs)
+	}
+
+	if _, err := svc.etcd.Put(ctx, gcKey, "{corrupt"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if _, err := svc.GC(ctx, time.Hour, true); err == nil {
+		t.Errorf("GC() with corrupt checkpoints error = nil")
+	}
+}
@@ -0,0 +1,50 @@
+package svcutil
+
+import "sync"
+
+// ServiceGroup runs several logical services embedded in one binary over a single etcd
+// connection, see WithSharedClient. The first service added to the group owns the
+// connection, the others share it. Every service keeps its own session, so locks and
+// elections of different services exclude each other as if they ran in separate processes.
+type ServiceGroup struct {
+	options  []func(*options) *options
+	lock     sync.Mutex
+	services []*Service
+}
+
+// NewServiceGroup creates a group whose services are created with the given options,
+// e.g. endpoints and credentials, followed by their own ones
+func NewServiceGroup(opt ...func(*options) *options) *ServiceGroup {
+	return &ServiceGroup{options: opt}
+}
+
+// Add creates a service of the group, e.g. with its own name and prefixes
+func (g *ServiceGroup) Add(opt ...func(*options) *options) (*Service, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	opts := append(append([]func(*options) *options{}, g.options...), opt...)
+	if len(g.services) > 0 {
+		opts = append(opts, WithSharedClient(g.services[0]))
+	}
+
+	svc, err := NewService(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	g.services = append(g.services, svc)
+	return svc, nil
+}
+
+// Close closes the services of the group in reverse order, the owner of the connection last
+func (g *ServiceGroup) Close() {
+	g.lock.Lock()
+	services := g.services
+	g.services = nil
+	g.lock.Unlock()
+
+	for n := len(services) - 1; n >= 0; n-- {
+		services[n].Close()
+	}
+}
@@ -0,0 +1,82 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestServiceGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	group := NewServiceGroup(LocalBackend(t.TempDir()))
+	defer group.Close()
+
+	billing, err := group.Add(Name("billing"), Instance("billing-1"))
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	ledger, err := group.Add(Name("ledger"), Instance("ledger-1"))
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	if ledger.etcd != billing.etcd {
+		t.Errorf("services of the group use different clients")
+	}
+	if ledger.session.Lease() == billing.session.Lease() {
+		t.Errorf("services of the group share a session")
+	}
+
+	if _, err := billing.AcquireLock(ctx, "migration"); err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+	if _, err := ledger.AcquireLock(ctx, "migration"); err != nil {
+		t.Errorf("AcquireLock() of the same name in another service error = %v", err)
+	}
+}
+
+func TestServiceGroupGlobalLock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	group := NewServiceGroup(LocalBackend(t.TempDir()))
+	defer group.Close()
+
+	billing, err := group.Add(Name("billing"), Instance("billing-1"))
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	ledger, err := group.Add(Name("ledger"), Instance("ledger-1"))
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	if _, err := billing.AcquireScopedLock(ctx, LockScopeGlobal, "schema"); err != nil {
+		t.Fatalf("AcquireScopedLock() error = %v", err)
+	}
+
+	if _, err := ledger.AcquireScopedLock(ctx, LockScopeGlobal, "schema"); !errors.Is(err, ErrMutexAlreadyAcquired) {
+		t.Fatalf("AcquireScopedLock() of a lock held by another service of the group error = %v, want ErrMutexAlreadyAcquired", err)
+	}
+
+	// a failed attempt doesn't release the hold of the other service
+	if err := ledger.ReleaseScopedLock(ctx, LockScopeGlobal, "schema"); err != nil {
+		t.Fatalf("ReleaseScopedLock() error = %v", err)
+	}
+	if _, err := ledger.AcquireScopedLock(ctx, LockScopeGlobal, "schema"); !errors.Is(err, ErrMutexAlreadyAcquired) {
+		t.Errorf("AcquireScopedLock() after the other service released nothing error = %v, want ErrMutexAlreadyAcquired", err)
+	}
+
+	if err := billing.ReleaseScopedLock(ctx, LockScopeGlobal, "schema"); err != nil {
+		t.Fatalf("ReleaseScopedLock() error = %v", err)
+	}
+	if _, err := ledger.AcquireScopedLock(ctx, LockScopeGlobal, "schema"); err != nil {
+		t.Errorf("AcquireScopedLock() after the holder released the lock error = %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package svcutil
+
+import (
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// heartbeatPrefix is the prefix of heartbeat keys of all hosts running the service, they
+// are kept apart from the host config so config listings never see them
+func (c *Service) heartbeatPrefix(serviceName string) string {
+	return c.options.heartbeatsPrefix + serviceName + "/"
+}
+
+func (c *Service) heartbeatKey(serviceName, host string) string {
+	return c.heartbeatPrefix(serviceName) + host
+}
+
+// heartbeatTTL lets a heartbeat key outlive two missed beats
+func heartbeatTTL(interval time.Duration) int64 {
+	ttl := int64((3*interval + time.Second - 1) / time.Second)
+	if ttl < 1 {
+		ttl = 1
+	}
+
+	return ttl
+}
+
+// StartHeartbeat periodically writes the current time under the heartbeat key of the
+// host, the key lives on a lease and disappears shortly after the beats stop.
+// Heartbeats stop once the context is done or the service is closed.
+func (c *Service) StartHeartbeat(ctx context.Context, interval time.Duration) error {
+	key := c.heartbeatKey(c.options.serviceName, c.options.hostname)
+	ttl := heartbeatTTL(interval)
+
+	beat := func(lease clientv3.LeaseID) (clientv3.LeaseID, error) {
+		if lease != 0 {
+			if _, err := c.etcd.KeepAliveOnce(ctx, lease); err != nil {
+				lease = 0
+			}
+		}
+
+		if lease == 0 {
+			resp, err := c.etcd.Grant(ctx, ttl)
+			if err != nil {
+				return 0, err
+			}
+
+			lease = resp.ID
+		}
+
+		_, err := c.etcd.Put(ctx, key, time.Now().UTC().Format(time.RFC3339Nano), clientv3.WithLease(lease))
+		return lease, err
+	}
+
+	lease, err := beat(0)
+	if err != nil {
+		return err
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		tk := time.NewTicker(interval)
+		defer tk.Stop()
+
+		defer func() {
+			rctx, cancel := context.WithTimeout(context.Background(), c.options.etcdDialTimeout)
+			defer cancel()
+			c.etcd.Revoke(rctx, lease)
+		}()
+
+		for {
+			select {
+			case <-c.stopper:
+				return
+			case <-ctx.Done():
+				return
+			case <-tk.C:
+				// a failed beat is retried on the next tick with a new lease if needed
+				if next, err := beat(lease); err == nil {
+					lease = next
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// LastSeen returns the time of the last heartbeat of every live host running the service
+func (c *Service) LastSeen(ctx context.Context, serviceName string) (map[string]time.Time, error) {
+	prefix := c.heartbeatPrefix(serviceName)
+	resp, err := c.etcd.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]time.Time)
+	for _, kv := range resp.Kvs {
+		host := strings.TrimPrefix(string(kv.Key), prefix)
+		if host == "" || strings.Contains(host, "/") {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339Nano, string(kv.Value))
+		if err != nil {
+			continue
+		}
+
+		seen[host] = t
+	}
+
+	return seen, nil
+}
@@ -0,0 +1,52 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestHeartbeatTTL(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		want     int64
+	}{
+		{interval: 100 * time.Millisecond, want: 1},
+		{interval: time.Second, want: 3},
+		{interval: 1500 * time.Millisecond, want: 5},
+		{interval: time.Minute, want: 180},
+	}
+
+	for _, tt := range tests {
+		if got := heartbeatTTL(tt.interval); got != tt.want {
+			t.Errorf("heartbeatTTL(%v) = %d, want %d", tt.interval, got, tt.want)
+		}
+	}
+}
+
+func TestHeartbeatOutsideHostConfig(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("billing"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	if err := svc.StartHeartbeat(ctx, time.Second); err != nil {
+		t.Fatalf("StartHeartbeat() error = %v", err)
+	}
+
+	seen, err := svc.LastSeen(ctx, "billing")
+	if _, ok := seen[svc.options.hostname]; err != nil || len(seen) != 1 || !ok {
+		t.Errorf("LastSeen() = %v, %v, want the host", seen, err)
+	}
+
+	// the heartbeat is not a config value of the host
+	values, err := svc.LoadConfigMap(ctx, ConfigurationTypeHost)
+	if err != nil || len(values) != 0 {
+		t.Errorf("LoadConfigMap() of the host = %v, %v, want no values", values, err)
+	}
+}
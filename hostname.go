@@ -1,6 +1,8 @@
 package svcutil
 
 import (
+	"fmt"
+	"hash/fnv"
 	"net"
 	"os"
 	"strings"
@@ -24,11 +26,67 @@ func GetLocalIP() string {
 }
 
 func Hostname() string {
+	return sanitizeHostname(rawHostname())
+}
+
+// ShortHostname returns the host name up to the first dot, e.g. "node1" on a host named
+// "node1.dc1.example.com", see HostnameMode
+func ShortHostname() string {
+	hostname := rawHostname()
+	if net.ParseIP(hostname) != nil {
+		return hostname
+	}
+
+	short, _, _ := strings.Cut(hostname, ".")
+	return short
+}
+
+// FQDNHostname returns the fully qualified host name, the canonical name of the host
+// looked up in DNS when os.Hostname returns the short name, see HostnameMode. The short
+// name is returned if the lookup fails.
+func FQDNHostname() string {
+	return fqdn(rawHostname(), net.LookupCNAME)
+}
+
+func fqdn(hostname string, lookup func(host string) (string, error)) string {
+	if strings.Contains(hostname, ".") {
+		return hostname
+	}
+
+	cname, err := lookup(hostname)
+	if cname = strings.TrimSuffix(cname, "."); err != nil || cname == "" {
+		return hostname
+	}
+
+	return cname
+}
+
+// rawHostname is the host name before sanitization, the local IP if it is not available
+func rawHostname() string {
 	hostname, err := os.Hostname()
 	if err != nil {
 		hostname = GetLocalIP()
 	}
 
+	return hostname
+}
+
+// hashHostname sanitizes the host name and, if that changed it, appends a short hash of
+// the original, so "node-1" and "node.1" don't both become "node_1"
+func hashHostname(hostname string) string {
+	sanitized := sanitizeHostname(hostname)
+	if sanitized == hostname {
+		return sanitized
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(hostname))
+
+	return fmt.Sprintf("%s_%06x", sanitized, h.Sum32()&0xffffff)
+}
+
+// sanitizeHostname replaces characters used as separators in keys and IDs
+func sanitizeHostname(hostname string) string {
 	hostname = strings.Replace(hostname, "-", "_", -1)
 	hostname = strings.Replace(hostname, ".", "_", -1)
 	hostname = strings.Replace(hostname, "*", "_", -1)
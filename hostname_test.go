@@ -0,0 +1,60 @@
+package svcutil
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestHashHostname(t *testing.T) {
+	if got := hashHostname("node1"); got != "node1" {
+		t.Errorf("hashHostname(node1) = %q, want it unchanged", got)
+	}
+
+	dash, dot := hashHostname("node-1"), hashHostname("node.1")
+	if dash == dot || len(dash) != len("node_1_")+6 || dash[:7] != "node_1_" {
+		t.Errorf("hashHostname() = %q and %q, want distinct hashed names", dash, dot)
+	}
+
+	if hashHostname("node-1") != dash {
+		t.Errorf("hashHostname() is not stable")
+	}
+}
+
+func TestFQDN(t *testing.T) {
+	lookup := func(host string) (string, error) {
+		if host == "node1" {
+			return "node1.dc1.example.com.", nil
+		}
+		return "", errors.New("no such host")
+	}
+
+	tests := map[string]string{
+		"node1":                 "node1.dc1.example.com",
+		"node1.dc2.example.com": "node1.dc2.example.com",
+		"node2":                 "node2",
+	}
+
+	for hostname, want := range tests {
+		if got := fqdn(hostname, lookup); got != want {
+			t.Errorf("fqdn(%q) = %q, want %q", hostname, got, want)
+		}
+	}
+
+	if short := ShortHostname(); strings.Contains(short, ".") && net.ParseIP(short) == nil {
+		t.Errorf("ShortHostname() = %q, want no domain", short)
+	}
+}
+
+func TestHostnameMode(t *testing.T) {
+	svc, err := NewService(Name("api"), LocalBackend(t.TempDir()), HostnameMode(func() string { return "node1.dc1.example.com" }))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	if svc.options.hostname != "node1_dc1_example_com" || svc.options.rawHostname != "node1.dc1.example.com" {
+		t.Errorf("hostname = %q (%q), want the custom one", svc.options.hostname, svc.options.rawHostname)
+	}
+}
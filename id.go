@@ -1,29 +1,68 @@
 package svcutil
 
-import "fmt"
+import "strings"
+
+// DefaultIDFormat produces "hostname-service-id" identities
+const DefaultIDFormat = "{host}-{service}-{id}"
 
 type ID struct {
 	Hostname string
 	Service  string
+	Scope    string
 
 	Value string
 	ID    int
+
+	format  string
+	numbers NumberFormat
 }
 
 func NewID(id int, service string) ID {
+	return NewIDWithFormat(DefaultIDFormat, id, service, "")
+}
+
+// NewIDWithFormat creates an ID rendered with the format. The format may contain the
+// {host}, {service}, {id} and {scope} placeholders, an empty placeholder (zero id, no scope)
+// is dropped together with the separator preceding it, e.g. "{host}.{service}.{id}"
+func NewIDWithFormat(format string, id int, service string, scope string) ID {
+	return newIDWithHost(Hostname(), format, NumberFormat{}, id, service, scope)
+}
+
+func newIDWithHost(host string, format string, numbers NumberFormat, id int, service string, scope string) ID {
 	sid := ID{
-		Hostname: Hostname(),
+		Hostname: host,
 		ID:       id,
 		Service:  service,
+		Scope:    scope,
+		format:   format,
+		numbers:  numbers,
+	}
+
+	sid.Value = sid.render(sid.Hostname)
+	return sid
+}
+
+// scopedIDFormat makes sure the format includes the scope, it is placed in front of
+// the service reusing the separator the format already has next to the service
+func scopedIDFormat(format string) string {
+	if strings.Contains(format, "{scope}") {
+		return format
 	}
 
-	if sid.ID > 0 {
-		sid.Value = fmt.Sprintf("%s-%s-%d", sid.Hostname, service, sid.ID)
-	} else {
-		sid.Value = fmt.Sprintf("%s-%s", sid.Hostname, service)
+	n := strings.Index(format, "{service}")
+	if n < 0 {
+		return "{scope}-" + format
 	}
 
-	return sid
+	sep := "-"
+	before, after := format[:n], format[n+len("{service}"):]
+	if i := strings.LastIndexByte(before, '}'); i >= 0 && i+1 < len(before) {
+		sep = before[i+1:]
+	} else if i := strings.IndexByte(after, '{'); i > 0 {
+		sep = after[:i]
+	}
+
+	return format[:n] + "{scope}" + sep + format[n:]
 }
 
 func (sid ID) String() string {
@@ -35,9 +74,102 @@ func (sid ID) Int() int {
 }
 
 func (sid ID) Mask(mask string) string {
-	if sid.ID > 0 {
-		return fmt.Sprintf("%s-%s-%d", mask, sid.Service, sid.ID)
-	} else {
-		return fmt.Sprintf("%s-%s", mask, sid.Service)
+	return sid.render(mask)
+}
+
+func (sid ID) render(host string) string {
+	format := sid.format
+	if format == "" {
+		format = DefaultIDFormat
+	}
+
+	id := ""
+	if sid.ID != 0 {
+		id = sid.numbers.Format(int64(sid.ID))
 	}
+
+	return formatID(format, map[string]string{
+		"host":    host,
+		"service": sid.Service,
+		"id":      id,
+		"scope":   sid.Scope,
+	})
+}
+
+type idToken struct {
+	text        string
+	placeholder bool
+}
+
+func tokenizeID(format string, values map[string]string) []idToken {
+	var tokens []idToken
+	for format != "" {
+		start := strings.IndexByte(format, '{')
+		if start < 0 {
+			tokens = append(tokens, idToken{text: format})
+			break
+		}
+
+		end := strings.IndexByte(format[start:], '}')
+		if end < 0 {
+			tokens = append(tokens, idToken{text: format})
+			break
+		}
+
+		name := format[start+1 : start+end]
+		if _, ok := values[name]; !ok {
+			// unknown placeholders are kept as literal text
+			tokens = append(tokens, idToken{text: format[:start+end+1]})
+			format = format[start+end+1:]
+			continue
+		}
+
+		if start > 0 {
+			tokens = append(tokens, idToken{text: format[:start]})
+		}
+		tokens = append(tokens, idToken{text: name, placeholder: true})
+		format = format[start+end+1:]
+	}
+
+	return tokens
+}
+
+// formatID renders the format keeping literal text before the first and after the last
+// placeholder, separators between placeholders are kept only between non-empty values
+func formatID(format string, values map[string]string) string {
+	tokens := tokenizeID(format, values)
+
+	first, last := -1, -1
+	for n, t := range tokens {
+		if t.placeholder {
+			if first < 0 {
+				first = n
+			}
+			last = n
+		}
+	}
+
+	var b strings.Builder
+	var separator strings.Builder
+	started := false
+
+	for n, t := range tokens {
+		switch {
+		case n < first || first < 0 || n > last:
+			b.WriteString(t.text)
+		case !t.placeholder:
+			separator.WriteString(t.text)
+		case values[t.text] == "":
+			separator.Reset()
+		default:
+			if started {
+				b.WriteString(separator.String())
+			}
+			separator.Reset()
+			b.WriteString(values[t.text])
+			started = true
+		}
+	}
+
+	return b.String()
 }
@@ -0,0 +1,195 @@
+package svcutil
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestFormatID(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		values map[string]string
+		want   string
+	}{
+		{
+			name:   "default",
+			format: DefaultIDFormat,
+			values: map[string]string{"host": "h1", "service": "auth", "id": "3"},
+			want:   "h1-auth-3",
+		},
+		{
+			name:   "default without id",
+			format: DefaultIDFormat,
+			values: map[string]string{"host": "h1", "service": "auth", "id": ""},
+			want:   "h1-auth",
+		},
+		{
+			name:   "dot separated",
+			format: "{service}.{id}.{host}",
+			values: map[string]string{"host": "h1", "service": "auth", "id": "3"},
+			want:   "auth.3.h1",
+		},
+		{
+			name:   "empty in the middle",
+			format: "{host}.{scope}.{service}",
+			values: map[string]string{"host": "h1", "service": "auth", "scope": ""},
+			want:   "h1.auth",
+		},
+		{
+			name:   "empty first",
+			format: "{scope}/{service}",
+			values: map[string]string{"service": "auth", "scope": ""},
+			want:   "auth",
+		},
+		{
+			name:   "literal prefix and suffix",
+			format: "svc:{service}-{id}.local",
+			values: map[string]string{"service": "auth", "id": ""},
+			want:   "svc:auth.local",
+		},
+		{
+			name:   "unknown placeholder",
+			format: "{host}-{rack}",
+			values: map[string]string{"host": "h1"},
+			want:   "h1-{rack}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatID(tt.format, tt.values); got != tt.want {
+				t.Errorf("formatID(%q) = %q, want %q", tt.format, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIDMask(t *testing.T) {
+	sid := NewIDWithFormat("{service}.{id}.{host}", 4, "auth", "")
+	if got, want := sid.Mask("*"), "auth.4.*"; got != want {
+		t.Errorf("Mask() = %q, want %q", got, want)
+	}
+
+	sid = NewID(0, "auth")
+	if got, want := sid.Mask("node"), "node-auth"; got != want {
+		t.Errorf("Mask() = %q, want %q", got, want)
+	}
+}
+
+func TestScopedIDFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: DefaultIDFormat, want: "{host}-{scope}-{service}-{id}"},
+		{format: "{host}.{service}.{id}", want: "{host}.{scope}.{service}.{id}"},
+		{format: "{service}.{id}.{host}", want: "{scope}.{service}.{id}.{host}"},
+		{format: "{service}", want: "{scope}-{service}"},
+		{format: "{scope}:{service}", want: "{scope}:{service}"},
+		{format: "{host}", want: "{scope}-{host}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if got := scopedIDFormat(tt.format); got != tt.want {
+				t.Errorf("scopedIDFormat(%q) = %q, want %q", tt.format, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopedID(t *testing.T) {
+	c := &Service{options: Scope("blue")(Name("auth")(NewOptions()))}
+
+	sid := c.ScopedID("3")
+	if got, want := sid.Mask("*"), "*-blue-auth-3"; got != want {
+		t.Errorf("Mask() = %q, want %q", got, want)
+	}
+
+	if got, want := c.ID("3").Mask("*"), "*-auth-3"; got != want {
+		t.Errorf("ID().Mask() = %q, want %q", got, want)
+	}
+
+	c = &Service{options: Name("auth")(NewOptions())}
+	if got, want := c.ScopedID("3").Mask("*"), "*-auth-3"; got != want {
+		t.Errorf("unscoped Mask() = %q, want %q", got, want)
+	}
+}
+
+func TestNumberFormat(t *testing.T) {
+	tests := []struct {
+		format NumberFormat
+		id     int64
+		want   string
+	}{
+		{NumberFormat{}, 7, "7"},
+		{PaddedIDs(3), 7, "007"},
+		{PaddedIDs(3), 1234, "1234"},
+		{PaddedIDs(3), -7, "-07"},
+		{HexIDs(0), 255, "ff"},
+		{HexIDs(4), 26, "001a"},
+	}
+
+	for _, tt := range tests {
+		got := tt.format.Format(tt.id)
+		if got != tt.want {
+			t.Errorf("%+v.Format(%d) = %q, want %q", tt.format, tt.id, got, tt.want)
+		}
+
+		if id, err := tt.format.Parse(got); err != nil || id != tt.id {
+			t.Errorf("%+v.Parse(%q) = %d, %v, want %d", tt.format, got, id, err, tt.id)
+		}
+	}
+}
+
+func TestIDNumberFormat(t *testing.T) {
+	c := &Service{options: IDNumberFormat(HexIDs(2))(Name("auth")(NewOptions()))}
+
+	r, err := NewIDRange("9-11", RangeNumberFormat(HexIDs(2)))
+	if err != nil {
+		t.Fatalf("NewIDRange() error = %v", err)
+	}
+
+	if got := r.Values; len(got) != 3 || got[0] != "09" || got[2] != "0b" {
+		t.Fatalf("Values = %v, want 09, 0a and 0b", got)
+	}
+
+	sid := c.ID(r.Values[1])
+	if sid.ID != 10 {
+		t.Errorf("ID = %d, want 10", sid.ID)
+	}
+	if got, want := sid.Mask("*"), "*-auth-0a"; got != want {
+		t.Errorf("Mask() = %q, want %q", got, want)
+	}
+}
+
+func TestNegativeRangeID(t *testing.T) {
+	c := &Service{options: Scope("blue")(Name("auth")(NewOptions()))}
+
+	r, err := NewIDRange("-2..2", RangeNegativeIDs())
+	if err != nil {
+		t.Fatalf("NewIDRange() error = %v", err)
+	}
+
+	seen := map[string]string{}
+	for _, v := range r.Values {
+		sid := c.ID(v)
+		if got := strconv.Itoa(sid.ID); got != v {
+			t.Errorf("ID(%q).ID = %s", v, got)
+		}
+
+		mask := sid.Mask("*")
+		if prev, ok := seen[mask]; ok {
+			t.Errorf("ID(%q).Mask() = %q, same as ID(%q)", v, mask, prev)
+		}
+		seen[mask] = v
+	}
+
+	if got, want := c.ID("-2").Mask("*"), "*-auth--2"; got != want {
+		t.Errorf("ID().Mask() = %q, want %q", got, want)
+	}
+	if got, want := c.ScopedID("-2").Mask("*"), "*-blue-auth--2"; got != want {
+		t.Errorf("ScopedID().Mask() = %q, want %q", got, want)
+	}
+}
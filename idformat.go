@@ -0,0 +1,99 @@
+package svcutil
+
+import (
+	"strconv"
+	"strings"
+)
+
+// NumberFormat renders numeric IDs, e.g. to match external naming conventions of managed
+// components. The zero value renders plain decimal numbers, PaddedIDs and HexIDs create
+// the other formats.
+type NumberFormat struct {
+	// hex renders hexadecimal digits in lower case instead of decimal ones
+	hex bool
+	// width pads numbers with leading zeros, e.g. 3 renders 1 as "001"
+	width int
+}
+
+// PaddedIDs renders decimal IDs padded with zeros to the width
+func PaddedIDs(width int) NumberFormat {
+	return NumberFormat{width: width}
+}
+
+// HexIDs renders hexadecimal IDs padded with zeros to the width, 0 for no padding
+func HexIDs(width int) NumberFormat {
+	return NumberFormat{hex: true, width: width}
+}
+
+func (f NumberFormat) base() int {
+	if f.hex {
+		return 16
+	}
+
+	return 10
+}
+
+// Format renders the ID, the padding goes after the sign of negative IDs
+func (f NumberFormat) Format(id int64) string {
+	s := strconv.FormatInt(id, f.base())
+	if len(s) >= f.width {
+		return s
+	}
+
+	if id < 0 {
+		return "-" + strings.Repeat("0", f.width-len(s)) + s[1:]
+	}
+
+	return strings.Repeat("0", f.width-len(s)) + s
+}
+
+// Parse reads an ID rendered with Format, padding is optional
+func (f NumberFormat) Parse(s string) (int64, error) {
+	return strconv.ParseInt(s, f.base(), 64)
+}
+
+type rangeOptions struct {
+	numbers  NumberFormat
+	maxSize  int
+	negative bool
+}
+
+// RangeOption customizes ranges created by NewIDRange, NewWeightedIDRange and the other
+// range constructors
+type RangeOption func(*rangeOptions) *rangeOptions
+
+// RangeNumberFormat renders the IDs of the range with the format, the values are used
+// as lease keys and returned by Lease.Obtain
+func RangeNumberFormat(f NumberFormat) RangeOption {
+	return func(o *rangeOptions) *rangeOptions {
+		o.numbers = f
+		return o
+	}
+}
+
+// RangeMaxSize sets the maximum number of values the range expands to,
+// DefaultMaxRangeSize by default. Options not applying to a range type are ignored.
+func RangeMaxSize(n int) RangeOption {
+	return func(o *rangeOptions) *rangeOptions {
+		o.maxSize = n
+		return o
+	}
+}
+
+// RangeNegativeIDs accepts negative IDs, e.g. "-5..5", for systems using signed
+// identifiers. Without it a negative ID makes the range invalid.
+func RangeNegativeIDs() RangeOption {
+	return func(o *rangeOptions) *rangeOptions {
+		o.negative = true
+		return o
+	}
+}
+
+func newRangeOptions(opts []RangeOption) *rangeOptions {
+	o := &rangeOptions{maxSize: DefaultMaxRangeSize}
+	for _, decorator := range opts {
+		o = decorator(o)
+	}
+
+	return o
+}
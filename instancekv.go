@@ -0,0 +1,127 @@
+package svcutil
+
+import (
+	"errors"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+var ErrInstanceKeyNotFound = errors.New("instance key not found")
+
+const instanceKVSegment = "/instance/"
+
+// InstanceKV is the scratch space of the instance for ephemeral runtime info, e.g. current
+// assignments or queue depths. Its keys are attached to the service session, so they are
+// removed when the instance dies and published again after a lost session is restored.
+type InstanceKV struct {
+	client *Service
+}
+
+// InstanceKV returns the scratch space of the instance
+func (c *Service) InstanceKV() *InstanceKV {
+	return &InstanceKV{client: c}
+}
+
+func (c *Service) instanceKVPrefix() string {
+	return c.options.locksPrefix + c.options.serviceName + instanceKVSegment
+}
+
+func (c *Service) instanceKVKey(key string) string {
+	return c.instanceKVPrefix() + c.options.instance + "/" + key
+}
+
+// Put sets the key of the instance, it is kept until deleted or the instance dies
+func (kv *InstanceKV) Put(ctx context.Context, key, value string) error {
+	c := kv.client
+
+	c.instanceKVMu.Lock()
+	if c.instanceKV == nil {
+		c.instanceKV = make(map[string]string)
+	}
+	c.instanceKV[key] = value
+	c.instanceKVMu.Unlock()
+
+	return c.publishInstanceKV(ctx, key, value)
+}
+
+// Get returns the value of the key of the instance, it fails with ErrInstanceKeyNotFound
+// if the key is not set
+func (kv *InstanceKV) Get(ctx context.Context, key string) (string, error) {
+	resp, err := kv.client.etcd.Get(ctx, kv.client.instanceKVKey(key))
+	if err != nil {
+		return "", etcdError(err)
+	}
+
+	if len(resp.Kvs) == 0 {
+		return "", ErrInstanceKeyNotFound
+	}
+
+	return string(resp.Kvs[0].Value), nil
+}
+
+// Delete removes the key of the instance
+func (kv *InstanceKV) Delete(ctx context.Context, key string) error {
+	c := kv.client
+
+	c.instanceKVMu.Lock()
+	delete(c.instanceKV, key)
+	c.instanceKVMu.Unlock()
+
+	_, err := c.etcd.Delete(ctx, kv.client.instanceKVKey(key))
+	return etcdError(err)
+}
+
+// Fleet returns the keys of all live instances of the service by instance
+func (kv *InstanceKV) Fleet(ctx context.Context) (map[string]map[string]string, error) {
+	prefix := kv.client.instanceKVPrefix()
+	resp, err := kv.client.etcd.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, etcdError(err)
+	}
+
+	fleet := make(map[string]map[string]string)
+	for _, item := range resp.Kvs {
+		instance, key, ok := strings.Cut(strings.TrimPrefix(string(item.Key), prefix), "/")
+		if !ok {
+			continue
+		}
+
+		if fleet[instance] == nil {
+			fleet[instance] = make(map[string]string)
+		}
+		fleet[instance][key] = string(item.Value)
+	}
+
+	return fleet, nil
+}
+
+func (c *Service) publishInstanceKV(ctx context.Context, key, value string) error {
+	c.lock.Lock()
+	session := c.session
+	c.lock.Unlock()
+
+	if session == nil {
+		return ErrSessionNotAvailable
+	}
+
+	_, err := c.etcd.Put(ctx, c.instanceKVKey(key), value, clientv3.WithLease(session.Lease()))
+	return etcdError(err)
+}
+
+// restoreInstanceKV publishes the keys of the instance again once a lost session is recreated
+func (c *Service) restoreInstanceKV() {
+	c.instanceKVMu.Lock()
+	entries := make(map[string]string, len(c.instanceKV))
+	for key, value := range c.instanceKV {
+		entries[key] = value
+	}
+	c.instanceKVMu.Unlock()
+
+	for key, value := range entries {
+		ctx, cancel := context.WithTimeout(context.Background(), c.options.etcdDialTimeout)
+		c.publishInstanceKV(ctx, key, value)
+		cancel()
+	}
+}
@@ -0,0 +1,59 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestInstanceKV(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	worker, err := NewService(Name("api"), Instance("worker"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+
+	observer, err := NewService(Name("api"), Instance("observer"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer observer.Close()
+
+	kv := worker.InstanceKV()
+	if err := kv.Put(ctx, "queue/depth", "42"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := kv.Put(ctx, "assignment", "shard-7"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	if value, err := kv.Get(ctx, "queue/depth"); err != nil || value != "42" {
+		t.Errorf("Get() = %q, %v, want 42", value, err)
+	}
+
+	if err := kv.Delete(ctx, "assignment"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := kv.Get(ctx, "assignment"); !errors.Is(err, ErrInstanceKeyNotFound) {
+		t.Errorf("Get() of a deleted key error = %v, want ErrInstanceKeyNotFound", err)
+	}
+
+	fleet, err := observer.InstanceKV().Fleet(ctx)
+	if err != nil {
+		t.Fatalf("Fleet() error = %v", err)
+	}
+	if len(fleet) != 1 || len(fleet["worker"]) != 1 || fleet["worker"]["queue/depth"] != "42" {
+		t.Errorf("Fleet() = %v, want the queue depth of the worker", fleet)
+	}
+
+	worker.Close()
+
+	if fleet, _ := observer.InstanceKV().Fleet(ctx); len(fleet) != 0 {
+		t.Errorf("Fleet() = %v after the worker stopped, want no keys", fleet)
+	}
+}
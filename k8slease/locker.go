@@ -0,0 +1,438 @@
+// Package k8slease implements svcutil locks on Kubernetes coordination.k8s.io Lease
+// objects, for clusters where services are not allowed to access etcd directly.
+package k8slease
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/potakhov/svcutil"
+	"golang.org/x/net/context"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+var ErrNamespaceNotSpecified = errors.New("namespace is not specified")
+
+type options struct {
+	namespace     string
+	identity      string
+	prefix        string
+	leaseDuration time.Duration
+	renewDeadline time.Duration
+	retryPeriod   time.Duration
+	waitTimeout   time.Duration
+}
+
+func newOptions() *options {
+	k := svcutil.KubernetesEnv()
+
+	identity := k.Pod
+	if identity == "" {
+		identity = svcutil.Hostname()
+	}
+
+	return &options{
+		namespace:     k.Namespace,
+		identity:      identity,
+		leaseDuration: 15 * time.Second,
+		renewDeadline: 10 * time.Second,
+		retryPeriod:   2 * time.Second,
+	}
+}
+
+// Namespace sets the namespace of the Lease objects, defaults to POD_NAMESPACE
+func Namespace(ns string) func(*options) *options {
+	return func(l *options) *options {
+		l.namespace = ns
+		return l
+	}
+}
+
+// Identity sets the holder identity written to the Lease objects, defaults to POD_NAME
+// or the hostname
+func Identity(id string) func(*options) *options {
+	return func(l *options) *options {
+		l.identity = id
+		return l
+	}
+}
+
+// Prefix is prepended to lock names to form the names of the Lease objects
+func Prefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.prefix = p
+		return l
+	}
+}
+
+// LeaseDuration sets how long a lease which is not renewed is honored by other holders
+func LeaseDuration(d time.Duration) func(*options) *options {
+	return func(l *options) *options {
+		l.leaseDuration = d
+		return l
+	}
+}
+
+// RenewDeadline sets how long the holder keeps retrying to renew the lease before the
+// lock is considered lost, it must be shorter than the lease duration
+func RenewDeadline(d time.Duration) func(*options) *options {
+	return func(l *options) *options {
+		l.renewDeadline = d
+		return l
+	}
+}
+
+// RetryPeriod sets the interval between renewals and between attempts to acquire a lock
+func RetryPeriod(d time.Duration) func(*options) *options {
+	return func(l *options) *options {
+		l.retryPeriod = d
+		return l
+	}
+}
+
+// WaitTimeout makes AcquireLock wait up to the timeout for a lock held by another holder
+// instead of failing immediately, same as svcutil.LockWaitTimeout
+func WaitTimeout(d time.Duration) func(*options) *options {
+	return func(l *options) *options {
+		l.waitTimeout = d
+		return l
+	}
+}
+
+type lockRecord struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	donec  chan struct{}
+	// renewed is the renew time last written by this holder, it tells the lease apart
+	// from one taken by another process with the same identity
+	renewed *metav1.MicroTime
+}
+
+// Locker implements svcutil.Locker on Lease objects. A lock is held by writing the
+// identity of the holder to the Lease and renewing it every retry period, the lock is
+// lost once the lease could not be renewed within the renew deadline.
+type Locker struct {
+	client  kubernetes.Interface
+	options *options
+
+	mu    sync.Mutex
+	locks map[string]*lockRecord
+}
+
+var _ svcutil.Locker = (*Locker)(nil)
+
+func NewLocker(client kubernetes.Interface, opt ...func(*options) *options) (*Locker, error) {
+	o := newOptions()
+
+	for _, decorator := range opt {
+		o = decorator(o)
+	}
+
+	if o.namespace == "" {
+		return nil, ErrNamespaceNotSpecified
+	}
+
+	return &Locker{
+		client:  client,
+		options: o,
+		locks:   make(map[string]*lockRecord),
+	}, nil
+}
+
+// NewInClusterLocker creates a Locker using the service account of the pod
+func NewInClusterLocker(opt ...func(*options) *options) (*Locker, error) {
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLocker(client, opt...)
+}
+
+func (l *Locker) leaseName(name string) string {
+	return l.options.prefix + name
+}
+
+// AcquireLock acquires the named lock. Unless WaitTimeout is set, a lock held by another
+// holder fails with an error matching svcutil.ErrMutexAlreadyAcquired.
+func (l *Locker) AcquireLock(ctx context.Context, name string) (<-chan struct{}, error) {
+	key := l.leaseName(name)
+
+	donec, err := l.acquireLock(ctx, key)
+	if err != nil {
+		return nil, &svcutil.LockError{Key: key, Op: "acquire", Err: err}
+	}
+
+	return donec, nil
+}
+
+func (l *Locker) acquireLock(ctx context.Context, key string) (<-chan struct{}, error) {
+	l.mu.Lock()
+	_, ok := l.locks[key]
+	l.mu.Unlock()
+	if ok {
+		return nil, svcutil.ErrMutexAlreadyAcquired
+	}
+
+	renewed, err := l.waitLease(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	rctx, cancel := context.WithCancel(context.Background())
+	rec := &lockRecord{
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		donec:   make(chan struct{}),
+		renewed: renewed,
+	}
+
+	l.mu.Lock()
+	l.locks[key] = rec
+	l.mu.Unlock()
+
+	go l.renew(rctx, key, rec)
+
+	return rec.donec, nil
+}
+
+// waitLease makes attempts to take the lease until it is taken or the wait timeout passes,
+// it returns the renew time written taking it
+func (l *Locker) waitLease(ctx context.Context, key string) (*metav1.MicroTime, error) {
+	var deadline <-chan time.Time
+	if l.options.waitTimeout > 0 {
+		timer := time.NewTimer(l.options.waitTimeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		renewed, err := l.tryAcquire(ctx, key, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if renewed != nil {
+			return renewed, nil
+		}
+
+		if deadline == nil {
+			return nil, svcutil.ErrMutexAlreadyAcquired
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline:
+			return nil, svcutil.ErrLockWaitTimeout
+		case <-time.After(l.options.retryPeriod):
+		}
+	}
+}
+
+// tryAcquire takes the lease if it is free, expired or still holds the renew time this
+// holder wrote last (nil when acquiring) and returns the renew time written, nil if the
+// lease is held by someone else. Concurrent attempts are resolved by the resource version
+// of the Lease object.
+func (l *Locker) tryAcquire(ctx context.Context, key string, renewed *metav1.MicroTime) (*metav1.MicroTime, error) {
+	leases := l.client.CoordinationV1().Leases(l.options.namespace)
+	now := metav1.NewMicroTime(time.Now())
+
+	lease, err := leases.Get(ctx, key, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Name: key, Namespace: l.options.namespace}}
+		l.hold(lease, now)
+
+		lease, err = leases.Create(ctx, lease, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return nil, nil
+		}
+
+		return renewTime(lease, err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !l.available(lease, renewed, now.Time) {
+		return nil, nil
+	}
+
+	if holder(lease) != l.options.identity {
+		transitions := int32(1)
+		if lease.Spec.LeaseTransitions != nil {
+			transitions += *lease.Spec.LeaseTransitions
+		}
+		lease.Spec.LeaseTransitions = &transitions
+	}
+	l.hold(lease, now)
+
+	lease, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return nil, nil
+	}
+
+	return renewTime(lease, err)
+}
+
+// renewTime returns the renew time stored by the API server, it may be truncated
+// compared to the one written
+func renewTime(lease *coordinationv1.Lease, err error) (*metav1.MicroTime, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return lease.Spec.RenewTime, nil
+}
+
+// available reports whether the lease may be taken by this holder. A lease of the same
+// identity is only ours if it still holds the renew time we wrote, otherwise another
+// process with the same identity holds it.
+func (l *Locker) available(lease *coordinationv1.Lease, renewed *metav1.MicroTime, now time.Time) bool {
+	h := holder(lease)
+	if h == "" || lease.Spec.RenewTime == nil {
+		return true
+	}
+
+	if h == l.options.identity && renewed != nil && lease.Spec.RenewTime.Equal(renewed) {
+		return true
+	}
+
+	duration := l.options.leaseDuration
+	if lease.Spec.LeaseDurationSeconds != nil {
+		duration = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	}
+
+	return now.After(lease.Spec.RenewTime.Add(duration))
+}
+
+func (l *Locker) hold(lease *coordinationv1.Lease, now metav1.MicroTime) {
+	identity := l.options.identity
+	seconds := int32(l.options.leaseDuration.Seconds())
+
+	if holder(lease) != identity {
+		lease.Spec.AcquireTime = &now
+	}
+	lease.Spec.HolderIdentity = &identity
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.RenewTime = &now
+}
+
+func holder(lease *coordinationv1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+
+	return *lease.Spec.HolderIdentity
+}
+
+// renew keeps the lease renewed until the lock is released or lost
+func (l *Locker) renew(ctx context.Context, key string, rec *lockRecord) {
+	defer close(rec.done)
+
+	renewed := time.Now()
+	tk := time.NewTicker(l.options.retryPeriod)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+		}
+
+		rctx, cancel := context.WithTimeout(ctx, l.options.renewDeadline)
+		stored, err := l.tryAcquire(rctx, key, rec.renewed)
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if stored != nil {
+			rec.renewed = stored
+			renewed = time.Now()
+			continue
+		}
+
+		// the lease was taken over or could not be renewed in time
+		if err == nil || time.Since(renewed) > l.options.renewDeadline {
+			l.mu.Lock()
+			owned := l.locks[key] == rec
+			if owned {
+				delete(l.locks, key)
+			}
+			l.mu.Unlock()
+
+			// otherwise the lock is being released and the channel is closed by ReleaseLock
+			if owned {
+				close(rec.donec)
+			}
+			return
+		}
+	}
+}
+
+// ReleaseLock releases the named lock, clearing the holder of the Lease so other holders
+// do not have to wait for it to expire
+func (l *Locker) ReleaseLock(ctx context.Context, name string) error {
+	key := l.leaseName(name)
+
+	if err := l.releaseLock(ctx, key); err != nil {
+		return &svcutil.LockError{Key: key, Op: "release", Err: err}
+	}
+
+	return nil
+}
+
+func (l *Locker) releaseLock(ctx context.Context, key string) error {
+	l.mu.Lock()
+	rec, ok := l.locks[key]
+	delete(l.locks, key)
+	l.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	rec.cancel()
+	<-rec.done
+	close(rec.donec)
+
+	leases := l.client.CoordinationV1().Leases(l.options.namespace)
+	lease, err := leases.Get(ctx, key, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	// the lease was taken over, possibly by another process with the same identity
+	if holder(lease) != l.options.identity || lease.Spec.RenewTime == nil || !lease.Spec.RenewTime.Equal(rec.renewed) {
+		return nil
+	}
+
+	empty := ""
+	lease.Spec.HolderIdentity = &empty
+	lease.Spec.AcquireTime = nil
+	lease.Spec.RenewTime = nil
+
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return nil
+	}
+
+	return err
+}
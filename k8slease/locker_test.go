@@ -0,0 +1,138 @@
+package k8slease
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/potakhov/svcutil"
+	"golang.org/x/net/context"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLocker(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx := context.Background()
+
+	a, err := NewLocker(client, Namespace("jobs"), Identity("a"), Prefix("billing-"))
+	if err != nil {
+		t.Fatalf("NewLocker() error = %v", err)
+	}
+	b, _ := NewLocker(client, Namespace("jobs"), Identity("b"), Prefix("billing-"))
+
+	donec, err := a.AcquireLock(ctx, "migration")
+	if err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	if _, err := b.AcquireLock(ctx, "migration"); !errors.Is(err, svcutil.ErrMutexAlreadyAcquired) {
+		t.Fatalf("AcquireLock() by another holder error = %v, want %v", err, svcutil.ErrMutexAlreadyAcquired)
+	}
+
+	lease, err := client.CoordinationV1().Leases("jobs").Get(ctx, "billing-migration", metav1.GetOptions{})
+	if err != nil || holder(lease) != "a" {
+		t.Fatalf("lease holder = %q, %v, want %q", holder(lease), err, "a")
+	}
+
+	if err := a.ReleaseLock(ctx, "migration"); err != nil {
+		t.Fatalf("ReleaseLock() error = %v", err)
+	}
+
+	select {
+	case <-donec:
+	default:
+		t.Error("lock channel is not closed after release")
+	}
+
+	if _, err := b.AcquireLock(ctx, "migration"); err != nil {
+		t.Fatalf("AcquireLock() after release error = %v", err)
+	}
+	b.ReleaseLock(ctx, "migration")
+}
+
+func TestLockerExpired(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx := context.Background()
+
+	a, _ := NewLocker(client, Namespace("jobs"), Identity("a"))
+	b, _ := NewLocker(client, Namespace("jobs"), Identity("b"), WaitTimeout(time.Second), RetryPeriod(10*time.Millisecond))
+
+	if _, err := a.AcquireLock(ctx, "migration"); err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	// stop renewing without releasing, as a crashed holder would
+	a.mu.Lock()
+	rec := a.locks["migration"]
+	a.mu.Unlock()
+	rec.cancel()
+	<-rec.done
+
+	leases := client.CoordinationV1().Leases("jobs")
+	lease, _ := leases.Get(ctx, "migration", metav1.GetOptions{})
+	expired := metav1.NewMicroTime(time.Now().Add(-time.Minute))
+	lease.Spec.RenewTime = &expired
+	leases.Update(ctx, lease, metav1.UpdateOptions{})
+
+	if _, err := b.AcquireLock(ctx, "migration"); err != nil {
+		t.Fatalf("AcquireLock() of an expired lease error = %v", err)
+	}
+
+	lease, _ = leases.Get(ctx, "migration", metav1.GetOptions{})
+	if holder(lease) != "b" || lease.Spec.LeaseTransitions == nil || *lease.Spec.LeaseTransitions != 1 {
+		t.Errorf("lease holder = %q, transitions = %v", holder(lease), lease.Spec.LeaseTransitions)
+	}
+	b.ReleaseLock(ctx, "migration")
+}
+
+func TestLockerSameIdentity(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx := context.Background()
+
+	// two processes of a pod restarted in place share the identity
+	a, _ := NewLocker(client, Namespace("jobs"), Identity("pod-0"), RetryPeriod(10*time.Millisecond))
+	b, _ := NewLocker(client, Namespace("jobs"), Identity("pod-0"), RetryPeriod(10*time.Millisecond))
+
+	donec, err := a.AcquireLock(ctx, "migration")
+	if err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	if _, err := b.AcquireLock(ctx, "migration"); !errors.Is(err, svcutil.ErrMutexAlreadyAcquired) {
+		t.Fatalf("AcquireLock() by the same identity error = %v, want %v", err, svcutil.ErrMutexAlreadyAcquired)
+	}
+
+	// the holder keeps renewing its lease
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-donec:
+		t.Fatal("lock lost while renewing")
+	default:
+	}
+
+	// a release by the other process does not clear the lease it never held
+	if err := b.ReleaseLock(ctx, "migration"); err != nil {
+		t.Fatalf("ReleaseLock() error = %v", err)
+	}
+	lease, err := client.CoordinationV1().Leases("jobs").Get(ctx, "migration", metav1.GetOptions{})
+	if err != nil || holder(lease) != "pod-0" || lease.Spec.RenewTime == nil {
+		t.Fatalf("lease after a foreign release = %+v, %v", lease, err)
+	}
+
+	if err := a.ReleaseLock(ctx, "migration"); err != nil {
+		t.Fatalf("ReleaseLock() error = %v", err)
+	}
+	if _, err := b.AcquireLock(ctx, "migration"); err != nil {
+		t.Fatalf("AcquireLock() after release error = %v", err)
+	}
+	b.ReleaseLock(ctx, "migration")
+}
+
+func TestNewLockerNamespace(t *testing.T) {
+	t.Setenv("POD_NAMESPACE", "")
+
+	if _, err := NewLocker(fake.NewSimpleClientset()); err != ErrNamespaceNotSpecified {
+		t.Errorf("NewLocker() error = %v, want %v", err, ErrNamespaceNotSpecified)
+	}
+}
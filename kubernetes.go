@@ -0,0 +1,72 @@
+package svcutil
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var ErrNoStatefulSetOrdinal = errors.New("pod name has no StatefulSet ordinal")
+var ErrOrdinalLease = errors.New("value is taken from the StatefulSet ordinal and not leased in etcd")
+
+// KubernetesInfo is the identity of the pod exposed through the downward API
+type KubernetesInfo struct {
+	Pod       string
+	Namespace string
+	Node      string
+}
+
+// KubernetesEnv reads the pod identity from the POD_NAME, POD_NAMESPACE and NODE_NAME
+// environment variables, which are expected to be populated by the downward API
+func KubernetesEnv() KubernetesInfo {
+	return KubernetesInfo{
+		Pod:       os.Getenv("POD_NAME"),
+		Namespace: os.Getenv("POD_NAMESPACE"),
+		Node:      os.Getenv("NODE_NAME"),
+	}
+}
+
+// Ordinal returns the ordinal suffix of a StatefulSet pod name, e.g. 2 for "billing-2"
+func (k KubernetesInfo) Ordinal() (int, bool) {
+	n := strings.LastIndexByte(k.Pod, '-')
+	if n < 0 {
+		return 0, false
+	}
+
+	ordinal, err := strconv.Atoi(k.Pod[n+1:])
+	if err != nil || ordinal < 0 || k.Pod[n+1] == '+' {
+		return 0, false
+	}
+
+	return ordinal, true
+}
+
+func (o *options) applyKubernetes(k KubernetesInfo) error {
+	if k.Pod != "" {
+		o.hostname = sanitizeHostname(k.Pod)
+		o.rawHostname = k.Pod
+		if o.instance == "" {
+			o.instance = k.Pod
+		}
+	}
+
+	if o.serviceScope == "" {
+		o.serviceScope = k.Namespace
+	}
+
+	if o.statefulSetIDs {
+		ordinal, ok := k.Ordinal()
+		if !ok {
+			return ErrNoStatefulSetOrdinal
+		}
+		o.ordinal = ordinal
+	}
+
+	return nil
+}
+
+// Ordinal returns the StatefulSet ordinal of the instance when StatefulSetIDs is enabled
+func (c *Service) Ordinal() (int, bool) {
+	return c.options.ordinal, c.options.ordinal >= 0
+}
@@ -0,0 +1,83 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestKubernetesOrdinal(t *testing.T) {
+	tests := []struct {
+		pod     string
+		ordinal int
+		ok      bool
+	}{
+		{"billing-2", 2, true},
+		{"billing-api-0", 0, true},
+		{"billing-7d9f8c-x2k4p", 0, false},
+		{"billing-+1", 0, false},
+		{"billing", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pod, func(t *testing.T) {
+			ordinal, ok := KubernetesInfo{Pod: tt.pod}.Ordinal()
+			if ordinal != tt.ordinal || ok != tt.ok {
+				t.Errorf("Ordinal() = %d, %v, want %d, %v", ordinal, ok, tt.ordinal, tt.ok)
+			}
+		})
+	}
+}
+
+func TestApplyKubernetes(t *testing.T) {
+	o := StatefulSetIDs()(Name("billing")(NewOptions()))
+	if err := o.applyKubernetes(KubernetesInfo{Pod: "billing-3", Namespace: "payments", Node: "node-a"}); err != nil {
+		t.Fatalf("applyKubernetes() error = %v", err)
+	}
+
+	if o.hostname != "billing_3" || o.instance != "billing-3" || o.serviceScope != "payments" || o.ordinal != 3 {
+		t.Errorf("applyKubernetes() = hostname %q, instance %q, scope %q, ordinal %d", o.hostname, o.instance, o.serviceScope, o.ordinal)
+	}
+
+	o = StatefulSetIDs()(Scope("blue")(NewOptions()))
+	if err := o.applyKubernetes(KubernetesInfo{Pod: "billing-7d9f8c-x2k4p", Namespace: "payments"}); err != ErrNoStatefulSetOrdinal {
+		t.Errorf("applyKubernetes() error = %v, want %v", err, ErrNoStatefulSetOrdinal)
+	}
+
+	if o.serviceScope != "blue" {
+		t.Errorf("scope = %q, want %q", o.serviceScope, "blue")
+	}
+}
+
+func TestOrdinalLease(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("billing"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+	svc.options.ordinal = 1
+
+	r, _ := NewIDRange("10-12")
+	l := NewLeaseWithOptions(r, svc)
+	defer l.Close()
+
+	if id, err := l.Obtain(ctx); err != nil || id != "11" {
+		t.Fatalf("Obtain() = %q, %v, want the value at the ordinal", id, err)
+	}
+
+	if rev := l.Revision(); rev != 0 {
+		t.Errorf("Revision() = %d, want 0", rev)
+	}
+	if _, err := l.Verify(ctx); !errors.Is(err, ErrOrdinalLease) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrOrdinalLease)
+	}
+	if err := l.TransferTo(ctx, "billing-2"); !errors.Is(err, ErrOrdinalLease) {
+		t.Errorf("TransferTo() error = %v, want %v", err, ErrOrdinalLease)
+	}
+}
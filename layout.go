@@ -0,0 +1,71 @@
+package svcutil
+
+// KeyLayout describes the effective etcd key prefixes used by the service
+type KeyLayout struct {
+	Tenant       string
+	Config       string
+	ScopeConfig  string
+	HostConfig   string
+	Heartbeat    string
+	Status       string
+	Mutexes      string
+	ScopedLocks  string
+	IDs          string
+	IPs          string
+	Inventory    string
+	MACs         string
+	VLANs        string
+	Subnets      string
+	Ranges       string
+	Load         string
+	Rebalance    string
+	Tombstones   string
+	Reservations string
+	Waiters      string
+	Transfers    string
+	Topics       string
+	Commands     string
+	Presence     string
+	InstanceKV   string
+	Transactions string
+	Workflows    string
+	Elections    string
+	Maintenance  string
+}
+
+// KeyLayout returns the effective key layout of the service including the tenant segment
+func (c *Service) KeyLayout() KeyLayout {
+	base := c.options.locksPrefix + c.options.serviceName
+
+	return KeyLayout{
+		Tenant:       c.options.tenant,
+		Config:       c.configPath(ConfigurationTypeService),
+		ScopeConfig:  c.configPath(ConfigurationTypeScope),
+		HostConfig:   c.configPath(ConfigurationTypeHost),
+		Heartbeat:    c.heartbeatKey(c.options.serviceName, c.options.hostname),
+		Status:       c.statusPrefix(c.options.serviceName),
+		Mutexes:      base + c.options.mutexesPrefix,
+		ScopedLocks:  c.options.scopedLocksPrefix,
+		IDs:          c.rangeKeyPrefix(RangeTypeID),
+		IPs:          c.rangeKeyPrefix(RangeTypeIP),
+		Inventory:    c.rangeKeyPrefix(RangeTypeHost),
+		MACs:         c.rangeKeyPrefix(RangeTypeMAC),
+		VLANs:        c.rangeKeyPrefix(RangeTypeVLAN),
+		Subnets:      base + c.options.subnetsPrefix,
+		Ranges:       c.options.rangesPrefix + c.options.serviceName + "/",
+		Load:         base + c.options.loadPrefix,
+		Rebalance:    base + c.options.rebalancePrefix,
+		Tombstones:   base + c.options.tombstonesPrefix,
+		Reservations: base + c.options.reservationsPrefix,
+		Waiters:      base + c.options.waitersPrefix,
+		Transfers:    base + c.options.transfersPrefix,
+		Topics:       c.options.topicsPrefix,
+		Commands:     c.commandPrefix(),
+		Presence:     base + presenceSegment,
+		InstanceKV:   c.instanceKVPrefix(),
+		Transactions: c.options.transactionsPrefix,
+		Workflows:    base + c.options.workflowsPrefix,
+		Elections:    base + c.options.electionsPrefix,
+		Maintenance:  c.options.maintenancePrefix,
+	}
+}
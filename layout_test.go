@@ -0,0 +1,100 @@
+package svcutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeyLayoutTenant(t *testing.T) {
+	o := Tenant("/staging/")(Name("billing")(NewOptions()))
+	o.applyTenant()
+	c := &Service{options: o}
+
+	layout := c.KeyLayout()
+	host := Hostname()
+
+	tests := []struct {
+		name     string
+		got      string
+		expected string
+	}{
+		{"tenant", layout.Tenant, "staging"},
+		{"config", layout.Config, "/staging/config/billing/"},
+		{"host config", layout.HostConfig, "/staging/host/billing/" + host + "/"},
+		{"heartbeat", layout.Heartbeat, "/staging/heartbeat/billing/" + host},
+		{"status", layout.Status, "/staging/status/billing/"},
+		{"mutexes", layout.Mutexes, "/staging/lock/billing/mutex/"},
+		{"ids", layout.IDs, "/staging/lock/billing/id/"},
+		{"topics", layout.Topics, "/staging/topic/"},
+		{"commands", layout.Commands, "/staging/command/billing/"},
+		{"transactions", layout.Transactions, "/staging/transaction/"},
+		{"ips", layout.IPs, "/staging/lock/billing/host/" + host + "/"},
+		{"inventory", layout.Inventory, "/staging/lock/billing/inventory/"},
+		{"macs", layout.MACs, "/staging/lock/billing/mac/"},
+		{"vlans", layout.VLANs, "/staging/lock/billing/vlan/"},
+		{"subnets", layout.Subnets, "/staging/lock/billing/subnet/"},
+		{"ranges", layout.Ranges, "/staging/range/billing/"},
+		{"workflows", layout.Workflows, "/staging/lock/billing/workflow/"},
+		{"elections", layout.Elections, "/staging/lock/billing/election/"},
+		{"maintenance", layout.Maintenance, "/staging/maintenance/"},
+		{"service maintenance", c.maintenanceKey(LockScopeService), "/staging/maintenance/service/billing"},
+		{"instance kv", layout.InstanceKV, "/staging/lock/billing/instance/"},
+		{"global lock", c.lockKey(LockScopeGlobal, "migration"), "/staging/scoped-lock/global/migration"},
+		{"host lock", c.lockKey(LockScopeHost, "migration"), "/staging/scoped-lock/host/billing/" + host + "/migration"},
+		{"scope lock without a scope", c.lockKey(LockScopeScope, "migration"), "/staging/lock/billing/mutex/migration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestKeyLayoutDefault(t *testing.T) {
+	o := Name("billing")(NewOptions())
+	o.applyTenant()
+	c := &Service{options: o}
+
+	layout := c.KeyLayout()
+	if layout.Config != "/config/billing/" || layout.IDs != "/lock/billing/id/" {
+		t.Errorf("KeyLayout() = %+v, want default prefixes", layout)
+	}
+}
+
+func TestScopedLockKeys(t *testing.T) {
+	service := func(opts ...func(*options) *options) *Service {
+		o := NewOptions()
+		for _, opt := range opts {
+			o = opt(o)
+		}
+		o.applyTenant()
+		return &Service{options: o}
+	}
+
+	api := service(Name("api"), Scope("api"))
+	mutex := service(Name("mutex"))
+
+	keys := map[string]string{
+		"service lock of api":                   api.lockKey(LockScopeService, "migration"),
+		"scope lock of the api scope":           api.lockKey(LockScopeScope, "migration"),
+		"host lock of api":                      api.lockKey(LockScopeHost, "migration"),
+		"global lock":                           api.lockKey(LockScopeGlobal, "migration"),
+		"service lock of a service named mutex": mutex.lockKey(LockScopeService, "migration"),
+	}
+
+	seen := make(map[string]string)
+	for name, key := range keys {
+		if other, ok := seen[key]; ok {
+			t.Errorf("%s and %s share the key %s", name, other, key)
+		}
+		seen[key] = name
+	}
+
+	// host locks are not listed with the IP leases of the host
+	if ips := api.rangeKeyPrefix(RangeTypeIP); strings.HasPrefix(keys["host lock of api"], ips) {
+		t.Errorf("host lock %s is under the IP lease prefix %s", keys["host lock of api"], ips)
+	}
+}
@@ -0,0 +1,136 @@
+package svcutil
+
+import (
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"golang.org/x/net/context"
+)
+
+func (c *Service) electionKey(name string) string {
+	return c.options.locksPrefix + c.options.serviceName + c.options.electionsPrefix + name
+}
+
+// RunWhenLeader campaigns in the named election and runs fn only while the instance is
+// the leader. The context of fn is canceled once the leadership is lost, e.g. with the
+// session or because the election key was deleted, and fn runs again after the instance
+// wins the election again. Leadership changes are reported as EventTypeLeadershipAcquired
+// and EventTypeLeadershipLost with the election in Key.
+//
+// RunWhenLeader returns once fn returns by itself, resigning the leadership, with the
+// error of fn, or once ctx is done or the service is closed.
+func (c *Service) RunWhenLeader(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	key := c.electionKey(name)
+
+	for {
+		c.lock.Lock()
+		session := c.session
+		c.lock.Unlock()
+
+		retry := true
+		if session != nil && !sessionDone(session) {
+			stop, err := c.lead(ctx, session, key, fn)
+			if stop {
+				return err
+			}
+
+			// lost leadership is campaigned for again right away, a failed campaign later
+			retry = err != nil
+		}
+
+		if !retry {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.stopper:
+			return context.Canceled
+		case <-time.After(c.options.retryInterval):
+		}
+	}
+}
+
+func sessionDone(session *concurrency.Session) bool {
+	select {
+	case <-session.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// lead campaigns with the session and runs fn while the leadership lasts. It stops with
+// the error of fn if fn returned by itself or with the error of ctx once it is done, a
+// failed campaign is returned without stopping.
+func (c *Service) lead(ctx context.Context, session *concurrency.Session, key string, fn func(ctx context.Context) error) (bool, error) {
+	lctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the campaign and the leadership end with the session
+	go func() {
+		select {
+		case <-session.Done():
+		case <-c.stopper:
+		case <-lctx.Done():
+		}
+		cancel()
+	}()
+
+	election := concurrency.NewElection(session, key)
+	if err := election.Campaign(lctx, c.options.instance); err != nil {
+		if ctx.Err() != nil {
+			return true, ctx.Err()
+		}
+		return false, etcdError(err)
+	}
+
+	c.emit(Event{Type: EventTypeLeadershipAcquired, Key: key})
+
+	done := make(chan error, 1)
+	go func() { done <- fn(lctx) }()
+
+	// an election key deleted by hand ends the leadership as well, Observe would only
+	// report it once another candidate takes over
+	deleted := c.etcd.Watch(lctx, election.Key(), clientv3.WithRev(election.Rev()+1), clientv3.WithFilterPut())
+
+	var fnErr error
+	returned := false
+	for !returned && lctx.Err() == nil {
+		select {
+		case fnErr = <-done:
+			returned = true
+		case wresp, ok := <-deleted:
+			if !ok || wresp.Canceled || len(wresp.Events) > 0 {
+				cancel()
+			}
+		case <-lctx.Done():
+		}
+	}
+
+	if !returned {
+		cancel()
+		<-done
+	} else if lctx.Err() != nil && ctx.Err() == nil {
+		// fn returned because the leadership was lost, not by itself
+		returned = false
+	}
+
+	rctx, rcancel := context.WithTimeout(context.Background(), c.options.etcdDialTimeout)
+	election.Resign(rctx)
+	rcancel()
+
+	c.emit(Event{Type: EventTypeLeadershipLost, Key: key})
+
+	if returned {
+		return true, fnErr
+	}
+
+	if ctx.Err() != nil {
+		return true, ctx.Err()
+	}
+
+	return false, nil
+}
@@ -0,0 +1,132 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+func TestRunWhenLeader(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	leading := make(chan string, 10)
+	stopped := make(chan string, 10)
+
+	run := func(instance string) (context.CancelFunc, <-chan error) {
+		svc, err := NewService(Name("jobs"), Instance(instance), LocalBackend(dir))
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		t.Cleanup(svc.Close)
+
+		rctx, rcancel := context.WithCancel(ctx)
+		result := make(chan error, 1)
+		go func() {
+			result <- svc.RunWhenLeader(rctx, "compactor", func(ctx context.Context) error {
+				leading <- instance
+				<-ctx.Done()
+				stopped <- instance
+				return nil
+			})
+		}()
+
+		return rcancel, result
+	}
+
+	next := func(ch <-chan string, want string) {
+		t.Helper()
+		select {
+		case got := <-ch:
+			if got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %s %v", want, ch == leading)
+		}
+	}
+
+	stopFirst, firstDone := run("first")
+	next(leading, "first")
+
+	stopSecond, secondDone := run("second")
+	select {
+	case instance := <-leading:
+		t.Fatalf("%s leads along with first", instance)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// deleting the key of the leader hands the leadership over, first campaigns again
+	svc, _ := NewService(Name("jobs"), LocalBackend(dir))
+	defer svc.Close()
+	resp, err := svc.etcd.Get(ctx, "/lock/jobs/election/compactor", clientv3.WithFirstCreate()...)
+	if err != nil || len(resp.Kvs) == 0 {
+		t.Fatalf("Get() of the election = %v, %v", resp, err)
+	}
+	if _, err := svc.etcd.Delete(ctx, string(resp.Kvs[0].Key)); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	next(stopped, "first")
+	next(leading, "second")
+
+	stopSecond()
+	next(stopped, "second")
+	if err := <-secondDone; !errors.Is(err, context.Canceled) {
+		t.Errorf("RunWhenLeader() error = %v, want %v", err, context.Canceled)
+	}
+	next(leading, "first")
+
+	stopFirst()
+	next(stopped, "first")
+	<-firstDone
+
+	failed := errors.New("compaction failed")
+	if err := svc.RunWhenLeader(ctx, "compactor", func(ctx context.Context) error { return failed }); err != failed {
+		t.Errorf("RunWhenLeader() error = %v, want the error of fn", err)
+	}
+}
+
+func TestRunWhenLeaderSessionLost(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("jobs"), LocalBackend(t.TempDir()), LeaseTTL(3), RetryInterval(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	leading := make(chan struct{}, 10)
+	result := make(chan error, 1)
+	go func() {
+		// fn returns as soon as its context is canceled, which is not a return by itself
+		result <- svc.RunWhenLeader(ctx, "compactor", func(ctx context.Context) error {
+			leading <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+
+	for range 3 {
+		select {
+		case <-leading:
+		case err := <-result:
+			t.Fatalf("RunWhenLeader() returned %v after the leadership was lost", err)
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for the leadership")
+		}
+
+		svc.lock.Lock()
+		lost := svc.session.Lease()
+		svc.lock.Unlock()
+
+		if _, err := svc.etcd.Revoke(ctx, lost); err != nil {
+			t.Fatalf("Revoke() error = %v", err)
+		}
+	}
+}
@@ -2,29 +2,42 @@ package svcutil
 
 import (
 	"fmt"
-	"math/rand/v2"
+	"strings"
 	"sync"
 	"time"
 
 	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/net/context"
 )
 
 type Lease struct {
-	client     *Service
-	r          *Range
-	appContext context.Context
+	client  *Service
+	r       *Range
+	options *leaseOptions
 
-	wg      sync.WaitGroup
-	stopper chan struct{}
-	breaker chan bool
-	donec   chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	stopper   chan struct{}
+	breaker   chan bool
+	donec     chan struct{}
 
 	closer   func()
+	m        sync.Mutex
 	lease    clientv3.LeaseID
 	leaseKey string
+	revision int64
+	// ordinal is set when the value was taken from the StatefulSet ordinal, it has no
+	// lease key and no fencing revision then
+	ordinal bool
+
+	// tombstone is the lease of the takeover tombstone of the value, see TakeoverDelay
+	tombstone       clientv3.LeaseID
+	tombstoneCloser func()
 
 	value string
+	// excluded values are never obtained by this lease
+	excluded map[string]struct{}
 }
 
 type reacquireResult int
@@ -36,35 +49,212 @@ const (
 )
 
 func NewLease(r *Range, etcd *Service, appContext context.Context) *Lease {
+	return NewLeaseWithOptions(r, etcd, LeaseWithContext(appContext))
+}
+
+func NewLeaseWithOptions(r *Range, etcd *Service, opts ...LeaseOption) *Lease {
+	o := newLeaseOptions()
+
+	for _, decorator := range opts {
+		o = decorator(o)
+	}
+
+	excluded := make(map[string]struct{}, len(o.excluded))
+	for _, value := range o.excluded {
+		excluded[value] = struct{}{}
+	}
+
 	return &Lease{
-		client:     etcd,
-		r:          r,
-		appContext: appContext,
-		stopper:    make(chan struct{}),
-		breaker:    make(chan bool, 1),
-		donec:      make(chan struct{}),
+		client:   etcd,
+		r:        r,
+		options:  o,
+		stopper:  make(chan struct{}),
+		breaker:  make(chan bool, 1),
+		donec:    make(chan struct{}),
+		excluded: excluded,
 	}
 }
 
+// Exclude makes the lease skip the value in following attempts to obtain one, e.g. an ID
+// the instance turned out to be bad for. A value already obtained is kept.
+func (i *Lease) Exclude(value string) {
+	i.m.Lock()
+	i.excluded[value] = struct{}{}
+	i.m.Unlock()
+}
+
+// candidates returns the members of the range the lease tries, in order
+func (i *Lease) candidates() []string {
+	values := i.r.candidates()
+
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	if len(i.excluded) == 0 {
+		return values
+	}
+
+	allowed := values[:0]
+	for _, value := range values {
+		if _, ok := i.excluded[value]; !ok {
+			allowed = append(allowed, value)
+		}
+	}
+
+	return allowed
+}
+
+// SetBackoff sets the minimum delay between attempts made by Wait and WaitWithNotify
+// while the range is exhausted, by default an attempt is made on every change of the range
+func (i *Lease) SetBackoff(b BackoffPolicy) {
+	i.options.backoff = b
+}
+
+// NewLeaseWithContext creates a lease bound to the process context, an obtained value
+// is registered as a component and the lease is revoked once the process shuts down
+func NewLeaseWithContext(pc *ProcessContext, r *Range, etcd *Service, opts ...LeaseOption) *Lease {
+	return NewLeaseWithOptions(r, etcd, append([]LeaseOption{LeaseWithProcessContext(pc)}, opts...)...)
+}
+
+// Close releases the lease, revoking it before returning. It is safe to call Close more than once.
 func (i *Lease) Close() {
-	close(i.stopper)
+	i.closeOnce.Do(func() {
+		close(i.stopper)
+	})
 	i.wg.Wait()
 }
 
+// attachProcess keeps the obtained value registered as a component of the process
+// until the process shuts down, the lease is closed or lost
+func (i *Lease) attachProcess(pc *ProcessContext) {
+	pc.ComponentStarted()
+
+	go func() {
+		defer pc.ComponentFinished()
+
+		select {
+		case <-pc.Done():
+		case <-i.stopper:
+		case <-i.donec:
+		}
+
+		i.Close()
+	}()
+}
+
 func (i *Lease) Done() <-chan struct{} {
 	return i.donec
 }
 
+func (i *Lease) currentLease() clientv3.LeaseID {
+	i.m.Lock()
+	defer i.m.Unlock()
+	return i.lease
+}
+
+func (i *Lease) setLease(lease clientv3.LeaseID, revision int64) {
+	i.m.Lock()
+	i.lease = lease
+	i.revision = revision
+	i.m.Unlock()
+}
+
 func (i *Lease) keyPrefix() string {
-	if i.r.Type == RangeTypeID {
-		return fmt.Sprintf("%s%s%s", i.client.options.locksPrefix, i.client.options.serviceName, i.client.options.idsPrefix)
-	} else {
-		return fmt.Sprintf("%s%s%s%s/", i.client.options.locksPrefix, i.client.options.serviceName, i.client.options.hostsPrefix, Hostname())
+	if i.options.keyPrefix != "" {
+		return i.options.keyPrefix
+	}
+
+	return i.client.rangeKeyPrefix(i.r.Type)
+}
+
+func (c *Service) rangeKeyPrefix(t RangeType) string {
+	switch t {
+	case RangeTypeID:
+		return fmt.Sprintf("%s%s%s", c.options.locksPrefix, c.options.serviceName, c.options.idsPrefix)
+	case RangeTypeHost:
+		return fmt.Sprintf("%s%s%s", c.options.locksPrefix, c.options.serviceName, c.options.inventoryPrefix)
+	case RangeTypeMAC:
+		return fmt.Sprintf("%s%s%s", c.options.locksPrefix, c.options.serviceName, c.options.macsPrefix)
+	case RangeTypeVLAN:
+		return fmt.Sprintf("%s%s%s", c.options.locksPrefix, c.options.serviceName, c.options.vlansPrefix)
+	default:
+		return fmt.Sprintf("%s%s%s%s/", c.options.locksPrefix, c.options.serviceName, c.options.hostsPrefix, c.options.hostname)
+	}
+}
+
+// sharedShadowsSegment names the namespace under the locks prefix holding shadow keys of
+// lease keys outside the service namespace
+const sharedShadowsSegment = "@shared"
+
+// shadowKey maps a lease key into a parallel namespace under the given prefix,
+// e.g. /lock/<service>/id/<name> into /lock/<service>/tombstone/id/<name>. Keys outside
+// the service namespace, e.g. under a LeaseWithKeyPrefix prefix, may be leased by several
+// services and must not meet the default ranges, their shadows are kept in a namespace
+// shared by all services, e.g. /jobs/<name> in /lock/@shared/tombstone/jobs/<name>.
+func (c *Service) shadowKey(prefix string, lockKey string) string {
+	base := c.options.locksPrefix + c.options.serviceName
+	if rest, ok := strings.CutPrefix(lockKey, base+"/"); ok {
+		return base + strings.TrimSuffix(prefix, "/") + "/" + rest
+	}
+
+	if !strings.HasPrefix(lockKey, "/") {
+		lockKey = "/" + lockKey
 	}
+	return c.sharedShadowsPrefix() + strings.TrimSuffix(prefix, "/") + lockKey
+}
+
+// sharedShadowsPrefix is the root of shadow keys of lease keys outside the service namespace
+func (c *Service) sharedShadowsPrefix() string {
+	return c.options.locksPrefix + sharedShadowsSegment
+}
+
+// obtainCmps returns the compares which must hold for the value to be obtained
+func (i *Lease) obtainCmps(lockKey string) []clientv3.Cmp {
+	cmps := []clientv3.Cmp{clientv3.Compare(clientv3.CreateRevision(lockKey), "=", 0)}
+	cmps = append(cmps, i.takeoverGuard(lockKey)...)
+	cmps = append(cmps, i.reservationGuard(lockKey)...)
+	return cmps
+}
+
+// unavailable returns the keys under the prefix the obtain compares reject, values held
+// by others, reserved or guarded by a takeover tombstone, and the revision they were read at
+func (i *Lease) unavailable(ctx context.Context, prefix string) (map[string]bool, int64, error) {
+	shadows := []string{i.client.shadowKey(i.client.options.reservationsPrefix, prefix)}
+	if i.client.options.takeoverDelay > 0 {
+		shadows = append(shadows, i.tombstoneKey(prefix))
+	}
+
+	ops := []clientv3.Op{clientv3.OpGet(prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())}
+	for _, shadow := range shadows {
+		ops = append(ops, clientv3.OpGet(shadow, clientv3.WithPrefix(), clientv3.WithKeysOnly()))
+	}
+
+	resp, err := i.client.etcd.Txn(ctx).Then(ops...).Commit()
+	if err != nil {
+		return nil, 0, etcdError(err)
+	}
+
+	taken := make(map[string]bool)
+	for n, r := range resp.Responses {
+		for _, kv := range r.GetResponseRange().Kvs {
+			key := string(kv.Key)
+			if n > 0 {
+				// a shadow key maps back to the lock key of the same value
+				key = prefix + strings.TrimPrefix(key, shadows[n-1])
+			}
+			taken[key] = true
+		}
+	}
+
+	return taken, resp.Header.Revision, nil
 }
 
 func (i *Lease) keepAliveWorker(kl <-chan *clientv3.LeaseKeepAliveResponse) {
-	for range kl {
+	last := time.Now()
+	for resp := range kl {
+		now := time.Now()
+		i.client.stats.keepAlive(now.Sub(last), resp.TTL)
+		last = now
 	}
 
 	select {
@@ -102,7 +292,7 @@ workerloop:
 
 			if leaseAlive {
 				// check if the lease is still alive
-				ctx, cancel := context.WithTimeout(i.appContext, i.client.options.etcdDialTimeout)
+				ctx, cancel := context.WithTimeout(i.options.appContext, i.client.options.etcdDialTimeout)
 				resp, err := i.client.etcd.TimeToLive(ctx, i.lease)
 				cancel()
 				if err != nil {
@@ -110,7 +300,7 @@ workerloop:
 				}
 
 				if resp.TTL <= 0 {
-					// lease is expired
+					// lease is expired, the tombstone keeps the value for us a while longer
 					leaseAlive = false
 				} else {
 					// lease is still alive, re-establish keep-alive
@@ -124,12 +314,16 @@ workerloop:
 					i.closer = keepAliveCancel
 					keepAlive = true
 					go i.keepAliveWorker(kl)
+					i.keepTombstone(i.tombstone)
 					continue
 				}
 			}
 
 			if !leaseAlive {
-				switch i.reacquire() {
+				result := i.reacquire()
+				i.client.stats.reacquire(result == reacquireSuccess)
+
+				switch result {
 				case reacquireSuccess:
 					leaseAlive = true
 					keepAlive = true
@@ -150,68 +344,187 @@ workerloop:
 	close(i.donec)
 
 	if leaseAlive {
-		go func() {
-			ctx, cancel := context.WithTimeout(context.Background(), i.client.options.etcdDialTimeout)
-			defer cancel()
-			i.client.etcd.Revoke(ctx, i.lease)
-		}()
+		ctx, cancel := context.WithTimeout(context.Background(), i.client.options.etcdDialTimeout)
+		defer cancel()
+		i.client.etcd.Revoke(ctx, i.lease)
 	}
+
+	i.releaseTombstone()
+}
+
+// revoke revokes the lease in the background context, the caller context may be done
+func (c *Service) revoke(lease clientv3.LeaseID) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.etcdDialTimeout)
+	defer cancel()
+	c.etcd.Revoke(ctx, lease)
 }
 
 func (i *Lease) Obtain(ctx context.Context) (string, error) {
-	lease := clientv3.NewLease(i.client.etcd)
-	resp, err := lease.Grant(ctx, int64(i.client.options.etcdLeaseTTL))
+	ctx, span := i.client.startSpan(ctx, "Lease.Obtain", attribute.String("svcutil.key", i.keyPrefix()))
+	id, err := i.obtain(ctx)
+	endSpan(span, err)
+
+	return id, err
+}
+
+func (i *Lease) obtain(ctx context.Context) (string, error) {
+	id, _, err := i.obtainRev(ctx)
+	return id, err
+}
+
+// obtainRev also returns the revision the first attempt was made at, changes of the
+// range after it may make a value available
+func (i *Lease) obtainRev(ctx context.Context) (string, int64, error) {
+	key := i.keyPrefix()
+
+	if ordinal, ok := i.client.Ordinal(); ok && i.r.Type == RangeTypeID {
+		return i.obtainOrdinal(key, ordinal)
+	}
+
+	if i.client.options.dryRun {
+		return i.obtainDryRun(ctx, key)
+	}
+
+	holder, err := i.holderValue()
 	if err != nil {
-		return "", err
+		return "", 0, &LeaseError{Key: key, Op: "encode", Err: err}
 	}
 
-	key := i.keyPrefix()
+	resp, err := i.client.etcd.Grant(ctx, int64(i.ttl()))
+	if err != nil {
+		return "", 0, &LeaseError{Key: key, Op: "grant", Err: etcdError(err)}
+	}
 
-	ids := make([]string, len(i.r.Values))
-	copy(ids, i.r.Values)
-	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	// the granted lease must not outlive a failed attempt, e.g. when the deadline
+	// of the caller expires halfway through the range
+	bound := false
+	defer func() {
+		if !bound {
+			i.client.revoke(resp.ID)
+		}
+	}()
 
-	for _, id := range ids {
-		idLockKey := key + id
+	tombstone, err := i.grantTombstone(ctx)
+	if err != nil {
+		return "", 0, &LeaseError{Key: key, Op: "grant", Err: etcdError(err)}
+	}
+	if tombstone != 0 {
+		defer func() {
+			if !bound {
+				i.client.revoke(tombstone)
+			}
+		}()
+	}
+
+	var rev int64
 
-		txn := i.client.etcd.Txn(ctx).
-			If(clientv3.Compare(clientv3.CreateRevision(idLockKey), "=", 0)).
-			Then(clientv3.OpPut(idLockKey, "locked", clientv3.WithLease(resp.ID))).
-			Else()
+	ids := i.candidates()
 
-		txnResp, err := txn.Commit()
+	batch := min(i.batchSize(), i.maxBatchSize(tombstone))
+	for start := 0; start < len(ids); start += batch {
+		chunk := ids[start:min(start+batch, len(ids))]
+
+		if err := ctx.Err(); err != nil {
+			return "", rev, &LeaseError{Key: key, Op: "obtain", Err: etcdError(err)}
+		}
+
+		keys := make([]string, len(chunk))
+		for n, id := range chunk {
+			keys[n] = key + id
+		}
+
+		cmps, thens, elses := i.candidateOps(keys, holder, resp.ID, tombstone)
+		txnResp, err := i.client.etcd.Txn(ctx).If(cmps...).Then(thens...).Else(elses...).Commit()
 		if err != nil {
-			return "", err
+			return "", 0, &LeaseError{Key: keys[0], Op: "obtain", Err: etcdError(err)}
 		}
 
-		if txnResp.Succeeded {
+		if rev == 0 {
+			rev = txnResp.Header.Revision
+		}
+
+		if n := obtainedCandidate(txnResp); n >= 0 {
+			id, idLockKey := chunk[n], keys[n]
+
 			keepAliveContext, cancel := context.WithCancel(context.Background())
 			kl, err := i.client.etcd.KeepAlive(keepAliveContext, resp.ID)
 			if err != nil {
 				cancel()
-				return "", err
+				return "", 0, &LeaseError{Key: idLockKey, Op: "keepalive", Err: etcdError(err)}
 			}
 
+			bound = true
 			go i.keepAliveWorker(kl)
 
 			i.value = id
 			i.closer = cancel
-			i.lease = resp.ID
+			i.setLease(resp.ID, txnResp.Header.Revision)
 			i.leaseKey = idLockKey
+			i.keepTombstone(tombstone)
 
 			i.wg.Add(1)
 			go i.worker()
 
-			return id, nil
+			if i.options.process != nil {
+				i.attachProcess(i.options.process)
+			}
+
+			return id, rev, nil
 		}
 	}
 
-	return "", ErrNoAvailableIDs
+	return "", rev, ErrNoAvailableIDs
+}
+
+// obtainOrdinal takes the value at the StatefulSet ordinal without leasing it in etcd,
+// the ordinal is unique among pods of the StatefulSet already. Nothing is written, so
+// the value has no fencing revision and can't be verified or transferred.
+func (i *Lease) obtainOrdinal(key string, ordinal int) (string, int64, error) {
+	if ordinal >= len(i.r.Values) {
+		return "", 0, ErrNoAvailableIDs
+	}
+
+	i.m.Lock()
+	_, excluded := i.excluded[i.r.Values[ordinal]]
+	i.m.Unlock()
+
+	if excluded {
+		return "", 0, ErrNoAvailableIDs
+	}
+
+	i.value = i.r.Values[ordinal]
+	i.ordinal = true
+
+	if i.options.process != nil {
+		i.attachProcess(i.options.process)
+	}
+
+	return i.value, 0, nil
 }
 
 func (i *Lease) Wait(ctx context.Context) (string, error) {
-	for {
-		id, err := i.Obtain(ctx)
+	return i.WaitWithNotify(ctx, nil)
+}
+
+// WaitWithNotify is Wait calling onAttempt after every attempt to obtain a value,
+// the last call gets a nil error once the value is obtained
+func (i *Lease) WaitWithNotify(ctx context.Context, onAttempt func(attempt int, err error)) (string, error) {
+	ctx, span := i.client.startSpan(ctx, "Lease.Wait", attribute.String("svcutil.key", i.keyPrefix()))
+	id, err := i.wait(ctx, onAttempt)
+	endSpan(span, err)
+
+	return id, err
+}
+
+func (i *Lease) wait(ctx context.Context, onAttempt func(attempt int, err error)) (string, error) {
+	for attempt := 1; ; attempt++ {
+		started := time.Now()
+
+		id, rev, err := i.obtainRev(ctx)
+		if onAttempt != nil {
+			onAttempt(attempt, err)
+		}
+
 		if err == nil {
 			return id, nil
 		}
@@ -220,56 +533,109 @@ func (i *Lease) Wait(ctx context.Context) (string, error) {
 			return "", err
 		}
 
-		wctx, cancel := context.WithCancel(ctx)
-		watchChan := i.client.etcd.Watch(wctx, i.keyPrefix(), clientv3.WithPrefix())
+		var from int64
+		if rev > 0 {
+			from = rev + 1
+		}
 
-		select {
-		case <-watchChan:
-		case <-time.After(i.client.options.retryInterval):
-		case <-ctx.Done():
-			cancel()
-			return "", ctx.Err()
+		if err := i.waitRelease(ctx, from); err != nil {
+			return "", err
 		}
 
-		cancel()
+		if err := i.sleepBackoff(ctx, attempt, started); err != nil {
+			return "", err
+		}
+	}
+}
+
+// sleepBackoff waits out the rest of the backoff delay of the attempt made at started
+func (i *Lease) sleepBackoff(ctx context.Context, attempt int, started time.Time) error {
+	if i.options.backoff == nil {
+		return nil
+	}
+
+	delay := i.options.backoff(attempt) - time.Since(started)
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
 func (i *Lease) reacquire() reacquireResult {
-	ctx, cancel := context.WithTimeout(i.appContext, i.client.options.etcdDialTimeout)
+	ctx, cancel := context.WithTimeout(i.options.appContext, i.client.options.etcdDialTimeout)
 	defer cancel()
 
-	lease := clientv3.NewLease(i.client.etcd)
-	resp, err := lease.Grant(ctx, int64(i.client.options.etcdLeaseTTL))
+	holder, err := i.holderValue()
 	if err != nil {
 		return reacquireFailure
 	}
 
-	txn := i.client.etcd.Txn(ctx).
-		If(clientv3.Compare(clientv3.CreateRevision(i.leaseKey), "=", 0)).
-		Then(clientv3.OpPut(i.leaseKey, "locked", clientv3.WithLease(resp.ID))).
-		Else()
+	resp, err := i.client.etcd.Grant(ctx, int64(i.ttl()))
+	if err != nil {
+		return reacquireFailure
+	}
 
-	txnResp, err := txn.Commit()
+	tombstone, err := i.grantTombstone(ctx)
 	if err != nil {
+		i.client.revoke(resp.ID)
 		return reacquireFailure
 	}
 
-	if txnResp.Succeeded {
-		keepAliveContext, keepAliveCancel := context.WithCancel(context.Background())
-		kl, err := i.client.etcd.KeepAlive(keepAliveContext, resp.ID)
+	thens := append([]clientv3.Op{clientv3.OpPut(i.leaseKey, holder, clientv3.WithLease(resp.ID))}, i.tombstoneOps(i.leaseKey, tombstone)...)
+
+	var txnResp *clientv3.TxnResponse
+	if tombstone != 0 {
+		// our own tombstone does not prevent us from reacquiring the value
+		txnResp, err = i.client.etcd.Txn(ctx).
+			If(append([]clientv3.Cmp{
+				clientv3.Compare(clientv3.CreateRevision(i.leaseKey), "=", 0),
+				clientv3.Compare(clientv3.Value(i.tombstoneKey(i.leaseKey)), "=", i.client.options.instance),
+			}, i.reservationGuard(i.leaseKey)...)...).
+			Then(thens...).
+			Commit()
+	}
+
+	if err == nil && (txnResp == nil || !txnResp.Succeeded) {
+		txnResp, err = i.client.etcd.Txn(ctx).
+			If(i.obtainCmps(i.leaseKey)...).
+			Then(thens...).
+			Commit()
+	}
+
+	if err != nil || !txnResp.Succeeded {
+		i.client.revoke(resp.ID)
+		if tombstone != 0 {
+			i.client.revoke(tombstone)
+		}
+
 		if err != nil {
-			keepAliveCancel()
 			return reacquireFailure
 		}
+		return reacquireLeaseTaken
+	}
 
-		go i.keepAliveWorker(kl)
+	keepAliveContext, keepAliveCancel := context.WithCancel(context.Background())
+	kl, err := i.client.etcd.KeepAlive(keepAliveContext, resp.ID)
+	if err != nil {
+		keepAliveCancel()
+		i.client.revoke(resp.ID)
+		if tombstone != 0 {
+			i.client.revoke(tombstone)
+		}
+		return reacquireFailure
+	}
 
-		i.closer = keepAliveCancel
-		i.lease = resp.ID
+	go i.keepAliveWorker(kl)
 
-		return reacquireSuccess
-	}
+	i.closer = keepAliveCancel
+	i.setLease(resp.ID, txnResp.Header.Revision)
+	i.keepTombstone(tombstone)
 
-	return reacquireLeaseTaken
+	return reacquireSuccess
 }
@@ -0,0 +1,87 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// leasesWithTTL returns the number of etcd leases granted with the TTL and not revoked
+func leasesWithTTL(ctx context.Context, t *testing.T, svc *Service, ttl int64) int {
+	t.Helper()
+
+	resp, err := svc.etcd.Leases(ctx)
+	if err != nil {
+		t.Fatalf("Leases() error = %v", err)
+	}
+
+	n := 0
+	for _, l := range resp.Leases {
+		info, err := svc.etcd.TimeToLive(ctx, l.ID)
+		if err != nil {
+			t.Fatalf("TimeToLive() error = %v", err)
+		}
+		if info.GrantedTTL == ttl {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestObtainRevokesUnusedLease(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// leases granted by Obtain are told apart from the service sessions by their TTL
+	const ttl = 17
+
+	dir := t.TempDir()
+	svc, err := NewService(Name("api"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	t.Run("exhausted range", func(t *testing.T) {
+		r, _ := NewIDRange("1-3")
+		for range r.Values {
+			l := NewLeaseWithOptions(r, svc, LeaseWithTTL(ttl))
+			defer l.Close()
+			if _, err := l.Obtain(ctx); err != nil {
+				t.Fatalf("Obtain() error = %v", err)
+			}
+		}
+
+		l := NewLeaseWithOptions(r, svc, LeaseWithTTL(ttl))
+		if _, err := l.Obtain(ctx); !errors.Is(err, ErrNoAvailableIDs) {
+			t.Fatalf("Obtain() error = %v, want %v", err, ErrNoAvailableIDs)
+		}
+		if n := leasesWithTTL(ctx, t, svc, ttl); n != len(r.Values) {
+			t.Errorf("%d leases after a failed Obtain(), want %d of the held values", n, len(r.Values))
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		// every transaction takes longer than the deadline of the caller
+		slow, err := NewService(Name("api"), LocalBackend(dir),
+			Chaos(NewChaosInjector(1, ChaosRule{Op: ChaosOpTxn, Probability: 1, Delay: time.Hour})))
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		defer slow.Close()
+
+		r, _ := NewIDRange("4-6")
+		octx, ocancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer ocancel()
+
+		if _, err := NewLeaseWithOptions(r, slow, LeaseWithTTL(ttl)).Obtain(octx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Obtain() past the deadline error = %v, want %v", err, context.DeadlineExceeded)
+		}
+		if n := leasesWithTTL(ctx, t, svc, ttl); n != 0 {
+			t.Errorf("%d leases after Obtain() ran out of time, want none", n)
+		}
+	})
+}
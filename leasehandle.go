@@ -0,0 +1,25 @@
+package svcutil
+
+import "golang.org/x/net/context"
+
+// LeaseHandle is the part of a Lease most consumers use, so packages taking it instead of
+// *Lease can mock leasing in their unit tests
+type LeaseHandle interface {
+	Obtain(ctx context.Context) (string, error)
+	Wait(ctx context.Context) (string, error)
+	Close()
+	Value() string
+	Done() <-chan struct{}
+}
+
+var _ LeaseHandle = (*Lease)(nil)
+
+// Value returns the obtained value, empty until Obtain or Wait succeeds
+func (i *Lease) Value() string {
+	return i.value
+}
+
+// NewIDLease creates a lease of the range bound to the service, see NewLeaseWithOptions
+func (c *Service) NewIDLease(r *Range, opts ...LeaseOption) LeaseHandle {
+	return NewLeaseWithOptions(r, c, opts...)
+}
@@ -0,0 +1,42 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestNewIDLease(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("api"), Instance("worker"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	r, _ := NewIDRange("7")
+	var l LeaseHandle = svc.NewIDLease(r)
+
+	if l.Value() != "" {
+		t.Errorf("Value() before Obtain() = %q, want empty", l.Value())
+	}
+
+	id, err := l.Obtain(ctx)
+	if err != nil {
+		t.Fatalf("Obtain() error = %v", err)
+	}
+	if id != "7" || l.Value() != "7" {
+		t.Errorf("Obtain() = %q, Value() = %q, want 7", id, l.Value())
+	}
+
+	l.Close()
+
+	select {
+	case <-l.Done():
+	case <-ctx.Done():
+		t.Errorf("Done() is not closed after Close()")
+	}
+}
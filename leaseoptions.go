@@ -0,0 +1,145 @@
+package svcutil
+
+import (
+	"golang.org/x/net/context"
+)
+
+type leaseOptions struct {
+	appContext context.Context
+	process    *ProcessContext
+	ttl        int
+	keyPrefix  string
+	metadata   string
+	events     Events
+	backoff    BackoffPolicy
+	codec      ValueCodec
+	batch      int
+	excluded   []string
+}
+
+// LeaseOption customizes a single Lease, unset options fall back to the service options
+type LeaseOption func(*leaseOptions) *leaseOptions
+
+func newLeaseOptions() *leaseOptions {
+	return &leaseOptions{
+		appContext: context.Background(),
+	}
+}
+
+// LeaseWithContext sets the application context used while reacquiring an expired lease
+func LeaseWithContext(ctx context.Context) LeaseOption {
+	return func(l *leaseOptions) *leaseOptions {
+		l.appContext = ctx
+		return l
+	}
+}
+
+// LeaseWithProcessContext binds the lease to the process context, see NewLeaseWithContext
+func LeaseWithProcessContext(pc *ProcessContext) LeaseOption {
+	return func(l *leaseOptions) *leaseOptions {
+		l.process = pc
+		l.appContext = pc.Context()
+		return l
+	}
+}
+
+// LeaseWithTTL sets the TTL of the lease in seconds instead of the service LeaseTTL
+func LeaseWithTTL(t int) LeaseOption {
+	return func(l *leaseOptions) *leaseOptions {
+		l.ttl = t
+		return l
+	}
+}
+
+// LeaseWithKeyPrefix stores the range values under the given prefix instead of the
+// default per-service range prefix
+func LeaseWithKeyPrefix(p string) LeaseOption {
+	return func(l *leaseOptions) *leaseOptions {
+		l.keyPrefix = p
+		return l
+	}
+}
+
+// LeaseWithMetadata stores the metadata as the value of the lease key instead of
+// the instance name, Availability reports it as the holder
+func LeaseWithMetadata(m string) LeaseOption {
+	return func(l *leaseOptions) *leaseOptions {
+		l.metadata = m
+		return l
+	}
+}
+
+// LeaseWithEvents delivers events of the lease to the given handler instead of
+// the handler set with the OnEvents service option
+func LeaseWithEvents(e Events) LeaseOption {
+	return func(l *leaseOptions) *leaseOptions {
+		l.events = e
+		return l
+	}
+}
+
+// LeaseWithBackoff sets the minimum delay between attempts made by the wait methods
+func LeaseWithBackoff(b BackoffPolicy) LeaseOption {
+	return func(l *leaseOptions) *leaseOptions {
+		l.backoff = b
+		return l
+	}
+}
+
+func (i *Lease) ttl() int {
+	if i.options.ttl > 0 {
+		return i.options.ttl
+	}
+
+	return i.client.options.etcdLeaseTTL
+}
+
+// LeaseWithCodec encodes the value written to the lease key with the codec
+func LeaseWithCodec(c ValueCodec) LeaseOption {
+	return func(l *leaseOptions) *leaseOptions {
+		l.codec = c
+		return l
+	}
+}
+
+// LeaseWithBatchSize sets how many candidate values Obtain tries in a single transaction,
+// every transaction makes one round trip to etcd. Sizes above the etcd limit of operations
+// per transaction (128 by default, 42 to 64 candidates) are lowered to fit it.
+func LeaseWithBatchSize(n int) LeaseOption {
+	return func(l *leaseOptions) *leaseOptions {
+		l.batch = n
+		return l
+	}
+}
+
+// holderValue is the value written to the lease key
+func (i *Lease) holderValue() (string, error) {
+	payload := i.client.options.instance
+	if i.options.metadata != "" {
+		payload = i.options.metadata
+	}
+
+	return i.encodeValue(payload)
+}
+
+func (i *Lease) emit(ev Event) {
+	if i.options.events == nil {
+		i.client.emit(ev)
+		return
+	}
+
+	if ev.Instance == "" {
+		ev.Instance = i.client.options.instance
+	}
+
+	dispatch(i.options.events, ev)
+}
+
+// LeaseWithExcludedValues makes the lease skip the values while drawing from the range,
+// e.g. IDs whose shard data is missing on the local disk, see also Lease.Exclude
+func LeaseWithExcludedValues(values []string) LeaseOption {
+	return func(l *leaseOptions) *leaseOptions {
+		l.excluded = append(l.excluded, values...)
+		return l
+	}
+}
@@ -0,0 +1,89 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestShadowKey(t *testing.T) {
+	svc, err := NewService(Name("billing"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	tests := []struct {
+		name    string
+		lockKey string
+		want    string
+	}{
+		{"service range", "/lock/billing/id/1", "/lock/billing/tombstone/id/1"},
+		{"service range prefix", "/lock/billing/id/", "/lock/billing/tombstone/id/"},
+		{"custom prefix", "/jobs/1", "/lock/@shared/tombstone/jobs/1"},
+		{"custom prefix like a range", "/id/1", "/lock/@shared/tombstone/id/1"},
+		{"custom prefix without slash", "jobs/1", "/lock/@shared/tombstone/jobs/1"},
+		{"service with the same name prefix", "/lock/billing2/id/1", "/lock/@shared/tombstone/lock/billing2/id/1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := svc.shadowKey("/tombstone/", tt.lockKey); got != tt.want {
+				t.Errorf("shadowKey(%q) = %q, want %q", tt.lockKey, got, tt.want)
+			}
+		})
+	}
+
+	// shadows of a prefix and of its keys stay aligned
+	r, _ := NewIDRange("1")
+	l := NewLeaseWithOptions(r, svc, LeaseWithKeyPrefix("/jobs/"))
+	if got, want := svc.shadowKey("/tombstone/", l.keyPrefix())+"1", l.tombstoneKey(l.keyPrefix()+"1"); got != want {
+		t.Errorf("shadow of the prefix + value = %q, want %q", got, want)
+	}
+}
+
+func TestLeaseWithKeyPrefixShared(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	newService := func(name string) *Service {
+		svc, err := NewService(Name(name), LocalBackend(dir), TakeoverDelay(time.Minute), RetryInterval(50*time.Millisecond))
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		t.Cleanup(svc.Close)
+		return svc
+	}
+
+	billing, reports := newService("billing"), newService("reports")
+	r, _ := NewIDRange("1")
+
+	// a reservation made for the default ID range does not reserve the custom prefix
+	if err := billing.ReserveIDs(ctx, r, "maintenance", 0); err != nil {
+		t.Fatalf("ReserveIDs() error = %v", err)
+	}
+
+	holder := NewLeaseWithOptions(r, billing, LeaseWithKeyPrefix("/id/"))
+	if _, err := holder.Obtain(ctx); err != nil {
+		t.Fatalf("Obtain() under a custom prefix error = %v", err)
+	}
+	defer holder.Close()
+
+	// the takeover tombstone of the holder guards the value from other services too
+	tombstone, err := reports.etcd.Get(ctx, "/lock/@shared/tombstone/id/1")
+	if err != nil || len(tombstone.Kvs) != 1 {
+		t.Fatalf("tombstone = %v, %v", tombstone, err)
+	}
+	if _, err := reports.etcd.Revoke(ctx, holder.lease); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+
+	other := NewLeaseWithOptions(r, reports, LeaseWithKeyPrefix("/id/"))
+	defer other.Close()
+	if _, err := other.Obtain(ctx); !errors.Is(err, ErrNoAvailableIDs) {
+		t.Errorf("Obtain() of a tombstoned value by another service error = %v, want %v", err, ErrNoAvailableIDs)
+	}
+}
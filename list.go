@@ -0,0 +1,205 @@
+package svcutil
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// defaultListLimit is the page size used when ListOptions.Limit is not set
+const defaultListLimit = 1000
+
+var ErrInvalidContinueToken = errors.New("invalid continue token")
+var ErrListCompacted = errors.New("revision of the listing is compacted")
+
+// ListOptions controls a paginated prefix listing
+type ListOptions struct {
+	// Limit is the maximum number of keys per page, defaults to 1000
+	Limit int64
+	// Continue is the token returned with the previous page, empty for the first page
+	Continue string
+	// Descend lists keys in descending order
+	Descend bool
+	// KeysOnly omits values
+	KeysOnly bool
+	// Interval is the pause between pages in WalkKeys, it rate-limits the load on etcd
+	Interval time.Duration
+}
+
+// KeyValue is a key listed by ListKeys
+type KeyValue struct {
+	Key            string
+	Value          []byte
+	Lease          int64
+	CreateRevision int64
+	ModRevision    int64
+}
+
+// ListPage is a single page of keys, Continue is empty when there are no more keys
+type ListPage struct {
+	KVs      []KeyValue
+	Continue string
+	// Revision is the store revision all pages of the listing are read at
+	Revision int64
+}
+
+// ListKeys lists a page of keys under the prefix, pass the returned Continue token to get
+// the next page. All pages are read at the revision of the first one, so the listing is
+// consistent even if keys change in the meantime. Once that revision is compacted the next
+// page fails with an error matching ErrListCompacted, the listing has to start over.
+func (c *Service) ListKeys(ctx context.Context, prefix string, opts ListOptions) (ListPage, error) {
+	var rev int64
+	var last string
+	if opts.Continue != "" {
+		var err error
+		rev, last, err = decodeContinueToken(opts.Continue)
+		if err != nil || !strings.HasPrefix(last, prefix) {
+			return ListPage{}, ErrInvalidContinueToken
+		}
+	}
+
+	return c.listKeys(ctx, prefix, opts, rev, last)
+}
+
+// listKeys lists the page after the last key at the revision, the first page of the
+// prefix if last is empty and at the current revision if rev is zero
+func (c *Service) listKeys(ctx context.Context, prefix string, opts ListOptions, rev int64, last string) (ListPage, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+
+	start, end := prefix, clientv3.GetPrefixRangeEnd(prefix)
+	if last != "" {
+		if opts.Descend {
+			end = last
+		} else {
+			start = last + "\x00"
+		}
+	}
+
+	order := clientv3.SortAscend
+	if opts.Descend {
+		order = clientv3.SortDescend
+	}
+
+	getOpts := []clientv3.OpOption{
+		clientv3.WithRange(end),
+		clientv3.WithLimit(limit),
+		clientv3.WithSort(clientv3.SortByKey, order),
+		clientv3.WithRev(rev),
+	}
+	if opts.KeysOnly {
+		getOpts = append(getOpts, clientv3.WithKeysOnly())
+	}
+
+	resp, err := c.etcd.Get(ctx, start, getOpts...)
+	if err != nil {
+		if errors.Is(err, rpctypes.ErrCompacted) {
+			return ListPage{}, wrapCause(ErrListCompacted, err)
+		}
+
+		return ListPage{}, etcdError(err)
+	}
+
+	if rev == 0 {
+		rev = resp.Header.Revision
+	}
+
+	page := ListPage{
+		KVs:      make([]KeyValue, 0, len(resp.Kvs)),
+		Revision: rev,
+	}
+	for _, kv := range resp.Kvs {
+		page.KVs = append(page.KVs, KeyValue{
+			Key:            string(kv.Key),
+			Value:          kv.Value,
+			Lease:          kv.Lease,
+			CreateRevision: kv.CreateRevision,
+			ModRevision:    kv.ModRevision,
+		})
+	}
+
+	if resp.More && len(page.KVs) > 0 {
+		page.Continue = encodeContinueToken(rev, page.KVs[len(page.KVs)-1].Key)
+	}
+
+	return page, nil
+}
+
+// WalkKeys calls fn for every key under the prefix page by page, pausing opts.Interval
+// between pages, until all keys are visited, fn returns an error or ctx is done. Pages are
+// read at the revision of the first one like ListKeys, once it is compacted the walk goes
+// on after the last visited key at the current revision, so a long walk never starts over
+// but keys changed during it may be seen at different revisions. Errors of the listing are
+// returned as a *ListError, errors of fn as they are.
+func (c *Service) WalkKeys(ctx context.Context, prefix string, opts ListOptions, fn func(KeyValue) error) error {
+	var rev int64
+	var last string
+	if opts.Continue != "" {
+		var err error
+		rev, last, err = decodeContinueToken(opts.Continue)
+		if err != nil || !strings.HasPrefix(last, prefix) {
+			return &ListError{Prefix: prefix, Err: ErrInvalidContinueToken}
+		}
+	}
+
+	for {
+		page, err := c.listKeys(ctx, prefix, opts, rev, last)
+		if errors.Is(err, ErrListCompacted) {
+			rev = 0
+			continue
+		}
+		if err != nil {
+			return &ListError{Prefix: prefix, Err: err}
+		}
+
+		for _, kv := range page.KVs {
+			if err := fn(kv); err != nil {
+				return err
+			}
+		}
+
+		if page.Continue == "" {
+			return nil
+		}
+		rev, last = page.Revision, page.KVs[len(page.KVs)-1].Key
+
+		if opts.Interval > 0 {
+			select {
+			case <-ctx.Done():
+				return &ListError{Prefix: prefix, Err: ctx.Err()}
+			case <-time.After(opts.Interval):
+			}
+		}
+	}
+}
+
+func encodeContinueToken(rev int64, key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(rev, 10) + "/" + key))
+}
+
+func decodeContinueToken(token string) (int64, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, "", ErrInvalidContinueToken
+	}
+
+	revStr, key, ok := strings.Cut(string(data), "/")
+	if !ok {
+		return 0, "", ErrInvalidContinueToken
+	}
+
+	rev, err := strconv.ParseInt(revStr, 10, 64)
+	if err != nil || rev <= 0 {
+		return 0, "", ErrInvalidContinueToken
+	}
+
+	return rev, key, nil
+}
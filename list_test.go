@@ -0,0 +1,100 @@
+package svcutil
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestContinueToken(t *testing.T) {
+	tests := []struct {
+		rev int64
+		key string
+	}{
+		{rev: 1, key: "/config/svc/a"},
+		{rev: 42, key: "/config/svc/with/slashes"},
+		{rev: 7, key: ""},
+	}
+
+	for _, tt := range tests {
+		rev, key, err := decodeContinueToken(encodeContinueToken(tt.rev, tt.key))
+		if err != nil || rev != tt.rev || key != tt.key {
+			t.Errorf("decodeContinueToken() = %d, %q, %v, want %d, %q", rev, key, err, tt.rev, tt.key)
+		}
+	}
+
+	for _, token := range []string{"!!", "bm9yZXY", "MC9rZXk", "YWJjL2tleQ"} {
+		if _, _, err := decodeContinueToken(token); err != ErrInvalidContinueToken {
+			t.Errorf("decodeContinueToken(%q) error = %v, want %v", token, err, ErrInvalidContinueToken)
+		}
+	}
+}
+
+func TestWalkKeysCompacted(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("api"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	for n := range 6 {
+		if _, err := svc.etcd.Put(ctx, fmt.Sprintf("/walk/%d", n), "v"); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	first, err := svc.ListKeys(ctx, "/walk/", ListOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("ListKeys() error = %v", err)
+	}
+
+	compact := func() {
+		resp, err := svc.etcd.Put(ctx, "/other", "v")
+		if err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+		if _, err := svc.etcd.Compact(ctx, resp.Header.Revision); err != nil {
+			t.Fatalf("Compact() error = %v", err)
+		}
+	}
+	compact()
+
+	if _, err := svc.ListKeys(ctx, "/walk/", ListOptions{Limit: 2, Continue: first.Continue}); !errors.Is(err, ErrListCompacted) {
+		t.Errorf("ListKeys() at a compacted revision error = %v, want %v", err, ErrListCompacted)
+	}
+
+	// the walk goes on after the last visited key once its revision is compacted
+	visited := make(map[string]int)
+	err = svc.WalkKeys(ctx, "/walk/", ListOptions{Limit: 2}, func(kv KeyValue) error {
+		visited[kv.Key]++
+		if kv.Key == "/walk/1" {
+			compact()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkKeys() error = %v", err)
+	}
+	for n := range 6 {
+		if key := fmt.Sprintf("/walk/%d", n); visited[key] != 1 {
+			t.Errorf("WalkKeys() visited %s %d times, want once", key, visited[key])
+		}
+	}
+
+	var listErr *ListError
+	err = svc.WalkKeys(ctx, "/walk/", ListOptions{Continue: "invalid"}, func(KeyValue) error { return nil })
+	if !errors.As(err, &listErr) || listErr.Prefix != "/walk/" || !errors.Is(err, ErrInvalidContinueToken) {
+		t.Errorf("WalkKeys() with an invalid token error = %v, want a *ListError", err)
+	}
+
+	failed := errors.New("failed")
+	if err := svc.WalkKeys(ctx, "/walk/", ListOptions{}, func(KeyValue) error { return failed }); err != failed {
+		t.Errorf("WalkKeys() error = %v, want the error of fn", err)
+	}
+}
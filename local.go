@@ -0,0 +1,664 @@
+package svcutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+)
+
+const (
+	// localBackend is the value of SVCUTIL_BACKEND selecting the local backend
+	localBackend = "local"
+	// localMaxEvents is the number of events kept for watches, older revisions are compacted
+	localMaxEvents = 10000
+)
+
+// localKV is a key stored by the local backend
+type localKV struct {
+	Value          []byte `json:"value"`
+	CreateRevision int64  `json:"create_revision"`
+	ModRevision    int64  `json:"mod_revision"`
+	Version        int64  `json:"version"`
+	Lease          int64  `json:"lease,omitempty"`
+}
+
+type localLease struct {
+	TTL     int64     `json:"ttl"`
+	Expires time.Time `json:"expires"`
+}
+
+// localEvent is a change kept for watches, KV of a delete event has only the mod revision set
+type localEvent struct {
+	Delete bool     `json:"delete,omitempty"`
+	Key    string   `json:"key"`
+	KV     localKV  `json:"kv"`
+	Prev   *localKV `json:"prev,omitempty"`
+}
+
+// localState is the content of the state file, every operation loads it, applies the
+// change under the file lock and writes it back if anything changed
+type localState struct {
+	Revision  int64                 `json:"revision"`
+	Compacted int64                 `json:"compacted"`
+	NextLease int64                 `json:"next_lease"`
+	Keys      map[string]*localKV   `json:"keys"`
+	Leases    map[int64]*localLease `json:"leases"`
+	Events    []localEvent          `json:"events"`
+
+	// pending is the revision written by the operation being applied, headers of its
+	// responses get the revision once it is committed. Keys changed by the operation mark
+	// the state dirty, changes which do not create a revision (leases) mark it changed.
+	pending int64
+	dirty   bool
+	changed bool
+	headers []*pb.ResponseHeader
+}
+
+func newLocalState() *localState {
+	return &localState{
+		// an empty etcd store is at revision 1, the first write gets revision 2
+		Revision:  1,
+		NextLease: rand.Int64N(1<<32) + 1,
+		Keys:      make(map[string]*localKV),
+		Leases:    make(map[int64]*localLease),
+	}
+}
+
+// localStore keeps the state of the local backend in a directory, processes sharing
+// the directory serialize their operations with an exclusive lock of the lock file.
+// The last state read or written is kept decoded, the file is decoded again only
+// once another process changed it.
+type localStore struct {
+	path     string
+	lockPath string
+
+	mu    sync.Mutex
+	data  []byte
+	state *localState
+}
+
+func newLocalStore(dir string) (*localStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &localStore{
+		path:     filepath.Join(dir, "state.json"),
+		lockPath: filepath.Join(dir, "state.lock"),
+	}, nil
+}
+
+// update applies fn to the current state, expired leases are revoked first. The state
+// is written back only if it changed and fn succeeded.
+func (s *localStore) update(fn func(st *localState) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.lockPath, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := lockFile(f); err != nil {
+		return err
+	}
+	defer unlockFile(f)
+
+	st, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	if st.expire(time.Now()) {
+		if err := s.save(st); err != nil {
+			return err
+		}
+	}
+
+	st.begin()
+	if err := fn(st); err != nil {
+		// fn may have changed the state before failing
+		s.state = nil
+		return err
+	}
+
+	if !st.commit() {
+		return nil
+	}
+
+	return s.save(st)
+}
+
+func (s *localStore) load() (*localState, error) {
+	st := newLocalState()
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.state = nil
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.state != nil && bytes.Equal(data, s.data) {
+		return s.state, nil
+	}
+
+	s.state = nil
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, err
+	}
+
+	if st.Keys == nil {
+		st.Keys = make(map[string]*localKV)
+	}
+	if st.Leases == nil {
+		st.Leases = make(map[int64]*localLease)
+	}
+
+	s.data, s.state = data, st
+	return st, nil
+}
+
+// save replaces the state file atomically, so a crashed process never leaves it truncated
+func (s *localStore) save(st *localState) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	s.state = nil
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+
+	s.data, s.state = data, st
+	return nil
+}
+
+func (st *localState) begin() {
+	st.pending = st.Revision + 1
+	st.dirty = false
+	st.changed = false
+	st.headers = nil
+}
+
+// commit completes the operation and reports whether the state has to be saved
+func (st *localState) commit() bool {
+	save := st.dirty || st.changed
+	if st.dirty {
+		st.Revision = st.pending
+	}
+
+	for _, h := range st.headers {
+		h.Revision = st.Revision
+	}
+	st.headers = nil
+	st.dirty = false
+	st.changed = false
+
+	if n := len(st.Events) - localMaxEvents; n > 0 {
+		st.Compacted = max(st.Compacted, st.Events[n-1].KV.ModRevision)
+		st.Events = slices.Clone(st.Events[n:])
+	}
+
+	return save
+}
+
+// expire revokes leases expired before now in a single revision
+func (st *localState) expire(now time.Time) bool {
+	var expired []int64
+	for id, l := range st.Leases {
+		if now.After(l.Expires) {
+			expired = append(expired, id)
+		}
+	}
+
+	if len(expired) == 0 {
+		return false
+	}
+
+	st.begin()
+	for _, id := range expired {
+		st.revoke(id)
+	}
+	st.commit()
+
+	return true
+}
+
+func (st *localState) revoke(id int64) {
+	delete(st.Leases, id)
+	st.changed = true
+
+	for _, key := range st.sortedKeys() {
+		if st.Keys[key].Lease == id {
+			st.delete(key)
+		}
+	}
+}
+
+func (st *localState) sortedKeys() []string {
+	keys := make([]string, 0, len(st.Keys))
+	for key := range st.Keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// inRange reports whether the key is selected by a key and range end pair of a request
+func inRange(k, key, end []byte) bool {
+	switch {
+	case len(end) == 0:
+		return bytes.Equal(k, key)
+	case len(end) == 1 && end[0] == 0:
+		return bytes.Compare(k, key) >= 0
+	default:
+		return bytes.Compare(k, key) >= 0 && bytes.Compare(k, end) < 0
+	}
+}
+
+func (st *localState) match(key, end []byte) []string {
+	if len(end) == 0 {
+		if _, ok := st.Keys[string(key)]; ok {
+			return []string{string(key)}
+		}
+		return nil
+	}
+
+	var keys []string
+	for _, k := range st.sortedKeys() {
+		if inRange([]byte(k), key, end) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+func (kv *localKV) pb(key string) *mvccpb.KeyValue {
+	return &mvccpb.KeyValue{
+		Key:            []byte(key),
+		CreateRevision: kv.CreateRevision,
+		ModRevision:    kv.ModRevision,
+		Version:        kv.Version,
+		Value:          kv.Value,
+		Lease:          kv.Lease,
+	}
+}
+
+func (st *localState) header() *pb.ResponseHeader {
+	h := &pb.ResponseHeader{}
+	st.headers = append(st.headers, h)
+	return h
+}
+
+func (st *localState) put(key string, value []byte, lease int64) *localKV {
+	prev := st.Keys[key]
+
+	kv := &localKV{Value: value, CreateRevision: st.pending, ModRevision: st.pending, Version: 1, Lease: lease}
+	if prev != nil {
+		kv.CreateRevision = prev.CreateRevision
+		kv.Version = prev.Version + 1
+	}
+
+	st.Keys[key] = kv
+	st.Events = append(st.Events, localEvent{Key: key, KV: *kv, Prev: prev})
+	st.dirty = true
+
+	return prev
+}
+
+func (st *localState) delete(key string) *localKV {
+	prev := st.Keys[key]
+	delete(st.Keys, key)
+
+	st.Events = append(st.Events, localEvent{Delete: true, Key: key, KV: localKV{ModRevision: st.pending}, Prev: prev})
+	st.dirty = true
+
+	return prev
+}
+
+// Range serves the current state, reads at an older revision which is not compacted
+// yet are served from the current state as well
+func (st *localState) Range(r *pb.RangeRequest) (*pb.RangeResponse, error) {
+	if r.Revision > 0 && r.Revision <= st.Compacted {
+		return nil, rpctypes.ErrGRPCCompacted
+	}
+	if r.Revision > st.Revision {
+		return nil, rpctypes.ErrGRPCFutureRev
+	}
+
+	var kvs []*mvccpb.KeyValue
+	for _, key := range st.match(r.Key, r.RangeEnd) {
+		kv := st.Keys[key]
+		if (r.MinModRevision > 0 && kv.ModRevision < r.MinModRevision) ||
+			(r.MaxModRevision > 0 && kv.ModRevision > r.MaxModRevision) ||
+			(r.MinCreateRevision > 0 && kv.CreateRevision < r.MinCreateRevision) ||
+			(r.MaxCreateRevision > 0 && kv.CreateRevision > r.MaxCreateRevision) {
+			continue
+		}
+
+		kvs = append(kvs, kv.pb(key))
+	}
+
+	sortKVs(kvs, r.SortTarget, r.SortOrder)
+
+	resp := &pb.RangeResponse{Header: st.header(), Count: int64(len(kvs))}
+	if r.CountOnly {
+		return resp, nil
+	}
+
+	if r.Limit > 0 && int64(len(kvs)) > r.Limit {
+		kvs = kvs[:r.Limit]
+		resp.More = true
+	}
+
+	if r.KeysOnly {
+		for _, kv := range kvs {
+			kv.Value = nil
+		}
+	}
+	resp.Kvs = kvs
+
+	return resp, nil
+}
+
+func sortKVs(kvs []*mvccpb.KeyValue, target pb.RangeRequest_SortTarget, order pb.RangeRequest_SortOrder) {
+	if order == pb.RangeRequest_NONE {
+		if target == pb.RangeRequest_KEY {
+			return
+		}
+		order = pb.RangeRequest_ASCEND
+	}
+
+	sort.SliceStable(kvs, func(i, j int) bool {
+		a, b := kvs[i], kvs[j]
+		if order == pb.RangeRequest_DESCEND {
+			a, b = b, a
+		}
+
+		switch target {
+		case pb.RangeRequest_VERSION:
+			return a.Version < b.Version
+		case pb.RangeRequest_CREATE:
+			return a.CreateRevision < b.CreateRevision
+		case pb.RangeRequest_MOD:
+			return a.ModRevision < b.ModRevision
+		case pb.RangeRequest_VALUE:
+			return bytes.Compare(a.Value, b.Value) < 0
+		default:
+			return bytes.Compare(a.Key, b.Key) < 0
+		}
+	})
+}
+
+func (st *localState) Put(r *pb.PutRequest) (*pb.PutResponse, error) {
+	key := string(r.Key)
+	prev := st.Keys[key]
+
+	value, lease := r.Value, r.Lease
+	if r.IgnoreValue || r.IgnoreLease {
+		if prev == nil {
+			return nil, rpctypes.ErrGRPCKeyNotFound
+		}
+		if r.IgnoreValue {
+			value = prev.Value
+		}
+		if r.IgnoreLease {
+			lease = prev.Lease
+		}
+	}
+
+	if _, ok := st.Leases[lease]; lease != 0 && !ok {
+		return nil, rpctypes.ErrGRPCLeaseNotFound
+	}
+
+	st.put(key, value, lease)
+
+	resp := &pb.PutResponse{Header: st.header()}
+	if r.PrevKv && prev != nil {
+		resp.PrevKv = prev.pb(key)
+	}
+
+	return resp, nil
+}
+
+func (st *localState) DeleteRange(r *pb.DeleteRangeRequest) (*pb.DeleteRangeResponse, error) {
+	resp := &pb.DeleteRangeResponse{Header: st.header()}
+
+	for _, key := range st.match(r.Key, r.RangeEnd) {
+		prev := st.delete(key)
+		resp.Deleted++
+		if r.PrevKv {
+			resp.PrevKvs = append(resp.PrevKvs, prev.pb(key))
+		}
+	}
+
+	return resp, nil
+}
+
+func (st *localState) Txn(r *pb.TxnRequest) (*pb.TxnResponse, error) {
+	succeeded := true
+	for _, c := range r.Compare {
+		if !st.compare(c) {
+			succeeded = false
+			break
+		}
+	}
+
+	ops := r.Success
+	if !succeeded {
+		ops = r.Failure
+	}
+
+	resp := &pb.TxnResponse{Header: st.header(), Succeeded: succeeded}
+	for _, op := range ops {
+		rop, err := st.applyOp(op)
+		if err != nil {
+			return nil, err
+		}
+		resp.Responses = append(resp.Responses, rop)
+	}
+
+	return resp, nil
+}
+
+func (st *localState) applyOp(op *pb.RequestOp) (*pb.ResponseOp, error) {
+	switch {
+	case op.GetRequestRange() != nil:
+		resp, err := st.Range(op.GetRequestRange())
+		return &pb.ResponseOp{Response: &pb.ResponseOp_ResponseRange{ResponseRange: resp}}, err
+	case op.GetRequestPut() != nil:
+		resp, err := st.Put(op.GetRequestPut())
+		return &pb.ResponseOp{Response: &pb.ResponseOp_ResponsePut{ResponsePut: resp}}, err
+	case op.GetRequestDeleteRange() != nil:
+		resp, err := st.DeleteRange(op.GetRequestDeleteRange())
+		return &pb.ResponseOp{Response: &pb.ResponseOp_ResponseDeleteRange{ResponseDeleteRange: resp}}, err
+	case op.GetRequestTxn() != nil:
+		resp, err := st.Txn(op.GetRequestTxn())
+		return &pb.ResponseOp{Response: &pb.ResponseOp_ResponseTxn{ResponseTxn: resp}}, err
+	}
+
+	return nil, rpctypes.ErrGRPCEmptyKey
+}
+
+// compare evaluates a txn compare the way etcd does, a missing key has zero revisions,
+// version and lease and fails any value compare
+func (st *localState) compare(c *pb.Compare) bool {
+	keys := st.match(c.Key, c.RangeEnd)
+	if len(keys) == 0 {
+		if c.Target == pb.Compare_VALUE {
+			return false
+		}
+		return compareKV(c, &localKV{})
+	}
+
+	for _, key := range keys {
+		if !compareKV(c, st.Keys[key]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func compareKV(c *pb.Compare, kv *localKV) bool {
+	var n int
+	switch c.Target {
+	case pb.Compare_VERSION:
+		n = cmpInt(kv.Version, c.GetVersion())
+	case pb.Compare_CREATE:
+		n = cmpInt(kv.CreateRevision, c.GetCreateRevision())
+	case pb.Compare_MOD:
+		n = cmpInt(kv.ModRevision, c.GetModRevision())
+	case pb.Compare_VALUE:
+		n = bytes.Compare(kv.Value, c.GetValue())
+	case pb.Compare_LEASE:
+		n = cmpInt(kv.Lease, c.GetLease())
+	}
+
+	switch c.Result {
+	case pb.Compare_EQUAL:
+		return n == 0
+	case pb.Compare_GREATER:
+		return n > 0
+	case pb.Compare_LESS:
+		return n < 0
+	case pb.Compare_NOT_EQUAL:
+		return n != 0
+	}
+
+	return false
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (st *localState) Compact(r *pb.CompactionRequest) (*pb.CompactionResponse, error) {
+	if r.Revision <= st.Compacted {
+		return nil, rpctypes.ErrGRPCCompacted
+	}
+	if r.Revision > st.Revision {
+		return nil, rpctypes.ErrGRPCFutureRev
+	}
+
+	st.Compacted = r.Revision
+	n := sort.Search(len(st.Events), func(i int) bool { return st.Events[i].KV.ModRevision > r.Revision })
+	st.Events = slices.Clone(st.Events[n:])
+	st.changed = true
+
+	return &pb.CompactionResponse{Header: st.header()}, nil
+}
+
+func (st *localState) grant(id, ttl int64, now time.Time) (*pb.LeaseGrantResponse, error) {
+	if id == 0 {
+		id = st.NextLease
+		st.NextLease++
+	} else if _, ok := st.Leases[id]; ok {
+		return nil, rpctypes.ErrGRPCLeaseExist
+	}
+
+	ttl = max(ttl, 1)
+	st.Leases[id] = &localLease{TTL: ttl, Expires: now.Add(time.Duration(ttl) * time.Second)}
+	st.changed = true
+
+	return &pb.LeaseGrantResponse{Header: st.header(), ID: id, TTL: ttl}, nil
+}
+
+// keepAlive renews the lease, a TTL of zero reports the lease as expired. Clients keep
+// alive every third of the TTL, so a lease with more than half of its TTL left is not
+// renewed to spare writing the state file on every keep-alive.
+func (st *localState) keepAlive(id int64, now time.Time) *pb.LeaseKeepAliveResponse {
+	resp := &pb.LeaseKeepAliveResponse{Header: st.header(), ID: id}
+
+	if l, ok := st.Leases[id]; ok {
+		ttl := time.Duration(l.TTL) * time.Second
+		if l.Expires.Sub(now) <= ttl/2 {
+			l.Expires = now.Add(ttl)
+			st.changed = true
+		}
+		resp.TTL = l.TTL
+	}
+
+	return resp
+}
+
+func (st *localState) timeToLive(r *pb.LeaseTimeToLiveRequest, now time.Time) *pb.LeaseTimeToLiveResponse {
+	resp := &pb.LeaseTimeToLiveResponse{Header: st.header(), ID: r.ID, TTL: -1}
+
+	l, ok := st.Leases[r.ID]
+	if !ok {
+		return resp
+	}
+
+	resp.TTL = int64(l.Expires.Sub(now).Seconds())
+	resp.GrantedTTL = l.TTL
+
+	if r.Keys {
+		for _, key := range st.sortedKeys() {
+			if st.Keys[key].Lease == r.ID {
+				resp.Keys = append(resp.Keys, []byte(key))
+			}
+		}
+	}
+
+	return resp
+}
+
+// events returns watch events of the range starting at the revision
+func (st *localState) events(key, end []byte, from int64, prevKV bool, filters []pb.WatchCreateRequest_FilterType) []*mvccpb.Event {
+	var events []*mvccpb.Event
+
+	n := sort.Search(len(st.Events), func(i int) bool { return st.Events[i].KV.ModRevision >= from })
+	for _, ev := range st.Events[n:] {
+		if !inRange([]byte(ev.Key), key, end) {
+			continue
+		}
+
+		e := &mvccpb.Event{Kv: ev.KV.pb(ev.Key)}
+		if ev.Delete {
+			e.Type = mvccpb.DELETE
+		}
+
+		if (e.Type == mvccpb.PUT && slices.Contains(filters, pb.WatchCreateRequest_NOPUT)) ||
+			(e.Type == mvccpb.DELETE && slices.Contains(filters, pb.WatchCreateRequest_NODELETE)) {
+			continue
+		}
+
+		if prevKV && ev.Prev != nil {
+			e.PrevKv = ev.Prev.pb(ev.Key)
+		}
+
+		events = append(events, e)
+	}
+
+	return events
+}
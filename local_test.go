@@ -0,0 +1,232 @@
+package svcutil
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"golang.org/x/net/context"
+)
+
+func TestLocalStateTxn(t *testing.T) {
+	st := newLocalState()
+
+	create := &pb.TxnRequest{
+		Compare: []*pb.Compare{{Key: []byte("/lock/a"), Target: pb.Compare_CREATE, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_CreateRevision{}}},
+		Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte("/lock/a"), Value: []byte("x")}}}},
+		Failure: []*pb.RequestOp{{Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: []byte("/lock/a")}}}},
+	}
+
+	st.begin()
+	resp, err := st.Txn(create)
+	st.commit()
+	// an empty store is at revision 1 like etcd
+	if err != nil || !resp.Succeeded || resp.Header.Revision != 2 {
+		t.Fatalf("Txn() = %v, %v, want succeeded at revision 2", resp, err)
+	}
+
+	st.begin()
+	resp, err = st.Txn(create)
+	st.commit()
+	if err != nil || resp.Succeeded || resp.Header.Revision != 2 {
+		t.Fatalf("Txn() on an existing key = %v, %v, want failed at revision 2", resp, err)
+	}
+
+	kvs := resp.Responses[0].GetResponseRange().Kvs
+	if len(kvs) != 1 || string(kvs[0].Value) != "x" || kvs[0].CreateRevision != 2 {
+		t.Errorf("Txn() else range = %v", kvs)
+	}
+}
+
+func TestLocalStateExpire(t *testing.T) {
+	st := newLocalState()
+	now := time.Now()
+
+	st.begin()
+	grant, _ := st.grant(0, 5, now)
+	st.Put(&pb.PutRequest{Key: []byte("/host/a"), Value: []byte("1"), Lease: grant.ID})
+	st.Put(&pb.PutRequest{Key: []byte("/config/a"), Value: []byte("2")})
+	st.commit()
+
+	if st.expire(now.Add(time.Second)) {
+		t.Fatal("expire() revoked a live lease")
+	}
+
+	if !st.expire(now.Add(10*time.Second)) || st.Revision != 3 {
+		t.Fatalf("expire() did not revoke the lease, revision %d", st.Revision)
+	}
+
+	if _, ok := st.Keys["/host/a"]; ok {
+		t.Error("key attached to the expired lease is not deleted")
+	}
+
+	events := st.events([]byte("/"), []byte("0"), 3, true, nil)
+	if len(events) != 1 || string(events[0].Kv.Key) != "/host/a" || events[0].PrevKv == nil {
+		t.Errorf("events() = %v, want the delete of /host/a", events)
+	}
+}
+
+func TestLocalStateKeepAlive(t *testing.T) {
+	st := newLocalState()
+	now := time.Now()
+
+	st.begin()
+	grant, _ := st.grant(0, 6, now)
+	st.commit()
+
+	st.begin()
+	resp := st.keepAlive(grant.ID, now.Add(time.Second))
+	if st.commit() || resp.TTL != 6 {
+		t.Errorf("keepAlive() with most of the TTL left = %v, want TTL 6 not saved", resp)
+	}
+
+	st.begin()
+	resp = st.keepAlive(grant.ID, now.Add(4*time.Second))
+	if !st.commit() || resp.TTL != 6 {
+		t.Errorf("keepAlive() with less than half of the TTL left = %v, want TTL 6 saved", resp)
+	}
+	if want := now.Add(10 * time.Second); !st.Leases[grant.ID].Expires.Equal(want) {
+		t.Errorf("lease expires at %v, want %v", st.Leases[grant.ID].Expires, want)
+	}
+}
+
+func TestLocalStateRevoke(t *testing.T) {
+	st := newLocalState()
+
+	st.begin()
+	grant, _ := st.grant(0, 5, time.Now())
+	st.commit()
+
+	// a lease without keys changes no revision but must be saved
+	st.begin()
+	st.revoke(grant.ID)
+	if !st.commit() {
+		t.Error("commit() after revoking a lease without keys = false, want the state saved")
+	}
+	if _, ok := st.Leases[grant.ID]; ok || st.Revision != 1 {
+		t.Errorf("lease kept after revoke() or revision %d changed", st.Revision)
+	}
+}
+
+func TestLocalStoreShared(t *testing.T) {
+	dir := t.TempDir()
+
+	a, err := newLocalStore(dir)
+	if err != nil {
+		t.Fatalf("newLocalStore() error = %v", err)
+	}
+	b, _ := newLocalStore(dir)
+
+	put := func(s *localStore, key, value string) {
+		t.Helper()
+		err := s.update(func(st *localState) error {
+			_, err := st.Put(&pb.PutRequest{Key: []byte(key), Value: []byte(value)})
+			return err
+		})
+		if err != nil {
+			t.Fatalf("update() error = %v", err)
+		}
+	}
+
+	get := func(s *localStore, key string) (value string) {
+		t.Helper()
+		err := s.update(func(st *localState) error {
+			if kv := st.Keys[key]; kv != nil {
+				value = string(kv.Value)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("update() error = %v", err)
+		}
+		return value
+	}
+
+	put(a, "/config/a", "1")
+	if got := get(b, "/config/a"); got != "1" {
+		t.Fatalf("value read by another store = %q, want 1", got)
+	}
+
+	// a read does not rewrite the state file
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(a.path, old, old); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+	get(a, "/config/a")
+	if fi, err := os.Stat(a.path); err != nil || !fi.ModTime().Equal(old) {
+		t.Errorf("state file modified by a read")
+	}
+
+	// the cached state of a store is replaced once another store changes the file
+	put(b, "/config/a", "2")
+	if got := get(a, "/config/a"); got != "2" {
+		t.Errorf("value read after a change by another store = %q, want 2", got)
+	}
+}
+
+func TestLocalBackend(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	a, err := NewService(Name("billing"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer a.Close()
+
+	b, err := NewService(Name("billing"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer b.Close()
+
+	if _, err := a.AcquireLock(ctx, "migration"); err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	if _, err := b.AcquireLock(ctx, "migration"); !errors.Is(err, ErrMutexAlreadyAcquired) {
+		t.Fatalf("AcquireLock() held by another service error = %v, want %v", err, ErrMutexAlreadyAcquired)
+	}
+
+	if err := a.ReleaseLock(ctx, "migration"); err != nil {
+		t.Fatalf("ReleaseLock() error = %v", err)
+	}
+
+	if _, err := b.AcquireLock(ctx, "migration"); err != nil {
+		t.Fatalf("AcquireLock() after release error = %v", err)
+	}
+
+	type config struct {
+		Level string `json:"level"`
+	}
+
+	if err := a.SaveConfig(ctx, ConfigurationTypeService, &config{Level: "debug"}); err != nil {
+		t.Fatalf("SaveConfig() error = %v", err)
+	}
+
+	var loaded config
+	if err := b.LoadConfig(ctx, ConfigurationTypeService, &loaded); err != nil || loaded.Level != "debug" {
+		t.Fatalf("LoadConfig() = %+v, %v", loaded, err)
+	}
+
+	msgs, err := b.Subscribe(ctx, "deploys")
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	if _, err := a.Publish(ctx, "deploys", []byte("v2")); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	select {
+	case msg := <-msgs:
+		if string(msg.Payload) != "v2" {
+			t.Errorf("message payload = %q, want %q", msg.Payload, "v2")
+		}
+	case <-ctx.Done():
+		t.Fatal("published message is not delivered")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package svcutil
+
+import "os"
+
+// lockFile is a no-op where flock is not available, the local backend directory must
+// not be shared by several processes there
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
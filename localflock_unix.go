@@ -0,0 +1,17 @@
+//go:build unix
+
+package svcutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock of the file shared by all processes using it
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
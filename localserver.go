@@ -0,0 +1,471 @@
+package svcutil
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+const (
+	// localEndpoint is the endpoint the clients of the local backend are configured with,
+	// connections are made in process and never reach the network
+	localEndpoint = "svcutil-local:0"
+	// localPollInterval is how often changes made by other processes and expired leases are picked up
+	localPollInterval = 100 * time.Millisecond
+)
+
+// localDirFromEnv returns the directory of the local backend selected with SVCUTIL_BACKEND=local
+func localDirFromEnv() string {
+	if os.Getenv("SVCUTIL_BACKEND") != localBackend {
+		return ""
+	}
+
+	if dir := os.Getenv("SVCUTIL_LOCAL_DIR"); dir != "" {
+		return dir
+	}
+
+	return filepath.Join(os.TempDir(), "svcutil")
+}
+
+// localServer serves the etcd KV, lease and watch API from a localStore in process, so
+// the service runs with the same clients as with etcd
+type localServer struct {
+	pb.UnimplementedAuthServer
+	pb.UnimplementedMaintenanceServer
+
+	store *localStore
+	grpc  *grpc.Server
+	lis   *pipeListener
+
+	mu       sync.Mutex
+	revision int64
+	changed  chan struct{}
+
+	stopper chan struct{}
+	wg      sync.WaitGroup
+}
+
+func startLocalServer(dir string) (*localServer, error) {
+	store, err := newLocalStore(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &localServer{
+		store:   store,
+		grpc:    grpc.NewServer(),
+		lis:     newPipeListener(),
+		changed: make(chan struct{}),
+		stopper: make(chan struct{}),
+	}
+
+	pb.RegisterKVServer(s.grpc, s)
+	pb.RegisterLeaseServer(s.grpc, s)
+	pb.RegisterWatchServer(s.grpc, s)
+	pb.RegisterAuthServer(s.grpc, s)
+	pb.RegisterMaintenanceServer(s.grpc, s)
+
+	go s.grpc.Serve(s.lis)
+
+	s.wg.Add(1)
+	go s.poll()
+
+	return s, nil
+}
+
+// dialOption connects clients to the server in process
+func (s *localServer) dialOption() grpc.DialOption {
+	return s.lis.dialOption()
+}
+
+// inProcessServer serves the etcd API to clients of the service in process
+type inProcessServer interface {
+	dialOption() grpc.DialOption
+	close()
+}
+
+// pipeListener accepts in process connections made with net.Pipe, so the in process
+// servers never open a socket
+type pipeListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// dial hands the server end of a new pipe to Accept and returns the client end
+func (l *pipeListener) dial(ctx context.Context) (net.Conn, error) {
+	client, server := net.Pipe()
+
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.closed:
+	case <-ctx.Done():
+	}
+
+	client.Close()
+	server.Close()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, net.ErrClosed
+}
+
+// dialOption connects clients to the listener
+func (l *pipeListener) dialOption() grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return l.dial(ctx)
+	})
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return localEndpoint }
+
+func (s *localServer) close() {
+	close(s.stopper)
+	s.wg.Wait()
+	s.grpc.Stop()
+}
+
+// poll revokes expired leases and picks up changes made by other processes
+func (s *localServer) poll() {
+	defer s.wg.Done()
+
+	tk := time.NewTicker(localPollInterval)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-s.stopper:
+			return
+		case <-tk.C:
+		}
+
+		s.update(func(st *localState) error { return nil })
+	}
+}
+
+// update applies fn to the store and wakes up watches once the revision changes
+func (s *localServer) update(fn func(st *localState) error) error {
+	var rev int64
+	err := s.store.update(func(st *localState) error {
+		if err := fn(st); err != nil {
+			return err
+		}
+
+		rev = st.pending
+		if !st.dirty {
+			rev = st.Revision
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if rev != s.revision {
+		s.revision = rev
+		close(s.changed)
+		s.changed = make(chan struct{})
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// changes returns a channel closed on the next change of the revision
+func (s *localServer) changes() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.changed
+}
+
+func (s *localServer) Range(ctx context.Context, r *pb.RangeRequest) (resp *pb.RangeResponse, err error) {
+	err = s.update(func(st *localState) error {
+		resp, err = st.Range(r)
+		return err
+	})
+	return resp, err
+}
+
+func (s *localServer) Put(ctx context.Context, r *pb.PutRequest) (resp *pb.PutResponse, err error) {
+	err = s.update(func(st *localState) error {
+		resp, err = st.Put(r)
+		return err
+	})
+	return resp, err
+}
+
+func (s *localServer) DeleteRange(ctx context.Context, r *pb.DeleteRangeRequest) (resp *pb.DeleteRangeResponse, err error) {
+	err = s.update(func(st *localState) error {
+		resp, err = st.DeleteRange(r)
+		return err
+	})
+	return resp, err
+}
+
+func (s *localServer) Txn(ctx context.Context, r *pb.TxnRequest) (resp *pb.TxnResponse, err error) {
+	err = s.update(func(st *localState) error {
+		resp, err = st.Txn(r)
+		return err
+	})
+	return resp, err
+}
+
+func (s *localServer) Compact(ctx context.Context, r *pb.CompactionRequest) (resp *pb.CompactionResponse, err error) {
+	err = s.update(func(st *localState) error {
+		resp, err = st.Compact(r)
+		return err
+	})
+	return resp, err
+}
+
+func (s *localServer) LeaseGrant(ctx context.Context, r *pb.LeaseGrantRequest) (resp *pb.LeaseGrantResponse, err error) {
+	err = s.update(func(st *localState) error {
+		resp, err = st.grant(r.ID, r.TTL, time.Now())
+		return err
+	})
+	return resp, err
+}
+
+func (s *localServer) LeaseRevoke(ctx context.Context, r *pb.LeaseRevokeRequest) (resp *pb.LeaseRevokeResponse, err error) {
+	err = s.update(func(st *localState) error {
+		if _, ok := st.Leases[r.ID]; !ok {
+			return rpctypes.ErrGRPCLeaseNotFound
+		}
+
+		st.revoke(r.ID)
+		resp = &pb.LeaseRevokeResponse{Header: st.header()}
+		return nil
+	})
+	return resp, err
+}
+
+func (s *localServer) LeaseKeepAlive(stream pb.Lease_LeaseKeepAliveServer) error {
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var resp *pb.LeaseKeepAliveResponse
+		err = s.update(func(st *localState) error {
+			resp = st.keepAlive(r.ID, time.Now())
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *localServer) LeaseTimeToLive(ctx context.Context, r *pb.LeaseTimeToLiveRequest) (resp *pb.LeaseTimeToLiveResponse, err error) {
+	err = s.update(func(st *localState) error {
+		resp = st.timeToLive(r, time.Now())
+		return nil
+	})
+	return resp, err
+}
+
+func (s *localServer) LeaseLeases(ctx context.Context, r *pb.LeaseLeasesRequest) (resp *pb.LeaseLeasesResponse, err error) {
+	err = s.update(func(st *localState) error {
+		resp = &pb.LeaseLeasesResponse{Header: st.header()}
+		for id := range st.Leases {
+			resp.Leases = append(resp.Leases, &pb.LeaseStatus{ID: id})
+		}
+		return nil
+	})
+	return resp, err
+}
+
+// Authenticate reports auth as disabled, so clients configured with credentials connect as well
+func (s *localServer) Authenticate(ctx context.Context, r *pb.AuthenticateRequest) (*pb.AuthenticateResponse, error) {
+	return nil, rpctypes.ErrGRPCAuthNotEnabled
+}
+
+func (s *localServer) Alarm(ctx context.Context, r *pb.AlarmRequest) (*pb.AlarmResponse, error) {
+	return &pb.AlarmResponse{Header: &pb.ResponseHeader{}}, nil
+}
+
+func (s *localServer) Status(ctx context.Context, r *pb.StatusRequest) (resp *pb.StatusResponse, err error) {
+	err = s.update(func(st *localState) error {
+		resp = &pb.StatusResponse{Header: st.header(), Version: localBackend}
+		return nil
+	})
+	return resp, err
+}
+
+// localWatch is a watch of a stream, next is the first revision not delivered yet
+type localWatch struct {
+	key, end []byte
+	next     int64
+	prevKV   bool
+	filters  []pb.WatchCreateRequest_FilterType
+}
+
+func (s *localServer) Watch(stream pb.Watch_WatchServer) error {
+	ctx := stream.Context()
+
+	reqs := make(chan *pb.WatchRequest)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				errc <- err
+				return
+			}
+
+			select {
+			case reqs <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	watches := make(map[int64]*localWatch)
+	var nextID int64
+
+	for {
+		changed := s.changes()
+
+		var resps []*pb.WatchResponse
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errc:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-changed:
+		case req := <-reqs:
+			var err error
+			if resps, err = s.handleWatchRequest(req, watches, &nextID); err != nil {
+				return err
+			}
+		}
+
+		delivered, err := s.deliver(watches)
+		if err != nil {
+			return err
+		}
+
+		for _, resp := range append(resps, delivered...) {
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *localServer) handleWatchRequest(req *pb.WatchRequest, watches map[int64]*localWatch, nextID *int64) ([]*pb.WatchResponse, error) {
+	var resp *pb.WatchResponse
+
+	err := s.update(func(st *localState) error {
+		switch {
+		case req.GetCreateRequest() != nil:
+			r := req.GetCreateRequest()
+			w := &localWatch{key: r.Key, end: r.RangeEnd, next: r.StartRevision, prevKV: r.PrevKv, filters: r.Filters}
+			if w.next == 0 {
+				w.next = st.Revision + 1
+			}
+
+			id := *nextID
+			*nextID++
+			watches[id] = w
+			resp = &pb.WatchResponse{Header: st.header(), WatchId: id, Created: true}
+		case req.GetCancelRequest() != nil:
+			id := req.GetCancelRequest().WatchId
+			delete(watches, id)
+			resp = &pb.WatchResponse{Header: st.header(), WatchId: id, Canceled: true}
+		case req.GetProgressRequest() != nil:
+			resp = &pb.WatchResponse{Header: st.header(), WatchId: clientv3.InvalidWatchID}
+		}
+		return nil
+	})
+	if err != nil || resp == nil {
+		return nil, err
+	}
+
+	return []*pb.WatchResponse{resp}, nil
+}
+
+// deliver collects events of the watches after their last delivered revision, watches
+// behind the compacted revision are canceled the way etcd does
+func (s *localServer) deliver(watches map[int64]*localWatch) ([]*pb.WatchResponse, error) {
+	if len(watches) == 0 {
+		return nil, nil
+	}
+
+	var resps []*pb.WatchResponse
+	err := s.update(func(st *localState) error {
+		for id, w := range watches {
+			if w.next <= st.Compacted {
+				delete(watches, id)
+				resps = append(resps, &pb.WatchResponse{Header: st.header(), WatchId: id, Canceled: true, CompactRevision: st.Compacted})
+				continue
+			}
+
+			if w.next > st.Revision {
+				continue
+			}
+
+			events := st.events(w.key, w.end, w.next, w.prevKV, w.filters)
+			w.next = st.Revision + 1
+
+			if len(events) > 0 {
+				resps = append(resps, &pb.WatchResponse{Header: st.header(), WatchId: id, Events: events})
+			}
+		}
+		return nil
+	})
+
+	return resps, err
+}
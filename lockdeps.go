@@ -0,0 +1,156 @@
+package svcutil
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+var ErrLockReentrant = errors.New("lock re-entrant acquisition")
+var ErrLockCycle = errors.New("lock acquisition cycle")
+
+type lockOwnerKey struct{}
+
+// WithLockOwner marks locks acquired with the context as held by the owner, e.g. a
+// goroutine or a job. Acquisitions by owners are tracked within the process, so a lock
+// acquired again by its owner or an acquisition closing a cycle of owners waiting for
+// each other's locks fails with a DeadlockError instead of blocking. With LockWaitTimeout
+// an owner waits for a lock held by another owner of the process to be released.
+func WithLockOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, lockOwnerKey{}, owner)
+}
+
+func lockOwner(ctx context.Context) string {
+	owner, _ := ctx.Value(lockOwnerKey{}).(string)
+	return owner
+}
+
+// LockWait is an owner waiting for a lock
+type LockWait struct {
+	Owner string
+	Key   string
+}
+
+// DeadlockError lists the owners and locks of a refused acquisition, every owner waits for
+// the lock held by the owner of the next entry and the last one for the lock held by the
+// first owner. A re-entrant acquisition has a single entry. It matches ErrLockReentrant or
+// ErrLockCycle and ErrMutexAlreadyAcquired.
+type DeadlockError struct {
+	Cycle []LockWait
+	Err   error
+}
+
+func (e *DeadlockError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Err.Error())
+	b.WriteString(": ")
+
+	for n, w := range e.Cycle {
+		if n > 0 {
+			b.WriteString(", ")
+		}
+
+		holder := e.Cycle[(n+1)%len(e.Cycle)].Owner
+		b.WriteString(w.Owner + " waits for " + w.Key + " held by " + holder)
+	}
+
+	return b.String()
+}
+
+func (e *DeadlockError) Unwrap() []error {
+	return []error{e.Err, ErrMutexAlreadyAcquired}
+}
+
+// lockCycle follows the owners holding the lock and the locks they wait for, it returns
+// an error if a chain leads back to the owner. It must be called with c.lock held.
+func (c *Service) lockCycle(owner, key string) *DeadlockError {
+	visited := make(map[string]bool)
+
+	var follow func(cycle []LockWait) []LockWait
+	follow = func(cycle []LockWait) []LockWait {
+		rec, ok := c.mutexes[cycle[len(cycle)-1].Key]
+		if !ok || rec.owner == "" {
+			return nil
+		}
+
+		if rec.owner == owner {
+			return cycle
+		}
+
+		if visited[rec.owner] {
+			return nil
+		}
+		visited[rec.owner] = true
+
+		for _, next := range c.waiting[rec.owner] {
+			if found := follow(append(cycle[:len(cycle):len(cycle)], LockWait{Owner: rec.owner, Key: next})); found != nil {
+				return found
+			}
+		}
+
+		return nil
+	}
+
+	cycle := follow([]LockWait{{Owner: owner, Key: key}})
+	switch {
+	case cycle == nil:
+		return nil
+	case len(cycle) == 1:
+		return &DeadlockError{Cycle: cycle, Err: ErrLockReentrant}
+	default:
+		return &DeadlockError{Cycle: cycle, Err: ErrLockCycle}
+	}
+}
+
+// addWaiting records the owner waiting for the lock, an owner may wait for several locks
+// from different goroutines. It must be called with c.lock held.
+func (c *Service) addWaiting(owner, key string) {
+	if owner != "" {
+		c.waiting[owner] = append(c.waiting[owner], key)
+	}
+}
+
+// removeWaiting drops one wait of the owner for the lock. It must be called with c.lock held.
+func (c *Service) removeWaiting(owner, key string) {
+	keys := c.waiting[owner]
+	for n, k := range keys {
+		if k == key {
+			keys = append(keys[:n:n], keys[n+1:]...)
+			break
+		}
+	}
+
+	if len(keys) == 0 {
+		delete(c.waiting, owner)
+	} else {
+		c.waiting[owner] = keys
+	}
+}
+
+// waitLocalLock waits up to the lock wait timeout for the lock held by another owner of
+// the process to be released. It must be called with c.lock held and returns with it
+// released.
+func (c *Service) waitLocalLock(ctx context.Context, owner, key string, held *muRecord) error {
+	c.addWaiting(owner, key)
+	c.lock.Unlock()
+
+	timer := time.NewTimer(c.options.lockWaitTimeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-held.donec:
+	case <-timer.C:
+		err = ErrLockWaitTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	c.lock.Lock()
+	c.removeWaiting(owner, key)
+	c.lock.Unlock()
+
+	return err
+}
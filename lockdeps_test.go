@@ -0,0 +1,145 @@
+package svcutil
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestLockCycle(t *testing.T) {
+	c := &Service{
+		mutexes: map[string]*muRecord{
+			"/lock/a": {owner: "job-1"},
+			"/lock/b": {owner: "job-2"},
+			"/lock/c": {owner: "job-3"},
+			"/lock/d": {},
+		},
+		waiting: map[string][]string{
+			"job-2": {"/lock/d", "/lock/c"},
+			"job-3": {"/lock/a"},
+		},
+	}
+
+	if err := c.lockCycle("job-1", "/lock/d"); err != nil {
+		t.Errorf("lockCycle() of a lock held without owner = %v", err)
+	}
+
+	if err := c.lockCycle("job-4", "/lock/b"); err != nil {
+		t.Errorf("lockCycle() of a chain not leading back = %v", err)
+	}
+
+	err := c.lockCycle("job-1", "/lock/a")
+	if err == nil || !errors.Is(err, ErrLockReentrant) || !errors.Is(err, ErrMutexAlreadyAcquired) {
+		t.Fatalf("lockCycle() re-entrant = %v", err)
+	}
+
+	err = c.lockCycle("job-1", "/lock/b")
+	if err == nil || !errors.Is(err, ErrLockCycle) {
+		t.Fatalf("lockCycle() = %v, want a cycle", err)
+	}
+
+	want := []LockWait{{"job-1", "/lock/b"}, {"job-2", "/lock/c"}, {"job-3", "/lock/a"}}
+	if !reflect.DeepEqual(err.Cycle, want) {
+		t.Errorf("cycle = %v, want %v", err.Cycle, want)
+	}
+
+	msg := "lock acquisition cycle: job-1 waits for /lock/b held by job-2, job-2 waits for /lock/c held by job-3, job-3 waits for /lock/a held by job-1"
+	if err.Error() != msg {
+		t.Errorf("Error() = %q, want %q", err.Error(), msg)
+	}
+
+	// a cycle of other owners does not loop forever
+	c.waiting["job-3"] = []string{"/lock/b"}
+	if err := c.lockCycle("job-1", "/lock/b"); err != nil {
+		t.Errorf("lockCycle() through a cycle of other owners = %v", err)
+	}
+}
+
+func TestLockOwnerReentrant(t *testing.T) {
+	svc, err := NewService(Name("billing"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	ctx := WithLockOwner(context.Background(), "job-1")
+	if _, err := svc.AcquireLock(ctx, "migration"); err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	var derr *DeadlockError
+	if _, err := svc.AcquireLock(ctx, "migration"); !errors.As(err, &derr) || !errors.Is(err, ErrLockReentrant) {
+		t.Fatalf("AcquireLock() again by the owner error = %v, want %v", err, ErrLockReentrant)
+	}
+
+	if _, err := svc.AcquireLock(WithLockOwner(context.Background(), "job-2"), "migration"); errors.As(err, &derr) || !errors.Is(err, ErrMutexAlreadyAcquired) {
+		t.Errorf("AcquireLock() by another owner error = %v, want %v", err, ErrMutexAlreadyAcquired)
+	}
+}
+
+func TestLockOwnerCycle(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("billing"), LocalBackend(t.TempDir()), LockWaitTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	job1, job2 := WithLockOwner(ctx, "job-1"), WithLockOwner(ctx, "job-2")
+	if _, err := svc.AcquireLock(job1, "a"); err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+	if _, err := svc.AcquireLock(job2, "b"); err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	// job-1 waits for the lock of job-2
+	acquired := make(chan error, 1)
+	go func() {
+		_, err := svc.AcquireLock(job1, "b")
+		acquired <- err
+	}()
+
+	for {
+		svc.lock.Lock()
+		waiting := len(svc.waiting["job-1"])
+		svc.lock.Unlock()
+		if waiting > 0 {
+			break
+		}
+
+		select {
+		case err := <-acquired:
+			t.Fatalf("AcquireLock() of a lock held by another owner returned %v without waiting", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// and job-2 waiting for the lock of job-1 would close the cycle
+	started := time.Now()
+	var derr *DeadlockError
+	if _, err := svc.AcquireLock(job2, "a"); !errors.As(err, &derr) || !errors.Is(err, ErrLockCycle) {
+		t.Fatalf("AcquireLock() closing a cycle error = %v, want %v", err, ErrLockCycle)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("AcquireLock() closing a cycle took %v, want it refused without waiting", elapsed)
+	}
+
+	want := []LockWait{{"job-2", svc.lockKey(LockScopeService, "a")}, {"job-1", svc.lockKey(LockScopeService, "b")}}
+	if !reflect.DeepEqual(derr.Cycle, want) {
+		t.Errorf("cycle = %v, want %v", derr.Cycle, want)
+	}
+
+	// the waiting owner gets the lock once it's released
+	if err := svc.ReleaseLock(ctx, "b"); err != nil {
+		t.Fatalf("ReleaseLock() error = %v", err)
+	}
+	if err := <-acquired; err != nil {
+		t.Errorf("AcquireLock() after the release error = %v", err)
+	}
+}
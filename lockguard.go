@@ -0,0 +1,51 @@
+package svcutil
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// lockGuardReleaseTimeout bounds the release of a lock taken by WithLock, the context of
+// the caller may already be done by then
+const lockGuardReleaseTimeout = 5 * time.Second
+
+// WithLock acquires the named lock, runs fn and releases the lock once fn returns or
+// panics. The context of fn is canceled once the lock is lost, e.g. with the session.
+// The error of fn takes precedence over a failed release.
+func WithLock(ctx context.Context, locker Locker, name string, fn func(ctx context.Context) error) error {
+	_, err := WithLockValue(ctx, locker, name, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// WithLockValue is WithLock for functions returning a result
+func WithLockValue[T any](ctx context.Context, locker Locker, name string, fn func(ctx context.Context) (T, error)) (result T, err error) {
+	donec, err := locker.AcquireLock(ctx, name)
+	if err != nil {
+		return result, err
+	}
+
+	lctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-donec:
+			cancel()
+		case <-lctx.Done():
+		}
+	}()
+
+	defer func() {
+		rctx, rcancel := context.WithTimeout(context.Background(), lockGuardReleaseTimeout)
+		defer rcancel()
+
+		if releaseErr := locker.ReleaseLock(rctx, name); releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+	}()
+
+	return fn(lctx)
+}
@@ -0,0 +1,77 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestWithLock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("api"), Instance("worker"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	held := func() bool {
+		svc.lock.Lock()
+		defer svc.lock.Unlock()
+		_, ok := svc.mutexes[svc.lockKey(LockScopeService, "reindex")]
+		return ok
+	}
+
+	failed := errors.New("reindex failed")
+	err = WithLock(ctx, svc, "reindex", func(ctx context.Context) error {
+		if !held() {
+			t.Errorf("lock is not held while fn runs")
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("WithLock() error = %v, want the error of fn", err)
+	}
+	if held() {
+		t.Errorf("lock is held after WithLock() returned")
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("panic of fn is not propagated")
+			}
+		}()
+
+		WithLock(ctx, svc, "reindex", func(ctx context.Context) error {
+			panic("boom")
+		})
+	}()
+	if held() {
+		t.Errorf("lock is held after fn panicked")
+	}
+
+	count, err := WithLockValue(ctx, svc, "reindex", func(ctx context.Context) (int, error) {
+		return 42, nil
+	})
+	if err != nil || count != 42 {
+		t.Errorf("WithLockValue() = %d, %v, want 42", count, err)
+	}
+
+	// the lock is lost while fn runs
+	err = WithLock(ctx, svc, "reindex", func(lctx context.Context) error {
+		svc.ReleaseLock(ctx, "reindex")
+		select {
+		case <-lctx.Done():
+			return lctx.Err()
+		case <-ctx.Done():
+			return errors.New("context of fn is not canceled")
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("WithLock() error = %v, want context.Canceled", err)
+	}
+}
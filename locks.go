@@ -0,0 +1,76 @@
+package svcutil
+
+import (
+	"slices"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// Locker acquires named locks, the channel returned by AcquireLock is closed once the
+// lock is lost or released. Service implements it on etcd, the k8slease package on
+// Kubernetes Lease objects for clusters where etcd access is not allowed.
+type Locker interface {
+	AcquireLock(ctx context.Context, name string) (<-chan struct{}, error)
+	ReleaseLock(ctx context.Context, name string) error
+}
+
+var _ Locker = (*Service)(nil)
+
+// AcquireLocks acquires several named locks with all-or-nothing semantics. Names are
+// sorted and acquired in order so jobs requesting overlapping sets of locks can not
+// deadlock each other, already acquired locks are released if any of them fails.
+// The returned channel is closed once any of the locks is lost or released.
+func (c *Service) AcquireLocks(ctx context.Context, names []string) (<-chan struct{}, error) {
+	sorted := slices.Clone(names)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+
+	chans := make([]<-chan struct{}, 0, len(sorted))
+	for n, name := range sorted {
+		donec, err := c.AcquireLock(ctx, name)
+		if err != nil {
+			c.releaseLocks(sorted[:n])
+			return nil, err
+		}
+
+		chans = append(chans, donec)
+	}
+
+	donec := make(chan struct{})
+	var once sync.Once
+	for _, ch := range chans {
+		go func(ch <-chan struct{}) {
+			<-ch
+			once.Do(func() { close(donec) })
+		}(ch)
+	}
+
+	return donec, nil
+}
+
+// ReleaseLocks releases locks acquired with AcquireLocks in reverse order
+func (c *Service) ReleaseLocks(ctx context.Context, names []string) error {
+	sorted := slices.Clone(names)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+
+	var firstErr error
+	for n := len(sorted) - 1; n >= 0; n-- {
+		if err := c.ReleaseLock(ctx, sorted[n]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// releaseLocks rolls back partially acquired locks, the caller context may already be expired
+func (c *Service) releaseLocks(names []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.etcdDialTimeout)
+	defer cancel()
+
+	for n := len(names) - 1; n >= 0; n-- {
+		c.ReleaseLock(ctx, names[n])
+	}
+}
@@ -0,0 +1,134 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+func TestLockMaxWaiters(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	if _, err := NewService(Name("api"), LocalBackend(dir), LockMaxWaiters(1)); err != ErrInvalidLockOptions {
+		t.Fatalf("NewService() with LockMaxWaiters only error = %v, want %v", err, ErrInvalidLockOptions)
+	}
+
+	newService := func(opts ...func(*options) *options) *Service {
+		svc, err := NewService(append([]func(*options) *options{Name("api"), LocalBackend(dir)}, opts...)...)
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		t.Cleanup(svc.Close)
+		return svc
+	}
+
+	holder := newService()
+	if _, err := holder.AcquireLock(ctx, "job"); err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	waiter := newService(LockWaitTimeout(5*time.Second), LockMaxWaiters(1))
+	acquired := make(chan error, 1)
+	go func() {
+		_, err := waiter.AcquireLock(ctx, "job")
+		acquired <- err
+	}()
+
+	// the holder and the waiter are queued
+	key := holder.lockKey(LockScopeService, "job")
+	for {
+		resp, err := holder.etcd.Get(ctx, key+"/", clientv3.WithPrefix(), clientv3.WithCountOnly())
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if resp.Count == 2 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatal("the waiter was not queued")
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	rejected := newService(LockWaitTimeout(5*time.Second), LockMaxWaiters(1))
+	if _, err := rejected.AcquireLock(ctx, "job"); err != ErrLockQueueFull {
+		t.Errorf("AcquireLock() with a full queue error = %v, want %v", err, ErrLockQueueFull)
+	}
+
+	if err := holder.ReleaseLock(ctx, "job"); err != nil {
+		t.Fatalf("ReleaseLock() error = %v", err)
+	}
+	if err := <-acquired; err != nil {
+		t.Errorf("AcquireLock() of the waiter error = %v", err)
+	}
+}
+
+func TestAcquireLocks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	newService := func() *Service {
+		svc, err := NewService(Name("api"), LocalBackend(dir))
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		t.Cleanup(svc.Close)
+		return svc
+	}
+
+	holder, jobs, other := newService(), newService(), newService()
+	if _, err := holder.AcquireLock(ctx, "b"); err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	// a is acquired before b is found held and is released again
+	names := []string{"c", "a", "b", "a"}
+	if _, err := jobs.AcquireLocks(ctx, names); !errors.Is(err, ErrMutexAlreadyAcquired) {
+		t.Fatalf("AcquireLocks() with b held error = %v, want %v", err, ErrMutexAlreadyAcquired)
+	}
+	for _, name := range []string{"a", "c"} {
+		if _, err := other.AcquireLock(ctx, name); err != nil {
+			t.Fatalf("AcquireLock(%q) after a failed AcquireLocks error = %v", name, err)
+		}
+		if err := other.ReleaseLock(ctx, name); err != nil {
+			t.Fatalf("ReleaseLock(%q) error = %v", name, err)
+		}
+	}
+
+	if err := holder.ReleaseLock(ctx, "b"); err != nil {
+		t.Fatalf("ReleaseLock() error = %v", err)
+	}
+
+	donec, err := jobs.AcquireLocks(ctx, names)
+	if err != nil {
+		t.Fatalf("AcquireLocks() error = %v", err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := other.AcquireLock(ctx, name); !errors.Is(err, ErrMutexAlreadyAcquired) {
+			t.Errorf("AcquireLock(%q) held by AcquireLocks error = %v, want %v", name, err, ErrMutexAlreadyAcquired)
+		}
+	}
+
+	if err := jobs.ReleaseLocks(ctx, names); err != nil {
+		t.Fatalf("ReleaseLocks() error = %v", err)
+	}
+	select {
+	case <-donec:
+	case <-ctx.Done():
+		t.Fatal("channel of AcquireLocks is not closed after ReleaseLocks")
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := other.AcquireLock(ctx, name); err != nil {
+			t.Errorf("AcquireLock(%q) after ReleaseLocks error = %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package svcutil
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"golang.org/x/net/context"
+)
+
+// LockStat are the acquisition wait times and hold durations of a lock acquired by the Service
+type LockStat struct {
+	Acquisitions int64
+	LastWait     time.Duration
+	MaxWait      time.Duration
+	TotalWait    time.Duration
+
+	// Releases counts releases and losses of the lock
+	Releases  int64
+	LastHold  time.Duration
+	MaxHold   time.Duration
+	TotalHold time.Duration
+}
+
+type lockStatsRecorder struct {
+	m sync.Mutex
+	s map[string]*LockStat
+}
+
+func (r *lockStatsRecorder) stat(key string) *LockStat {
+	if r.s == nil {
+		r.s = make(map[string]*LockStat)
+	}
+
+	st, ok := r.s[key]
+	if !ok {
+		st = &LockStat{}
+		r.s[key] = st
+	}
+
+	return st
+}
+
+func (r *lockStatsRecorder) acquired(key string, wait time.Duration) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	st := r.stat(key)
+	st.Acquisitions++
+	st.LastWait = wait
+	st.MaxWait = max(st.MaxWait, wait)
+	st.TotalWait += wait
+}
+
+func (r *lockStatsRecorder) released(key string, hold time.Duration) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	st := r.stat(key)
+	st.Releases++
+	st.LastHold = hold
+	st.MaxHold = max(st.MaxHold, hold)
+	st.TotalHold += hold
+}
+
+func (r *lockStatsRecorder) snapshot() map[string]LockStat {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	stats := make(map[string]LockStat, len(r.s))
+	for key, st := range r.s {
+		stats[key] = *st
+	}
+
+	return stats
+}
+
+// LockStats returns the statistics of locks acquired by the service by lock key
+func (c *Service) LockStats() map[string]LockStat {
+	return c.lockStats.snapshot()
+}
+
+// lockTracing reports whether holders publish their identity for slow lock warnings
+func (c *Service) lockTracing() bool {
+	return c.options.slowLockThreshold > 0 || c.options.lockWaitersWarning > 0
+}
+
+// publishLockHolder stores the instance as the value of the holder key, it keeps the
+// create revision the mutex orders holders by, so other instances can name the holder
+func (c *Service) publishLockHolder(ctx context.Context, mutex *concurrency.Mutex) {
+	c.etcd.Put(ctx, mutex.Key(), c.options.instance, clientv3.WithIgnoreLease())
+}
+
+// lockHolder returns the identity published by the holder, the holder key if it has none
+func lockHolder(value, key []byte) string {
+	if len(value) > 0 {
+		return string(value)
+	}
+
+	return string(key)
+}
+
+// checkLockWaiters emits EventTypeLockContention when the lock has more holders and
+// waiters than allowed by LockWaitersWarning
+func (c *Service) checkLockWaiters(ctx context.Context, key string) {
+	resp, err := c.etcd.Get(ctx, key+"/", append(clientv3.WithFirstCreate(), clientv3.WithPrefix())...)
+	if err != nil || resp.Count <= int64(c.options.lockWaitersWarning) || len(resp.Kvs) == 0 {
+		return
+	}
+
+	c.emit(Event{
+		Type:     EventTypeLockContention,
+		Key:      key,
+		Value:    strconv.FormatInt(resp.Count, 10),
+		Instance: lockHolder(resp.Kvs[0].Value, resp.Kvs[0].Key),
+	})
+}
+
+// slowLock emits EventTypeLockSlow for a lock held longer than SlowLockWarning allows
+func (c *Service) slowLock(key string, mrec *muRecord) {
+	c.lock.Lock()
+	current, ok := c.mutexes[key]
+	c.lock.Unlock()
+
+	if !ok || current != mrec {
+		return
+	}
+
+	c.emit(Event{Type: EventTypeLockSlow, Key: key, Value: mrec.owner, Instance: c.options.instance})
+}
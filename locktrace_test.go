@@ -0,0 +1,128 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+func TestLockStatsRecorder(t *testing.T) {
+	var r lockStatsRecorder
+
+	r.acquired("/lock/a", 3*time.Second)
+	r.released("/lock/a", time.Minute)
+	r.acquired("/lock/a", time.Second)
+
+	st := r.snapshot()["/lock/a"]
+	want := LockStat{
+		Acquisitions: 2,
+		LastWait:     time.Second,
+		MaxWait:      3 * time.Second,
+		TotalWait:    4 * time.Second,
+		Releases:     1,
+		LastHold:     time.Minute,
+		MaxHold:      time.Minute,
+		TotalHold:    time.Minute,
+	}
+	if st != want {
+		t.Errorf("snapshot() = %+v, want %+v", st, want)
+	}
+}
+
+func TestSlowLockWarning(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events := make(chan Event, 10)
+	holder, err := NewService(Name("billing"), Instance("holder"), LocalBackend(dir),
+		SlowLockWarning(50*time.Millisecond), OnEvents(EventsFunc(func(e Event) { events <- e })))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer holder.Close()
+
+	if _, err := holder.AcquireLock(WithLockOwner(ctx, "migrator"), "migration"); err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	select {
+	case e := <-events:
+		if e.Type != EventTypeLockSlow || e.Value != "migrator" || e.Instance != "holder" {
+			t.Errorf("event = %+v, want EventTypeLockSlow of migrator", e)
+		}
+	case <-ctx.Done():
+		t.Fatal("slow lock event is not emitted")
+	}
+
+	if err := holder.ReleaseLock(ctx, "migration"); err != nil {
+		t.Fatalf("ReleaseLock() error = %v", err)
+	}
+
+	st := holder.LockStats()[holder.lockKey(LockScopeService, "migration")]
+	if st.Acquisitions != 1 || st.Releases != 1 || st.LastHold < 50*time.Millisecond {
+		t.Errorf("LockStats() = %+v", st)
+	}
+}
+
+func TestLockWaitersWarning(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	holder, err := NewService(Name("billing"), Instance("holder"), LocalBackend(dir), SlowLockWarning(time.Hour))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer holder.Close()
+
+	if _, err := holder.AcquireLock(ctx, "migration"); err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	events := make(chan Event, 10)
+	waiter, err := NewService(Name("billing"), LocalBackend(dir), LockWaitersWarning(1),
+		OnEvents(EventsFunc(func(e Event) { events <- e })))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer waiter.Close()
+
+	// the holder alone does not exceed the limit
+	waiter.AcquireLock(ctx, "migration")
+
+	queued, err := NewService(Name("billing"), LocalBackend(dir), LockWaitTimeout(time.Minute))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer queued.Close()
+
+	qctx, qcancel := context.WithCancel(ctx)
+	defer qcancel()
+	go queued.AcquireLock(qctx, "migration")
+
+	key := holder.lockKey(LockScopeService, "migration") + "/"
+	for {
+		resp, err := holder.etcd.Get(ctx, key, clientv3.WithPrefix(), clientv3.WithCountOnly())
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if resp.Count == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	waiter.AcquireLock(ctx, "migration")
+
+	select {
+	case e := <-events:
+		if e.Type != EventTypeLockContention || e.Value != "2" || e.Instance != "holder" {
+			t.Errorf("event = %+v, want contention of 2 held by holder", e)
+		}
+	case <-ctx.Done():
+		t.Fatal("lock contention event is not emitted")
+	}
+}
@@ -0,0 +1,76 @@
+package svcutil
+
+import (
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// lockVerifier checks at the interval of LockVerifyInterval that the held locks are
+// still held, see verifyLocks
+func (c *Service) lockVerifier() {
+	defer c.wg.Done()
+
+	tk := time.NewTicker(c.options.lockVerifyInterval)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-c.stopper:
+			return
+		case <-tk.C:
+			c.verifyLocks()
+		}
+	}
+}
+
+// verifyLocks checks that the key of every held mutex still exists with the lease of the
+// session. A lock whose key is gone, e.g. deleted by hand or by AdminBreakLock, is dropped:
+// its channel is closed and EventTypeLockLost is emitted with the lock key in Key. Locks
+// which can't be checked because of etcd errors are kept until the next check.
+func (c *Service) verifyLocks() {
+	c.lock.Lock()
+	session := c.session
+	held := make(map[string]*muRecord, len(c.mutexes))
+	for key, mrec := range c.mutexes {
+		// locks acquired in dry-run mode have no key
+		if mrec.mu != nil {
+			held[key] = mrec
+		}
+	}
+	c.lock.Unlock()
+
+	if session == nil {
+		return
+	}
+
+	for key, mrec := range held {
+		ctx, cancel := context.WithTimeout(context.Background(), c.options.etcdDialTimeout)
+		resp, err := c.etcd.Get(ctx, mrec.mu.Key())
+		cancel()
+
+		if err != nil {
+			continue
+		}
+
+		if len(resp.Kvs) > 0 && clientv3.LeaseID(resp.Kvs[0].Lease) == session.Lease() {
+			continue
+		}
+
+		c.lock.Lock()
+		// the lock may have been released or acquired again meanwhile
+		current, ok := c.mutexes[key]
+		lost := ok && current == mrec
+		if lost {
+			mrec.stop()
+			delete(c.mutexes, key)
+			c.lockStats.released(key, time.Since(mrec.acquired))
+		}
+		c.lock.Unlock()
+
+		if lost {
+			c.emit(Event{Type: EventTypeLockLost, Key: key})
+		}
+	}
+}
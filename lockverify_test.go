@@ -0,0 +1,62 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+func TestLockVerify(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	lost := make(chan string, 1)
+	svc, err := NewService(Name("api"), Instance("worker"), LocalBackend(t.TempDir()), LockVerifyInterval(20*time.Millisecond),
+		OnEvents(EventsFunc(func(ev Event) {
+			if ev.Type == EventTypeLockLost {
+				lost <- ev.Key
+			}
+		})))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	kept, err := svc.AcquireLock(ctx, "kept")
+	if err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	donec, err := svc.AcquireLock(ctx, "migration")
+	if err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	key := svc.lockKey(LockScopeService, "migration")
+	if _, err := svc.etcd.Delete(ctx, key+"/", clientv3.WithPrefix()); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	select {
+	case <-donec:
+	case <-ctx.Done():
+		t.Fatalf("lock channel is not closed after its key was deleted")
+	}
+
+	if got := <-lost; got != key {
+		t.Errorf("EventTypeLockLost key = %s, want %s", got, key)
+	}
+
+	select {
+	case <-kept:
+		t.Errorf("lock with its key in place was dropped")
+	default:
+	}
+
+	// the lost lock can be acquired again
+	if _, err := svc.AcquireLock(ctx, "migration"); err != nil {
+		t.Errorf("AcquireLock() after the lock was lost error = %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package svcutil
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+var ErrEtcdAlarm = errors.New("etcd alarm")
+var ErrInvalidMaintenanceOptions = errors.New("invalid maintenance options")
+
+// compactionElection is the election of the instance compacting revisions
+const compactionElection = "compaction"
+
+// MaintenanceOptions configures the routines started by StartMaintenance,
+// a routine with a zero interval is disabled
+type MaintenanceOptions struct {
+	// CompactKeyspace enables revision compaction. etcd compacts the whole keyspace at
+	// once, including keys of other services and tenants sharing the cluster, so it has
+	// to be enabled explicitly.
+	CompactKeyspace bool
+	// CompactInterval is the interval between revision compactions
+	CompactInterval time.Duration
+	// RetainRevisions is the number of most recent revisions kept by a compaction, it
+	// must be positive
+	RetainRevisions int64
+	// AlarmInterval is the interval between alarm checks
+	AlarmInterval time.Duration
+}
+
+// StartMaintenance starts periodic revision compaction and alarm checks until the context
+// is done or the service is closed. Compaction runs only with CompactKeyspace set and a
+// positive RetainRevisions, otherwise ErrInvalidMaintenanceOptions is returned, and only on
+// the instance of the service elected for it, see RunWhenLeader. etcd compacts the whole
+// keyspace at once, so the history of keys outside svcutil prefixes is compacted as well.
+// Compactions are reported with EventTypeCompacted, raised and cleared alarms such as
+// NOSPACE with EventTypeAlarm and EventTypeAlarmCleared, failed alarm checks with
+// EventTypeAlarm without Key.
+func (c *Service) StartMaintenance(ctx context.Context, opts MaintenanceOptions) error {
+	if opts.CompactInterval > 0 && (!opts.CompactKeyspace || opts.RetainRevisions <= 0) {
+		return ErrInvalidMaintenanceOptions
+	}
+
+	if opts.CompactInterval > 0 {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+
+			c.RunWhenLeader(ctx, compactionElection, func(ctx context.Context) error {
+				c.maintain(ctx, opts.CompactInterval, func() {
+					c.compact(ctx, opts.RetainRevisions)
+				})
+				return ctx.Err()
+			})
+		}()
+	}
+
+	if opts.AlarmInterval > 0 {
+		active := make(map[string]struct{})
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+
+			c.maintain(ctx, opts.AlarmInterval, func() {
+				c.checkAlarms(ctx, active)
+			})
+		}()
+	}
+
+	return nil
+}
+
+func (c *Service) maintain(ctx context.Context, interval time.Duration, run func()) {
+	tk := time.NewTicker(interval)
+	defer tk.Stop()
+
+	run()
+
+	for {
+		select {
+		case <-c.stopper:
+			return
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+			run()
+		}
+	}
+}
+
+// compactRevision returns the revision to compact at to keep the given number of revisions,
+// zero if there is nothing to compact
+func compactRevision(current, retain int64) int64 {
+	if retain <= 0 || current-retain <= 0 {
+		return 0
+	}
+
+	return current - retain
+}
+
+func (c *Service) compact(ctx context.Context, retain int64) {
+	cctx, cancel := context.WithTimeout(ctx, c.options.etcdDialTimeout)
+	defer cancel()
+
+	resp, err := c.etcd.Get(cctx, c.options.locksPrefix, clientv3.WithCountOnly())
+	if err != nil {
+		c.emit(Event{Type: EventTypeCompacted, Err: etcdError(err)})
+		return
+	}
+
+	rev := compactRevision(resp.Header.Revision, retain)
+	if rev == 0 {
+		return
+	}
+
+	_, err = c.etcd.Compact(cctx, rev)
+	c.emit(Event{Type: EventTypeCompacted, Value: fmt.Sprint(rev), Err: etcdError(err)})
+}
+
+// alarmKey identifies an alarm raised by a member, e.g. "NOSPACE/8e9e05c52164694d"
+func alarmKey(a *pb.AlarmMember) string {
+	return fmt.Sprintf("%s/%x", a.Alarm, a.MemberID)
+}
+
+// diffAlarms updates the set of active alarms and returns the raised and cleared ones
+func diffAlarms(active map[string]struct{}, alarms []*pb.AlarmMember) (raised, cleared []string) {
+	current := make(map[string]struct{}, len(alarms))
+	for _, a := range alarms {
+		if a.Alarm == pb.AlarmType_NONE {
+			continue
+		}
+
+		key := alarmKey(a)
+		current[key] = struct{}{}
+		if _, ok := active[key]; !ok {
+			active[key] = struct{}{}
+			raised = append(raised, key)
+		}
+	}
+
+	for key := range active {
+		if _, ok := current[key]; !ok {
+			delete(active, key)
+			cleared = append(cleared, key)
+		}
+	}
+
+	sort.Strings(raised)
+	sort.Strings(cleared)
+
+	return raised, cleared
+}
+
+func (c *Service) checkAlarms(ctx context.Context, active map[string]struct{}) {
+	actx, cancel := context.WithTimeout(ctx, c.options.etcdDialTimeout)
+	defer cancel()
+
+	resp, err := c.etcd.AlarmList(actx)
+	if err != nil {
+		c.emit(Event{Type: EventTypeAlarm, Err: etcdError(err)})
+		return
+	}
+
+	raised, cleared := diffAlarms(active, resp.Alarms)
+	for _, key := range raised {
+		c.emit(Event{Type: EventTypeAlarm, Key: key, Err: fmt.Errorf("%w: %s", ErrEtcdAlarm, key)})
+	}
+
+	for _, key := range cleared {
+		c.emit(Event{Type: EventTypeAlarmCleared, Key: key})
+	}
+}
@@ -0,0 +1,125 @@
+package svcutil
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"golang.org/x/net/context"
+)
+
+func TestCompactRevision(t *testing.T) {
+	tests := []struct {
+		current, retain, want int64
+	}{
+		{current: 1000, retain: 100, want: 900},
+		{current: 100, retain: 100, want: 0},
+		{current: 50, retain: 100, want: 0},
+		{current: 1000, retain: 0, want: 0},
+		{current: 1000, retain: -5, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := compactRevision(tt.current, tt.retain); got != tt.want {
+			t.Errorf("compactRevision(%d, %d) = %d, want %d", tt.current, tt.retain, got, tt.want)
+		}
+	}
+}
+
+func TestDiffAlarms(t *testing.T) {
+	active := make(map[string]struct{})
+
+	steps := []struct {
+		alarms  []*pb.AlarmMember
+		raised  []string
+		cleared []string
+	}{
+		{
+			alarms: []*pb.AlarmMember{{MemberID: 0x1a, Alarm: pb.AlarmType_NOSPACE}, {MemberID: 0x2b, Alarm: pb.AlarmType_NONE}},
+			raised: []string{"NOSPACE/1a"},
+		},
+		{
+			alarms: []*pb.AlarmMember{{MemberID: 0x1a, Alarm: pb.AlarmType_NOSPACE}, {MemberID: 0x2b, Alarm: pb.AlarmType_CORRUPT}},
+			raised: []string{"CORRUPT/2b"},
+		},
+		{
+			alarms:  []*pb.AlarmMember{{MemberID: 0x2b, Alarm: pb.AlarmType_CORRUPT}},
+			cleared: []string{"NOSPACE/1a"},
+		},
+		{
+			cleared: []string{"CORRUPT/2b"},
+		},
+	}
+
+	for i, step := range steps {
+		raised, cleared := diffAlarms(active, step.alarms)
+		if !reflect.DeepEqual(raised, step.raised) || !reflect.DeepEqual(cleared, step.cleared) {
+			t.Errorf("step %d: diffAlarms() = %v, %v, want %v, %v", i, raised, cleared, step.raised, step.cleared)
+		}
+	}
+}
+
+func TestStartMaintenanceOptions(t *testing.T) {
+	svc, err := NewService(Name("api"), Instance("worker"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	invalid := []MaintenanceOptions{
+		{CompactInterval: time.Second, RetainRevisions: 100},
+		{CompactKeyspace: true, CompactInterval: time.Second},
+		{CompactKeyspace: true, CompactInterval: time.Second, RetainRevisions: -1},
+	}
+	for _, opts := range invalid {
+		if err := svc.StartMaintenance(ctx, opts); !errors.Is(err, ErrInvalidMaintenanceOptions) {
+			t.Errorf("StartMaintenance(%+v) error = %v, want ErrInvalidMaintenanceOptions", opts, err)
+		}
+	}
+}
+
+func TestCompactionElected(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	var mu sync.Mutex
+	compacted := make(map[string]int)
+
+	for _, instance := range []string{"a", "b", "c"} {
+		svc, err := NewService(Name("api"), Instance(instance), LocalBackend(dir), OnEvents(EventsFunc(func(ev Event) {
+			if ev.Type == EventTypeCompacted && ev.Err == nil {
+				mu.Lock()
+				compacted[instance]++
+				mu.Unlock()
+			}
+		})))
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		defer svc.Close()
+
+		for n := 0; n < 5; n++ {
+			svc.etcd.Put(ctx, "/history", instance)
+		}
+
+		opts := MaintenanceOptions{CompactKeyspace: true, CompactInterval: 20 * time.Millisecond, RetainRevisions: 1}
+		if err := svc.StartMaintenance(ctx, opts); err != nil {
+			t.Fatalf("StartMaintenance() error = %v", err)
+		}
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(compacted) != 1 {
+		t.Errorf("instances compacting = %v, want a single elected one", compacted)
+	}
+}
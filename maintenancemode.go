@@ -0,0 +1,195 @@
+package svcutil
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// Maintenance is a maintenance switch turned on with SetMaintenance
+type Maintenance struct {
+	Scope    LockScope `json:"scope"`
+	Reason   string    `json:"reason"`
+	Instance string    `json:"instance"`
+	Time     time.Time `json:"time"`
+}
+
+// maintenanceKey is the key of the switch of the scope, scopes are the ones of locks and
+// LockScopeScope falls back to the service without a service scope. Every scope has its
+// own segment under the maintenance prefix, so switches never collide with each other or
+// with keys of services.
+func (c *Service) maintenanceKey(scope LockScope) string {
+	switch scope {
+	case LockScopeGlobal:
+		return c.options.maintenancePrefix + "global"
+	case LockScopeScope:
+		if c.options.serviceScope != "" {
+			return c.options.maintenancePrefix + "scope/" + c.options.serviceScope
+		}
+	case LockScopeHost:
+		return c.options.maintenancePrefix + "host/" + c.options.serviceName + "/" + c.options.hostname
+	}
+
+	return c.options.maintenancePrefix + "service/" + c.options.serviceName
+}
+
+// maintenanceKeys are the switches applying to the instance, widest scope first
+func (c *Service) maintenanceKeys() []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, scope := range []LockScope{LockScopeGlobal, LockScopeScope, LockScopeService, LockScopeHost} {
+		if key := c.maintenanceKey(scope); !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// SetMaintenance turns the maintenance switch of the scope on or off: LockScopeGlobal
+// applies to all services, LockScopeScope to services of the scope, LockScopeService to
+// instances of the service and LockScopeHost to instances of the service on the host.
+// Instances react to it with IsMaintenance or WatchMaintenance, e.g. reject writes.
+func (c *Service) SetMaintenance(ctx context.Context, scope LockScope, on bool, reason string) error {
+	key := c.maintenanceKey(scope)
+
+	if !on {
+		if _, err := c.etcd.Delete(ctx, key); err != nil {
+			return &ConfigError{Key: key, Op: "maintenance", Err: etcdError(err)}
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(Maintenance{
+		Scope:    scope,
+		Reason:   reason,
+		Instance: c.options.instance,
+		Time:     time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.etcd.Put(ctx, key, string(data)); err != nil {
+		return &ConfigError{Key: key, Op: "maintenance", Err: etcdError(err)}
+	}
+
+	return nil
+}
+
+// IsMaintenance reports whether a maintenance switch applying to the instance is on and
+// returns the switches turned on, widest scope first
+func (c *Service) IsMaintenance(ctx context.Context) (bool, []Maintenance, error) {
+	active, _, err := c.readMaintenance(ctx)
+	if err != nil {
+		return false, nil, err
+	}
+
+	return len(active) > 0, active, nil
+}
+
+func (c *Service) readMaintenance(ctx context.Context) ([]Maintenance, int64, error) {
+	keys := c.maintenanceKeys()
+
+	ops := make([]clientv3.Op, len(keys))
+	for n, key := range keys {
+		ops[n] = clientv3.OpGet(key)
+	}
+
+	resp, err := c.etcd.Txn(ctx).Then(ops...).Commit()
+	if err != nil {
+		return nil, 0, &ConfigError{Key: keys[0], Op: "maintenance", Err: etcdError(err)}
+	}
+
+	var active []Maintenance
+	for _, r := range resp.Responses {
+		for _, kv := range r.GetResponseRange().Kvs {
+			var m Maintenance
+			if err := json.Unmarshal(kv.Value, &m); err != nil {
+				return nil, 0, &ConfigError{Key: string(kv.Key), Op: "maintenance", Err: err}
+			}
+			active = append(active, m)
+		}
+	}
+
+	return active, resp.Header.Revision, nil
+}
+
+// WatchMaintenance calls onChange with the current maintenance state of the instance, see
+// IsMaintenance, and again after every change of a switch applying to it until ctx is done
+func (c *Service) WatchMaintenance(ctx context.Context, onChange func(on bool, active []Maintenance)) {
+	go c.watchMaintenance(ctx, onChange)
+}
+
+func (c *Service) watchMaintenance(ctx context.Context, onChange func(on bool, active []Maintenance)) {
+	var last []Maintenance
+	first := true
+	closed := 0
+
+	for ctx.Err() == nil {
+		active, rev, err := c.readMaintenance(ctx)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+			case <-c.stopper:
+				return
+			case <-time.After(c.options.retryInterval):
+			}
+			continue
+		}
+
+		if first || !reflect.DeepEqual(active, last) {
+			first, last = false, active
+			onChange(len(active) > 0, active)
+		}
+
+		if c.retryWatch(ctx, c.waitKeysChange(ctx, c.maintenanceKeys(), rev), &closed) != nil {
+			return
+		}
+	}
+}
+
+// waitKeysChange waits for a change of any of the keys, or under the prefixes with
+// WithPrefix, after the revision. A watch failing or closing first returns errWatchClosed,
+// see retryWatch.
+func (c *Service) waitKeysChange(ctx context.Context, keys []string, rev int64, opts ...clientv3.OpOption) error {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// every watch reports once, the buffer keeps the others from blocking
+	changed := make(chan bool, len(keys))
+	for _, key := range keys {
+		go func(watchChan clientv3.WatchChan) {
+			for wresp := range watchChan {
+				if wresp.Err() != nil {
+					break
+				}
+
+				if len(wresp.Events) > 0 {
+					changed <- true
+					return
+				}
+			}
+			changed <- false
+		}(c.etcd.Watch(wctx, key, append(opts, clientv3.WithRev(rev+1))...))
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.stopper:
+		return context.Canceled
+	case ok := <-changed:
+		if ok {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return errWatchClosed
+	}
+}
@@ -0,0 +1,126 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	newService := func(name, instance string) *Service {
+		svc, err := NewService(Name(name), Instance(instance), LocalBackend(dir))
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		t.Cleanup(svc.Close)
+		return svc
+	}
+
+	operator := newService("api", "operator")
+	worker := newService("api", "worker")
+	other := newService("billing", "worker")
+
+	changes := make(chan bool, 10)
+	worker.WatchMaintenance(ctx, func(on bool, active []Maintenance) { changes <- on })
+
+	expect := func(want bool) {
+		t.Helper()
+		select {
+		case on := <-changes:
+			if on != want {
+				t.Fatalf("maintenance notification = %v, want %v", on, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("no maintenance notification, want %v", want)
+		}
+	}
+
+	expect(false)
+
+	if err := operator.SetMaintenance(ctx, LockScopeService, true, "schema migration"); err != nil {
+		t.Fatalf("SetMaintenance() error = %v", err)
+	}
+	expect(true)
+
+	on, active, err := worker.IsMaintenance(ctx)
+	if err != nil {
+		t.Fatalf("IsMaintenance() error = %v", err)
+	}
+	if !on || len(active) != 1 || active[0].Reason != "schema migration" || active[0].Instance != "operator" || active[0].Scope != LockScopeService {
+		t.Errorf("IsMaintenance() = %v, %+v", on, active)
+	}
+
+	if on, _, _ := other.IsMaintenance(ctx); on {
+		t.Errorf("maintenance of api applies to billing")
+	}
+
+	if err := other.SetMaintenance(ctx, LockScopeGlobal, true, "etcd upgrade"); err != nil {
+		t.Fatalf("SetMaintenance() error = %v", err)
+	}
+	expect(true)
+
+	if _, active, _ := worker.IsMaintenance(ctx); len(active) != 2 || active[0].Scope != LockScopeGlobal {
+		t.Errorf("IsMaintenance() active = %+v, want global and service switches", active)
+	}
+
+	for _, scope := range []LockScope{LockScopeService, LockScopeGlobal} {
+		if err := operator.SetMaintenance(ctx, scope, false, ""); err != nil {
+			t.Fatalf("SetMaintenance() error = %v", err)
+		}
+	}
+
+	// turning off the service switch may be seen before the global one
+	for on := true; on; {
+		select {
+		case on = <-changes:
+		case <-ctx.Done():
+			t.Fatalf("no maintenance notification after the switches were turned off")
+		}
+	}
+
+	if on, _, _ := worker.IsMaintenance(ctx); on {
+		t.Errorf("IsMaintenance() = true after the switches were turned off")
+	}
+}
+
+func TestMaintenanceSurvivesGC(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	svc, err := NewService(Name("api"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	// a service named like the segment of the switches doesn't see them
+	named, err := NewService(Name("maintenance"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer named.Close()
+
+	for _, scope := range []LockScope{LockScopeGlobal, LockScopeService, LockScopeHost} {
+		if err := svc.SetMaintenance(ctx, scope, true, "upgrade"); err != nil {
+			t.Fatalf("SetMaintenance() error = %v", err)
+		}
+	}
+
+	if _, err := svc.GC(ctx, 0, false); err != nil {
+		t.Fatalf("GC() error = %v", err)
+	}
+
+	if _, active, err := svc.IsMaintenance(ctx); err != nil || len(active) != 3 {
+		t.Errorf("IsMaintenance() after GC = %+v, %v, want 3 switches", active, err)
+	}
+
+	if _, active, err := named.IsMaintenance(ctx); err != nil || len(active) != 1 || active[0].Scope != LockScopeGlobal {
+		t.Errorf("IsMaintenance() of the maintenance service = %+v, %v, want the global switch", active, err)
+	}
+}
@@ -0,0 +1,107 @@
+package svcutil
+
+import (
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// Operation executes a single etcd key-value request (get, put, delete or txn)
+type Operation func(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error)
+
+// MiddlewareFunc wraps an Operation, e.g. to inject retries, metrics or faults
+type MiddlewareFunc func(next Operation) Operation
+
+// middlewareKV routes every key-value request through the middleware chain. It replaces
+// the KV of the etcd client, so key-value requests made by sessions and mutexes are covered
+// as well. Compactions and the lease and watch APIs of the client bypass it.
+type middlewareKV struct {
+	kv clientv3.KV
+	do Operation
+}
+
+func newMiddlewareKV(kv clientv3.KV, middleware []MiddlewareFunc) *middlewareKV {
+	do := kv.Do
+	// the first middleware is the outermost one
+	for n := len(middleware) - 1; n >= 0; n-- {
+		do = middleware[n](do)
+	}
+
+	return &middlewareKV{
+		kv: kv,
+		do: do,
+	}
+}
+
+func (m *middlewareKV) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	resp, err := m.do(ctx, clientv3.OpPut(key, val, opts...))
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Put(), nil
+}
+
+func (m *middlewareKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	resp, err := m.do(ctx, clientv3.OpGet(key, opts...))
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Get(), nil
+}
+
+func (m *middlewareKV) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	resp, err := m.do(ctx, clientv3.OpDelete(key, opts...))
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Del(), nil
+}
+
+func (m *middlewareKV) Compact(ctx context.Context, rev int64, opts ...clientv3.CompactOption) (*clientv3.CompactResponse, error) {
+	return m.kv.Compact(ctx, rev, opts...)
+}
+
+func (m *middlewareKV) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+	return m.do(ctx, op)
+}
+
+func (m *middlewareKV) Txn(ctx context.Context) clientv3.Txn {
+	return &middlewareTxn{
+		ctx: ctx,
+		kv:  m,
+	}
+}
+
+type middlewareTxn struct {
+	ctx   context.Context
+	kv    *middlewareKV
+	cmps  []clientv3.Cmp
+	thens []clientv3.Op
+	elses []clientv3.Op
+}
+
+func (t *middlewareTxn) If(cs ...clientv3.Cmp) clientv3.Txn {
+	t.cmps = append(t.cmps, cs...)
+	return t
+}
+
+func (t *middlewareTxn) Then(ops ...clientv3.Op) clientv3.Txn {
+	t.thens = append(t.thens, ops...)
+	return t
+}
+
+func (t *middlewareTxn) Else(ops ...clientv3.Op) clientv3.Txn {
+	t.elses = append(t.elses, ops...)
+	return t
+}
+
+func (t *middlewareTxn) Commit() (*clientv3.TxnResponse, error) {
+	resp, err := t.kv.do(t.ctx, clientv3.OpTxn(t.cmps, t.thens, t.elses))
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Txn(), nil
+}
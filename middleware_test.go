@@ -0,0 +1,81 @@
+package svcutil
+
+import (
+	"reflect"
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+type fakeKV struct {
+	clientv3.KV
+	ops []clientv3.Op
+}
+
+func (f *fakeKV) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+	f.ops = append(f.ops, op)
+
+	switch {
+	case op.IsGet():
+		return (&clientv3.GetResponse{Kvs: []*mvccpb.KeyValue{{Key: op.KeyBytes(), Value: []byte("value")}}}).OpResponse(), nil
+	case op.IsPut():
+		return (&clientv3.PutResponse{}).OpResponse(), nil
+	case op.IsDelete():
+		return (&clientv3.DeleteResponse{Deleted: 1}).OpResponse(), nil
+	default:
+		return (&clientv3.TxnResponse{Succeeded: true}).OpResponse(), nil
+	}
+}
+
+func TestMiddlewareKV(t *testing.T) {
+	var calls []string
+	record := func(name string) MiddlewareFunc {
+		return func(next Operation) Operation {
+			return func(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+				calls = append(calls, name+":"+string(op.KeyBytes()))
+				return next(ctx, op)
+			}
+		}
+	}
+
+	fake := &fakeKV{}
+	kv := newMiddlewareKV(fake, []MiddlewareFunc{record("outer"), record("inner")})
+	ctx := context.Background()
+
+	resp, err := kv.Get(ctx, "/a")
+	if err != nil || len(resp.Kvs) != 1 || string(resp.Kvs[0].Value) != "value" {
+		t.Fatalf("Get() = %v, %v", resp, err)
+	}
+
+	if _, err := kv.Put(ctx, "/b", "1"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	if resp, err := kv.Delete(ctx, "/c"); err != nil || resp.Deleted != 1 {
+		t.Fatalf("Delete() = %v, %v", resp, err)
+	}
+
+	txnResp, err := kv.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision("/d"), "=", 0)).
+		Then(clientv3.OpPut("/d", "1")).
+		Commit()
+	if err != nil || !txnResp.Succeeded {
+		t.Fatalf("Txn() = %v, %v", txnResp, err)
+	}
+
+	expected := []string{
+		"outer:/a", "inner:/a",
+		"outer:/b", "inner:/b",
+		"outer:/c", "inner:/c",
+		"outer:", "inner:",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("middleware calls = %v, want %v", calls, expected)
+	}
+
+	if len(fake.ops) != 4 || !fake.ops[3].IsTxn() {
+		t.Errorf("underlying KV received %d ops, want 4 ending with txn", len(fake.ops))
+	}
+}
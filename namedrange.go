@@ -0,0 +1,84 @@
+package svcutil
+
+import (
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// ParseRangeDefinition parses a range definition, the value optionally prefixed with its
+// type: "id:" (default), "weighted:", "ip:", "host:", "mac:" or "vlan:", e.g.
+// "ip:10.0.0.1-10.0.0.20". The options are passed to the range constructor.
+func ParseRangeDefinition(def string, opts ...RangeOption) (*Range, error) {
+	def = strings.TrimSpace(def)
+
+	kind, value, ok := strings.Cut(def, ":")
+	if !ok {
+		return NewIDRange(def, opts...)
+	}
+
+	switch strings.TrimSpace(kind) {
+	case "id":
+		return NewIDRange(value, opts...)
+	case "weighted":
+		return NewWeightedIDRange(value, opts...)
+	case "ip":
+		return NewIPRange(value, opts...)
+	case "host":
+		return NewHostRange(value, opts...)
+	case "mac":
+		return NewMACRange(value, opts...)
+	case "vlan":
+		return NewVLANRange(value, opts...)
+	}
+
+	// no type prefix, e.g. a stride "0-100:5"
+	return NewIDRange(def, opts...)
+}
+
+// rangeKey is the key of the definition of the named range, named ranges are kept apart
+// from the service config so config listings and LoadConfigMap never see them
+func (c *Service) rangeKey(name string) string {
+	return configKey(c.options.rangesPrefix+c.options.serviceName+"/", name)
+}
+
+// LoadRange reads the definition of the named range from the "<name>" key under the ranges
+// prefix of the service and parses it with ParseRangeDefinition, so pools are managed centrally
+// instead of being passed to each binary. Payloads of the members are attached, see
+// LoadRangePayloads.
+func (c *Service) LoadRange(ctx context.Context, name string) (*Range, error) {
+	key := c.rangeKey(name)
+
+	def, err := GetConfigValue[string](ctx, c, ConfigurationTypeService, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.loadNamedRange(ctx, name, key, def)
+}
+
+// WatchRange calls onChange with the named range and again after every change of its
+// definition until ctx is done, see LoadRange. A deleted definition is reported with
+// ErrConfigKeyNotFound, an invalid one with the parse error. Payloads are read again with
+// every change of the definition, changes of payloads alone are not reported.
+func (c *Service) WatchRange(ctx context.Context, name string, onChange func(*Range, error)) {
+	key := c.rangeKey(name)
+
+	WatchConfigValue(ctx, c, ConfigurationTypeService, key, func(def string, err error) {
+		if err != nil {
+			onChange(nil, err)
+			return
+		}
+
+		onChange(c.loadNamedRange(ctx, name, key, def))
+	})
+}
+
+func parseNamedRange(key, def string) (*Range, error) {
+	r, err := ParseRangeDefinition(def)
+	if err != nil {
+		return nil, &ConfigError{Key: key, Op: "parse", Err: err}
+	}
+
+	return r, nil
+}
@@ -0,0 +1,110 @@
+package svcutil
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestParseRangeDefinition(t *testing.T) {
+	tests := []struct {
+		def    string
+		typ    RangeType
+		values []string
+	}{
+		{"1-3", RangeTypeID, []string{"1", "2", "3"}},
+		{"0-10:5", RangeTypeID, []string{"0", "5", "10"}},
+		{"id: 4,5", RangeTypeID, []string{"4", "5"}},
+		{"weighted:1=3,2", RangeTypeID, []string{"1", "2"}},
+		{"ip:10.0.0.1-10.0.0.2", RangeTypeIP, []string{"10.0.0.1", "10.0.0.2"}},
+		{"ip:2001:db8::1,2001:db8::2", RangeTypeIP, []string{"2001:db8::1", "2001:db8::2"}},
+		{"host:node1-node2", RangeTypeHost, []string{"node1", "node2"}},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseRangeDefinition(tt.def)
+		if err != nil {
+			t.Errorf("ParseRangeDefinition(%q) error = %v", tt.def, err)
+			continue
+		}
+
+		if r.Type != tt.typ || !reflect.DeepEqual(r.Values, tt.values) {
+			t.Errorf("ParseRangeDefinition(%q) = %v %v, want %v %v", tt.def, r.Type, r.Values, tt.typ, tt.values)
+		}
+	}
+
+	for _, def := range []string{"", "mac:1-2", "ip:1-2"} {
+		if _, err := ParseRangeDefinition(def); err == nil {
+			t.Errorf("ParseRangeDefinition(%q) error = nil", def)
+		}
+	}
+}
+
+func TestWatchRange(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("api"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	if _, err := svc.LoadRange(ctx, "shards"); !errors.Is(err, ErrConfigKeyNotFound) {
+		t.Fatalf("LoadRange() of a missing range error = %v, want %v", err, ErrConfigKeyNotFound)
+	}
+
+	if _, err := svc.etcd.Put(ctx, "/range/api/shards", "1-4"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	r, err := svc.LoadRange(ctx, "shards")
+	if err != nil || len(r.Values) != 4 {
+		t.Fatalf("LoadRange() = %+v, %v, want 4 values", r, err)
+	}
+
+	// the definition is not a config value of the service
+	if values, err := svc.LoadConfigMap(ctx, ConfigurationTypeService); err != nil || len(values) != 0 {
+		t.Errorf("LoadConfigMap() = %v, %v, want no values", values, err)
+	}
+
+	type update struct {
+		r   *Range
+		err error
+	}
+	updates := make(chan update, 10)
+	svc.WatchRange(ctx, "shards", func(r *Range, err error) { updates <- update{r, err} })
+
+	next := func() update {
+		t.Helper()
+		select {
+		case u := <-updates:
+			return u
+		case <-ctx.Done():
+			t.Fatal("no range update")
+			return update{}
+		}
+	}
+
+	if u := next(); u.err != nil || len(u.r.Values) != 4 {
+		t.Fatalf("initial range = %+v, %v", u.r, u.err)
+	}
+
+	svc.etcd.Put(ctx, "/range/api/shards", "host:node1-node2")
+	if u := next(); u.err != nil || u.r.Type != RangeTypeHost || len(u.r.Values) != 2 {
+		t.Errorf("updated range = %+v, %v", u.r, u.err)
+	}
+
+	svc.etcd.Put(ctx, "/range/api/shards", "5-1")
+	if u := next(); !errors.Is(u.err, ErrInvalidRange) {
+		t.Errorf("invalid range error = %v, want %v", u.err, ErrInvalidRange)
+	}
+
+	svc.etcd.Delete(ctx, "/range/api/shards")
+	if u := next(); !errors.Is(u.err, ErrConfigKeyNotFound) {
+		t.Errorf("deleted range error = %v, want %v", u.err, ErrConfigKeyNotFound)
+	}
+}
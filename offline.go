@@ -0,0 +1,160 @@
+package svcutil
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+var ErrNoConfigSnapshot = errors.New("etcd is unreachable and there is no config snapshot")
+
+// configSnapshot keeps the config values read by LoadConfig in a local file, so the
+// service can boot with them while etcd is unreachable
+type configSnapshot struct {
+	file string
+
+	mu     sync.Mutex
+	saved  time.Time
+	values map[string]string
+}
+
+type configSnapshotFile struct {
+	Saved  time.Time         `json:"saved"`
+	Values map[string]string `json:"values"`
+}
+
+func loadConfigSnapshot(file string) (*configSnapshot, error) {
+	s := &configSnapshot{file: file, values: make(map[string]string)}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f configSnapshotFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, &ConfigError{Key: file, Op: "load snapshot", Err: err}
+	}
+
+	s.saved = f.Saved
+	if f.Values != nil {
+		s.values = f.Values
+	}
+
+	return s, nil
+}
+
+// available reports whether a snapshot was ever saved
+func (s *configSnapshot) available() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return !s.saved.IsZero()
+}
+
+func (s *configSnapshot) get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.values[key]
+	return []byte(value), ok, nil
+}
+
+// store updates the snapshot with the values read by LoadConfig, keys missing from
+// etcd are removed, and writes it to the file
+func (s *configSnapshot) store(values map[string]string, missing []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, value := range values {
+		s.values[key] = value
+	}
+	for _, key := range missing {
+		delete(s.values, key)
+	}
+	s.saved = time.Now()
+
+	data, err := json.Marshal(configSnapshotFile{Saved: s.saved, Values: s.values})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.file), 0o700); err != nil {
+		return err
+	}
+
+	// the file holds decrypted values, so it is readable by the owner only
+	tmp := s.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.file)
+}
+
+// Degraded reports whether the service runs with the config snapshot of OfflineConfig
+// because etcd was unreachable at startup and is still not connected
+func (c *Service) Degraded() bool {
+	return c.degraded.Load()
+}
+
+// ping checks that etcd is reachable within the dial timeout
+func (c *Service) ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.etcdDialTimeout)
+	defer cancel()
+
+	_, err := c.etcd.Get(ctx, c.options.configPrefix, clientv3.WithCountOnly())
+	return etcdError(err)
+}
+
+// startDegraded decides whether the service boots without etcd, it does once etcd is
+// unreachable and a config snapshot is available
+func (c *Service) startDegraded() (bool, error) {
+	err := c.ping()
+	if err == nil {
+		return false, nil
+	}
+
+	if !c.offline.available() {
+		return false, wrapCause(ErrNoConfigSnapshot, err)
+	}
+
+	c.degraded.Store(true)
+	c.emit(Event{Type: EventTypeDegradedMode, Key: c.offline.file, Err: err})
+
+	return true, nil
+}
+
+// connectDegraded creates the session of a service started in degraded mode once etcd
+// is reachable, it returns false if the service is closed first. The service has no
+// session until then, so the watchdog of SessionLossPolicy is armed.
+func (c *Service) connectDegraded() bool {
+	disarm := c.armSessionWatchdog()
+	defer disarm()
+
+	for {
+		if c.ping() == nil && c.createSession() == nil {
+			c.degraded.Store(false)
+			c.restoreStatus()
+			c.restoreAnnouncements()
+			c.restoreInstanceKV()
+			c.emit(Event{Type: EventTypeSessionRestored})
+			return true
+		}
+
+		select {
+		case <-c.stopper:
+			return false
+		case <-time.After(c.options.retryInterval):
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package svcutil
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestOfflineConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	type config struct {
+		Level string `json:"level"`
+		Port  int    `json:"port"`
+	}
+
+	online, err := NewService(Name("billing"), LocalBackend(t.TempDir()), OfflineConfig(file))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+
+	if online.Degraded() {
+		t.Error("Degraded() = true with etcd reachable")
+	}
+
+	if err := online.SaveConfig(ctx, ConfigurationTypeService, &config{Level: "debug", Port: 8080}); err != nil {
+		t.Fatalf("SaveConfig() error = %v", err)
+	}
+
+	var loaded config
+	if err := online.LoadConfig(ctx, ConfigurationTypeService, &loaded); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	online.Close()
+
+	events := make(chan Event, 10)
+	lost := make(chan struct{}, 1)
+	offline, err := NewService(Name("billing"), EtcdEndpoints("127.0.0.1:1"), DialTimeout(100*time.Millisecond),
+		RetryInterval(10*time.Millisecond), OfflineConfig(file), OnEvents(EventsFunc(func(e Event) { events <- e })),
+		SessionLossPolicy(50*time.Millisecond, SessionLossCallback(func() { lost <- struct{}{} })))
+	if err != nil {
+		t.Fatalf("NewService() with etcd unreachable error = %v", err)
+	}
+	defer offline.Close()
+
+	if !offline.Degraded() {
+		t.Error("Degraded() = false with etcd unreachable")
+	}
+
+	select {
+	case e := <-events:
+		if e.Type != EventTypeDegradedMode || e.Key != file || e.Err == nil {
+			t.Errorf("event = %+v, want EventTypeDegradedMode", e)
+		}
+	default:
+		t.Error("degraded mode event is not emitted")
+	}
+
+	loaded = config{}
+	if err := offline.LoadConfig(ctx, ConfigurationTypeService, &loaded); err != nil || loaded != (config{Level: "debug", Port: 8080}) {
+		t.Errorf("LoadConfig() in degraded mode = %+v, %v", loaded, err)
+	}
+
+	if _, err := offline.AcquireLock(ctx, "migration"); !errors.Is(err, ErrSessionNotAvailable) {
+		t.Errorf("AcquireLock() in degraded mode error = %v, want %v", err, ErrSessionNotAvailable)
+	}
+
+	select {
+	case <-lost:
+	case <-ctx.Done():
+		t.Error("SessionLossPolicy action is not run in degraded mode")
+	}
+}
+
+func TestOfflineConfigNoSnapshot(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+
+	_, err := NewService(Name("billing"), EtcdEndpoints("127.0.0.1:1"), DialTimeout(100*time.Millisecond), OfflineConfig(file))
+	if !errors.Is(err, ErrNoConfigSnapshot) {
+		t.Errorf("NewService() error = %v, want %v", err, ErrNoConfigSnapshot)
+	}
+}
@@ -3,34 +3,140 @@ package svcutil
 import (
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
+// ServiceOption configures a Service, it lets callers hold options in variables and slices
+type ServiceOption = func(*options) *options
+
 type options struct {
-	serviceName     string
-	serviceScope    string
-	etcdDialTimeout time.Duration
-	etcdLeaseTTL    int
-	locksPrefix     string
-	configPrefix    string
-	hostsPrefix     string
-	mutexesPrefix   string
-	idsPrefix       string
-	endpoints       []string
-	username        string
-	password        string
-	retryInterval   time.Duration
+	serviceName          string
+	serviceScope         string
+	etcdDialTimeout      time.Duration
+	etcdLeaseTTL         int
+	locksPrefix          string
+	configPrefix         string
+	hostsPrefix          string
+	mutexesPrefix        string
+	idsPrefix            string
+	loadPrefix           string
+	rebalancePrefix      string
+	tombstonesPrefix     string
+	reservationsPrefix   string
+	waitersPrefix        string
+	transfersPrefix      string
+	lockWaitTimeout      time.Duration
+	lockMaxWaiters       int
+	lockHoldTimeout      time.Duration
+	cacheStaleness       time.Duration
+	readMode             ReadMode
+	tracer               trace.Tracer
+	middleware           []MiddlewareFunc
+	tenant               string
+	hostConfigPrefix     string
+	configHistoryPrefix  string
+	configHistoryLimit   int
+	takeoverDelay        time.Duration
+	instance             string
+	events               Events
+	endpoints            []string
+	username             string
+	password             string
+	retryInterval        time.Duration
+	statsInterval        time.Duration
+	idFormat             string
+	cipher               Cipher
+	topicsPrefix         string
+	topicRetention       time.Duration
+	commandsPrefix       string
+	watchClients         int
+	readEndpoints        []string
+	passwordFile         string
+	passwordFileInterval time.Duration
+	tokenProvider        TokenProvider
+	hostname             string
+	kubernetes           bool
+	statefulSetIDs       bool
+	ordinal              int
+	localDir             string
+	chaos                *ChaosInjector
+	slowLockThreshold    time.Duration
+	lockWaitersWarning   int
+	retryAttempts        int
+	retryBackoff         BackoffPolicy
+	offlineConfig        string
+	configPolicy         ConfigPolicy
+	duplicateGuard       bool
+	refuseDuplicates     bool
+	inventoryPrefix      string
+	rateLimit            *rateLimit
+	categoryRateLimits   map[RateCategory]rateLimit
+	dryRun               bool
+	recordFile           string
+	replayFile           string
+	replayLoose          bool
+	idNumbers            NumberFormat
+	macsPrefix           string
+	vlansPrefix          string
+	subnetsPrefix        string
+	rawHostname          string
+	hostnameHash         bool
+	hostnameCheck        bool
+	hostnameMode         func() string
+	transactionsPrefix   string
+	workflowsPrefix      string
+	electionsPrefix      string
+	maintenancePrefix    string
+	scopedLocksPrefix    string
+	heartbeatsPrefix     string
+	statusPrefix         string
+	rangesPrefix         string
+	drainTimeout         time.Duration
+	sessionLossMax       time.Duration
+	sessionLossAction    SessionLossAction
+	lockVerifyInterval   time.Duration
+	sharedClient         *Service
 }
 
 func NewOptions() *options {
 	return &options{
-		etcdDialTimeout: 5 * time.Second,
-		etcdLeaseTTL:    30,
-		locksPrefix:     "/lock/",
-		configPrefix:    "/config/",
-		hostsPrefix:     "/host/",
-		mutexesPrefix:   "/mutex/",
-		idsPrefix:       "/id/",
-		retryInterval:   15 * time.Second,
+		etcdDialTimeout:     5 * time.Second,
+		etcdLeaseTTL:        30,
+		locksPrefix:         "/lock/",
+		configPrefix:        "/config/",
+		hostsPrefix:         "/host/",
+		mutexesPrefix:       "/mutex/",
+		idsPrefix:           "/id/",
+		loadPrefix:          "/load/",
+		rebalancePrefix:     "/rebalance/",
+		tombstonesPrefix:    "/tombstone/",
+		reservationsPrefix:  "/reservation/",
+		waitersPrefix:       "/waiter/",
+		transfersPrefix:     "/transfer/",
+		configHistoryPrefix: "/configs-history/",
+		configHistoryLimit:  100,
+		retryInterval:       15 * time.Second,
+		idFormat:            DefaultIDFormat,
+		topicsPrefix:        "/topic/",
+		topicRetention:      10 * time.Minute,
+		commandsPrefix:      "/command/",
+		hostname:            Hostname(),
+		rawHostname:         rawHostname(),
+		ordinal:             -1,
+		inventoryPrefix:     "/inventory/",
+		macsPrefix:          "/mac/",
+		vlansPrefix:         "/vlan/",
+		subnetsPrefix:       "/subnet/",
+		transactionsPrefix:  "/transaction/",
+		workflowsPrefix:     "/workflow/",
+		electionsPrefix:     "/election/",
+		maintenancePrefix:   "/maintenance/",
+		scopedLocksPrefix:   "/scoped-lock/",
+		heartbeatsPrefix:    "/heartbeat/",
+		statusPrefix:        "/status/",
+		rangesPrefix:        "/range/",
+		drainTimeout:        30 * time.Second,
 	}
 }
 
@@ -96,9 +202,203 @@ func IDsPrefix(p string) func(*options) *options {
 	}
 }
 
+func LoadPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.loadPrefix = p
+		return l
+	}
+}
+
+func RebalancePrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.rebalancePrefix = p
+		return l
+	}
+}
+
+func TombstonesPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.tombstonesPrefix = p
+		return l
+	}
+}
+
+func ReservationsPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.reservationsPrefix = p
+		return l
+	}
+}
+
+func WaitersPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.waitersPrefix = p
+		return l
+	}
+}
+
+func TransfersPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.transfersPrefix = p
+		return l
+	}
+}
+
+func ConfigHistoryPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.configHistoryPrefix = p
+		return l
+	}
+}
+
+// ConfigHistoryLimit sets how many writes of every configuration are kept in the history,
+// 100 by default. Older writes are deleted by SaveConfig, zero keeps the whole history.
+func ConfigHistoryLimit(n int) func(*options) *options {
+	return func(l *options) *options {
+		l.configHistoryLimit = max(n, 0)
+		return l
+	}
+}
+
+// TakeoverDelay prevents other instances from obtaining a value for the given time
+// after its lease has expired, e.g. its holder crashed or lost etcd, the previous
+// holder may reacquire it meanwhile
+func TakeoverDelay(t time.Duration) func(*options) *options {
+	return func(l *options) *options {
+		l.takeoverDelay = t
+		return l
+	}
+}
+
+func Instance(name string) func(*options) *options {
+	return func(l *options) *options {
+		l.instance = name
+		return l
+	}
+}
+
+func OnEvents(e Events) func(*options) *options {
+	return func(l *options) *options {
+		l.events = e
+		return l
+	}
+}
+
+// LockWaitTimeout makes AcquireLock wait up to the given time for a held lock
+// instead of failing immediately
+func LockWaitTimeout(t time.Duration) func(*options) *options {
+	return func(l *options) *options {
+		l.lockWaitTimeout = t
+		return l
+	}
+}
+
+// LockMaxWaiters rejects waiting for a lock which already has the given number of waiters
+// with ErrLockQueueFull. It requires LockWaitTimeout, NewService returns ErrInvalidLockOptions
+// otherwise.
+func LockMaxWaiters(n int) func(*options) *options {
+	return func(l *options) *options {
+		l.lockMaxWaiters = n
+		return l
+	}
+}
+
+// LockHoldTimeout automatically releases locks held for longer than the given time
+func LockHoldTimeout(t time.Duration) func(*options) *options {
+	return func(l *options) *options {
+		l.lockHoldTimeout = t
+		return l
+	}
+}
+
+// ConfigCache enables a read-through cache of configuration keys invalidated by etcd watches,
+// cached values are never older than the staleness bound
+func ConfigCache(staleness time.Duration) func(*options) *options {
+	return func(l *options) *options {
+		l.cacheStaleness = staleness
+		return l
+	}
+}
+
+// ConfigReadMode sets the default read mode of configuration reads
+func ConfigReadMode(m ReadMode) func(*options) *options {
+	return func(l *options) *options {
+		l.readMode = m
+		return l
+	}
+}
+
+// Tracing enables OpenTelemetry spans for locks, leases and configuration operations
+func Tracing(tp trace.TracerProvider) func(*options) *options {
+	return func(l *options) *options {
+		l.tracer = tp.Tracer(tracerName)
+		return l
+	}
+}
+
+// Middleware wraps the etcd key-value requests (get, put, delete and txn) made by the
+// service, including the key-value requests of sessions, mutexes and leases. Lease grants,
+// keep-alives and revocations, watches and compactions are not wrapped. Middleware are
+// applied in the given order.
+func Middleware(m ...MiddlewareFunc) func(*options) *options {
+	return func(l *options) *options {
+		l.middleware = append(l.middleware, m...)
+		return l
+	}
+}
+
+// Tenant prepends a tenant segment to the root prefixes of all keys, so isolated
+// environments or customers can share one etcd cluster
+func Tenant(name string) func(*options) *options {
+	return func(l *options) *options {
+		l.tenant = strings.Trim(name, "/")
+		return l
+	}
+}
+
+func (o *options) applyTenant() {
+	o.hostConfigPrefix = o.hostsPrefix
+
+	if o.tenant == "" {
+		return
+	}
+
+	root := "/" + o.tenant
+	o.locksPrefix = root + o.locksPrefix
+	o.configPrefix = root + o.configPrefix
+	o.hostConfigPrefix = root + o.hostsPrefix
+	o.configHistoryPrefix = root + o.configHistoryPrefix
+	o.topicsPrefix = root + o.topicsPrefix
+	o.commandsPrefix = root + o.commandsPrefix
+	o.transactionsPrefix = root + o.transactionsPrefix
+	o.maintenancePrefix = root + o.maintenancePrefix
+	o.scopedLocksPrefix = root + o.scopedLocksPrefix
+	o.heartbeatsPrefix = root + o.heartbeatsPrefix
+	o.statusPrefix = root + o.statusPrefix
+	o.rangesPrefix = root + o.rangesPrefix
+}
+
 func EtcdEndpoints(e string) func(*options) *options {
 	return func(l *options) *options {
-		l.endpoints = strings.Split(e, ",")
+		l.endpoints = parseEndpoints(e)
+		return l
+	}
+}
+
+// EndpointsFromSRV discovers etcd endpoints from DNS SRV records of the domain,
+// same as passing "dns+srv://domain" to EtcdEndpoints
+func EndpointsFromSRV(domain string) func(*options) *options {
+	return func(l *options) *options {
+		l.endpoints = []string{srvScheme + domain}
+		return l
+	}
+}
+
+// ReadEndpoints directs serializable reads at the given comma-separated endpoints, e.g. members
+// in the same availability zone, while writes and linearizable reads use EtcdEndpoints
+func ReadEndpoints(e string) func(*options) *options {
+	return func(l *options) *options {
+		l.readEndpoints = parseEndpoints(e)
 		return l
 	}
 }
@@ -117,9 +417,444 @@ func EtcdPassword(p string) func(*options) *options {
 	}
 }
 
+// AuthTokenProvider attaches the token returned by the provider to every etcd request,
+// e.g. for etcd JWT auth or short-lived tokens, instead of the username and password
+func AuthTokenProvider(p TokenProvider) func(*options) *options {
+	return func(l *options) *options {
+		l.tokenProvider = p
+		return l
+	}
+}
+
+// EtcdPasswordFile reads the etcd password (or token) from the file and re-reads it every
+// interval, credentials are updated with UpdateCredentials once the content changes
+func EtcdPasswordFile(path string, interval time.Duration) func(*options) *options {
+	return func(l *options) *options {
+		l.passwordFile = path
+		l.passwordFileInterval = interval
+		return l
+	}
+}
+
 func RetryInterval(t time.Duration) func(*options) *options {
 	return func(l *options) *options {
 		l.retryInterval = t
 		return l
 	}
 }
+
+// StatsInterval emits the service counters as EventTypeStats at the given interval
+func StatsInterval(d time.Duration) func(*options) *options {
+	return func(l *options) *options {
+		l.statsInterval = d
+		return l
+	}
+}
+
+// IDFormat sets the format of identities returned by Service.ID, see NewIDWithFormat
+func IDFormat(format string) func(*options) *options {
+	return func(l *options) *options {
+		l.idFormat = format
+		return l
+	}
+}
+
+// ConfigCipher encrypts values written by SaveConfig and decrypts values read by LoadConfig,
+// values stored without encryption are still read as plaintext
+func ConfigCipher(c Cipher) func(*options) *options {
+	return func(l *options) *options {
+		l.cipher = c
+		return l
+	}
+}
+
+func TopicsPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.topicsPrefix = p
+		return l
+	}
+}
+
+func CommandsPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.commandsPrefix = p
+		return l
+	}
+}
+
+// TopicRetention sets how long messages published with Publish and commands are kept
+func TopicRetention(d time.Duration) func(*options) *options {
+	return func(l *options) *options {
+		l.topicRetention = d
+		return l
+	}
+}
+
+// WatchClients spreads watches over a pool of n etcd clients, so heavy watch workloads are
+// not multiplexed over a single connection. A watch whose client fails is moved to another one.
+func WatchClients(n int) func(*options) *options {
+	return func(l *options) *options {
+		l.watchClients = n
+		return l
+	}
+}
+
+// Kubernetes derives the identity of the instance from the downward API environment
+// (POD_NAME, POD_NAMESPACE, NODE_NAME): the pod name is used as the hostname and the
+// instance name, the namespace as the scope unless Scope is set
+func Kubernetes() func(*options) *options {
+	return func(l *options) *options {
+		l.kubernetes = true
+		return l
+	}
+}
+
+// StatefulSetIDs implies Kubernetes and derives the ID of the instance from the ordinal
+// suffix of the StatefulSet pod name, leases of ID ranges return the value at the ordinal
+// without leasing it in etcd
+func StatefulSetIDs() func(*options) *options {
+	return func(l *options) *options {
+		l.kubernetes = true
+		l.statefulSetIDs = true
+		return l
+	}
+}
+
+// LocalBackend stores locks, config and leases in the directory instead of etcd, for
+// development and single-node setups. Processes sharing the directory see each other's
+// locks and changes, same as SVCUTIL_BACKEND=local with SVCUTIL_LOCAL_DIR.
+func LocalBackend(dir string) func(*options) *options {
+	return func(l *options) *options {
+		l.localDir = dir
+		return l
+	}
+}
+
+// Chaos injects faults into etcd operations of the service (key-value requests, lease
+// keep-alives and lock releases) according to the rules of the injector, for testing
+// under etcd flakiness without external fault injection tools
+func Chaos(ci *ChaosInjector) func(*options) *options {
+	return func(l *options) *options {
+		l.chaos = ci
+		return l
+	}
+}
+
+// SlowLockWarning emits EventTypeLockSlow once a lock acquired by the service is held
+// longer than the threshold, the lock stays held
+func SlowLockWarning(threshold time.Duration) func(*options) *options {
+	return func(l *options) *options {
+		l.slowLockThreshold = threshold
+		return l
+	}
+}
+
+// LockWaitersWarning emits EventTypeLockContention when a lock being acquired has more
+// than n holders and waiters, the holder is counted as well
+func LockWaitersWarning(n int) func(*options) *options {
+	return func(l *options) *options {
+		l.lockWaitersWarning = n
+		return l
+	}
+}
+
+// RetryTransient retries etcd key-value requests of the service (gets, puts, deletes and
+// transactions, including those of locks and leases) failing with a transient error, such
+// as a leader change, an unavailable endpoint or a request timed out by etcd, up to the
+// given number of attempts, waiting between them as the backoff policy says. Note that a
+// write which timed out may have been applied before it is retried.
+func RetryTransient(attempts int, backoff BackoffPolicy) func(*options) *options {
+	return func(l *options) *options {
+		l.retryAttempts = attempts
+		l.retryBackoff = backoff
+		return l
+	}
+}
+
+// OfflineConfig saves the config values read by LoadConfig to the file. When etcd is
+// unreachable at startup the service boots in degraded mode with LoadConfig served from
+// the file, emitting EventTypeDegradedMode, and connects to etcd once it is reachable.
+func OfflineConfig(file string) func(*options) *options {
+	return func(l *options) *options {
+		l.offlineConfig = file
+		return l
+	}
+}
+
+// StartupConfigPolicy sets how Connect and Run treat a configuration which can't be
+// loaded at startup, RequireConfig by default
+func StartupConfigPolicy(p ConfigPolicy) func(*options) *options {
+	return func(l *options) *options {
+		l.configPolicy = p
+		return l
+	}
+}
+
+// DuplicateInstanceGuard announces the instance name (see Instance) with AnnounceID at
+// startup, so two processes running as the same instance emit EventTypeDuplicateInstance.
+// With refuse set NewService of the second one fails with ErrDuplicateInstance.
+func DuplicateInstanceGuard(refuse bool) func(*options) *options {
+	return func(l *options) *options {
+		l.duplicateGuard = true
+		l.refuseDuplicates = refuse
+		return l
+	}
+}
+
+// InventoryPrefix sets the prefix of host range (see NewHostRange) lease keys under the
+// locks prefix of the service
+func InventoryPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.inventoryPrefix = p
+		return l
+	}
+}
+
+// RateLimit limits etcd requests made by the service to ops per second with the given
+// burst, so a hot loop can't overload a shared cluster. Watches and lease keep-alives
+// are not limited. A request waiting longer than its context allows fails with
+// ErrRateLimited.
+func RateLimit(ops float64, burst int) func(*options) *options {
+	return func(l *options) *options {
+		l.rateLimit = &rateLimit{rate: ops, burst: burst}
+		return l
+	}
+}
+
+// CategoryRateLimit limits requests of the category separately from the RateLimit shared
+// by the other categories
+func CategoryRateLimit(rc RateCategory, ops float64, burst int) func(*options) *options {
+	return func(l *options) *options {
+		if l.categoryRateLimits == nil {
+			l.categoryRateLimits = make(map[RateCategory]rateLimit)
+		}
+		l.categoryRateLimits[rc] = rateLimit{rate: ops, burst: burst}
+		return l
+	}
+}
+
+// DryRun makes AcquireLock, Lease.Obtain, SaveConfig and RollbackConfig succeed without
+// writing to etcd, every skipped write is reported as EventTypeDryRun. Reads still go to
+// etcd, so deployment automation and new prefix layouts can be validated in production.
+func DryRun() func(*options) *options {
+	return func(l *options) *options {
+		l.dryRun = true
+		return l
+	}
+}
+
+// RecordTo records the etcd key-value and lease requests of the service with their
+// responses to the file, to be served by ReplayBackend in tests
+func RecordTo(path string) func(*options) *options {
+	return func(l *options) *options {
+		l.recordFile = path
+		return l
+	}
+}
+
+// ReplayBackend serves etcd requests of the service from a file recorded with RecordTo
+// instead of etcd, so coordination sequences can be regression tested without a cluster.
+// Requests differing from the recording fail (see ReplayLooseMatch), watches never receive
+// events.
+func ReplayBackend(path string) func(*options) *options {
+	return func(l *options) *options {
+		l.replayFile = path
+		return l
+	}
+}
+
+// ReplayLooseMatch makes ReplayBackend answer a request differing from the recording with
+// the next unused recorded response of the same method, for sequences whose requests vary
+// between runs, e.g. with timestamps, process ids or randomly ordered lease candidates
+func ReplayLooseMatch() func(*options) *options {
+	return func(l *options) *options {
+		l.replayLoose = true
+		return l
+	}
+}
+
+// IDNumberFormat sets how the {id} placeholder of IDs is rendered and how ID and
+// ScopedID read their values, e.g. PaddedIDs(3) or HexIDs(2) to match a range created
+// with the same RangeNumberFormat. Decimal numbers without padding by default.
+func IDNumberFormat(f NumberFormat) func(*options) *options {
+	return func(l *options) *options {
+		l.idNumbers = f
+		return l
+	}
+}
+
+// MACPrefix sets the prefix of MAC range (see NewMACRange) lease keys under the locks
+// prefix of the service
+func MACPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.macsPrefix = p
+		return l
+	}
+}
+
+// VLANPrefix sets the prefix of VLAN range (see NewVLANRange) lease keys under the locks
+// prefix of the service
+func VLANPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.vlansPrefix = p
+		return l
+	}
+}
+
+// SubnetsPrefix sets the prefix of subnet allocations (see NewSubnetAllocator) under the
+// locks prefix of the service
+func SubnetsPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.subnetsPrefix = p
+		return l
+	}
+}
+
+// HostnameHash appends a short hash of the original host name to the sanitized one if
+// sanitization changed it, e.g. "node_1_c43383" for "node-1", so hosts whose names differ
+// only in separators get their own host config and host lease keys. Turning it on moves
+// existing host keys of such hosts.
+func HostnameHash() func(*options) *options {
+	return func(l *options) *options {
+		l.hostnameHash = true
+		return l
+	}
+}
+
+// HostnameCollisionCheck registers the original host name for the sanitized one at
+// startup and emits EventTypeHostnameCollision if another host registered it before,
+// e.g. "node.1" after "node-1", see HostnameHash
+func HostnameCollisionCheck() func(*options) *options {
+	return func(l *options) *options {
+		l.hostnameCheck = true
+		return l
+	}
+}
+
+// HostnameMode sets how the host name is resolved: ShortHostname, FQDNHostname or a custom
+// function, so the same machine gets the same host config keys on OS images whose
+// os.Hostname returns the short name and on those returning the FQDN. By default the name
+// is used as os.Hostname returns it. The pod name in Kubernetes mode takes precedence.
+func HostnameMode(mode func() string) func(*options) *options {
+	return func(l *options) *options {
+		l.hostnameMode = mode
+		return l
+	}
+}
+
+// TransactionsPrefix sets the root prefix of two-phase commit transactions (see
+// NewCoordinator), shared by all services
+func TransactionsPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.transactionsPrefix = p
+		return l
+	}
+}
+
+// WorkflowsPrefix sets the prefix of workflow checkpoints (see NewWorkflow) under the
+// locks prefix of the service
+func WorkflowsPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.workflowsPrefix = p
+		return l
+	}
+}
+
+// ElectionsPrefix sets the prefix of leader elections (see RunWhenLeader) under the locks
+// prefix of the service
+func ElectionsPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.electionsPrefix = p
+		return l
+	}
+}
+
+// DrainTimeout sets how long Drain waits for the routers to acknowledge the draining
+// instance before it releases the leases anyway, 30 seconds by default
+func DrainTimeout(d time.Duration) func(*options) *options {
+	return func(l *options) *options {
+		l.drainTimeout = d
+		return l
+	}
+}
+
+// SessionLossPolicy runs the action once the session stays lost for longer than
+// maxDowntime, e.g. SessionLossShutdown or SessionLossExit, so a service holding exclusive
+// resources doesn't keep running while it is unable to renew its claims. A service started
+// in degraded mode (see OfflineConfig) has no session, the watchdog runs until it connects.
+func SessionLossPolicy(maxDowntime time.Duration, action SessionLossAction) func(*options) *options {
+	return func(l *options) *options {
+		l.sessionLossMax = maxDowntime
+		l.sessionLossAction = action
+		return l
+	}
+}
+
+// LockVerifyInterval checks at the interval that the key of every held lock still exists
+// with the lease of the session. A lock whose key is gone, e.g. deleted by hand, is dropped,
+// its channel is closed and EventTypeLockLost is emitted, instead of going unnoticed until
+// the next session event.
+func LockVerifyInterval(d time.Duration) func(*options) *options {
+	return func(l *options) *options {
+		l.lockVerifyInterval = d
+		return l
+	}
+}
+
+// WithSharedClient makes the service use the etcd connection of the owner instead of
+// opening its own, so logical services embedded in one binary don't multiply connections,
+// see NewServiceGroup. The service still creates its own session on the connection, so its
+// locks and leases are not mixed with those of the owner. Connection options of the
+// service, e.g. endpoints, credentials or middleware, are ignored in favor of those of the
+// owner. Services sharing the connection must be closed before the owner.
+func WithSharedClient(owner *Service) func(*options) *options {
+	return func(l *options) *options {
+		l.sharedClient = owner
+		return l
+	}
+}
+
+// MaintenancePrefix sets the root prefix of maintenance switches (see SetMaintenance),
+// shared by all services
+func MaintenancePrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.maintenancePrefix = p
+		return l
+	}
+}
+
+// ScopedLocksPrefix sets the root prefix of global, scope and host locks (see
+// AcquireScopedLock), shared by all services
+func ScopedLocksPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.scopedLocksPrefix = p
+		return l
+	}
+}
+
+// HeartbeatsPrefix sets the root prefix of heartbeats (see StartHeartbeat), shared by all
+// services
+func HeartbeatsPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.heartbeatsPrefix = p
+		return l
+	}
+}
+
+// StatusPrefix sets the root prefix of instance statuses (see SetStatus), shared by all
+// services
+func StatusPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.statusPrefix = p
+		return l
+	}
+}
+
+// RangesPrefix sets the root prefix of named range definitions and member payloads (see
+// LoadRange), services keep their ranges under their names
+func RangesPrefix(p string) func(*options) *options {
+	return func(l *options) *options {
+		l.rangesPrefix = p
+		return l
+	}
+}
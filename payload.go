@@ -0,0 +1,110 @@
+package svcutil
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+var ErrNoPayload = errors.New("no payload")
+
+// membersSegment is the segment under a named range the payloads of its members are stored under
+const membersSegment = "/members/"
+
+// WithPayloads sets the payloads of the members, e.g. {"10.0.0.5": {"gateway": "10.0.0.1",
+// "vlan": 100}}, and returns the range. Lease.Payload returns the payload of the obtained member.
+func (r *Range) WithPayloads(payloads map[string]json.RawMessage) *Range {
+	r.Payloads = payloads
+	return r
+}
+
+// Payload returns the payload of the member
+func (r *Range) Payload(value string) (json.RawMessage, bool) {
+	p, ok := r.Payloads[value]
+	return p, ok
+}
+
+// Payload returns the payload of the obtained member, ErrNoPayload if nothing is obtained
+// or the member has none
+func (i *Lease) Payload() (json.RawMessage, error) {
+	if i.value == "" {
+		return nil, ErrNoPayload
+	}
+
+	p, ok := i.r.Payload(i.value)
+	if !ok {
+		return nil, ErrNoPayload
+	}
+
+	return p, nil
+}
+
+// LeasePayload decodes the payload of the member obtained by the lease into T, e.g. a
+// struct with the IP, gateway and VLAN an instance should configure
+func LeasePayload[T any](l *Lease) (T, error) {
+	var v T
+
+	p, err := l.Payload()
+	if err != nil {
+		return v, err
+	}
+
+	err = json.Unmarshal(p, &v)
+	return v, err
+}
+
+func (c *Service) rangeMembersKey(name string) string {
+	return c.rangeKey(name) + membersSegment
+}
+
+// LoadRangePayloads reads the payloads of the members of the named range, JSON values
+// stored under "<name>/members/<member>" of the ranges prefix of the service
+func (c *Service) LoadRangePayloads(ctx context.Context, name string) (map[string]json.RawMessage, error) {
+	prefix := c.rangeMembersKey(name)
+
+	resp, err := c.etcd.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, &ConfigError{Key: prefix, Op: "get", Err: etcdError(err)}
+	}
+
+	payloads := make(map[string]json.RawMessage, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		key := string(kv.Key)
+
+		data, err := c.decryptConfig(key, kv.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		var payload json.RawMessage
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return nil, &ConfigError{Key: key, Op: "parse", Err: err}
+		}
+
+		payloads[strings.TrimPrefix(key, prefix)] = payload
+	}
+
+	return payloads, nil
+}
+
+// loadNamedRange parses the definition of the named range and attaches the payloads of its members
+func (c *Service) loadNamedRange(ctx context.Context, name, key, def string) (*Range, error) {
+	r, err := parseNamedRange(key, def)
+	if err != nil {
+		return nil, err
+	}
+
+	payloads, err := c.LoadRangePayloads(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payloads) > 0 {
+		r.WithPayloads(payloads)
+	}
+
+	return r, nil
+}
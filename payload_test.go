@@ -0,0 +1,69 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestLeasePayload(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("api"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	for key, value := range map[string]string{
+		"/range/api/pool":                    "ip:10.0.0.5-10.0.0.6",
+		"/range/api/pool/members/10.0.0.5":   `{"ip":"10.0.0.5","gateway":"10.0.0.1","vlan":100}`,
+		"/range/api/pool/members/10.0.0.6":   `{"ip":"10.0.0.6","gateway":"10.0.0.1","vlan":101}`,
+		"/range/api/broken":                  "1-2",
+		"/range/api/broken/members/1":        `{"vlan":`,
+		"/range/api/poolside/members/ignore": `"other range"`,
+	} {
+		if _, err := svc.etcd.Put(ctx, key, value); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	r, err := svc.LoadRange(ctx, "pool")
+	if err != nil {
+		t.Fatalf("LoadRange() error = %v", err)
+	}
+	if len(r.Payloads) != 2 {
+		t.Fatalf("LoadRange() payloads = %s, want 2", r.Payloads)
+	}
+
+	l := NewLeaseWithOptions(r, svc)
+	defer l.Close()
+
+	type bundle struct {
+		IP      string `json:"ip"`
+		Gateway string `json:"gateway"`
+		VLAN    int    `json:"vlan"`
+	}
+
+	if _, err := LeasePayload[bundle](l); !errors.Is(err, ErrNoPayload) {
+		t.Errorf("LeasePayload() before Obtain error = %v, want %v", err, ErrNoPayload)
+	}
+
+	value, err := l.Obtain(ctx)
+	if err != nil {
+		t.Fatalf("Obtain() error = %v", err)
+	}
+
+	b, err := LeasePayload[bundle](l)
+	if err != nil || b.IP != value || b.Gateway != "10.0.0.1" || b.VLAN == 0 {
+		t.Errorf("LeasePayload() = %+v, %v for %s", b, err, value)
+	}
+
+	var cerr *ConfigError
+	if _, err := svc.LoadRange(ctx, "broken"); !errors.As(err, &cerr) || cerr.Op != "parse" {
+		t.Errorf("LoadRange() with an invalid payload error = %v, want a parse error", err)
+	}
+}
@@ -0,0 +1,158 @@
+package svcutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+var ErrDuplicateInstance = errors.New("identity is announced by another process")
+
+const presenceSegment = "/presence/"
+
+// hostnamesSegment is where the original host names of sanitized ones are registered
+const hostnamesSegment = "/hostname/"
+
+func (c *Service) presenceKey(value string) string {
+	return c.options.locksPrefix + c.options.serviceName + presenceSegment + value
+}
+
+// presenceHolder identifies the process announcing an identity
+func (c *Service) presenceHolder() string {
+	return fmt.Sprintf("%s:%d", c.options.hostname, os.Getpid())
+}
+
+// AnnounceID claims the identity for this process with a presence key attached to the
+// service session. If another process already announced it, e.g. a mis-scheduled
+// duplicate pod, EventTypeDuplicateInstance is emitted with the identity in Key and
+// the other process (host:pid) in Value and ErrDuplicateInstance is returned. Announced
+// identities are claimed again after the session is restored.
+func (c *Service) AnnounceID(ctx context.Context, id ID) error {
+	return c.claim(ctx, id.Value)
+}
+
+// claim announces the identity and keeps it to be claimed again after a session loss
+func (c *Service) claim(ctx context.Context, value string) error {
+	if err := c.announce(ctx, value); err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	if c.announced == nil {
+		c.announced = make(map[string]struct{})
+	}
+	c.announced[value] = struct{}{}
+	c.lock.Unlock()
+
+	return nil
+}
+
+// guardInstance announces the instance name at startup, a duplicate fails the startup
+// only if DuplicateInstanceGuard refuses duplicates
+func (c *Service) guardInstance() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.etcdDialTimeout)
+	defer cancel()
+
+	err := c.claim(ctx, c.options.instance)
+	if errors.Is(err, ErrDuplicateInstance) && !c.options.refuseDuplicates {
+		return nil
+	}
+
+	return err
+}
+
+func (c *Service) announce(ctx context.Context, value string) error {
+	c.lock.Lock()
+	session := c.session
+	c.lock.Unlock()
+
+	if session == nil {
+		return ErrSessionNotAvailable
+	}
+
+	key := c.presenceKey(value)
+	resp, err := c.etcd.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, c.presenceHolder(), clientv3.WithLease(session.Lease()))).
+		Else(clientv3.OpGet(key)).
+		Commit()
+	if err != nil {
+		return etcdError(err)
+	}
+
+	if resp.Succeeded {
+		return nil
+	}
+
+	kvs := resp.Responses[0].GetResponseRange().Kvs
+	if len(kvs) == 0 || clientv3.LeaseID(kvs[0].Lease) == session.Lease() {
+		// announced by this process before
+		return nil
+	}
+
+	c.emit(Event{Type: EventTypeDuplicateInstance, Key: value, Value: string(kvs[0].Value)})
+	return ErrDuplicateInstance
+}
+
+// restoreAnnouncements claims the announced identities again once a lost session is recreated
+func (c *Service) restoreAnnouncements() {
+	c.lock.Lock()
+	values := make([]string, 0, len(c.announced))
+	for value := range c.announced {
+		values = append(values, value)
+	}
+	c.lock.Unlock()
+
+	for _, value := range values {
+		ctx, cancel := context.WithTimeout(context.Background(), c.options.etcdDialTimeout)
+		c.announce(ctx, value)
+		cancel()
+	}
+}
+
+func (c *Service) hostnameKey() string {
+	return c.options.locksPrefix + c.options.serviceName + hostnamesSegment + c.options.hostname
+}
+
+// registerHostname records the original host name for the sanitized one, the key is kept
+// after the service stops, and emits EventTypeHostnameCollision with the sanitized name in
+// Key and the host registered before in Value if it differs. The check is best effort, a
+// failed request doesn't fail the startup.
+func (c *Service) registerHostname() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.etcdDialTimeout)
+	defer cancel()
+
+	key := c.hostnameKey()
+
+	var kvs []*mvccpb.KeyValue
+	if c.options.dryRun {
+		resp, err := c.etcd.Get(ctx, key)
+		if err != nil {
+			return
+		}
+
+		if kvs = resp.Kvs; len(kvs) == 0 {
+			c.dryRun(key, "register hostname "+c.options.rawHostname)
+			return
+		}
+	} else {
+		resp, err := c.etcd.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+			Then(clientv3.OpPut(key, c.options.rawHostname)).
+			Else(clientv3.OpGet(key)).
+			Commit()
+		if err != nil || resp.Succeeded {
+			return
+		}
+
+		kvs = resp.Responses[0].GetResponseRange().Kvs
+	}
+
+	if len(kvs) > 0 && string(kvs[0].Value) != c.options.rawHostname {
+		c.emit(Event{Type: EventTypeHostnameCollision, Key: c.options.hostname, Value: string(kvs[0].Value)})
+	}
+}
@@ -0,0 +1,155 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestDuplicateInstanceGuard(t *testing.T) {
+	dir := t.TempDir()
+
+	first, err := NewService(Name("billing"), Instance("billing-0"), LocalBackend(dir), DuplicateInstanceGuard(true))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer first.Close()
+
+	var events []Event
+	second, err := NewService(Name("billing"), Instance("billing-0"), LocalBackend(dir), DuplicateInstanceGuard(false),
+		OnEvents(EventsFunc(func(e Event) { events = append(events, e) })))
+	if err != nil {
+		t.Fatalf("NewService() of a tolerated duplicate error = %v", err)
+	}
+	second.Close()
+
+	if len(events) != 1 || events[0].Type != EventTypeDuplicateInstance || events[0].Key != "billing-0" || events[0].Value != first.presenceHolder() {
+		t.Errorf("events = %+v, want EventTypeDuplicateInstance", events)
+	}
+
+	if _, err := NewService(Name("billing"), Instance("billing-0"), LocalBackend(dir), DuplicateInstanceGuard(true)); !errors.Is(err, ErrDuplicateInstance) {
+		t.Errorf("NewService() of a duplicate error = %v, want %v", err, ErrDuplicateInstance)
+	}
+
+	other, err := NewService(Name("billing"), Instance("billing-1"), LocalBackend(dir), DuplicateInstanceGuard(true))
+	if err != nil {
+		t.Fatalf("NewService() of another instance error = %v", err)
+	}
+	other.Close()
+}
+
+func TestAnnounceID(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	a, err := NewService(Name("billing"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+
+	b, err := NewService(Name("billing"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer b.Close()
+
+	id := a.ID("3")
+	if err := a.AnnounceID(ctx, id); err != nil {
+		a.Close()
+		t.Fatalf("AnnounceID() error = %v", err)
+	}
+
+	if err := a.AnnounceID(ctx, id); err != nil {
+		t.Errorf("AnnounceID() again error = %v", err)
+	}
+
+	if err := b.AnnounceID(ctx, id); !errors.Is(err, ErrDuplicateInstance) {
+		t.Errorf("AnnounceID() by another process error = %v, want %v", err, ErrDuplicateInstance)
+	}
+
+	a.Close()
+	if err := b.AnnounceID(ctx, id); err != nil {
+		t.Errorf("AnnounceID() after the holder closed error = %v", err)
+	}
+}
+
+func TestHostnameCollision(t *testing.T) {
+	dir := t.TempDir()
+
+	host := func(name string) func(*options) *options {
+		return func(o *options) *options {
+			o.rawHostname, o.hostname = name, sanitizeHostname(name)
+			return o
+		}
+	}
+
+	var events []Event
+	record := OnEvents(EventsFunc(func(e Event) { events = append(events, e) }))
+
+	for _, name := range []string{"node-1", "node-1", "node.1"} {
+		svc, err := NewService(Name("billing"), LocalBackend(dir), host(name), HostnameCollisionCheck(), record)
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		svc.Close()
+	}
+
+	if len(events) != 1 || events[0].Type != EventTypeHostnameCollision || events[0].Key != "node_1" || events[0].Value != "node-1" {
+		t.Errorf("events = %+v, want EventTypeHostnameCollision", events)
+	}
+
+	events = nil
+	svc, err := NewService(Name("billing"), LocalBackend(dir), host("node.1"), HostnameHash(), HostnameCollisionCheck(), record)
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	svc.Close()
+
+	if svc.options.hostname != hashHostname("node.1") || len(events) != 0 {
+		t.Errorf("hashed hostname %q, events = %+v", svc.options.hostname, events)
+	}
+}
+
+func TestHostnameSurvivesGC(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+
+	host := func(name string) func(*options) *options {
+		return func(o *options) *options {
+			o.rawHostname, o.hostname = name, sanitizeHostname(name)
+			return o
+		}
+	}
+
+	var events []Event
+	record := OnEvents(EventsFunc(func(e Event) { events = append(events, e) }))
+
+	svc, err := NewService(Name("billing"), LocalBackend(dir), host("node-1"), HostnameCollisionCheck(), record)
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+
+	// the registration is not leased, GC must not take it for an orphan
+	if cleaned, err := svc.GC(ctx, 0, false); err != nil || len(cleaned) != 0 {
+		t.Fatalf("GC() = %v, %v, want nothing cleaned", cleaned, err)
+	}
+	if resp, err := svc.etcd.Get(ctx, svc.hostnameKey()); err != nil || len(resp.Kvs) != 1 {
+		t.Fatalf("hostname key after GC = %v, %v", resp, err)
+	}
+	svc.Close()
+
+	svc, err = NewService(Name("billing"), LocalBackend(dir), host("node.1"), HostnameCollisionCheck(), record)
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	svc.Close()
+
+	if len(events) != 1 || events[0].Type != EventTypeHostnameCollision || events[0].Value != "node-1" {
+		t.Errorf("events = %+v, want EventTypeHostnameCollision", events)
+	}
+}
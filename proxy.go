@@ -0,0 +1,314 @@
+package svcutil
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+var ErrShardNotAssigned = errors.New("shard is not assigned")
+
+type shardContextKey struct{}
+
+// DefaultShardProxyMaxRetryBody is the largest request body buffered to be sent again
+const DefaultShardProxyMaxRetryBody = 1 << 20
+
+type shardProxyOptions struct {
+	target       func(owner string) (*url.URL, error)
+	transport    http.RoundTripper
+	retries      int
+	ownerWait    time.Duration
+	maxRetryBody int64
+}
+
+// ShardProxyOption customizes a ShardProxy
+type ShardProxyOption func(*shardProxyOptions) *shardProxyOptions
+
+// ShardProxyWithTarget maps the owner of a shard to the URL requests are proxied to,
+// by default the owner is used as the URL if it has a scheme or as the host otherwise
+func ShardProxyWithTarget(target func(owner string) (*url.URL, error)) ShardProxyOption {
+	return func(o *shardProxyOptions) *shardProxyOptions {
+		o.target = target
+		return o
+	}
+}
+
+// ShardProxyWithTransport sets the transport requests are sent with, http.DefaultTransport by default
+func ShardProxyWithTransport(t http.RoundTripper) ShardProxyOption {
+	return func(o *shardProxyOptions) *shardProxyOptions {
+		o.transport = t
+		return o
+	}
+}
+
+// ShardProxyWithRetries sets how many times an idempotent request is sent again once the
+// owner of its shard changed, 3 by default. Request bodies are buffered in memory to be
+// sent again, see ShardProxyWithMaxRetryBody.
+func ShardProxyWithRetries(n int) ShardProxyOption {
+	return func(o *shardProxyOptions) *shardProxyOptions {
+		o.retries = n
+		return o
+	}
+}
+
+// ShardProxyWithMaxRetryBody sets the largest request body buffered in memory to be sent
+// again, a larger body is streamed to the owner and the request is not retried.
+// DefaultShardProxyMaxRetryBody by default.
+func ShardProxyWithMaxRetryBody(n int64) ShardProxyOption {
+	return func(o *shardProxyOptions) *shardProxyOptions {
+		o.maxRetryBody = n
+		return o
+	}
+}
+
+// ShardProxyWithOwnerWait sets how long a request waits for a shard without an owner to
+// be assigned and for the owner to change after a failed attempt, 5 seconds by default
+func ShardProxyWithOwnerWait(d time.Duration) ShardProxyOption {
+	return func(o *shardProxyOptions) *shardProxyOptions {
+		o.ownerWait = d
+		return o
+	}
+}
+
+// ShardProxy is an http.Handler proxying requests to the instance owning their shard as
+// resolved by a Router. An idempotent request failing because its owner went away (a
+// transport error, 421 Misdirected Request or 503 Service Unavailable) is sent to the new
+// owner once the ownership changes, so failovers are handled mid-flight.
+type ShardProxy struct {
+	router  *Router
+	shard   func(r *http.Request) (string, error)
+	options *shardProxyOptions
+	proxy   *httputil.ReverseProxy
+}
+
+// NewShardProxy creates a proxy routing requests by the shard the function extracts from
+// them, e.g. a path segment or a header. A failed extraction is answered with 400.
+func NewShardProxy(router *Router, shard func(r *http.Request) (string, error), opts ...ShardProxyOption) *ShardProxy {
+	o := &shardProxyOptions{
+		target:       ownerURL,
+		transport:    http.DefaultTransport,
+		retries:      3,
+		ownerWait:    5 * time.Second,
+		maxRetryBody: DefaultShardProxyMaxRetryBody,
+	}
+
+	for _, decorator := range opts {
+		o = decorator(o)
+	}
+
+	p := &ShardProxy{
+		router:  router,
+		shard:   shard,
+		options: o,
+	}
+
+	p.proxy = &httputil.ReverseProxy{
+		// the target is resolved by the transport for every attempt
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetXForwarded()
+		},
+		Transport: shardTransport{p},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if errors.Is(err, ErrShardNotAssigned) {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		},
+	}
+
+	return p
+}
+
+// ownerURL is the default target of an owner
+func ownerURL(owner string) (*url.URL, error) {
+	if strings.Contains(owner, "://") {
+		return url.Parse(owner)
+	}
+
+	return &url.URL{Scheme: "http", Host: owner}, nil
+}
+
+func (p *ShardProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	shard, err := p.shard(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	retry := p.options.retries > 0 && idempotent(r)
+	if retry && r.Body != nil && r.Body != http.NoBody {
+		// the tee keeps every byte read, also the one MaxBytesReader reads past the limit,
+		// and without a writer exceeding the limit doesn't fail the request
+		var body bytes.Buffer
+		_, err := io.Copy(io.Discard, http.MaxBytesReader(nil, io.NopCloser(io.TeeReader(r.Body, &body)), p.options.maxRetryBody))
+
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			r.Body = readCloser{io.MultiReader(&body, r.Body), r.Body}
+			r.GetBody = nil
+			retry = false
+		case err != nil:
+			r.Body.Close()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		default:
+			r.Body.Close()
+			buffered := body.Bytes()
+			r.Body = io.NopCloser(bytes.NewReader(buffered))
+			r.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(buffered)), nil
+			}
+		}
+	}
+
+	ctx := context.WithValue(r.Context(), shardContextKey{}, shardRequest{shard: shard, retry: retry})
+	p.proxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// shardRequest is what the transport needs to know about a proxied request
+type shardRequest struct {
+	shard string
+	retry bool
+}
+
+// readCloser streams the buffered start of a body followed by the rest of it
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// idempotent reports whether the request may be sent again, by its method or an
+// Idempotency-Key header like net/http does
+func idempotent(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	_, key := r.Header["Idempotency-Key"]
+	_, xkey := r.Header["X-Idempotency-Key"]
+	return key || xkey
+}
+
+// targetURL rewrites the URL of the request to the target, the path of the target is
+// kept as a prefix and its query is merged like httputil.ProxyRequest.SetURL does
+func targetURL(target, u *url.URL) *url.URL {
+	out := *u
+	out.Scheme = target.Scheme
+	out.Host = target.Host
+
+	out.Path = joinURLPath(target.Path, u.Path)
+	if target.RawPath != "" || u.RawPath != "" {
+		out.RawPath = joinURLPath(target.EscapedPath(), u.EscapedPath())
+	}
+
+	if target.RawQuery != "" && u.RawQuery != "" {
+		out.RawQuery = target.RawQuery + "&" + u.RawQuery
+	} else if target.RawQuery != "" {
+		out.RawQuery = target.RawQuery
+	}
+
+	return &out
+}
+
+func joinURLPath(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash && a != "" && b != "":
+		return a + "/" + b
+	}
+
+	return a + b
+}
+
+// misrouted reports whether the attempt failed in a way a change of the owner can fix
+func misrouted(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	return resp.StatusCode == http.StatusMisdirectedRequest || resp.StatusCode == http.StatusServiceUnavailable
+}
+
+// waitChange waits for the channel until the owner wait passes or ctx is done, changes
+// of a stopped router are never seen
+func (p *ShardProxy) waitChange(ctx context.Context, changed <-chan struct{}) bool {
+	timer := time.NewTimer(p.options.ownerWait)
+	defer timer.Stop()
+
+	select {
+	case <-changed:
+		select {
+		case <-p.router.Done():
+			return false
+		default:
+		}
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	return false
+}
+
+// shardTransport sends a request to the current owner of its shard, again after the
+// owner changes if the attempt was misrouted
+type shardTransport struct {
+	p *ShardProxy
+}
+
+func (t shardTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p := t.p
+	ctx := req.Context()
+	sr, _ := ctx.Value(shardContextKey{}).(shardRequest)
+
+	for sent := 0; ; {
+		owner, ok, changed := p.router.OwnerOf(sr.shard)
+		if !ok {
+			if !p.waitChange(ctx, changed) {
+				return nil, ErrShardNotAssigned
+			}
+			continue
+		}
+
+		target, err := p.options.target(owner)
+		if err != nil {
+			return nil, err
+		}
+
+		out := req.Clone(ctx)
+		out.URL = targetURL(target, req.URL)
+		out.Host = ""
+
+		if sent > 0 && req.GetBody != nil {
+			if out.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := p.options.transport.RoundTrip(out)
+		sent++
+
+		if !sr.retry || sent > p.options.retries || !misrouted(resp, err) || !p.waitChange(ctx, changed) {
+			return resp, err
+		}
+
+		if resp != nil {
+			resp.Body.Close()
+		}
+	}
+}
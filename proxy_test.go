@@ -0,0 +1,179 @@
+package svcutil
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestShardProxy(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("api"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	backend := func(name string, status int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			w.WriteHeader(status)
+			io.WriteString(w, name+":"+r.URL.Path+":"+string(body))
+		}))
+	}
+
+	// the primary lost its shard but still answers, the standby takes over
+	primary := backend("primary", http.StatusMisdirectedRequest)
+	defer primary.Close()
+	standby := backend("standby", http.StatusOK)
+	defer standby.Close()
+
+	r, _ := NewIDRange("7")
+	router, err := NewRouter(ctx, NewLeaseWithOptions(r, svc))
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+
+	owner := NewLeaseWithOptions(r, svc, LeaseWithMetadata(primary.URL))
+	if _, err := owner.Obtain(ctx); err != nil {
+		t.Fatalf("Obtain() error = %v", err)
+	}
+	waitOwner(t, ctx, router, "7")
+
+	proxy := httptest.NewServer(NewShardProxy(router, func(r *http.Request) (string, error) {
+		shard, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/shards/"), "/")
+		return shard, nil
+	}, ShardProxyWithOwnerWait(5*time.Second)))
+	defer proxy.Close()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		owner.Close()
+
+		standbyLease := NewLeaseWithOptions(r, svc, LeaseWithMetadata(standby.URL))
+		standbyLease.Obtain(ctx)
+	}()
+
+	req, _ := http.NewRequest(http.MethodPut, proxy.URL+"/shards/7/orders", strings.NewReader("order"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "standby:/shards/7/orders:order" {
+		t.Errorf("response = %d %q, want the standby answer", resp.StatusCode, body)
+	}
+
+	resp, err = http.Get(proxy.URL + "/shards/8/orders")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("unassigned shard status = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+}
+
+func TestShardProxyRetries(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("api"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	// the owner keeps refusing requests and never changes
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusMisdirectedRequest)
+		io.WriteString(w, r.URL.Path+":"+string(body))
+	}))
+	defer primary.Close()
+
+	r, _ := NewIDRange("7")
+	router, err := NewRouter(ctx, NewLeaseWithOptions(r, svc))
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+
+	owner := NewLeaseWithOptions(r, svc, LeaseWithMetadata(primary.URL))
+	if _, err := owner.Obtain(ctx); err != nil {
+		t.Fatalf("Obtain() error = %v", err)
+	}
+	defer owner.Close()
+	waitOwner(t, ctx, router, "7")
+
+	proxy := httptest.NewServer(NewShardProxy(router, func(r *http.Request) (string, error) {
+		return "7", nil
+	}, ShardProxyWithOwnerWait(2*time.Second), ShardProxyWithMaxRetryBody(8), ShardProxyWithTarget(func(owner string) (*url.URL, error) {
+		return url.Parse(owner + "/v1")
+	})))
+	defer proxy.Close()
+
+	large := strings.Repeat("x", 64)
+	tests := []struct {
+		name   string
+		method string
+		body   string
+	}{
+		{name: "not idempotent", method: http.MethodPost, body: "order"},
+		{name: "body above the limit", method: http.MethodPut, body: large},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, proxy.URL+"/orders", strings.NewReader(tt.body))
+			started := time.Now()
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			defer resp.Body.Close()
+
+			// the answer is passed on without waiting for the owner to change
+			if elapsed := time.Since(started); elapsed > time.Second {
+				t.Errorf("request took %v, want no retry", elapsed)
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusMisdirectedRequest || string(body) != "/v1/orders:"+tt.body {
+				t.Errorf("response = %d %q", resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+func TestTargetURL(t *testing.T) {
+	tests := []struct {
+		target string
+		path   string
+		want   string
+	}{
+		{target: "http://a:80", path: "/orders?id=1", want: "http://a:80/orders?id=1"},
+		{target: "http://a:80/", path: "/orders", want: "http://a:80/orders"},
+		{target: "http://a:80/v1", path: "/orders", want: "http://a:80/v1/orders"},
+		{target: "http://a:80/v1/?key=k", path: "/orders?id=1", want: "http://a:80/v1/orders?key=k&id=1"},
+		{target: "http://a:80/v1", path: "/a%2Fb", want: "http://a:80/v1/a%2Fb"},
+	}
+
+	for _, tt := range tests {
+		target, _ := url.Parse(tt.target)
+		u, _ := url.Parse(tt.path)
+		if got := targetURL(target, u).String(); got != tt.want {
+			t.Errorf("targetURL(%q, %q) = %q, want %q", tt.target, tt.path, got, tt.want)
+		}
+	}
+}
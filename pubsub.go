@@ -0,0 +1,163 @@
+package svcutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+var ErrInvalidTopic = errors.New("invalid topic")
+
+// Message is a notification published to a topic
+type Message struct {
+	Topic     string    `json:"-"`
+	Publisher string    `json:"publisher"`
+	Time      time.Time `json:"time"`
+	Payload   []byte    `json:"payload"`
+	// Revision orders messages of a topic, pass it to SubscribeFrom to resume after it
+	Revision int64 `json:"-"`
+}
+
+func (c *Service) topicPrefix(topic string) string {
+	return c.options.topicsPrefix + topic + "/"
+}
+
+// topicTTL is the lease TTL of published messages and commands
+func (c *Service) topicTTL() int64 {
+	ttl := int64(c.options.topicRetention / time.Second)
+	if ttl < 1 {
+		ttl = 1
+	}
+
+	return ttl
+}
+
+func validTopic(topic string) bool {
+	return topic != "" && !strings.Contains(topic, "/")
+}
+
+// Publish stores the payload under a versioned key of the topic, the key expires after
+// the retention set with TopicRetention. Publishing is meant for low-volume control-plane
+// notifications, every message is a separate etcd write with its own lease.
+func (c *Service) Publish(ctx context.Context, topic string, payload []byte) (int64, error) {
+	if !validTopic(topic) {
+		return 0, ErrInvalidTopic
+	}
+
+	now := time.Now()
+	data, err := json.Marshal(Message{Publisher: c.options.instance, Time: now, Payload: payload})
+	if err != nil {
+		return 0, err
+	}
+
+	grant, err := c.etcd.Grant(ctx, c.topicTTL())
+	if err != nil {
+		return 0, etcdError(err)
+	}
+
+	key := fmt.Sprintf("%s%020d-%s", c.topicPrefix(topic), now.UnixNano(), c.options.instance)
+	resp, err := c.etcd.Put(ctx, key, string(data), clientv3.WithLease(grant.ID))
+	if err != nil {
+		return 0, etcdError(err)
+	}
+
+	return resp.Header.Revision, nil
+}
+
+// Subscribe delivers messages published to the topic after the call, the channel is
+// closed once ctx is done or the service is closed
+func (c *Service) Subscribe(ctx context.Context, topic string) (<-chan Message, error) {
+	if !validTopic(topic) {
+		return nil, ErrInvalidTopic
+	}
+
+	resp, err := c.etcd.Get(ctx, c.topicPrefix(topic), clientv3.WithCountOnly())
+	if err != nil {
+		return nil, etcdError(err)
+	}
+
+	return c.subscribe(ctx, topic, resp.Header.Revision), nil
+}
+
+// SubscribeFrom delivers messages published after the given revision, including retained
+// messages published before the call, so a consumer can resume where it stopped. Messages
+// older than the last compaction are not replayed.
+func (c *Service) SubscribeFrom(ctx context.Context, topic string, revision int64) (<-chan Message, error) {
+	if !validTopic(topic) {
+		return nil, ErrInvalidTopic
+	}
+
+	return c.subscribe(ctx, topic, revision), nil
+}
+
+func (c *Service) subscribe(ctx context.Context, topic string, rev int64) <-chan Message {
+	ch := make(chan Message, 64)
+	prefix := c.topicPrefix(topic)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer close(ch)
+
+		for ctx.Err() == nil {
+			wctx, cancel := context.WithCancel(ctx)
+			watchChan := c.etcd.Watch(wctx, prefix, clientv3.WithPrefix(), clientv3.WithFilterDelete(), clientv3.WithRev(rev+1))
+
+			for alive := true; alive; {
+				select {
+				case <-c.stopper:
+					cancel()
+					return
+				case wresp, ok := <-watchChan:
+					if !ok || wresp.Err() != nil {
+						if wresp.CompactRevision > rev {
+							// compacted messages are lost, resume with the oldest available one
+							rev = wresp.CompactRevision - 1
+						}
+						alive = false
+						continue
+					}
+
+					for _, ev := range wresp.Events {
+						rev = ev.Kv.ModRevision
+						msg, err := decodeMessage(topic, ev.Kv)
+						if err != nil {
+							continue
+						}
+
+						select {
+						case ch <- msg:
+						case <-ctx.Done():
+							cancel()
+							return
+						case <-c.stopper:
+							cancel()
+							return
+						}
+					}
+				}
+			}
+			cancel()
+		}
+	}()
+
+	return ch
+}
+
+func decodeMessage(topic string, kv *mvccpb.KeyValue) (Message, error) {
+	var msg Message
+	if err := json.Unmarshal(kv.Value, &msg); err != nil {
+		return msg, err
+	}
+
+	msg.Topic = topic
+	msg.Revision = kv.ModRevision
+
+	return msg, nil
+}
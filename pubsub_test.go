@@ -0,0 +1,43 @@
+package svcutil
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+func TestDecodeMessage(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	data, _ := json.Marshal(Message{Publisher: "host-a", Time: now, Payload: []byte(`{"cmd":"flush"}`)})
+
+	msg, err := decodeMessage("cache", &mvccpb.KeyValue{Key: []byte("/topic/cache/1"), Value: data, ModRevision: 42})
+	if err != nil {
+		t.Fatalf("decodeMessage() error = %v", err)
+	}
+
+	if msg.Topic != "cache" || msg.Publisher != "host-a" || !msg.Time.Equal(now) ||
+		string(msg.Payload) != `{"cmd":"flush"}` || msg.Revision != 42 {
+		t.Errorf("decodeMessage() = %+v", msg)
+	}
+
+	if _, err := decodeMessage("cache", &mvccpb.KeyValue{Value: []byte("garbage")}); err == nil {
+		t.Error("decodeMessage() of invalid data succeeded")
+	}
+}
+
+func TestValidTopic(t *testing.T) {
+	tests := map[string]bool{
+		"cache":       true,
+		"cache-flush": true,
+		"":            false,
+		"a/b":         false,
+	}
+
+	for topic, want := range tests {
+		if got := validTopic(topic); got != want {
+			t.Errorf("validTopic(%q) = %v, want %v", topic, got, want)
+		}
+	}
+}
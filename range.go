@@ -1,8 +1,12 @@
 package svcutil
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -10,28 +14,170 @@ import (
 var ErrInvalidRange = errors.New("invalid range format")
 var ErrEmptyRange = errors.New("empty range")
 var ErrIPV6RangeNotSupported = errors.New("IPv6 range not supported, use comma-separated format")
+var ErrRangeTooLarge = errors.New("range is too large")
+
+// DefaultMaxRangeSize is the maximum number of values a parsed range expands to unless
+// RangeMaxSize is given, so a typo like "1-500000000" fails instead of allocating the
+// whole range
+const DefaultMaxRangeSize = 1 << 20
+
+// RangeTooLargeError is returned when a range expands to more values than allowed, it
+// matches ErrRangeTooLarge with errors.Is
+type RangeTooLargeError struct {
+	Size  uint64
+	Limit int
+}
+
+func (e *RangeTooLargeError) Error() string {
+	return fmt.Sprintf("%s: %d values, limit %d", ErrRangeTooLarge, e.Size, e.Limit)
+}
+
+func (e *RangeTooLargeError) Is(target error) bool {
+	return target == ErrRangeTooLarge
+}
+
+// spanSize returns the number of values from..to (inclusive), failing when adding them to
+// the given number of parsed values exceeds the limit. The difference is computed on
+// unsigned integers, so it can't overflow.
+func spanSize(from, to int64, parsed, limit int) (int, error) {
+	return strideSize(from, to, 1, parsed, limit)
+}
+
+// strideSize is spanSize of every step-th value from..to
+func strideSize(from, to int64, step uint64, parsed, limit int) (int, error) {
+	steps := (uint64(to) - uint64(from)) / step
+	if steps >= uint64(max(limit-parsed, 0)) {
+		size := steps + uint64(parsed) + 1
+		if size < steps {
+			size = math.MaxUint64
+		}
+		return 0, &RangeTooLargeError{Size: size, Limit: limit}
+	}
+
+	return int(steps) + 1, nil
+}
 
 type RangeType int
 
 const (
 	RangeTypeID RangeType = 0
 	RangeTypeIP RangeType = 1
+	// RangeTypeHost ranges are host names, e.g. appliances assigned to instances
+	RangeTypeHost RangeType = 2
+	// RangeTypeMAC ranges are MAC addresses in the canonical lower case colon notation
+	RangeTypeMAC RangeType = 3
+	// RangeTypeVLAN ranges are VLAN IDs from 1 to 4094
+	RangeTypeVLAN RangeType = 4
+)
+
+const (
+	minVLAN = 1
+	maxVLAN = 4094
 )
 
 type Range struct {
 	Type   RangeType
 	Values []string
+	// Weights make Lease prefer free members with higher weights, members without
+	// a weight weigh 1
+	Weights map[string]int
+	// Payloads are structured values of the members, e.g. the gateway and VLAN to
+	// configure along with an IP, see WithPayloads
+	Payloads map[string]json.RawMessage
+}
+
+// WithWeights sets the weights of the members, e.g. to land bigger shards on bigger
+// machines started first, and returns the range
+func (r *Range) WithWeights(weights map[string]int) *Range {
+	r.Weights = weights
+	return r
+}
+
+// Weight returns the weight of the member
+func (r *Range) Weight(value string) int {
+	if w, ok := r.Weights[value]; ok {
+		return w
+	}
+
+	return 1
+}
+
+// candidates returns the members in the order Lease tries them: shuffled, so instances
+// starting together don't compete for the same members, higher weights first
+func (r *Range) candidates() []string {
+	values := make([]string, len(r.Values))
+	copy(values, r.Values)
+	rand.Shuffle(len(values), func(i, j int) { values[i], values[j] = values[j], values[i] })
+
+	if len(r.Weights) > 0 {
+		sort.SliceStable(values, func(i, j int) bool { return r.Weight(values[i]) > r.Weight(values[j]) })
+	}
+
+	return values
+}
+
+// NewWeightedIDRange creates a Range of IDs with weights, members are comma-separated
+// IDs or ID ranges with an optional weight following "=", e.g. "1=3,2=1" or "1-4=2,5-8".
+// Ranges keep their step syntax, e.g. "0-100:5=2". An ID listed by several members keeps
+// the weight of the first one.
+func NewWeightedIDRange(value string, opts ...RangeOption) (*Range, error) {
+	o := newRangeOptions(opts)
+	r := &Range{Type: RangeTypeID, Weights: make(map[string]int)}
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		weight := 1
+		if ids, w, ok := strings.Cut(part, "="); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(w))
+			if err != nil || n < 0 {
+				return nil, ErrInvalidRange
+			}
+			part, weight = strings.TrimSpace(ids), n
+		}
+
+		ids, err := parseIDRange64(part, o)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(r.Values)+len(ids) > o.maxSize {
+			return nil, &RangeTooLargeError{Size: uint64(len(r.Values) + len(ids)), Limit: o.maxSize}
+		}
+
+		for _, id := range ids {
+			v := o.numbers.Format(id)
+			if _, ok := r.Weights[v]; ok {
+				continue
+			}
+			r.Values = append(r.Values, v)
+			r.Weights[v] = weight
+		}
+	}
+
+	if len(r.Values) == 0 {
+		return nil, ErrEmptyRange
+	}
+
+	return r, nil
 }
 
-func NewIDRange(value string) (*Range, error) {
-	ids, err := ParseIDRange(value)
+// NewIDRange creates a Range of IDs parsed with ParseIDRange64, rendered as decimal
+// numbers unless RangeNumberFormat is given
+func NewIDRange(value string, opts ...RangeOption) (*Range, error) {
+	o := newRangeOptions(opts)
+
+	ids, err := parseIDRange64(value, o)
 	if err != nil {
 		return nil, err
 	}
 
 	strIDs := make([]string, len(ids))
 	for i, id := range ids {
-		strIDs[i] = strconv.Itoa(id)
+		strIDs[i] = o.numbers.Format(id)
 	}
 
 	return &Range{
@@ -40,38 +186,80 @@ func NewIDRange(value string) (*Range, error) {
 	}, nil
 }
 
-func ParseIDRange(input string) ([]int, error) {
+// ParseIDRange parses an ID range into ints, see ParseIDRange64 for the syntax. IDs not
+// fitting into int (on 32-bit platforms) are invalid.
+func ParseIDRange(input string, opts ...RangeOption) ([]int, error) {
+	ids, err := ParseIDRange64(input, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]int, len(ids))
+	for n, id := range ids {
+		if int64(int(id)) != id {
+			return nil, ErrInvalidRange
+		}
+		result[n] = int(id)
+	}
+
+	return result, nil
+}
+
+// ParseIDRange64 parses "start-end", "start..end" or comma-separated IDs. IDs are 64-bit,
+// with RangeNegativeIDs they may be negative, e.g. "-5..5", "-10--1" or "-3,7". A range
+// may take every step-th value only, e.g. "0-100:5". Repeated IDs are listed once.
+func ParseIDRange64(input string, opts ...RangeOption) ([]int64, error) {
+	return parseIDRange64(input, newRangeOptions(opts))
+}
+
+func parseIDRange64(input string, o *rangeOptions) ([]int64, error) {
 	input = strings.TrimSpace(input)
 	if input == "" {
 		return nil, ErrInvalidRange
 	}
 
-	var result []int
+	var result []int64
 
-	if strings.Contains(input, "-") {
-		parts := strings.Split(input, "-")
-		if len(parts) != 2 {
+	input, stride, strided := strings.Cut(input, ":")
+	step := uint64(1)
+	if strided {
+		var err error
+		if step, err = strconv.ParseUint(strings.TrimSpace(stride), 10, 64); err != nil || step == 0 {
 			return nil, ErrInvalidRange
 		}
+	}
 
-		start, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if first, last, ok := splitIDRange(input); ok {
+		start, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
 		if err != nil {
 			return nil, ErrInvalidRange
 		}
 
-		end, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		end, err := strconv.ParseInt(strings.TrimSpace(last), 10, 64)
 		if err != nil {
 			return nil, ErrInvalidRange
 		}
 
-		if start > end {
+		if start > end || (start < 0 && !o.negative) {
 			return nil, ErrInvalidRange
 		}
 
-		for i := start; i <= end; i++ {
-			result = append(result, i)
+		size, err := strideSize(start, end, step, 0, o.maxSize)
+		if err != nil {
+			return nil, err
+		}
+
+		// the values don't pass the end, so the product can't overflow
+		result = make([]int64, size)
+		for i := range result {
+			result[i] = int64(uint64(start) + uint64(i)*step)
 		}
 	} else {
+		if strided {
+			return nil, ErrInvalidRange
+		}
+
+		seen := make(map[int64]bool)
 		parts := strings.Split(input, ",")
 		for _, part := range parts {
 			part = strings.TrimSpace(part)
@@ -79,11 +267,20 @@ func ParseIDRange(input string) ([]int, error) {
 				continue
 			}
 
-			num, err := strconv.Atoi(part)
-			if err != nil {
+			num, err := strconv.ParseInt(part, 10, 64)
+			if err != nil || (num < 0 && !o.negative) {
 				return nil, ErrInvalidRange
 			}
 
+			if seen[num] {
+				continue
+			}
+			seen[num] = true
+
+			if len(result) >= o.maxSize {
+				return nil, &RangeTooLargeError{Size: uint64(len(result)) + 1, Limit: o.maxSize}
+			}
+
 			result = append(result, num)
 		}
 	}
@@ -95,8 +292,29 @@ func ParseIDRange(input string) ([]int, error) {
 	return result, nil
 }
 
-func NewIPRange(value string) (*Range, error) {
-	ips, err := ParseIPRange(value)
+// splitIDRange splits a range at "..", or at the first hyphen following a digit so the
+// sign of a negative start or end is not taken for the separator
+func splitIDRange(input string) (string, string, bool) {
+	if first, last, ok := strings.Cut(input, ".."); ok {
+		return first, last, true
+	}
+
+	for n := 1; n < len(input); n++ {
+		if input[n] != '-' {
+			continue
+		}
+
+		prev := strings.TrimRight(input[:n], " \t")
+		if prev != "" && prev[len(prev)-1] >= '0' && prev[len(prev)-1] <= '9' {
+			return input[:n], input[n+1:], true
+		}
+	}
+
+	return "", "", false
+}
+
+func NewIPRange(value string, opts ...RangeOption) (*Range, error) {
+	ips, err := parseIPRange(value, newRangeOptions(opts).maxSize)
 	if err != nil {
 		return nil, err
 	}
@@ -108,6 +326,10 @@ func NewIPRange(value string) (*Range, error) {
 }
 
 func ParseIPRange(input string) ([]string, error) {
+	return parseIPRange(input, DefaultMaxRangeSize)
+}
+
+func parseIPRange(input string, limit int) ([]string, error) {
 	input = strings.TrimSpace(input)
 	if input == "" {
 		return nil, ErrInvalidRange
@@ -133,7 +355,7 @@ func ParseIPRange(input string) ([]string, error) {
 		}
 
 		var err error
-		result, err = generateIPRange(startIP, endIP)
+		result, err = generateIPRange(startIP, endIP, limit)
 		if err != nil {
 			return nil, err
 		}
@@ -149,6 +371,10 @@ func ParseIPRange(input string) ([]string, error) {
 				return nil, ErrInvalidRange
 			}
 
+			if len(result) >= limit {
+				return nil, &RangeTooLargeError{Size: uint64(len(result)) + 1, Limit: limit}
+			}
+
 			result = append(result, ip)
 		}
 	}
@@ -160,6 +386,243 @@ func ParseIPRange(input string) ([]string, error) {
 	return result, nil
 }
 
+// NewHostRange creates a Range of host names, e.g. "node01-node05,gw1"
+func NewHostRange(value string, opts ...RangeOption) (*Range, error) {
+	hosts, err := parseHostRange(value, newRangeOptions(opts).maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Range{
+		Type:   RangeTypeHost,
+		Values: hosts,
+	}, nil
+}
+
+// ParseHostRange parses comma-separated host names and patterns, a pattern expands the
+// numeric suffix of two names with the same prefix keeping the zero padding of the first
+// one, e.g. "node08-node10" to node08, node09 and node10 ("node08-10" is the same)
+func ParseHostRange(input string) ([]string, error) {
+	return parseHostRange(input, DefaultMaxRangeSize)
+}
+
+func parseHostRange(input string, limit int) ([]string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, ErrInvalidRange
+	}
+
+	var result []string
+
+	for _, part := range strings.Split(input, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		if strings.ContainsAny(part, "/ \t") {
+			return nil, ErrInvalidRange
+		}
+
+		hosts, ok, err := expandHostPattern(part, len(result), limit)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			if len(result) >= limit {
+				return nil, &RangeTooLargeError{Size: uint64(len(result)) + 1, Limit: limit}
+			}
+			hosts = []string{part}
+		}
+
+		result = append(result, hosts...)
+	}
+
+	if len(result) == 0 {
+		return nil, ErrEmptyRange
+	}
+
+	return result, nil
+}
+
+// expandHostPattern expands "<prefix><n>-<prefix><m>" or "<prefix><n>-<m>", host names
+// may contain hyphens themselves, so every hyphen is tried as the separator. Parsed is
+// the number of hosts parsed before the pattern.
+func expandHostPattern(pattern string, parsed, limit int) ([]string, bool, error) {
+	for n := 0; n < len(pattern); n++ {
+		if pattern[n] != '-' {
+			continue
+		}
+
+		prefix, start := splitNumericSuffix(pattern[:n])
+		lastPrefix, end := splitNumericSuffix(pattern[n+1:])
+
+		if start == "" || end == "" || (lastPrefix != prefix && lastPrefix != "") {
+			continue
+		}
+
+		from, err := strconv.Atoi(start)
+		if err != nil {
+			return nil, false, ErrInvalidRange
+		}
+
+		to, err := strconv.Atoi(end)
+		if err != nil || from > to {
+			return nil, false, ErrInvalidRange
+		}
+
+		size, err := spanSize(int64(from), int64(to), parsed, limit)
+		if err != nil {
+			return nil, false, err
+		}
+
+		hosts := make([]string, size)
+		for i := range hosts {
+			hosts[i] = fmt.Sprintf("%s%0*d", prefix, len(start), from+i)
+		}
+
+		return hosts, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// splitNumericSuffix splits "node01" into "node" and "01"
+func splitNumericSuffix(name string) (string, string) {
+	n := len(name)
+	for n > 0 && name[n-1] >= '0' && name[n-1] <= '9' {
+		n--
+	}
+
+	return name[:n], name[n:]
+}
+
+// NewMACRange creates a Range of MAC addresses, e.g. "00:11:22:33:44:00-00:11:22:33:44:ff"
+func NewMACRange(value string, opts ...RangeOption) (*Range, error) {
+	macs, err := parseMACRange(value, newRangeOptions(opts).maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Range{
+		Type:   RangeTypeMAC,
+		Values: macs,
+	}, nil
+}
+
+// ParseMACRange parses a range or comma-separated list of colon-separated MAC addresses,
+// the addresses are returned in lower case
+func ParseMACRange(input string) ([]string, error) {
+	return parseMACRange(input, DefaultMaxRangeSize)
+}
+
+func parseMACRange(input string, limit int) ([]string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, ErrInvalidRange
+	}
+
+	var result []string
+
+	if first, last, ok := strings.Cut(input, "-"); ok {
+		start, ok := parseMAC(strings.TrimSpace(first))
+		if !ok {
+			return nil, ErrInvalidRange
+		}
+
+		end, ok := parseMAC(strings.TrimSpace(last))
+		if !ok || start > end {
+			return nil, ErrInvalidRange
+		}
+
+		size, err := spanSize(int64(start), int64(end), 0, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		result = make([]string, size)
+		for i := range result {
+			result[i] = formatMAC(start + uint64(i))
+		}
+	} else {
+		for _, part := range strings.Split(input, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+
+			mac, ok := parseMAC(part)
+			if !ok {
+				return nil, ErrInvalidRange
+			}
+
+			if len(result) >= limit {
+				return nil, &RangeTooLargeError{Size: uint64(len(result)) + 1, Limit: limit}
+			}
+
+			result = append(result, formatMAC(mac))
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, ErrEmptyRange
+	}
+
+	return result, nil
+}
+
+// parseMAC parses "00:11:22:33:44:55" into its 48-bit value
+func parseMAC(s string) (uint64, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 6 {
+		return 0, false
+	}
+
+	var mac uint64
+	for _, part := range parts {
+		if len(part) != 2 {
+			return 0, false
+		}
+
+		b, err := strconv.ParseUint(part, 16, 8)
+		if err != nil {
+			return 0, false
+		}
+
+		mac = mac<<8 | b
+	}
+
+	return mac, true
+}
+
+func formatMAC(mac uint64) string {
+	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x",
+		(mac>>40)&0xFF, (mac>>32)&0xFF, (mac>>24)&0xFF, (mac>>16)&0xFF, (mac>>8)&0xFF, mac&0xFF)
+}
+
+// NewVLANRange creates a Range of VLAN IDs written like ID ranges, e.g. "100-199" or
+// "2-4094:2", IDs outside of 1-4094 are invalid
+func NewVLANRange(value string, opts ...RangeOption) (*Range, error) {
+	ids, err := parseIDRange64(value, newRangeOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	vlans := make([]string, len(ids))
+	for n, id := range ids {
+		if id < minVLAN || id > maxVLAN {
+			return nil, ErrInvalidRange
+		}
+		vlans[n] = strconv.FormatInt(id, 10)
+	}
+
+	return &Range{
+		Type:   RangeTypeVLAN,
+		Values: vlans,
+	}, nil
+}
+
 func isValidIP(ip string) bool {
 	return isIPv4(ip) || isIPv6(ip)
 }
@@ -236,7 +699,7 @@ func isIPv6(ip string) bool {
 	return true
 }
 
-func generateIPRange(startIP, endIP string) ([]string, error) {
+func generateIPRange(startIP, endIP string, limit int) ([]string, error) {
 	start := ipv4ToInt(startIP)
 	end := ipv4ToInt(endIP)
 
@@ -244,9 +707,15 @@ func generateIPRange(startIP, endIP string) ([]string, error) {
 		return nil, ErrInvalidRange
 	}
 
-	var ips []string
-	for i := start; i <= end; i++ {
-		ips = append(ips, intToIPv4(i))
+	size, err := spanSize(int64(start), int64(end), 0, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// counting avoids the overflow of start past 255.255.255.255
+	ips := make([]string, size)
+	for i := range ips {
+		ips[i] = intToIPv4(start + uint32(i))
 	}
 
 	return ips, nil
@@ -1,8 +1,11 @@
 package svcutil
 
 import (
+	"errors"
 	"reflect"
 	"testing"
+
+	"golang.org/x/net/context"
 )
 
 func TestNewIDRange(t *testing.T) {
@@ -155,11 +158,83 @@ func TestParseIDRange(t *testing.T) {
 			expected: []int{1, 2, 3},
 			wantErr:  false,
 		},
+		{
+			name:     "dotted range",
+			input:    "3..5",
+			expected: []int{3, 4, 5},
+			wantErr:  false,
+		},
+		{
+			name:     "negative start",
+			input:    "-2-1",
+			expected: []int{-2, -1, 0, 1},
+			wantErr:  false,
+		},
+		{
+			name:     "negative bounds",
+			input:    "-3 - -1",
+			expected: []int{-3, -2, -1},
+			wantErr:  false,
+		},
+		{
+			name:     "negative dotted range",
+			input:    "-1..1",
+			expected: []int{-1, 0, 1},
+			wantErr:  false,
+		},
+		{
+			name:     "negative values",
+			input:    "-7,3",
+			expected: []int{-7, 3},
+			wantErr:  false,
+		},
+		{
+			name:     "stride",
+			input:    "0-20:5",
+			expected: []int{0, 5, 10, 15, 20},
+			wantErr:  false,
+		},
+		{
+			name:     "stride not reaching the end",
+			input:    "-3..4:3",
+			expected: []int{-3, 0, 3},
+			wantErr:  false,
+		},
+		{
+			name:     "zero stride",
+			input:    "0-20:0",
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name:     "stride of a list",
+			input:    "1,2:2",
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name:     "repeated values",
+			input:    "3,1,3,1",
+			expected: []int{3, 1},
+			wantErr:  false,
+		},
+		{
+			name:     "missing end",
+			input:    "1..",
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name:     "double sign",
+			input:    "--1",
+			expected: nil,
+			wantErr:  true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := ParseIDRange(tt.input)
+			result, err := ParseIDRange(tt.input, RangeNegativeIDs())
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ParseIDRange(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
 				return
@@ -171,6 +246,36 @@ func TestParseIDRange(t *testing.T) {
 	}
 }
 
+func TestParseIDRange64(t *testing.T) {
+	ids, err := ParseIDRange64("9223372036854775805..9223372036854775807")
+	if err != nil || !reflect.DeepEqual(ids, []int64{9223372036854775805, 9223372036854775806, 9223372036854775807}) {
+		t.Errorf("ParseIDRange64() = %v, %v", ids, err)
+	}
+
+	ids, err = ParseIDRange64("-9223372036854775808,5000000000", RangeNegativeIDs())
+	if err != nil || !reflect.DeepEqual(ids, []int64{-9223372036854775808, 5000000000}) {
+		t.Errorf("ParseIDRange64() = %v, %v", ids, err)
+	}
+
+	for _, input := range []string{"-2-1", "-3 - -1", "-1..1", "-7,3", "-3..4:3"} {
+		if _, err := ParseIDRange64(input); err != ErrInvalidRange {
+			t.Errorf("ParseIDRange64(%q) without RangeNegativeIDs error = %v, want %v", input, err, ErrInvalidRange)
+		}
+	}
+	if r, err := NewIDRange("-1..1", RangeNegativeIDs()); err != nil || !reflect.DeepEqual(r.Values, []string{"-1", "0", "1"}) {
+		t.Errorf("NewIDRange() with RangeNegativeIDs = %+v, %v", r, err)
+	}
+
+	if _, err := ParseIDRange64("9223372036854775808"); err == nil {
+		t.Error("ParseIDRange64() of an overflowing ID error = nil")
+	}
+
+	r, err := NewIDRange("4294967296..4294967297")
+	if err != nil || !reflect.DeepEqual(r.Values, []string{"4294967296", "4294967297"}) {
+		t.Errorf("NewIDRange() = %+v, %v", r, err)
+	}
+}
+
 func TestNewIPRange(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -364,7 +469,7 @@ func TestGenerateIPRange(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := generateIPRange(tt.start, tt.end)
+			result, err := generateIPRange(tt.start, tt.end, DefaultMaxRangeSize)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("generateIPRange(%q, %q) error = %v, wantErr %v", tt.start, tt.end, err, tt.wantErr)
 				return
@@ -375,3 +480,301 @@ func TestGenerateIPRange(t *testing.T) {
 		})
 	}
 }
+
+func TestNewHostRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+		wantErr  bool
+	}{
+		{"pattern and host", "node01-node05,gw1", []string{"node01", "node02", "node03", "node04", "node05", "gw1"}, false},
+		{"short pattern", "node08-10", []string{"node08", "node09", "node10"}, false},
+		{"unpadded pattern", "node8-node10", []string{"node8", "node9", "node10"}, false},
+		{"hyphenated names", "gw-eu-1-gw-eu-3", []string{"gw-eu-1", "gw-eu-2", "gw-eu-3"}, false},
+		{"hyphenated host", "db-primary, db-replica", []string{"db-primary", "db-replica"}, false},
+		{"different prefixes", "node1-gw3", []string{"node1-gw3"}, false},
+		{"reversed pattern", "node05-node01", nil, true},
+		{"slash", "rack/1", nil, true},
+		{"empty", " ", nil, true},
+		{"only commas", ",,", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewHostRange(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewHostRange(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if r.Type != RangeTypeHost || !reflect.DeepEqual(r.Values, tt.expected) {
+				t.Errorf("NewHostRange(%q) = %v, want %v", tt.input, r.Values, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewWeightedIDRange(t *testing.T) {
+	r, err := NewWeightedIDRange("1=3, 2=1, 5-7=2, 9")
+	if err != nil {
+		t.Fatalf("NewWeightedIDRange() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(r.Values, []string{"1", "2", "5", "6", "7", "9"}) {
+		t.Errorf("Values = %v", r.Values)
+	}
+
+	if r.Weight("1") != 3 || r.Weight("6") != 2 || r.Weight("9") != 1 || r.Weight("42") != 1 {
+		t.Errorf("Weights = %v", r.Weights)
+	}
+
+	r, err = NewWeightedIDRange("0-10:5=3, 3-4, 5=9")
+	if err != nil {
+		t.Fatalf("NewWeightedIDRange() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(r.Values, []string{"0", "5", "10", "3", "4"}) || r.Weight("5") != 3 || r.Weight("4") != 1 {
+		t.Errorf("strided range = %v, weights %v", r.Values, r.Weights)
+	}
+
+	// a step without a weight is not mistaken for one
+	r, err = NewWeightedIDRange("0-4:2")
+	if err != nil || !reflect.DeepEqual(r.Values, []string{"0", "2", "4"}) || r.Weight("2") != 1 {
+		t.Errorf("NewWeightedIDRange() of a strided range = %+v, %v", r, err)
+	}
+
+	for _, input := range []string{"1=x", "1=-1", "3-1=2", "", "1-4=0=x"} {
+		if _, err := NewWeightedIDRange(input); err == nil {
+			t.Errorf("NewWeightedIDRange(%q) error = nil", input)
+		}
+	}
+}
+
+func TestRangeCandidates(t *testing.T) {
+	r := (&Range{Type: RangeTypeID, Values: []string{"1", "2", "3", "4"}}).WithWeights(map[string]int{"3": 5, "1": 2})
+
+	for range 10 {
+		c := r.candidates()
+		if c[0] != "3" || c[1] != "1" || len(c) != 4 {
+			t.Fatalf("candidates() = %v, want 3 and 1 first", c)
+		}
+	}
+}
+
+func TestRangeTooLarge(t *testing.T) {
+	parse := map[string]func(string) (int, error){
+		"id":   func(s string) (int, error) { r, err := ParseIDRange(s); return len(r), err },
+		"ip":   func(s string) (int, error) { r, err := ParseIPRange(s); return len(r), err },
+		"host": func(s string) (int, error) { r, err := ParseHostRange(s); return len(r), err },
+		"weighted": func(s string) (int, error) {
+			r, err := NewWeightedIDRange(s)
+			if err != nil {
+				return 0, err
+			}
+			return len(r.Values), nil
+		},
+	}
+
+	tests := []struct {
+		parser string
+		input  string
+	}{
+		{"id", "1-500000000"},
+		{"id", "0-9223372036854775807"},
+		{"ip", "0.0.0.0-255.255.255.255"},
+		{"ip", "10.0.0.0-10.255.255.255"},
+		{"host", "node0-node9999999999"},
+		{"host", "gw,node0-node1048575"},
+	}
+
+	for _, tt := range tests {
+		var tooLarge *RangeTooLargeError
+		if _, err := parse[tt.parser](tt.input); !errors.Is(err, ErrRangeTooLarge) || !errors.As(err, &tooLarge) {
+			t.Errorf("%s %q error = %v, want %v", tt.parser, tt.input, err, ErrRangeTooLarge)
+		}
+	}
+
+	newRange := map[string]func(string, ...RangeOption) (*Range, error){
+		"id":       NewIDRange,
+		"ip":       NewIPRange,
+		"host":     NewHostRange,
+		"mac":      NewMACRange,
+		"vlan":     NewVLANRange,
+		"weighted": NewWeightedIDRange,
+		"def":      ParseRangeDefinition,
+	}
+
+	limited := []struct {
+		parser string
+		input  string
+		ok     bool
+	}{
+		{"id", "1-4", true},
+		{"id", "1-5", false},
+		{"id", "1,2,3,4,5", false},
+		{"ip", "10.0.0.1-10.0.0.4", true},
+		{"ip", "10.0.0.255-10.0.1.3", false},
+		{"host", "node1-node4", true},
+		{"host", "a,node1-node4", false},
+		{"mac", "00:00:00:00:00:01-00:00:00:00:00:04", true},
+		{"mac", "00:00:00:00:00:01-00:00:00:00:00:05", false},
+		{"vlan", "100-103", true},
+		{"vlan", "100-104", false},
+		{"weighted", "1-2=2,3-4", true},
+		{"weighted", "1-3=2,4-5", false},
+		{"def", "ip:10.0.0.1-10.0.0.4", true},
+		{"def", "host:node1-node5", false},
+	}
+
+	for _, tt := range limited {
+		r, err := newRange[tt.parser](tt.input, RangeMaxSize(4))
+		if tt.ok && (err != nil || len(r.Values) != 4) {
+			t.Errorf("%s %q = %+v, %v, want 4 values", tt.parser, tt.input, r, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrRangeTooLarge) {
+			t.Errorf("%s %q error = %v, want %v", tt.parser, tt.input, err, ErrRangeTooLarge)
+		}
+	}
+}
+
+func FuzzParseIDRange(f *testing.F) {
+	for _, seed := range []string{"1-10", "1,2,3", " 5 ", "1-", "-1", "10-1", "0-9223372036854775807", "1-500000000", "-5..5", "-10--1", "0-100:5", "-9223372036854775808..9223372036854775807:4611686018427387904"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		ids, err := ParseIDRange(input)
+		if err != nil {
+			return
+		}
+
+		if len(ids) == 0 || len(ids) > DefaultMaxRangeSize {
+			t.Errorf("ParseIDRange(%q) returned %d values", input, len(ids))
+		}
+	})
+}
+
+func FuzzParseIPRange(f *testing.F) {
+	for _, seed := range []string{"10.0.0.1-10.0.0.5", "10.0.0.1,10.0.0.2", "::1", "0.0.0.0-255.255.255.255", "1.2.3.4-", "255.255.255.255-255.255.255.255"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		ips, err := ParseIPRange(input)
+		if err != nil {
+			return
+		}
+
+		if len(ips) == 0 || len(ips) > DefaultMaxRangeSize {
+			t.Errorf("ParseIPRange(%q) returned %d values", input, len(ips))
+		}
+
+		for _, ip := range ips {
+			if !isValidIP(ip) {
+				t.Errorf("ParseIPRange(%q) returned invalid %q", input, ip)
+			}
+		}
+	})
+}
+
+func FuzzParseHostRange(f *testing.F) {
+	for _, seed := range []string{"node01-node05,gw1", "node08-10", "a-b-c", "x0-x99999999999999999999", "-", "n1-n0"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		hosts, err := ParseHostRange(input)
+		if err != nil {
+			return
+		}
+
+		if len(hosts) == 0 || len(hosts) > DefaultMaxRangeSize {
+			t.Errorf("ParseHostRange(%q) returned %d values", input, len(hosts))
+		}
+	})
+}
+
+func TestParseMACRange(t *testing.T) {
+	macs, err := ParseMACRange("00:11:22:33:44:FE-00:11:22:33:45:01")
+	if err != nil {
+		t.Fatalf("ParseMACRange() error = %v", err)
+	}
+
+	want := []string{"00:11:22:33:44:fe", "00:11:22:33:44:ff", "00:11:22:33:45:00", "00:11:22:33:45:01"}
+	if !reflect.DeepEqual(macs, want) {
+		t.Errorf("ParseMACRange() = %v, want %v", macs, want)
+	}
+
+	macs, err = ParseMACRange("AA:BB:CC:DD:EE:FF, 00:00:00:00:00:01")
+	if err != nil || !reflect.DeepEqual(macs, []string{"aa:bb:cc:dd:ee:ff", "00:00:00:00:00:01"}) {
+		t.Errorf("ParseMACRange() list = %v, %v", macs, err)
+	}
+
+	for _, input := range []string{"", "00:11:22:33:44", "00:11:22:33:44:0g", "00:11:22:33:44:1-00:11:22:33:44:02", "00:11:22:33:44:02-00:11:22:33:44:01", "00-11-22-33-44-55"} {
+		if _, err := ParseMACRange(input); err == nil {
+			t.Errorf("ParseMACRange(%q) error = nil", input)
+		}
+	}
+
+	if _, err := ParseMACRange("00:00:00:00:00:00-ff:ff:ff:ff:ff:ff"); !errors.Is(err, ErrRangeTooLarge) {
+		t.Errorf("ParseMACRange() of all addresses error = %v, want %v", err, ErrRangeTooLarge)
+	}
+
+	r, err := NewMACRange("00:11:22:33:44:00-00:11:22:33:44:ff")
+	if err != nil || r.Type != RangeTypeMAC || len(r.Values) != 256 {
+		t.Errorf("NewMACRange() = %+v, %v", r, err)
+	}
+}
+
+func TestNewVLANRange(t *testing.T) {
+	r, err := NewVLANRange("100-103")
+	if err != nil || r.Type != RangeTypeVLAN || !reflect.DeepEqual(r.Values, []string{"100", "101", "102", "103"}) {
+		t.Errorf("NewVLANRange() = %+v, %v", r, err)
+	}
+
+	r, err = NewVLANRange("1-4094")
+	if err != nil || len(r.Values) != 4094 {
+		t.Errorf("NewVLANRange() of all VLANs = %d values, %v", len(r.Values), err)
+	}
+
+	for _, input := range []string{"0-10", "4090-4095", "5000", "-1", ""} {
+		if _, err := NewVLANRange(input); err == nil {
+			t.Errorf("NewVLANRange(%q) error = nil", input)
+		}
+	}
+}
+
+func TestNetworkRangeLease(t *testing.T) {
+	svc, err := NewService(Name("netprov"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	macs, _ := NewMACRange("00:11:22:33:44:00")
+	vlans, _ := NewVLANRange("100")
+
+	for _, tt := range []struct {
+		r      *Range
+		prefix string
+	}{
+		{macs, "/lock/netprov/mac/"},
+		{vlans, "/lock/netprov/vlan/"},
+	} {
+		lease := NewLeaseWithOptions(tt.r, svc)
+		value, err := lease.Obtain(context.Background())
+		if err != nil || value != tt.r.Values[0] {
+			t.Fatalf("Obtain() = %q, %v, want %q", value, err, tt.r.Values[0])
+		}
+
+		resp, err := svc.etcd.Get(context.Background(), tt.prefix+value)
+		if err != nil || len(resp.Kvs) != 1 {
+			t.Errorf("lease key %q not found: %v", tt.prefix+value, err)
+		}
+		lease.Close()
+	}
+}
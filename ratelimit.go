@@ -0,0 +1,158 @@
+package svcutil
+
+import (
+	"errors"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+)
+
+var ErrRateLimited = errors.New("etcd request rate limit would exceed the deadline")
+
+// RateCategory groups etcd requests limited with RateLimit and CategoryRateLimit. Watches
+// and lease keep-alives are long-lived streams and are never limited.
+type RateCategory int
+
+const (
+	RateRead RateCategory = iota
+	// RateWrite are puts and deletes
+	RateWrite
+	// RateTxn is the commit of a transaction, used by locks, leases and config history
+	RateTxn
+	// RateLease are grants, revocations and queries of etcd leases
+	RateLease
+)
+
+func (rc RateCategory) String() string {
+	switch rc {
+	case RateRead:
+		return "read"
+	case RateWrite:
+		return "write"
+	case RateTxn:
+		return "txn"
+	case RateLease:
+		return "lease"
+	}
+
+	return "unknown"
+}
+
+// rateLimit is the configured rate of requests per second and the burst
+type rateLimit struct {
+	rate  float64
+	burst int
+}
+
+func (l rateLimit) limiter() *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(l.rate), max(l.burst, 1))
+}
+
+// rateLimiter throttles requests of every category with its own limiter if it has an
+// override or with the shared one otherwise
+type rateLimiter struct {
+	categories [RateLease + 1]*rate.Limiter
+}
+
+// newRateLimiter returns nil when no limit is configured
+func newRateLimiter(all *rateLimit, overrides map[RateCategory]rateLimit) *rateLimiter {
+	if all == nil && len(overrides) == 0 {
+		return nil
+	}
+
+	rl := &rateLimiter{}
+
+	var shared *rate.Limiter
+	if all != nil {
+		shared = all.limiter()
+	}
+
+	for n := range rl.categories {
+		if l, ok := overrides[RateCategory(n)]; ok {
+			rl.categories[n] = l.limiter()
+		} else {
+			rl.categories[n] = shared
+		}
+	}
+
+	return rl
+}
+
+// wait blocks until the request is allowed, it fails right away if the wait would outlast
+// the deadline of ctx
+func (rl *rateLimiter) wait(ctx context.Context, rc RateCategory) error {
+	l := rl.categories[rc]
+	if l == nil {
+		return nil
+	}
+
+	if err := l.Wait(ctx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return ErrRateLimited
+	}
+
+	return nil
+}
+
+func rateCategory(op clientv3.Op) RateCategory {
+	switch {
+	case op.IsPut(), op.IsDelete():
+		return RateWrite
+	case op.IsTxn():
+		return RateTxn
+	}
+
+	return RateRead
+}
+
+// middleware throttles key-value requests, it goes after retries so every attempt is limited
+func (rl *rateLimiter) middleware(next Operation) Operation {
+	return func(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+		if err := rl.wait(ctx, rateCategory(op)); err != nil {
+			return clientv3.OpResponse{}, err
+		}
+
+		return next(ctx, op)
+	}
+}
+
+// rateLimitLease throttles lease requests other than keep-alives
+type rateLimitLease struct {
+	clientv3.Lease
+	rl *rateLimiter
+}
+
+func (l *rateLimitLease) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	if err := l.rl.wait(ctx, RateLease); err != nil {
+		return nil, err
+	}
+
+	return l.Lease.Grant(ctx, ttl)
+}
+
+func (l *rateLimitLease) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	if err := l.rl.wait(ctx, RateLease); err != nil {
+		return nil, err
+	}
+
+	return l.Lease.Revoke(ctx, id)
+}
+
+func (l *rateLimitLease) TimeToLive(ctx context.Context, id clientv3.LeaseID, opts ...clientv3.LeaseOption) (*clientv3.LeaseTimeToLiveResponse, error) {
+	if err := l.rl.wait(ctx, RateLease); err != nil {
+		return nil, err
+	}
+
+	return l.Lease.TimeToLive(ctx, id, opts...)
+}
+
+func (l *rateLimitLease) Leases(ctx context.Context) (*clientv3.LeaseLeasesResponse, error) {
+	if err := l.rl.wait(ctx, RateLease); err != nil {
+		return nil, err
+	}
+
+	return l.Lease.Leases(ctx)
+}
@@ -0,0 +1,74 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+func TestRateLimiter(t *testing.T) {
+	if newRateLimiter(nil, nil) != nil {
+		t.Fatal("newRateLimiter() without limits is not nil")
+	}
+
+	var calls int
+	next := func(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+		calls++
+		return clientv3.OpResponse{}, nil
+	}
+
+	// reads share a limit of 1 per second, writes are limited separately
+	rl := newRateLimiter(&rateLimit{rate: 1, burst: 1}, map[RateCategory]rateLimit{RateWrite: {rate: 1000, burst: 5}})
+	do := rl.middleware(next)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := do(ctx, clientv3.OpGet("/a")); err != nil {
+		t.Fatalf("first get error = %v", err)
+	}
+	if _, err := do(ctx, clientv3.OpGet("/a")); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("second get error = %v, want %v", err, ErrRateLimited)
+	}
+
+	for n := 0; n < 5; n++ {
+		if _, err := do(ctx, clientv3.OpPut("/a", "1")); err != nil {
+			t.Fatalf("put %d error = %v", n, err)
+		}
+	}
+
+	// transactions fall back to the shared limit used up by the reads
+	if _, err := do(ctx, clientv3.OpTxn(nil, nil, nil)); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("txn error = %v, want %v", err, ErrRateLimited)
+	}
+
+	if calls != 6 {
+		t.Errorf("calls = %d, want 6", calls)
+	}
+}
+
+func TestRateLimitService(t *testing.T) {
+	svc, err := NewService(Name("api"), LocalBackend(t.TempDir()), CategoryRateLimit(RateWrite, 20, 1))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	started := time.Now()
+	for n := 0; n < 5; n++ {
+		if _, err := svc.etcd.Put(ctx, "/limited", "1"); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	// the first put uses the burst, the other four wait 50ms each
+	if elapsed := time.Since(started); elapsed < 150*time.Millisecond {
+		t.Errorf("5 puts took %v, want them throttled", elapsed)
+	}
+}
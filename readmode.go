@@ -0,0 +1,35 @@
+package svcutil
+
+import (
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+type ReadMode int
+
+const (
+	// ReadModeLinearizable reads go through the raft quorum and always observe the latest data
+	ReadModeLinearizable ReadMode = iota
+	// ReadModeSerializable reads are served by the connected member and may be slightly stale
+	ReadModeSerializable
+)
+
+type readModeKey struct{}
+
+// WithReadMode overrides the read mode of configuration reads made with the returned context
+func WithReadMode(ctx context.Context, mode ReadMode) context.Context {
+	return context.WithValue(ctx, readModeKey{}, mode)
+}
+
+func (c *Service) readOptions(ctx context.Context) []clientv3.OpOption {
+	mode := c.options.readMode
+	if m, ok := ctx.Value(readModeKey{}).(ReadMode); ok {
+		mode = m
+	}
+
+	if mode == ReadModeSerializable {
+		return []clientv3.OpOption{clientv3.WithSerializable()}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package svcutil
+
+import (
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// readRoutingKV sends serializable reads to a client connected to the read endpoints,
+// e.g. members in the same availability zone, everything else goes to the full endpoint
+// set. A failed read is retried on the full endpoint set.
+type readRoutingKV struct {
+	kv    clientv3.KV
+	reads clientv3.KV
+}
+
+func (r *readRoutingKV) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	return r.kv.Put(ctx, key, val, opts...)
+}
+
+func (r *readRoutingKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	resp, err := r.Do(ctx, clientv3.OpGet(key, opts...))
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Get(), nil
+}
+
+func (r *readRoutingKV) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	return r.kv.Delete(ctx, key, opts...)
+}
+
+func (r *readRoutingKV) Compact(ctx context.Context, rev int64, opts ...clientv3.CompactOption) (*clientv3.CompactResponse, error) {
+	return r.kv.Compact(ctx, rev, opts...)
+}
+
+func (r *readRoutingKV) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+	if !op.IsGet() || !op.IsSerializable() {
+		return r.kv.Do(ctx, op)
+	}
+
+	resp, err := r.reads.Do(ctx, op)
+	if err != nil && ctx.Err() == nil {
+		return r.kv.Do(ctx, op)
+	}
+
+	return resp, err
+}
+
+func (r *readRoutingKV) Txn(ctx context.Context) clientv3.Txn {
+	return r.kv.Txn(ctx)
+}
@@ -0,0 +1,55 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// recordingKV counts requests and fails them if err is set
+type recordingKV struct {
+	clientv3.KV
+	ops int
+	err error
+}
+
+func (k *recordingKV) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+	k.ops++
+	if k.err != nil {
+		return clientv3.OpResponse{}, k.err
+	}
+
+	return (&clientv3.GetResponse{}).OpResponse(), nil
+}
+
+func TestReadRoutingKV(t *testing.T) {
+	tests := []struct {
+		name      string
+		op        clientv3.Op
+		readErr   error
+		wantMain  int
+		wantReads int
+	}{
+		{name: "serializable get", op: clientv3.OpGet("k", clientv3.WithSerializable()), wantReads: 1},
+		{name: "linearizable get", op: clientv3.OpGet("k"), wantMain: 1},
+		{name: "put", op: clientv3.OpPut("k", "v"), wantMain: 1},
+		{name: "failed read falls back", op: clientv3.OpGet("k", clientv3.WithSerializable()), readErr: errors.New("unavailable"), wantMain: 1, wantReads: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			main, reads := &recordingKV{}, &recordingKV{err: tt.readErr}
+			r := &readRoutingKV{kv: main, reads: reads}
+
+			if _, err := r.Do(context.Background(), tt.op); err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+
+			if main.ops != tt.wantMain || reads.ops != tt.wantReads {
+				t.Errorf("main ops = %d, read ops = %d, want %d, %d", main.ops, reads.ops, tt.wantMain, tt.wantReads)
+			}
+		})
+	}
+}
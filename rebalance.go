@@ -0,0 +1,347 @@
+package svcutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// LoadReport is published by lease holders in coordinator mode
+type LoadReport struct {
+	Instance string `json:"instance"`
+	Value    string `json:"value"`
+	// Key is the lease key of the value, values of ranges of different types may be equal
+	Key  string    `json:"key,omitempty"`
+	Load float64   `json:"load"`
+	Time time.Time `json:"time"`
+
+	lease clientv3.LeaseID
+}
+
+// RebalanceAdvice suggests an instance to voluntarily release one of its leased values
+type RebalanceAdvice struct {
+	Instance     string
+	Value        string
+	Load         float64
+	InstanceLoad float64
+	MeanLoad     float64
+
+	key   string
+	lease clientv3.LeaseID
+}
+
+// loadKey is the lease key mapped into the load namespace, so the range type and the host
+// of per-host ranges tell equal values apart
+func (i *Lease) loadKey() string {
+	return i.client.shadowKey(i.client.options.loadPrefix, i.leaseKey)
+}
+
+func (i *Lease) rebalanceKey() string {
+	return i.client.shadowKey(i.client.options.rebalancePrefix, i.leaseKey)
+}
+
+// PublishLoad publishes the load metric of the leased value, the record is attached
+// to the lease and disappears together with it
+func (i *Lease) PublishLoad(ctx context.Context, load float64) error {
+	if i.value == "" {
+		return ErrLeaseNotObtained
+	}
+
+	data, err := json.Marshal(LoadReport{
+		Instance: i.client.options.instance,
+		Value:    i.value,
+		Key:      i.leaseKey,
+		Load:     load,
+		Time:     time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = i.client.etcd.Put(ctx, i.loadKey(), string(data), clientv3.WithLease(i.currentLease()))
+	return err
+}
+
+// Coordinate enables coordinator mode: load of the leased value is published every interval
+// and EventTypeRebalanceRequested is emitted once a RebalanceAdvisor asks to release the value.
+// Releasing is voluntary, the application is expected to Close the lease when it is ready.
+func (i *Lease) Coordinate(interval time.Duration, load func() float64) error {
+	if i.value == "" {
+		return ErrLeaseNotObtained
+	}
+
+	i.wg.Add(1)
+	go i.coordinator(interval, load)
+
+	return nil
+}
+
+func (i *Lease) coordinator(interval time.Duration, load func() float64) {
+	defer i.wg.Done()
+
+	watchContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	key := i.rebalanceKey()
+
+	// rev is the revision the watch has seen up to, a re-created watch resumes after it so
+	// requests written in between are not lost. The created response pins the first watch.
+	var rev int64
+	watch := func() clientv3.WatchChan {
+		if rev == 0 {
+			return i.client.etcd.Watch(watchContext, key, clientv3.WithCreatedNotify())
+		}
+		return i.client.etcd.Watch(watchContext, key, clientv3.WithRev(rev+1))
+	}
+	watchChan := watch()
+
+	requested := func() {
+		i.emit(Event{Type: EventTypeRebalanceRequested, Key: i.leaseKey, Value: i.value})
+	}
+
+	publish := func() {
+		defer func() {
+			if r := recover(); r != nil {
+				i.emit(Event{Type: EventTypeHandlerPanic, Key: "load", Value: i.value, Err: fmt.Errorf("load func panic: %v", r)})
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(i.options.appContext, i.client.options.etcdDialTimeout)
+		defer cancel()
+		i.PublishLoad(ctx, load())
+	}
+
+	tk := time.NewTicker(interval)
+	defer tk.Stop()
+
+	publish()
+
+	// a failed watch is re-created after a backoff growing with the failures in a row, the
+	// load keeps being published meanwhile
+	var retry <-chan time.Time
+	failures := 0
+
+	for {
+		select {
+		case <-i.stopper:
+			return
+		case <-i.donec:
+			return
+		case <-tk.C:
+			publish()
+		case <-retry:
+			retry = nil
+			watchChan = watch()
+		case wresp, ok := <-watchChan:
+			if ok && wresp.CompactRevision != 0 {
+				// requests written since rev may be compacted away, a pending one is read
+				// from the key and the watch resumes after the revision it was read at
+				if current, err := i.pendingRebalance(watchContext, key, requested); err == nil {
+					rev = current
+					watchChan = watch()
+					continue
+				}
+			}
+
+			if !ok || wresp.Canceled {
+				failures++
+				watchChan = nil
+				retry = time.After(watchRetryBackoff(failures))
+				continue
+			}
+
+			failures = 0
+			switch {
+			case wresp.Created && rev == 0:
+				rev = wresp.Header.Revision
+			case wresp.IsProgressNotify():
+				rev = max(rev, wresp.Header.Revision)
+			}
+
+			for _, ev := range wresp.Events {
+				rev = max(rev, ev.Kv.ModRevision)
+				if ev.Type == clientv3.EventTypePut {
+					requested()
+				}
+			}
+		}
+	}
+}
+
+// pendingRebalance calls requested if a rebalance request is pending under the key and
+// returns the revision the key was read at
+func (i *Lease) pendingRebalance(ctx context.Context, key string, requested func()) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, i.client.options.etcdDialTimeout)
+	defer cancel()
+
+	resp, err := i.client.etcd.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(resp.Kvs) > 0 {
+		requested()
+	}
+
+	return resp.Header.Revision, nil
+}
+
+type RebalanceAdvisor struct {
+	client    *Service
+	threshold float64
+}
+
+// NewRebalanceAdvisor creates an advisor which suggests releasing values held by instances
+// whose load exceeds the mean instance load by the threshold ratio (e.g. 1.25)
+func NewRebalanceAdvisor(etcd *Service, threshold float64) *RebalanceAdvisor {
+	return &RebalanceAdvisor{
+		client:    etcd,
+		threshold: threshold,
+	}
+}
+
+// Loads returns load reports published by all lease holders of the service, including
+// holders of ranges under a LeaseWithKeyPrefix prefix outside the service namespace
+func (a *RebalanceAdvisor) Loads(ctx context.Context) ([]LoadReport, error) {
+	var reports []LoadReport
+	for _, prefix := range []string{
+		fmt.Sprintf("%s%s%s", a.client.options.locksPrefix, a.client.options.serviceName, a.client.options.loadPrefix),
+		a.client.sharedShadowsPrefix() + a.client.options.loadPrefix,
+	} {
+		resp, err := a.client.etcd.Get(ctx, prefix, clientv3.WithPrefix())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, kv := range resp.Kvs {
+			var report LoadReport
+			if err := json.Unmarshal(kv.Value, &report); err != nil {
+				continue
+			}
+
+			report.lease = clientv3.LeaseID(kv.Lease)
+			reports = append(reports, report)
+		}
+	}
+
+	return reports, nil
+}
+
+// Advise returns release suggestions for overloaded instances
+func (a *RebalanceAdvisor) Advise(ctx context.Context) ([]RebalanceAdvice, error) {
+	reports, err := a.Loads(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return adviseRebalance(reports, a.threshold), nil
+}
+
+// Trigger asks the holder of the advised value to release it
+func (a *RebalanceAdvisor) Trigger(ctx context.Context, advice RebalanceAdvice) error {
+	key := a.client.shadowKey(a.client.options.rebalancePrefix, advice.key)
+	if advice.key == "" {
+		// reported by a holder of an older version, which watches the key of the value
+		key = fmt.Sprintf("%s%s%s%s", a.client.options.locksPrefix, a.client.options.serviceName, a.client.options.rebalancePrefix, advice.Value)
+	}
+
+	// the request is attached to the holder's lease so it never outlives the holder
+	_, err := a.client.etcd.Put(ctx, key, a.client.options.instance, clientv3.WithLease(advice.lease))
+	return err
+}
+
+// Run evaluates the load every interval until ctx is done, emitting EventTypeRebalanceAdvice
+// for every suggestion and triggering the release if trigger is set
+func (a *RebalanceAdvisor) Run(ctx context.Context, interval time.Duration, trigger bool) {
+	tk := time.NewTicker(interval)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+		}
+
+		actx, cancel := context.WithTimeout(ctx, a.client.options.etcdDialTimeout)
+		advice, err := a.Advise(actx)
+		if err != nil {
+			cancel()
+			continue
+		}
+
+		for _, adv := range advice {
+			a.client.emit(Event{Type: EventTypeRebalanceAdvice, Value: adv.Value, Instance: adv.Instance})
+			if trigger {
+				a.Trigger(actx, adv)
+			}
+		}
+		cancel()
+	}
+}
+
+func adviseRebalance(reports []LoadReport, threshold float64) []RebalanceAdvice {
+	byInstance := make(map[string][]LoadReport)
+	total := 0.0
+	for _, r := range reports {
+		byInstance[r.Instance] = append(byInstance[r.Instance], r)
+		total += r.Load
+	}
+
+	if len(byInstance) < 2 {
+		return nil
+	}
+
+	instances := make([]string, 0, len(byInstance))
+	for instance := range byInstance {
+		instances = append(instances, instance)
+	}
+	sort.Strings(instances)
+
+	mean := total / float64(len(byInstance))
+
+	var advice []RebalanceAdvice
+	for _, instance := range instances {
+		values := byInstance[instance]
+		if len(values) < 2 {
+			// releasing the only value just moves the whole load elsewhere
+			continue
+		}
+
+		instanceLoad := 0.0
+		for _, v := range values {
+			instanceLoad += v.Load
+		}
+
+		if instanceLoad <= mean*threshold {
+			continue
+		}
+
+		// release the value which brings the instance closest to the mean
+		excess := instanceLoad - mean
+		best := values[0]
+		for _, v := range values[1:] {
+			if math.Abs(v.Load-excess) < math.Abs(best.Load-excess) ||
+				(math.Abs(v.Load-excess) == math.Abs(best.Load-excess) && v.Value < best.Value) {
+				best = v
+			}
+		}
+
+		advice = append(advice, RebalanceAdvice{
+			Instance:     instance,
+			Value:        best.Value,
+			Load:         best.Load,
+			InstanceLoad: instanceLoad,
+			MeanLoad:     mean,
+			key:          best.Key,
+			lease:        best.lease,
+		})
+	}
+
+	return advice
+}
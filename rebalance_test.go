@@ -0,0 +1,278 @@
+package svcutil
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+func TestAdviseRebalance(t *testing.T) {
+	tests := []struct {
+		name      string
+		reports   []LoadReport
+		threshold float64
+		expected  []string
+	}{
+		{
+			name: "balanced",
+			reports: []LoadReport{
+				{Instance: "a", Value: "1", Load: 10},
+				{Instance: "a", Value: "2", Load: 10},
+				{Instance: "b", Value: "3", Load: 10},
+				{Instance: "b", Value: "4", Load: 10},
+			},
+			threshold: 1.25,
+			expected:  nil,
+		},
+		{
+			name: "overloaded instance releases value closest to excess",
+			reports: []LoadReport{
+				{Instance: "a", Value: "1", Load: 60},
+				{Instance: "a", Value: "2", Load: 25},
+				{Instance: "a", Value: "3", Load: 5},
+				{Instance: "b", Value: "4", Load: 30},
+			},
+			threshold: 1.25,
+			expected:  []string{"a/2"},
+		},
+		{
+			name: "single value instance is never advised",
+			reports: []LoadReport{
+				{Instance: "a", Value: "1", Load: 100},
+				{Instance: "b", Value: "2", Load: 1},
+			},
+			threshold: 1.25,
+			expected:  nil,
+		},
+		{
+			name: "single instance",
+			reports: []LoadReport{
+				{Instance: "a", Value: "1", Load: 100},
+				{Instance: "a", Value: "2", Load: 1},
+			},
+			threshold: 1.25,
+			expected:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result []string
+			for _, adv := range adviseRebalance(tt.reports, tt.threshold) {
+				result = append(result, adv.Instance+"/"+adv.Value)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("adviseRebalance() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRebalanceRangeTypes(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events := make(chan Event, 10)
+	svc, err := NewService(Name("api"), LocalBackend(t.TempDir()), OnEvents(EventsFunc(func(e Event) {
+		if e.Type == EventTypeRebalanceRequested {
+			events <- e
+		}
+	})))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	// the same value leased from ranges of different types
+	ids, _ := NewIDRange("100")
+	vlans, _ := NewVLANRange("100")
+	var leases []*Lease
+	for _, r := range []*Range{ids, vlans} {
+		l := NewLeaseWithOptions(r, svc)
+		defer l.Close()
+		if _, err := l.Obtain(ctx); err != nil {
+			t.Fatalf("Obtain() error = %v", err)
+		}
+		if err := l.Coordinate(time.Hour, func() float64 { return 1 }); err != nil {
+			t.Fatalf("Coordinate() error = %v", err)
+		}
+		leases = append(leases, l)
+	}
+
+	advisor := NewRebalanceAdvisor(svc, 1.25)
+	var reports []LoadReport
+	for len(reports) < 2 {
+		if reports, err = advisor.Loads(ctx); err != nil {
+			t.Fatalf("Loads() error = %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Loads() = %+v, want a report of each lease", reports)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	var vlan LoadReport
+	for _, report := range reports {
+		if report.Key == leases[1].leaseKey {
+			vlan = report
+		}
+	}
+	if len(reports) != 2 || vlan.Key == "" {
+		t.Fatalf("Loads() = %+v, want separate reports of both leases", reports)
+	}
+
+	if err := advisor.Trigger(ctx, RebalanceAdvice{Value: vlan.Value, key: vlan.Key, lease: vlan.lease}); err != nil {
+		t.Fatalf("Trigger() error = %v", err)
+	}
+
+	select {
+	case e := <-events:
+		if e.Key != leases[1].leaseKey {
+			t.Errorf("rebalance requested for %s, want %s", e.Key, leases[1].leaseKey)
+		}
+	case <-ctx.Done():
+		t.Fatal("rebalance was not requested")
+	}
+
+	select {
+	case e := <-events:
+		t.Errorf("rebalance requested for %s as well", e.Key)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// gapWatcher drops the responses of the first watch of the key once drop is closed and closes
+// it once cut is closed, created is closed once that watch is created and the options of the
+// later watches of the key are recorded
+type gapWatcher struct {
+	clientv3.Watcher
+	key                string
+	drop, cut, created chan struct{}
+
+	mu      sync.Mutex
+	started bool
+	watches [][]clientv3.OpOption
+}
+
+func (w *gapWatcher) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	in := w.Watcher.Watch(ctx, key, opts...)
+	if key != w.key {
+		return in
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.started {
+		w.watches = append(w.watches, opts)
+		return in
+	}
+	w.started = true
+
+	out := make(chan clientv3.WatchResponse)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-w.cut:
+				return
+			case resp := <-in:
+				select {
+				case <-w.drop:
+					continue
+				default:
+				}
+				select {
+				case out <- resp:
+					if resp.Created {
+						close(w.created)
+					}
+				case <-w.cut:
+					return
+				}
+			}
+		}
+	}()
+
+	return out
+}
+
+func TestCoordinatorWatchResume(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		events := make(chan Event, 10)
+		svc, err := NewService(Name("api"), LocalBackend(t.TempDir()), OnEvents(EventsFunc(func(e Event) {
+			if e.Type == EventTypeRebalanceRequested {
+				events <- e
+			}
+		})))
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		defer svc.Close()
+
+		r, _ := NewIDRange("1")
+		l := NewLeaseWithOptions(r, svc)
+		defer l.Close()
+		if _, err := l.Obtain(ctx); err != nil {
+			t.Fatalf("Obtain() error = %v", err)
+		}
+
+		w := &gapWatcher{Watcher: svc.etcd.Watcher, key: l.rebalanceKey(), drop: make(chan struct{}), cut: make(chan struct{}), created: make(chan struct{})}
+		svc.etcd.Watcher = w
+		if err := l.Coordinate(time.Hour, func() float64 { return 1 }); err != nil {
+			t.Fatalf("Coordinate() error = %v", err)
+		}
+
+		select {
+		case <-w.created:
+		case <-ctx.Done():
+			t.Fatalf("compact %v: rebalance watch was not created", compact)
+		}
+
+		advisor := NewRebalanceAdvisor(svc, 1.25)
+		var reports []LoadReport
+		for len(reports) == 0 {
+			if reports, err = advisor.Loads(ctx); err != nil {
+				t.Fatalf("Loads() error = %v", err)
+			}
+		}
+
+		// the request is written while the watch is gone
+		close(w.drop)
+		if err := advisor.Trigger(ctx, RebalanceAdvice{Value: "1", key: reports[0].Key, lease: reports[0].lease}); err != nil {
+			t.Fatalf("Trigger() error = %v", err)
+		}
+		if compact {
+			resp, err := svc.etcd.Get(ctx, "/")
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if _, err := svc.etcd.Compact(ctx, resp.Header.Revision); err != nil {
+				t.Fatalf("Compact() error = %v", err)
+			}
+		}
+		close(w.cut)
+
+		select {
+		case e := <-events:
+			if e.Key != l.leaseKey {
+				t.Errorf("compact %v: rebalance requested for %s, want %s", compact, e.Key, l.leaseKey)
+			}
+		case <-ctx.Done():
+			t.Fatalf("compact %v: rebalance request written while the watch was gone is lost", compact)
+		}
+
+		w.mu.Lock()
+		if len(w.watches) == 0 || clientv3.OpGet("", w.watches[0]...).Rev() == 0 {
+			t.Errorf("compact %v: watch re-created without a start revision", compact)
+		}
+		w.mu.Unlock()
+	}
+}
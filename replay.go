@@ -0,0 +1,378 @@
+package svcutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// replayEntry is a recorded etcd request and its response or error, messages are kept in
+// their protobuf encoding
+type replayEntry struct {
+	Method   string     `json:"method"`
+	Request  []byte     `json:"request"`
+	Response []byte     `json:"response,omitempty"`
+	Code     codes.Code `json:"code,omitempty"`
+	Message  string     `json:"message,omitempty"`
+}
+
+// replayMessage is implemented by the etcd API messages
+type replayMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+// recorded reports whether requests of the method are recorded, unary key-value and lease
+// requests are, streams (watches and keep-alives) are not
+func recorded(method string) bool {
+	return strings.HasPrefix(method, "/etcdserverpb.KV/") || strings.HasPrefix(method, "/etcdserverpb.Lease/")
+}
+
+// recorder appends etcd requests of the service and their responses to a file, one json
+// entry per line, see RecordTo
+type recorder struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+	// emit reports requests which could not be recorded as EventTypeRecordFailed
+	emit func(Event)
+}
+
+func newRecorder(path string, emit func(Event)) (*recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &recorder{file: f, enc: json.NewEncoder(f), emit: emit}, nil
+}
+
+// failed reports a request missing from the recording, a replay of it would fail
+func (r *recorder) failed(method string, err error) {
+	r.emit(Event{Type: EventTypeRecordFailed, Key: method, Err: err})
+}
+
+// intercept is a unary client interceptor recording every attempt of a request
+func (r *recorder) intercept(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if !recorded(method) {
+		return err
+	}
+
+	reqMsg, ok := req.(replayMessage)
+	if !ok {
+		return err
+	}
+
+	entry := replayEntry{Method: method}
+
+	var merr error
+	if entry.Request, merr = reqMsg.Marshal(); merr != nil {
+		r.failed(method, merr)
+		return err
+	}
+
+	if err != nil {
+		s, _ := status.FromError(err)
+		entry.Code, entry.Message = s.Code(), s.Message()
+	} else if replyMsg, ok := reply.(replayMessage); ok {
+		if entry.Response, merr = replyMsg.Marshal(); merr != nil {
+			r.failed(method, merr)
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	merr = r.enc.Encode(entry)
+	r.mu.Unlock()
+
+	if merr != nil {
+		r.failed(method, merr)
+	}
+
+	return err
+}
+
+func (r *recorder) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.file.Close()
+}
+
+// replayServer serves recorded responses instead of etcd, see ReplayBackend. A request
+// gets the response of the first unused entry with the same method and request, a request
+// matching none fails so the replayed run can't silently diverge from the recording. With
+// ReplayLooseMatch it gets the first unused entry with the same method instead (requests
+// with timestamps or process ids differ between runs). Keep-alives of granted leases
+// always succeed and watches never receive events.
+type replayServer struct {
+	pb.UnimplementedAuthServer
+	pb.UnimplementedMaintenanceServer
+
+	grpc *grpc.Server
+	lis  *pipeListener
+
+	loose bool
+
+	mu      sync.Mutex
+	entries []replayEntry
+	used    []bool
+	ttls    map[int64]int64
+}
+
+func startReplayServer(path string, loose bool) (*replayServer, error) {
+	entries, err := readReplay(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &replayServer{
+		grpc:    grpc.NewServer(),
+		lis:     newPipeListener(),
+		loose:   loose,
+		entries: entries,
+		used:    make([]bool, len(entries)),
+		ttls:    make(map[int64]int64),
+	}
+
+	pb.RegisterKVServer(s.grpc, s)
+	pb.RegisterLeaseServer(s.grpc, s)
+	pb.RegisterWatchServer(s.grpc, s)
+	pb.RegisterAuthServer(s.grpc, s)
+	pb.RegisterMaintenanceServer(s.grpc, s)
+
+	go s.grpc.Serve(s.lis)
+
+	return s, nil
+}
+
+// startInProcessServer starts the server of the local or replay backend, nil when the
+// service uses etcd
+func startInProcessServer(o *options) (inProcessServer, error) {
+	switch {
+	case o.replayFile != "":
+		s, err := startReplayServer(o.replayFile, o.replayLoose)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case o.localDir != "":
+		s, err := startLocalServer(o.localDir)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	return nil, nil
+}
+
+func readReplay(path string) ([]replayEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []replayEntry
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var entry replayEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+}
+
+// dialOption connects clients to the server in process
+func (s *replayServer) dialOption() grpc.DialOption {
+	return s.lis.dialOption()
+}
+
+func (s *replayServer) close() {
+	s.grpc.Stop()
+}
+
+// take finds the entry answering the request and marks it used, it fails if no unused
+// entry of the method is left or, unless the match is loose, none has the same request
+func (s *replayServer) take(method string, req []byte) (replayEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found, exact := -1, false
+	for n, entry := range s.entries {
+		if s.used[n] || entry.Method != method {
+			continue
+		}
+
+		if bytes.Equal(entry.Request, req) {
+			found, exact = n, true
+			break
+		}
+
+		if found < 0 {
+			found = n
+		}
+	}
+
+	switch {
+	case found < 0:
+		return replayEntry{}, status.Errorf(codes.FailedPrecondition, "svcutil: no recorded response for %s", method)
+	case !exact && !s.loose:
+		return replayEntry{}, status.Errorf(codes.FailedPrecondition, "svcutil: %s request differs from the recording", method)
+	}
+
+	s.used[found] = true
+	return s.entries[found], nil
+}
+
+// replay answers the request of the method with the recorded response
+func (s *replayServer) replay(method string, req replayMessage, resp replayMessage) error {
+	data, err := req.Marshal()
+	if err != nil {
+		return err
+	}
+
+	entry, err := s.take(method, data)
+	if err != nil {
+		return err
+	}
+
+	if entry.Code != codes.OK {
+		return status.Error(entry.Code, entry.Message)
+	}
+
+	return resp.Unmarshal(entry.Response)
+}
+
+func (s *replayServer) Range(ctx context.Context, r *pb.RangeRequest) (*pb.RangeResponse, error) {
+	resp := &pb.RangeResponse{}
+	return resp, s.replay("/etcdserverpb.KV/Range", r, resp)
+}
+
+func (s *replayServer) Put(ctx context.Context, r *pb.PutRequest) (*pb.PutResponse, error) {
+	resp := &pb.PutResponse{}
+	return resp, s.replay("/etcdserverpb.KV/Put", r, resp)
+}
+
+func (s *replayServer) DeleteRange(ctx context.Context, r *pb.DeleteRangeRequest) (*pb.DeleteRangeResponse, error) {
+	resp := &pb.DeleteRangeResponse{}
+	return resp, s.replay("/etcdserverpb.KV/DeleteRange", r, resp)
+}
+
+func (s *replayServer) Txn(ctx context.Context, r *pb.TxnRequest) (*pb.TxnResponse, error) {
+	resp := &pb.TxnResponse{}
+	return resp, s.replay("/etcdserverpb.KV/Txn", r, resp)
+}
+
+func (s *replayServer) Compact(ctx context.Context, r *pb.CompactionRequest) (*pb.CompactionResponse, error) {
+	resp := &pb.CompactionResponse{}
+	return resp, s.replay("/etcdserverpb.KV/Compact", r, resp)
+}
+
+func (s *replayServer) LeaseGrant(ctx context.Context, r *pb.LeaseGrantRequest) (*pb.LeaseGrantResponse, error) {
+	resp := &pb.LeaseGrantResponse{}
+	if err := s.replay("/etcdserverpb.Lease/LeaseGrant", r, resp); err != nil {
+		return nil, err
+	}
+
+	// keep-alives are not recorded, they are answered with the granted TTL
+	s.mu.Lock()
+	s.ttls[resp.ID] = resp.TTL
+	s.mu.Unlock()
+
+	return resp, nil
+}
+
+func (s *replayServer) LeaseRevoke(ctx context.Context, r *pb.LeaseRevokeRequest) (*pb.LeaseRevokeResponse, error) {
+	resp := &pb.LeaseRevokeResponse{}
+	return resp, s.replay("/etcdserverpb.Lease/LeaseRevoke", r, resp)
+}
+
+func (s *replayServer) LeaseTimeToLive(ctx context.Context, r *pb.LeaseTimeToLiveRequest) (*pb.LeaseTimeToLiveResponse, error) {
+	resp := &pb.LeaseTimeToLiveResponse{}
+	return resp, s.replay("/etcdserverpb.Lease/LeaseTimeToLive", r, resp)
+}
+
+func (s *replayServer) LeaseLeases(ctx context.Context, r *pb.LeaseLeasesRequest) (*pb.LeaseLeasesResponse, error) {
+	resp := &pb.LeaseLeasesResponse{}
+	return resp, s.replay("/etcdserverpb.Lease/LeaseLeases", r, resp)
+}
+
+func (s *replayServer) LeaseKeepAlive(stream pb.Lease_LeaseKeepAliveServer) error {
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		ttl := s.ttls[r.ID]
+		s.mu.Unlock()
+
+		if err := stream.Send(&pb.LeaseKeepAliveResponse{Header: &pb.ResponseHeader{}, ID: r.ID, TTL: ttl}); err != nil {
+			return err
+		}
+	}
+}
+
+// Watch acknowledges watches without ever sending events
+func (s *replayServer) Watch(stream pb.Watch_WatchServer) error {
+	var nextID int64
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		resp := &pb.WatchResponse{Header: &pb.ResponseHeader{}}
+		switch {
+		case req.GetCreateRequest() != nil:
+			resp.WatchId, resp.Created = nextID, true
+			nextID++
+		case req.GetCancelRequest() != nil:
+			resp.WatchId, resp.Canceled = req.GetCancelRequest().WatchId, true
+		default:
+			continue
+		}
+
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// Authenticate reports auth as disabled, so clients configured with credentials connect as well
+func (s *replayServer) Authenticate(ctx context.Context, r *pb.AuthenticateRequest) (*pb.AuthenticateResponse, error) {
+	return nil, rpctypes.ErrGRPCAuthNotEnabled
+}
+
+func (s *replayServer) Alarm(ctx context.Context, r *pb.AlarmRequest) (*pb.AlarmResponse, error) {
+	return &pb.AlarmResponse{Header: &pb.ResponseHeader{}}, nil
+}
+
+func (s *replayServer) Status(ctx context.Context, r *pb.StatusRequest) (*pb.StatusResponse, error) {
+	return &pb.StatusResponse{Header: &pb.ResponseHeader{}, Version: "replay"}, nil
+}
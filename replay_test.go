@@ -0,0 +1,146 @@
+package svcutil
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+func TestRecordReplay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	fixture := filepath.Join(t.TempDir(), "etcd.jsonl")
+
+	type config struct {
+		Level string `json:"level"`
+	}
+
+	holder, err := NewService(Name("api"), Instance("api-0"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer holder.Close()
+
+	if _, err := holder.AcquireLock(ctx, "migration"); err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+	if err := holder.SaveConfig(ctx, ConfigurationTypeService, &config{Level: "debug"}); err != nil {
+		t.Fatalf("SaveConfig() error = %v", err)
+	}
+
+	// the sequence runs against the live backend and again against the recording, where
+	// the lock is held and the config saved by an instance which is not running
+	sequence := func(svc *Service, leases bool) {
+		t.Helper()
+
+		if _, err := svc.AcquireLock(ctx, "migration"); !errors.Is(err, ErrMutexAlreadyAcquired) {
+			t.Errorf("AcquireLock() error = %v, want %v", err, ErrMutexAlreadyAcquired)
+		}
+
+		var cfg config
+		if err := svc.LoadConfig(ctx, ConfigurationTypeService, &cfg); err != nil || cfg.Level != "debug" {
+			t.Errorf("LoadConfig() = %+v, %v, want debug", cfg, err)
+		}
+
+		if !leases {
+			return
+		}
+
+		r, _ := NewIDRange("1-3")
+		lease := NewLeaseWithOptions(r, svc)
+		defer lease.Close()
+
+		if _, err := lease.Obtain(ctx); err != nil {
+			t.Errorf("Obtain() error = %v", err)
+		}
+	}
+
+	recorded, err := NewService(Name("api"), Instance("api-1"), LocalBackend(dir), RecordTo(fixture))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	sequence(recorded, true)
+	recorded.Close()
+
+	// lease candidates are tried in random order, so the lease requests differ between
+	// runs and match the recording only loosely
+	replayed, err := NewService(Name("api"), Instance("api-1"), ReplayBackend(fixture), ReplayLooseMatch())
+	if err != nil {
+		t.Fatalf("NewService() with the replay backend error = %v", err)
+	}
+	defer replayed.Close()
+
+	sequence(replayed, true)
+
+	// the recording is used up
+	if _, err := replayed.etcd.Get(ctx, "/unrecorded"); err == nil {
+		t.Error("Get() of an unrecorded request succeeded")
+	}
+}
+
+func TestReplayStrict(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	fixture := filepath.Join(t.TempDir(), "etcd.jsonl")
+
+	recorded, err := NewService(Name("api"), Instance("api-0"), LocalBackend(dir), RecordTo(fixture))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	if _, err := recorded.etcd.Get(ctx, "/recorded"); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	recorded.Close()
+
+	replayed, err := NewService(Name("api"), Instance("api-0"), ReplayBackend(fixture))
+	if err != nil {
+		t.Fatalf("NewService() with the replay backend error = %v", err)
+	}
+	defer replayed.Close()
+
+	// a request differing from the recording fails instead of taking its response
+	if _, err := replayed.etcd.Get(ctx, "/other"); err == nil {
+		t.Error("Get() of a different key succeeded")
+	}
+	if _, err := replayed.etcd.Get(ctx, "/recorded"); err != nil {
+		t.Errorf("Get() of the recorded key error = %v", err)
+	}
+}
+
+func TestRecordFailed(t *testing.T) {
+	fixture := filepath.Join(t.TempDir(), "etcd.jsonl")
+
+	events := make(chan Event, 10)
+	r, err := newRecorder(fixture, func(ev Event) { events <- ev })
+	if err != nil {
+		t.Fatalf("newRecorder() error = %v", err)
+	}
+	r.close()
+
+	// writes to the closed file fail and are reported instead of silently dropped
+	invoke := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+	req, reply := &pb.RangeRequest{Key: []byte("/key")}, &pb.RangeResponse{}
+	if err := r.intercept(context.Background(), "/etcdserverpb.KV/Range", req, reply, nil, invoke); err != nil {
+		t.Fatalf("intercept() error = %v", err)
+	}
+
+	select {
+	case ev := <-events:
+		if ev.Type != EventTypeRecordFailed || ev.Key != "/etcdserverpb.KV/Range" || ev.Err == nil {
+			t.Errorf("event = %+v, want %s of the request", ev, EventTypeRecordFailed)
+		}
+	default:
+		t.Error("the failed write was not reported")
+	}
+}
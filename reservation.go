@@ -0,0 +1,153 @@
+package svcutil
+
+import (
+	"encoding/json"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/context"
+)
+
+// Reservation marks a range member unavailable to Lease.Obtain
+type Reservation struct {
+	Key      string    `json:"-"`
+	Type     RangeType `json:"type"`
+	Value    string    `json:"value"`
+	Reason   string    `json:"reason"`
+	Instance string    `json:"instance"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires,omitempty"`
+}
+
+func (c *Service) reservationKey(t RangeType, value string) string {
+	return c.shadowKey(c.options.reservationsPrefix, c.rangeKeyPrefix(t)+value)
+}
+
+func (i *Lease) reservationGuard(lockKey string) []clientv3.Cmp {
+	return []clientv3.Cmp{clientv3.Compare(clientv3.CreateRevision(i.client.shadowKey(i.client.options.reservationsPrefix, lockKey)), "=", 0)}
+}
+
+// ReserveIDs marks all members of the range unavailable to Lease.Obtain and Lease.Wait,
+// values which are currently held stay with their holders until released.
+// Reservations expire after ttl, zero ttl keeps them until Unreserve is called.
+func (c *Service) ReserveIDs(ctx context.Context, r *Range, reason string, ttl time.Duration) error {
+	ctx, span := c.startSpan(ctx, "ReserveIDs", attribute.Int("svcutil.range.size", len(r.Values)))
+	err := c.reserveIDs(ctx, r, reason, ttl)
+	endSpan(span, err)
+
+	return err
+}
+
+func (c *Service) reserveIDs(ctx context.Context, r *Range, reason string, ttl time.Duration) error {
+	var opts []clientv3.OpOption
+	var lease clientv3.LeaseID
+
+	now := time.Now()
+	res := Reservation{
+		Type:     r.Type,
+		Reason:   reason,
+		Instance: c.options.instance,
+		Created:  now,
+	}
+
+	if ttl > 0 {
+		seconds := int64(ttl.Seconds())
+		if seconds < 1 {
+			seconds = 1
+		}
+
+		resp, err := c.etcd.Grant(ctx, seconds)
+		if err != nil {
+			return err
+		}
+
+		lease = resp.ID
+		opts = append(opts, clientv3.WithLease(lease))
+		res.Expires = now.Add(ttl)
+	}
+
+	keys := make([]string, len(r.Values))
+	ops := make([]clientv3.Op, len(r.Values))
+	for n, value := range r.Values {
+		res.Value = value
+		data, err := json.Marshal(res)
+		if err != nil {
+			c.undoReservations(lease, nil)
+			return err
+		}
+
+		keys[n] = c.reservationKey(r.Type, value)
+		ops[n] = clientv3.OpPut(keys[n], string(data), opts...)
+	}
+
+	// a range larger than a transaction is written in chunks, a failed chunk removes the
+	// reservations written before it
+	for start := 0; start < len(ops); start += maxTxnOps {
+		if _, err := c.etcd.Txn(ctx).Then(ops[start:min(start+maxTxnOps, len(ops))]...).Commit(); err != nil {
+			c.undoReservations(lease, keys[:start])
+			return err
+		}
+	}
+
+	return nil
+}
+
+// undoReservations removes the reservations of a failed ReserveIDs in the background
+// context, the caller context may be done. Reservations with a lease go away with it.
+func (c *Service) undoReservations(lease clientv3.LeaseID, keys []string) {
+	if lease != 0 {
+		c.revoke(lease)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.etcdDialTimeout)
+	defer cancel()
+
+	for start := 0; start < len(keys); start += maxTxnOps {
+		var ops []clientv3.Op
+		for _, key := range keys[start:min(start+maxTxnOps, len(keys))] {
+			ops = append(ops, clientv3.OpDelete(key))
+		}
+		c.etcd.Txn(ctx).Then(ops...).Commit()
+	}
+}
+
+// ListReservations returns all active reservations of the service, including those of
+// ranges under a custom LeaseWithKeyPrefix outside the service namespace, which are
+// shared with the other services leasing under that prefix
+func (c *Service) ListReservations(ctx context.Context) ([]Reservation, error) {
+	var reservations []Reservation
+	for _, prefix := range []string{
+		c.options.locksPrefix + c.options.serviceName + c.options.reservationsPrefix,
+		c.sharedShadowsPrefix() + c.options.reservationsPrefix,
+	} {
+		resp, err := c.etcd.Get(ctx, prefix, clientv3.WithPrefix())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, kv := range resp.Kvs {
+			var res Reservation
+			if err := json.Unmarshal(kv.Value, &res); err != nil {
+				continue
+			}
+
+			res.Key = string(kv.Key)
+			reservations = append(reservations, res)
+		}
+	}
+
+	return reservations, nil
+}
+
+// Unreserve makes members of the range available to Lease.Obtain again
+func (c *Service) Unreserve(ctx context.Context, r *Range) error {
+	for _, value := range r.Values {
+		if _, err := c.etcd.Delete(ctx, c.reservationKey(r.Type, value)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
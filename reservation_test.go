@@ -0,0 +1,149 @@
+package svcutil
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+func TestReserveIDs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("api"), Instance("operator"), LocalBackend(t.TempDir()), RetryInterval(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	r, _ := NewIDRange("1-2")
+	reserved, _ := NewIDRange("1")
+	if err := svc.ReserveIDs(ctx, reserved, "draining shard 1", 0); err != nil {
+		t.Fatalf("ReserveIDs() error = %v", err)
+	}
+
+	reservations, err := svc.ListReservations(ctx)
+	if err != nil {
+		t.Fatalf("ListReservations() error = %v", err)
+	}
+	if len(reservations) != 1 || reservations[0].Value != "1" || reservations[0].Reason != "draining shard 1" ||
+		reservations[0].Instance != "operator" || !reservations[0].Expires.IsZero() {
+		t.Fatalf("ListReservations() = %+v, want the reservation of 1", reservations)
+	}
+
+	first := NewLeaseWithOptions(r, svc)
+	defer first.Close()
+	if value, err := first.Obtain(ctx); err != nil || value != "2" {
+		t.Fatalf("Obtain() = %q, %v, want the unreserved 2", value, err)
+	}
+
+	second := NewLeaseWithOptions(r, svc)
+	defer second.Close()
+	if _, err := second.Obtain(ctx); !errors.Is(err, ErrNoAvailableIDs) {
+		t.Fatalf("Obtain() with the rest reserved error = %v, want %v", err, ErrNoAvailableIDs)
+	}
+
+	waited := make(chan string, 1)
+	go func() {
+		value, err := second.Wait(ctx)
+		if err != nil {
+			t.Errorf("Wait() error = %v", err)
+		}
+		waited <- value
+	}()
+
+	if err := svc.Unreserve(ctx, reserved); err != nil {
+		t.Fatalf("Unreserve() error = %v", err)
+	}
+	if value := <-waited; value != "1" {
+		t.Errorf("Wait() after Unreserve = %q, want 1", value)
+	}
+
+	if reservations, err := svc.ListReservations(ctx); err != nil || len(reservations) != 0 {
+		t.Errorf("ListReservations() after Unreserve = %+v, %v, want none", reservations, err)
+	}
+
+	// reservations of ranges under a custom prefix live in the shared namespace
+	shared := svc.shadowKey(svc.options.reservationsPrefix, "/custom/ids/7")
+	if _, err := svc.etcd.Put(ctx, shared, `{"type":0,"value":"7","reason":"shared"}`); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if reservations, err := svc.ListReservations(ctx); err != nil || len(reservations) != 1 || reservations[0].Key != shared {
+		t.Errorf("ListReservations() with a shared reservation = %+v, %v, want %s", reservations, err, shared)
+	}
+}
+
+func TestReserveIDsExpire(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("api"), LocalBackend(t.TempDir()), RetryInterval(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	r, _ := NewIDRange("1")
+	if err := svc.ReserveIDs(ctx, r, "maintenance", time.Second); err != nil {
+		t.Fatalf("ReserveIDs() error = %v", err)
+	}
+
+	l := NewLeaseWithOptions(r, svc)
+	defer l.Close()
+	if _, err := l.Obtain(ctx); !errors.Is(err, ErrNoAvailableIDs) {
+		t.Fatalf("Obtain() of a reserved value error = %v, want %v", err, ErrNoAvailableIDs)
+	}
+
+	started := time.Now()
+	if value, err := l.Wait(ctx); err != nil || value != "1" {
+		t.Fatalf("Wait() = %q, %v, want 1 once the reservation expired", value, err)
+	}
+	if elapsed := time.Since(started); elapsed < 500*time.Millisecond {
+		t.Errorf("value obtained after %v, want the reservation to expire first", elapsed)
+	}
+}
+
+func TestReserveIDsFailure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the second transaction written once txns is armed fails
+	errInjected := errors.New("injected")
+	var txns atomic.Int64
+	failSecond := func(next Operation) Operation {
+		return func(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+			if op.IsTxn() && txns.Load() > 0 && txns.Add(1) == 3 {
+				return clientv3.OpResponse{}, errInjected
+			}
+			return next(ctx, op)
+		}
+	}
+
+	svc, err := NewService(Name("api"), LocalBackend(t.TempDir()), Middleware(failSecond))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	// the range takes two transactions
+	r, _ := NewIDRange("1-200")
+	for _, ttl := range []time.Duration{0, time.Hour} {
+		txns.Store(1)
+		if err := svc.ReserveIDs(ctx, r, "maintenance", ttl); !errors.Is(err, errInjected) {
+			t.Fatalf("ReserveIDs() with ttl %v error = %v, want %v", ttl, err, errInjected)
+		}
+
+		txns.Store(0)
+		if reservations, err := svc.ListReservations(ctx); err != nil || len(reservations) != 0 {
+			t.Errorf("ListReservations() after a failed ReserveIDs() with ttl %v = %d reservations, %v, want none", ttl, len(reservations), err)
+		}
+	}
+
+	if n := leasesWithTTL(ctx, t, svc, int64(time.Hour.Seconds())); n != 0 {
+		t.Errorf("%d leases after a failed ReserveIDs(), want none", n)
+	}
+}
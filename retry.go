@@ -0,0 +1,64 @@
+package svcutil
+
+import (
+	"errors"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultRetryBackoff is used by RetryTransient when no backoff policy is given
+var defaultRetryBackoff = ExponentialBackoff(100*time.Millisecond, 2*time.Second)
+
+// isTransient reports whether err is a transient etcd error worth retrying: a leader
+// change or election, an unavailable endpoint or an expired deadline, which is transient
+// only while the context of the caller is not done
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var etcdErr rpctypes.EtcdError
+	if errors.As(err, &etcdErr) {
+		return etcdErr.Code() == codes.Unavailable
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	if s, ok := status.FromError(err); ok {
+		return s.Code() == codes.Unavailable || s.Code() == codes.DeadlineExceeded
+	}
+
+	return false
+}
+
+// retryMiddleware retries requests failing with transient errors until the attempts are
+// used up or the context of the caller is done, the last error is returned
+func retryMiddleware(attempts int, backoff BackoffPolicy) MiddlewareFunc {
+	if backoff == nil {
+		backoff = defaultRetryBackoff
+	}
+
+	return func(next Operation) Operation {
+		return func(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+			for attempt := 1; ; attempt++ {
+				resp, err := next(ctx, op)
+				if err == nil || attempt >= attempts || ctx.Err() != nil || !isTransient(err) {
+					return resp, err
+				}
+
+				select {
+				case <-time.After(backoff(attempt)):
+				case <-ctx.Done():
+					return resp, err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{rpctypes.ErrLeaderChanged, true},
+		{rpctypes.ErrNoLeader, true},
+		{rpctypes.ErrTimeout, true},
+		{status.Error(codes.Unavailable, "connection refused"), true},
+		{wrapCause(ErrEtcdTimeout, context.DeadlineExceeded), true},
+		{rpctypes.ErrCompacted, false},
+		{rpctypes.ErrPermissionDenied, false},
+		{context.Canceled, false},
+		{ErrChaosInjected, false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := isTransient(tt.err); got != tt.want {
+			t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryMiddleware(t *testing.T) {
+	failures := 2
+	var calls int
+	next := func(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+		calls++
+		if calls <= failures {
+			return clientv3.OpResponse{}, rpctypes.ErrLeaderChanged
+		}
+		return (&clientv3.PutResponse{}).OpResponse(), nil
+	}
+
+	do := retryMiddleware(3, ConstantBackoff(time.Millisecond))(next)
+	if _, err := do(context.Background(), clientv3.OpPut("/a", "1")); err != nil || calls != 3 {
+		t.Fatalf("do() error = %v after %d calls, want success after 3", err, calls)
+	}
+
+	calls, failures = 0, 5
+	if _, err := do(context.Background(), clientv3.OpPut("/a", "1")); !errors.Is(err, rpctypes.ErrLeaderChanged) || calls != 3 {
+		t.Errorf("do() error = %v after %d calls, want %v after 3", err, calls, rpctypes.ErrLeaderChanged)
+	}
+
+	calls = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := do(ctx, clientv3.OpPut("/a", "1")); err == nil || calls != 1 {
+		t.Errorf("do() with a done context made %d calls, want 1", calls)
+	}
+}
+
+func TestRetryTransient(t *testing.T) {
+	ci := NewChaosInjector(1, ChaosRule{Op: ChaosOpPut, Probability: 0.5, Fail: true, Err: rpctypes.ErrLeaderChanged})
+	ci.SetEnabled(false)
+
+	svc, err := NewService(Name("billing"), LocalBackend(t.TempDir()), Chaos(ci),
+		RetryTransient(20, ConstantBackoff(time.Millisecond)))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	ci.SetEnabled(true)
+	ctx := context.Background()
+	for n := range 10 {
+		if _, err := svc.etcd.Put(ctx, "/retry", "value"); err != nil {
+			t.Fatalf("Put() #%d error = %v", n, err)
+		}
+	}
+
+	if ci.Injected(ChaosOpPut) == 0 {
+		t.Error("no faults were injected")
+	}
+}
@@ -0,0 +1,45 @@
+package svcutil
+
+import (
+	"golang.org/x/net/context"
+)
+
+// Router resolves the owners of range members for request routing, it is kept up to
+// date with WatchAssignments, so traffic can be redirected right after a failover
+type Router struct {
+	assignments *AssignmentMap
+}
+
+// NewRouter watches the assignments of the range of the lease until ctx is done or the
+// service is closed. The lease only describes the range, it doesn't need to obtain a value.
+func NewRouter(ctx context.Context, l *Lease) (*Router, error) {
+	m, err := l.WatchAssignments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Router{assignments: m}, nil
+}
+
+// OwnerOf returns the holder of the member, the instance name or the lease metadata
+// (e.g. an endpoint set with LeaseWithMetadata), false if the member is not taken, and a
+// channel closed once the owner changes. The channel is taken before the owner is read,
+// so a change right after the call is never missed. Once the router stops (see Done) the
+// channel is closed right away.
+func (r *Router) OwnerOf(value string) (string, bool, <-chan struct{}) {
+	changed := r.assignments.Changed(value)
+	owner, ok := r.assignments.Holder(value)
+
+	return owner, ok, changed
+}
+
+// Done returns a channel closed once the router stops following the owners, when the
+// context of NewRouter is done or the service is closed
+func (r *Router) Done() <-chan struct{} {
+	return r.assignments.Done()
+}
+
+// Assignments returns the watched assignments
+func (r *Router) Assignments() *AssignmentMap {
+	return r.assignments
+}
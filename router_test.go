@@ -0,0 +1,77 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestRouterOwnerOf(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("billing"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	r, _ := NewIDRange("1")
+	router, err := NewRouter(ctx, NewLeaseWithOptions(r, svc))
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+
+	if _, ok, _ := router.OwnerOf("1"); ok {
+		t.Fatal("OwnerOf() reports an owner of a free value")
+	}
+
+	primary := NewLeaseWithOptions(r, svc, LeaseWithMetadata("10.0.0.1:8080"))
+	if _, err := primary.Obtain(ctx); err != nil {
+		t.Fatalf("Obtain() error = %v", err)
+	}
+
+	owner := waitOwner(t, ctx, router, "1")
+	if owner != "10.0.0.1:8080" {
+		t.Fatalf("OwnerOf() = %q, want the primary endpoint", owner)
+	}
+
+	_, _, changed := router.OwnerOf("1")
+	primary.Close()
+
+	standby := NewLeaseWithOptions(r, svc, LeaseWithMetadata("10.0.0.2:8080"))
+	defer standby.Close()
+	if _, err := standby.Obtain(ctx); err != nil {
+		t.Fatalf("Obtain() by the standby error = %v", err)
+	}
+
+	select {
+	case <-changed:
+	case <-ctx.Done():
+		t.Fatal("owner change is not notified")
+	}
+
+	if owner := waitOwner(t, ctx, router, "1"); owner != "10.0.0.2:8080" {
+		t.Errorf("OwnerOf() after the failover = %q, want the standby endpoint", owner)
+	}
+}
+
+// waitOwner waits until the value has an owner
+func waitOwner(t *testing.T, ctx context.Context, router *Router, value string) string {
+	t.Helper()
+
+	for {
+		owner, ok, changed := router.OwnerOf(value)
+		if ok {
+			return owner
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			t.Fatalf("%s has no owner", value)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package svcutil
+
+import (
+	"os/signal"
+	"syscall"
+)
+
+// RunSpec describes a service started with Run
+type RunSpec struct {
+	// Options configure the Service
+	Options []ServiceOption
+	// Config, if set, is loaded with LoadConfig before the lease is obtained, a config
+	// which can't be loaded is handled as the StartupConfigPolicy option says
+	Config     any
+	ConfigType ConfigurationType
+	// Range, if set, is waited on for a value leased for the whole run
+	Range *Range
+	// Start starts the components of the service. Long running components register
+	// with ComponentStarted and ComponentFinished of the process context and stop
+	// once it is done. Returning an error shuts the service down.
+	Start func(rt *Runtime) error
+}
+
+// Runtime is passed to RunSpec.Start
+type Runtime struct {
+	Process *ProcessContext
+	Service *Service
+	// Lease and ID are set when RunSpec.Range is set
+	Lease *Lease
+	ID    string
+}
+
+// Run creates the process context, connects the service, loads the configuration,
+// obtains a value of the range and starts the components. It blocks until SIGINT,
+// SIGTERM, a failed component or a lost lease, then stops the components first, runs
+// the shutdown hooks registered with OnShutdown, releases the lease and closes the service.
+func Run(spec RunSpec) (err error) {
+	process := NewProcessContext()
+
+	var svc *Service
+	var leased *Lease
+
+	// every return, including a failed start, runs the shutdown hooks before the lease is
+	// released and the service is closed
+	defer func() {
+		process.Shutdown()
+		process.WaitForComponentsToFinish()
+		process.WaitForShutdownHooks()
+
+		if leased != nil {
+			leased.Close()
+		}
+
+		if svc != nil {
+			svc.Close()
+		}
+	}()
+
+	svc, err = NewService(spec.Options...)
+	if err != nil {
+		return err
+	}
+
+	rt := &Runtime{
+		Process: process,
+		Service: svc,
+	}
+
+	if spec.Config != nil {
+		if err := svc.loadStartupConfig(process.Context(), spec.ConfigType, spec.Config); err != nil {
+			return err
+		}
+	}
+
+	if spec.Range != nil {
+		rt.Lease = NewLeaseWithOptions(spec.Range, svc, LeaseWithContext(process.Context()))
+
+		// shutdown signals are not handled yet, let them interrupt the wait
+		waitCtx, cancel := signal.NotifyContext(process.Context(), syscall.SIGINT, syscall.SIGTERM)
+		rt.ID, err = rt.Lease.Wait(waitCtx)
+		interrupted := waitCtx.Err() != nil
+		cancel()
+
+		if err != nil {
+			if interrupted {
+				return nil
+			}
+
+			return err
+		}
+		leased = rt.Lease
+
+		go func() {
+			select {
+			case <-rt.Lease.Done():
+				process.Shutdown()
+			case <-process.Done():
+			}
+		}()
+	}
+
+	if spec.Start != nil {
+		if err := spec.Start(rt); err != nil {
+			return err
+		}
+	}
+
+	WaitForShutdown(process)
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestRunShutdownHooks(t *testing.T) {
+	dir := t.TempDir()
+	failed := errors.New("start failed")
+
+	tests := []struct {
+		name  string
+		start func(rt *Runtime) error
+		want  error
+	}{
+		{"failed start", func(*Runtime) error { return failed }, failed},
+		{"shutdown", func(rt *Runtime) error {
+			go rt.Process.Shutdown()
+			return nil
+		}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var held bool
+			var hookErr error
+			hooked := false
+
+			r, _ := NewIDRange("1")
+			err := Run(RunSpec{
+				Options: []ServiceOption{Name("api"), LocalBackend(dir)},
+				Range:   r,
+				Start: func(rt *Runtime) error {
+					rt.Process.OnShutdown(0, func(ctx context.Context) {
+						// the service and the lease are still available to the hooks
+						hooked = true
+						held, hookErr = rt.Lease.Verify(ctx)
+					})
+					return tt.start(rt)
+				},
+			})
+
+			if err != tt.want {
+				t.Errorf("Run() error = %v, want %v", err, tt.want)
+			}
+			if !hooked || !held || hookErr != nil {
+				t.Errorf("shutdown hook ran = %v with Verify() = %v, %v, want it run before the lease is released", hooked, held, hookErr)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	admin, err := NewService(Name("api"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer admin.Close()
+
+	type config struct {
+		Level string `json:"level"`
+	}
+	if err := admin.SaveConfig(ctx, ConfigurationTypeService, &config{Level: "debug"}); err != nil {
+		t.Fatalf("SaveConfig() error = %v", err)
+	}
+
+	var cfg config
+	var id, level string
+	stopped := make(chan struct{})
+
+	r, _ := NewIDRange("1")
+	err = Run(RunSpec{
+		Options: []ServiceOption{Name("api"), LocalBackend(dir)},
+		Config:  &cfg,
+		Range:   r,
+		Start: func(rt *Runtime) error {
+			id, level = rt.ID, cfg.Level
+
+			// a long running component is stopped before Run returns
+			rt.Process.ComponentStarted()
+			go func() {
+				defer rt.Process.ComponentFinished()
+				<-rt.Process.Done()
+				close(stopped)
+			}()
+
+			go rt.Process.Shutdown()
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if id != "1" || level != "debug" {
+		t.Errorf("Start() got ID %q and level %q, want 1 and debug", id, level)
+	}
+
+	select {
+	case <-stopped:
+	default:
+		t.Error("Run() returned before the component stopped")
+	}
+
+	// the value is released once Run returns
+	l := NewLeaseWithOptions(r, admin)
+	defer l.Close()
+	if _, err := l.Obtain(ctx); err != nil {
+		t.Errorf("Obtain() after Run() error = %v", err)
+	}
+}
+
+func TestRunLeaseLost(t *testing.T) {
+	r, _ := NewIDRange("1")
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(RunSpec{
+			Options: []ServiceOption{Name("api"), LocalBackend(t.TempDir())},
+			Range:   r,
+			Start: func(rt *Runtime) error {
+				// the lease ends without a shutdown of the process
+				rt.Lease.Close()
+				return nil
+			},
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run() did not return after the lease ended")
+	}
+}
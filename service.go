@@ -7,25 +7,68 @@ import (
 	"os"
 	"reflect"
 	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	clientv3 "go.etcd.io/etcd/client/v3"
 	concurrency "go.etcd.io/etcd/client/v3/concurrency"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc"
 )
 
 type Service struct {
-	etcd    *clientv3.Client
-	session *concurrency.Session
-	options *options
-
-	mutexes map[string]*muRecord
-	lock    sync.Mutex
-	stopper chan struct{}
-	wg      sync.WaitGroup
+	etcd *clientv3.Client
+	// readEtcd serves serializable reads when ReadEndpoints is set
+	readEtcd *clientv3.Client
+	session  *concurrency.Session
+	options  *options
+
+	cache     *kvCache
+	events    eventsHandler
+	stats     statsRecorder
+	lockStats lockStatsRecorder
+	mutexes   map[string]*muRecord
+	// waiting maps owners set with WithLockOwner to the locks they are acquiring
+	waiting map[string][]string
+	// announced are the identities claimed with AnnounceID
+	announced map[string]struct{}
+	lock      sync.Mutex
+	stopper   chan struct{}
+	wg        sync.WaitGroup
+
+	commandMu      sync.Mutex
+	commandHandler CommandHandler
+
+	statusMu sync.Mutex
+	status   *InstanceStatus
+
+	// switches route every etcd client of the service to its current connection
+	switches []*connSwitch
+	credMu   sync.Mutex
+
+	// local serves the etcd API in process when the local or replay backend is used
+	local inProcessServer
+	// recorder records etcd requests when RecordTo is used
+	recorder *recorder
+
+	// offline keeps the config snapshot of OfflineConfig, degraded is set while the
+	// service runs with it because etcd was unreachable at startup
+	offline  *configSnapshot
+	degraded atomic.Bool
+
+	// clock is the last cluster timestamp handed out by ClusterTime
+	clockMu sync.Mutex
+	clock   ClusterTimestamp
+
+	// instanceKV are the keys put with InstanceKV, published again after a session loss
+	instanceKVMu sync.Mutex
+	instanceKV   map[string]string
+
+	// shared is the owner of the connection used with WithSharedClient
+	shared *Service
 }
 
 type ConfigurationType int
@@ -36,6 +79,15 @@ const (
 	ConfigurationTypeHost
 )
 
+type LockScope int
+
+const (
+	LockScopeService LockScope = iota
+	LockScopeScope
+	LockScopeHost
+	LockScopeGlobal
+)
+
 var ErrServiceNameNotSpecified = errors.New("service name is not specified")
 var ErrWrongEtcdAddress = errors.New("wrong etcd address")
 var ErrMutexAlreadyAcquired = errors.New("mutex already acquired")
@@ -44,10 +96,35 @@ var ErrInvalidConfigPointer = errors.New("invalid config pointer")
 var ErrEmptyValue = errors.New("empty value")
 var ErrNoAvailableIDs = errors.New("no available IDs")
 var ErrSessionNotAvailable = errors.New("session not available")
+var ErrLeaseNotObtained = errors.New("lease not obtained")
+var ErrLockQueueFull = errors.New("lock queue is full")
+var ErrLockWaitTimeout = errors.New("lock wait timeout")
+var ErrInvalidLockOptions = errors.New("invalid lock options")
+
+// maxTxnOps is the default limit of operations in a single etcd transaction (--max-txn-ops)
+const maxTxnOps = 128
 
 type muRecord struct {
 	mu    *concurrency.Mutex
 	donec chan struct{}
+	timer *time.Timer
+	// owner is set when the lock was acquired with WithLockOwner
+	owner    string
+	acquired time.Time
+	// slow fires the slow lock warning
+	slow *time.Timer
+}
+
+func (m *muRecord) stop() {
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+
+	if m.slow != nil {
+		m.slow.Stop()
+	}
+
+	close(m.donec)
 }
 
 func NewService(opt ...func(*options) *options) (*Service, error) {
@@ -61,53 +138,289 @@ func NewService(opt ...func(*options) *options) (*Service, error) {
 		return nil, ErrServiceNameNotSpecified
 	}
 
-	if len(o.endpoints) == 0 {
-		o.endpoints = strings.Split(os.Getenv("ETCD_ADDRESS"), ",")
+	if o.lockMaxWaiters > 0 && o.lockWaitTimeout <= 0 {
+		// without a wait timeout nobody waits for a lock, so there is no queue to limit
+		return nil, ErrInvalidLockOptions
+	}
+
+	if o.localDir == "" {
+		o.localDir = localDirFromEnv()
+	}
+
+	if o.sharedClient != nil {
+		// the connection of the owner is used, see WithSharedClient
+		o.endpoints = o.sharedClient.options.endpoints
+		o.readEndpoints = o.sharedClient.options.readEndpoints
+	} else if o.localDir != "" || o.replayFile != "" {
+		// the local and replay backends are served in process, endpoints and credentials are not used
+		o.endpoints = []string{localEndpoint}
+		o.readEndpoints = nil
+	} else {
+		if len(o.endpoints) == 0 {
+			o.endpoints = parseEndpoints(os.Getenv("ETCD_ADDRESS"))
+		}
+
+		if o.username == "" {
+			o.username = os.Getenv("ETCD_USER")
+		}
+
+		if o.passwordFile != "" {
+			password, err := readPasswordFile(o.passwordFile)
+			if err != nil {
+				return nil, err
+			}
+			o.password = password
+		}
+
+		if o.password == "" {
+			o.password = os.Getenv("ETCD_PASSWORD")
+		}
+
+		if len(o.endpoints) == 0 {
+			return nil, ErrWrongEtcdAddress
+		}
+
+		endpoints, err := resolveEndpoints(o.endpoints, lookupSRVEndpoints)
+		if err != nil {
+			return nil, err
+		}
+		o.endpoints = endpoints
+
+		if len(o.readEndpoints) > 0 {
+			o.readEndpoints, err = resolveEndpoints(o.readEndpoints, lookupSRVEndpoints)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if o.hostnameMode != nil {
+		o.rawHostname = o.hostnameMode()
+		if o.rawHostname == "" {
+			o.rawHostname = GetLocalIP()
+		}
+		o.hostname = sanitizeHostname(o.rawHostname)
+	}
+
+	if o.kubernetes {
+		if err := o.applyKubernetes(KubernetesEnv()); err != nil {
+			return nil, err
+		}
 	}
 
-	if o.username == "" {
-		o.username = os.Getenv("ETCD_USER")
+	o.applyTenant()
+
+	if o.hostnameHash {
+		o.hostname = hashHostname(o.rawHostname)
 	}
 
-	if o.password == "" {
-		o.password = os.Getenv("ETCD_PASSWORD")
+	if o.tracer == nil {
+		o.tracer = noopTracer
 	}
 
-	if len(o.endpoints) == 0 {
-		return nil, ErrWrongEtcdAddress
+	if o.instance == "" {
+		o.instance = fmt.Sprintf("%s-%d", newIDWithHost(o.hostname, DefaultIDFormat, NumberFormat{}, 0, o.serviceName, "").Value, os.Getpid())
 	}
 
 	cli := &Service{
 		options: o,
 		mutexes: make(map[string]*muRecord),
+		waiting: make(map[string][]string),
 		stopper: make(chan struct{}),
 	}
+	cli.events.store(o.events)
 
 	var err error
-	cli.etcd, err = clientv3.New(clientv3.Config{
-		Endpoints:   o.endpoints,
-		DialTimeout: o.etcdDialTimeout,
-		Username:    o.username,
-		Password:    o.password,
-		Logger:      zap.NewNop(),
-	})
-
-	if err != nil {
+	if o.sharedClient != nil {
+		cli.shared = o.sharedClient
+		cli.etcd = cli.shared.etcd
+		cli.readEtcd = cli.shared.readEtcd
+	} else if err = cli.connect(); err != nil {
 		return nil, err
 	}
 
-	err = cli.createSession()
-	if err != nil {
-		cli.etcd.Close()
-		return nil, err
+	var degraded bool
+	if o.offlineConfig != "" {
+		if cli.offline, err = loadConfigSnapshot(o.offlineConfig); err == nil {
+			degraded, err = cli.startDegraded()
+		}
+		if err != nil {
+			cli.closeClients()
+			return nil, err
+		}
+	}
+
+	if !degraded {
+		err = cli.createSession()
+		if err != nil {
+			cli.closeClients()
+			return nil, err
+		}
+
+		if o.hostnameCheck {
+			cli.registerHostname()
+		}
+
+		if o.duplicateGuard {
+			if err := cli.guardInstance(); err != nil {
+				cli.session.Close()
+				cli.closeClients()
+				return nil, err
+			}
+		}
 	}
 
 	cli.wg.Add(1)
 	go cli.monitorSession()
 
+	if o.statsInterval > 0 {
+		cli.wg.Add(1)
+		go cli.statsReporter()
+	}
+
+	if o.lockVerifyInterval > 0 {
+		cli.wg.Add(1)
+		go cli.lockVerifier()
+	}
+
+	if o.passwordFile != "" && o.passwordFileInterval > 0 {
+		cli.wg.Add(1)
+		go cli.passwordFileWatcher()
+	}
+
+	if o.cacheStaleness > 0 {
+		cli.cache = newKVCache(o.cacheStaleness, o.configPrefix, o.hostConfigPrefix)
+		for _, prefix := range cli.cache.prefixes {
+			cli.wg.Add(1)
+			go cli.cacheInvalidator(prefix)
+		}
+	}
+
 	return cli, nil
 }
 
+// connect creates the etcd clients of the service with its middleware, the in-process
+// server of the local and replay backends and the recorder
+func (c *Service) connect() error {
+	o := c.options
+
+	var err error
+	if c.local, err = startInProcessServer(o); err != nil {
+		return err
+	}
+
+	if o.recordFile != "" {
+		if c.recorder, err = newRecorder(o.recordFile, c.emit); err != nil {
+			if c.local != nil {
+				c.local.close()
+			}
+			return err
+		}
+	}
+
+	c.etcd, err = c.newClient(o.endpoints)
+
+	if err != nil {
+		if c.local != nil {
+			c.local.close()
+		}
+		if c.recorder != nil {
+			c.recorder.close()
+		}
+		return err
+	}
+
+	if len(o.readEndpoints) > 0 {
+		c.readEtcd, err = c.newClient(o.readEndpoints)
+		if err != nil {
+			c.closeClients()
+			return err
+		}
+
+		// routing goes first so middleware observe reads served by the read endpoints too
+		c.etcd.KV = &readRoutingKV{kv: c.etcd.KV, reads: c.readEtcd.KV}
+	}
+
+	middleware := o.middleware
+	if o.retryAttempts > 1 {
+		// retries go after user middleware, so they observe a single request
+		middleware = append(middleware[:len(middleware):len(middleware)], retryMiddleware(o.retryAttempts, o.retryBackoff))
+	}
+	if rl := newRateLimiter(o.rateLimit, o.categoryRateLimits); rl != nil {
+		// limits go after retries, so every attempt is throttled
+		middleware = append(middleware[:len(middleware):len(middleware)], rl.middleware)
+		c.etcd.Lease = &rateLimitLease{Lease: c.etcd.Lease, rl: rl}
+	}
+	if o.chaos != nil {
+		middleware = append(middleware[:len(middleware):len(middleware)], o.chaos.middleware)
+		c.etcd.Lease = &chaosLease{Lease: c.etcd.Lease, ci: o.chaos}
+	}
+
+	if len(middleware) > 0 {
+		c.etcd.KV = newMiddlewareKV(c.etcd.KV, middleware)
+	}
+
+	if o.watchClients > 1 {
+		pool := make([]*clientv3.Client, 0, o.watchClients-1)
+		for len(pool) < o.watchClients-1 {
+			wcli, err := c.newClient(o.endpoints)
+			if err != nil {
+				for _, conn := range pool {
+					conn.Close()
+				}
+				c.closeClients()
+				return err
+			}
+
+			pool = append(pool, wcli)
+		}
+
+		c.etcd.Watcher = newWatchPool(c.etcd.Watcher, pool)
+	}
+
+	return nil
+}
+
+func (c *Service) etcdConfig(endpoints []string) clientv3.Config {
+	cfg := clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: c.options.etcdDialTimeout,
+		Username:    c.options.username,
+		Password:    c.options.password,
+		Logger:      zap.NewNop(),
+	}
+
+	if c.options.tokenProvider != nil {
+		// the provider replaces the static credentials
+		cfg.Username, cfg.Password = "", ""
+		cfg.DialOptions = append(cfg.DialOptions, grpc.WithPerRPCCredentials(tokenCredentials{provider: c.options.tokenProvider}))
+	}
+
+	if c.local != nil {
+		cfg.DialOptions = append(cfg.DialOptions, c.local.dialOption())
+	}
+
+	if c.recorder != nil {
+		cfg.DialOptions = append(cfg.DialOptions, grpc.WithChainUnaryInterceptor(c.recorder.intercept))
+	}
+
+	return cfg
+}
+
+// newClient connects to the endpoints through a connSwitch, so the connection can be
+// rebuilt by UpdateCredentials
+func (c *Service) newClient(endpoints []string) (*clientv3.Client, error) {
+	conn, err := clientv3.New(c.etcdConfig(endpoints))
+	if err != nil {
+		return nil, err
+	}
+
+	client, sw := newSwitchedClient(conn, endpoints)
+	c.switches = append(c.switches, sw)
+
+	return client, nil
+}
+
 func (c *Service) Close() {
 	close(c.stopper)
 	c.wg.Wait()
@@ -116,7 +429,27 @@ func (c *Service) Close() {
 		c.session.Close()
 	}
 
+	c.closeClients()
+}
+
+func (c *Service) closeClients() {
+	if c.shared != nil {
+		// the clients are closed by the owner of the connection
+		return
+	}
+
 	c.etcd.Close()
+	if c.readEtcd != nil {
+		c.readEtcd.Close()
+	}
+
+	if c.local != nil {
+		c.local.close()
+	}
+
+	if c.recorder != nil {
+		c.recorder.close()
+	}
 }
 
 func (c *Service) createSession() error {
@@ -135,6 +468,10 @@ func (c *Service) createSession() error {
 func (c *Service) monitorSession() {
 	defer c.wg.Done()
 
+	if c.Degraded() && !c.connectDegraded() {
+		return
+	}
+
 	ch := c.session.Done()
 
 	for {
@@ -151,11 +488,15 @@ func (c *Service) monitorSession() {
 			}
 			c.lock.Unlock()
 
-			for _, mrec := range oldMutexes {
+			for key, mrec := range oldMutexes {
 				// in case if session is lost we kill all mutexes and notify all waiters
-				close(mrec.donec)
+				mrec.stop()
+				c.lockStats.released(key, time.Since(mrec.acquired))
 			}
 
+			c.emit(Event{Type: EventTypeSessionLost})
+			disarm := c.armSessionWatchdog()
+
 			for {
 				err := c.createSession()
 				if err == nil {
@@ -164,18 +505,66 @@ func (c *Service) monitorSession() {
 
 				select {
 				case <-c.stopper:
+					disarm()
 					return
 				case <-time.After(c.options.retryInterval):
 				}
 			}
 
+			disarm()
+
 			ch = c.session.Done()
+			c.restoreStatus()
+			c.restoreAnnouncements()
+			c.restoreInstanceKV()
+			c.stats.sessionRecreated()
+			c.emit(Event{Type: EventTypeSessionRestored})
+		}
+	}
+}
+
+// lockKey is the key of the named lock of the scope, locks of the service live under the
+// locks prefix of the service while other scopes have their own segments under the scoped
+// locks prefix, so they never collide with service names or range leases
+func (c *Service) lockKey(scope LockScope, name string) string {
+	switch scope {
+	case LockScopeGlobal:
+		return fmt.Sprintf("%sglobal/%s", c.options.scopedLocksPrefix, name)
+	case LockScopeScope:
+		if c.options.serviceScope != "" {
+			return fmt.Sprintf("%sscope/%s/%s", c.options.scopedLocksPrefix, c.options.serviceScope, name)
 		}
+	case LockScopeHost:
+		return fmt.Sprintf("%s%s/%s", c.hostLocksPrefix(), c.options.hostname, name)
 	}
+
+	return fmt.Sprintf("%s%s%s%s", c.options.locksPrefix, c.options.serviceName, c.options.mutexesPrefix, name)
+}
+
+// hostLocksPrefix is the prefix of host locks of the service on all hosts
+func (c *Service) hostLocksPrefix() string {
+	return c.options.scopedLocksPrefix + "host/" + c.options.serviceName + "/"
 }
 
 func (c *Service) AcquireLock(ctx context.Context, name string) (<-chan struct{}, error) {
-	key := fmt.Sprintf("%s%s%s%s", c.options.locksPrefix, c.options.serviceName, c.options.mutexesPrefix, name)
+	return c.AcquireScopedLock(ctx, LockScopeService, name)
+}
+
+// AcquireScopedLock acquires a named distributed lock shared by all services (LockScopeGlobal),
+// instances of the service (LockScopeService), services of the same scope (LockScopeScope)
+// or instances of the service running on the same host (LockScopeHost)
+func (c *Service) AcquireScopedLock(ctx context.Context, scope LockScope, name string) (<-chan struct{}, error) {
+	key := c.lockKey(scope, name)
+
+	ctx, span := c.startSpan(ctx, "AcquireLock", attribute.String("svcutil.key", key))
+	donec, err := c.acquireLock(ctx, key)
+	err = lockError(key, "acquire", err)
+	endSpan(span, err)
+
+	return donec, err
+}
+
+func (c *Service) acquireLock(ctx context.Context, key string) (<-chan struct{}, error) {
 
 	c.lock.Lock()
 	if c.session == nil {
@@ -183,42 +572,149 @@ func (c *Service) AcquireLock(ctx context.Context, name string) (<-chan struct{}
 		return nil, ErrSessionNotAvailable
 	}
 
-	_, ok := c.mutexes[key]
-	if ok {
+	owner := lockOwner(ctx)
+	for {
+		if owner != "" {
+			if err := c.lockCycle(owner, key); err != nil {
+				c.lock.Unlock()
+				return nil, err
+			}
+		}
+
+		held, ok := c.mutexes[key]
+		if !ok {
+			break
+		}
+
+		if owner == "" || c.options.lockWaitTimeout <= 0 {
+			c.lock.Unlock()
+			return nil, ErrMutexAlreadyAcquired
+		}
+
+		// the etcd mutex can't tell apart holders sharing the session, so an owner waits
+		// for another owner of the process here
+		if err := c.waitLocalLock(ctx, owner, key, held); err != nil {
+			return nil, err
+		}
+
+		c.lock.Lock()
+		if c.session == nil {
+			c.lock.Unlock()
+			return nil, ErrSessionNotAvailable
+		}
+	}
+
+	if c.options.dryRun {
+		mrec := &muRecord{
+			donec:    make(chan struct{}),
+			owner:    owner,
+			acquired: time.Now(),
+		}
+		c.mutexes[key] = mrec
 		c.lock.Unlock()
-		return nil, ErrMutexAlreadyAcquired
+
+		c.dryRun(key, "acquire lock")
+		return mrec.donec, nil
 	}
+
+	c.addWaiting(owner, key)
 	c.lock.Unlock()
 
+	started := time.Now()
+	if c.options.lockWaitersWarning > 0 {
+		c.checkLockWaiters(ctx, key)
+	}
+
 	mutex := concurrency.NewMutex(c.session, key)
-	err := mutex.TryLock(ctx)
-	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			return nil, ErrEtcdTimeout
-		}
+	err := c.lockMutex(ctx, mutex, key)
 
-		if err == concurrency.ErrLocked {
-			return nil, ErrMutexAlreadyAcquired
-		}
+	c.lock.Lock()
+	c.removeWaiting(owner, key)
+	c.lock.Unlock()
 
+	if err != nil {
 		return nil, err
 	}
 
 	mrec := &muRecord{
-		mu:    mutex,
-		donec: make(chan struct{}),
+		mu:       mutex,
+		donec:    make(chan struct{}),
+		owner:    owner,
+		acquired: time.Now(),
+	}
+	c.lockStats.acquired(key, mrec.acquired.Sub(started))
+
+	if c.lockTracing() {
+		c.publishLockHolder(ctx, mutex)
 	}
 
 	c.lock.Lock()
 	c.mutexes[key] = mrec
+	if c.options.lockHoldTimeout > 0 {
+		mrec.timer = time.AfterFunc(c.options.lockHoldTimeout, func() { c.holdTimeoutExpired(key, mrec) })
+	}
+	if c.options.slowLockThreshold > 0 {
+		mrec.slow = time.AfterFunc(c.options.slowLockThreshold, func() { c.slowLock(key, mrec) })
+	}
 	c.lock.Unlock()
 
 	return mrec.donec, nil
 }
 
+func (c *Service) lockMutex(ctx context.Context, mutex *concurrency.Mutex, key string) error {
+	var err error
+
+	if c.options.lockWaitTimeout > 0 {
+		if c.options.lockMaxWaiters > 0 {
+			resp, err := c.etcd.Get(ctx, key+"/", clientv3.WithPrefix(), clientv3.WithCountOnly())
+			if err != nil {
+				return etcdError(err)
+			}
+
+			// the holder is counted as well
+			if resp.Count > int64(c.options.lockMaxWaiters) {
+				return ErrLockQueueFull
+			}
+		}
+
+		wctx, cancel := context.WithTimeout(ctx, c.options.lockWaitTimeout)
+		err = mutex.Lock(wctx)
+		cancel()
+
+		if err != nil && errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return ErrLockWaitTimeout
+		}
+	} else {
+		err = mutex.TryLock(ctx)
+	}
+
+	if err != nil {
+		if err == concurrency.ErrLocked {
+			return ErrMutexAlreadyAcquired
+		}
+
+		return etcdError(err)
+	}
+
+	return nil
+}
+
 func (c *Service) ReleaseLock(ctx context.Context, name string) error {
-	key := fmt.Sprintf("%s%s%s%s", c.options.locksPrefix, c.options.serviceName, c.options.mutexesPrefix, name)
+	return c.ReleaseScopedLock(ctx, LockScopeService, name)
+}
+
+func (c *Service) ReleaseScopedLock(ctx context.Context, scope LockScope, name string) error {
+	key := c.lockKey(scope, name)
+
+	ctx, span := c.startSpan(ctx, "ReleaseLock", attribute.String("svcutil.key", key))
+	err := c.releaseLock(ctx, key)
+	err = lockError(key, "release", err)
+	endSpan(span, err)
+
+	return err
+}
 
+func (c *Service) releaseLock(ctx context.Context, key string) error {
 	c.lock.Lock()
 	mutex, ok := c.mutexes[key]
 	if !ok {
@@ -227,27 +723,57 @@ func (c *Service) ReleaseLock(ctx context.Context, name string) error {
 	}
 	c.lock.Unlock()
 
-	err := mutex.mu.Unlock(ctx)
-	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			return ErrEtcdTimeout
+	if mutex.mu == nil {
+		// acquired in dry-run mode
+		c.dryRun(key, "release lock")
+	} else {
+		if c.options.chaos != nil {
+			if err := c.options.chaos.inject(ctx, ChaosOpUnlock); err != nil {
+				return err
+			}
 		}
 
-		return err
+		if err := mutex.mu.Unlock(ctx); err != nil {
+			return etcdError(err)
+		}
 	}
 
 	c.lock.Lock()
 	mutex, ok = c.mutexes[key]
 	if ok {
-		close(mutex.donec)
+		mutex.stop()
 		delete(c.mutexes, key)
+		c.lockStats.released(key, time.Since(mutex.acquired))
 	}
 	c.lock.Unlock()
 
 	return nil
 }
 
+// holdTimeoutExpired releases the lock held for longer than allowed by the hold timeout
+func (c *Service) holdTimeoutExpired(key string, mrec *muRecord) {
+	c.lock.Lock()
+	current, ok := c.mutexes[key]
+	c.lock.Unlock()
+
+	if !ok || current != mrec {
+		return
+	}
+
+	c.emit(Event{Type: EventTypeLockHoldTimeout, Key: key})
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.etcdDialTimeout)
+	defer cancel()
+	c.releaseLock(ctx, key)
+}
+
 func (c *Service) loadConfig(ctx context.Context, cfg any, path string) error {
+	return c.loadConfigFrom(ctx, cfg, path, c.Degraded())
+}
+
+// loadConfigFrom loads the config from etcd, or from the snapshot of OfflineConfig,
+// which keeps values with references resolved
+func (c *Service) loadConfigFrom(ctx context.Context, cfg any, path string, snapshot bool) error {
 	v := reflect.ValueOf(cfg)
 	if v.Kind() != reflect.Ptr {
 		return ErrInvalidConfigPointer
@@ -257,24 +783,51 @@ func (c *Service) loadConfig(ctx context.Context, cfg any, path string) error {
 		return ErrInvalidConfigPointer
 	}
 
-	tags := getJSONTags(cfg)
-	if len(tags) == 0 {
+	keys := getConfigKeys(cfg)
+	if len(keys) == 0 {
 		return ErrInvalidConfigPointer
 	}
 
 	cfgValue := v.Elem()
 
-	for fieldName, jsonTag := range tags {
-		key := path + jsonTag
-		resp, err := c.etcd.Get(ctx, key)
+	get := c.getConfig
+	if snapshot {
+		get = c.offline.get
+	}
+
+	// values read from etcd are recorded for the snapshot
+	var loaded map[string]string
+	var missing []string
+	if c.offline != nil && !snapshot {
+		loaded = make(map[string]string, len(keys))
+	}
+
+	for fieldName, fieldKey := range keys {
+		key := configKey(path, fieldKey)
+		data, found, err := get(ctx, key)
 		if err != nil {
 			return err
 		}
 
-		if len(resp.Kvs) > 0 {
+		if !found && loaded != nil {
+			missing = append(missing, key)
+		}
+
+		if found {
+			if !snapshot {
+				data, err = resolveConfigRef(ctx, get, key, data)
+				if err != nil {
+					return err
+				}
+			}
+
+			if loaded != nil {
+				loaded[key] = string(data)
+			}
+
 			field := cfgValue.FieldByName(fieldName)
 			if field.CanSet() {
-				value := string(resp.Kvs[0].Value)
+				value := string(data)
 
 				switch field.Kind() {
 				case reflect.String:
@@ -295,36 +848,60 @@ func (c *Service) loadConfig(ctx context.Context, cfg any, path string) error {
 		}
 	}
 
+	if loaded != nil {
+		// the snapshot is best effort, a failed write leaves the previous one in place
+		c.offline.store(loaded, missing)
+	}
+
 	return nil
 }
 
-func (c *Service) LoadConfig(ctx context.Context, ct ConfigurationType, cfg any) error {
-	var path string
-
+func (c *Service) configPath(ct ConfigurationType) string {
 	switch ct {
-	case ConfigurationTypeService:
-		path = c.options.configPrefix + c.options.serviceName + "/"
 	case ConfigurationTypeScope:
 		if c.options.serviceScope != "" {
-			path = c.options.configPrefix + c.options.serviceScope + "/"
-		} else {
-			path = c.options.configPrefix + c.options.serviceName + "/"
+			return c.options.configPrefix + c.options.serviceScope + "/"
 		}
 	case ConfigurationTypeHost:
-		path = c.options.hostsPrefix + c.options.serviceName + "/" + Hostname() + "/"
+		return c.options.hostConfigPrefix + c.options.serviceName + "/" + c.options.hostname + "/"
 	}
 
-	return c.loadConfig(ctx, cfg, path)
+	return c.options.configPrefix + c.options.serviceName + "/"
+}
+
+func (c *Service) LoadConfig(ctx context.Context, ct ConfigurationType, cfg any) error {
+	path := c.configPath(ct)
+
+	ctx, span := c.startSpan(ctx, "LoadConfig", attribute.String("svcutil.key", path))
+	err := c.loadConfig(ctx, cfg, path)
+	endSpan(span, err)
+
+	return err
+}
+
+// Instance returns the name identifying this process among other instances of the service
+func (c *Service) Instance() string {
+	return c.options.instance
 }
 
 func (c *Service) ID(id string) ID {
-	var err error
-	var idval int
+	return newIDWithHost(c.options.hostname, c.options.idFormat, c.options.idNumbers, c.parseIDValue(id), c.options.serviceName, c.options.serviceScope)
+}
+
+// ScopedID creates an ID which always includes the service scope, so instances of
+// different scopes (e.g. blue/green deployments) never share an identity. The scope is
+// placed in front of the service unless the IDFormat already has a {scope} placeholder.
+func (c *Service) ScopedID(id string) ID {
+	return newIDWithHost(c.options.hostname, scopedIDFormat(c.options.idFormat), c.options.idNumbers, c.parseIDValue(id), c.options.serviceName, c.options.serviceScope)
+}
 
-	idval, err = strconv.Atoi(id)
-	if err != nil || idval < 0 {
-		idval = 0
+// parseIDValue reads a value rendered with the IDNumberFormat, e.g. one obtained from a
+// range created with the same format, negative values keep their sign
+func (c *Service) parseIDValue(id string) int {
+	idval, err := c.options.idNumbers.Parse(id)
+	if err != nil || int64(int(idval)) != idval {
+		return 0
 	}
 
-	return NewID(idval, c.options.serviceName)
+	return int(idval)
 }
@@ -0,0 +1,74 @@
+package svcutil
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// crockfordLower is the Crockford base32 alphabet without the ambiguous i, l, o and u
+const crockfordLower = "0123456789abcdefghjkmnpqrstvwxyz"
+
+const crockfordUpper = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+const (
+	shortIDBits    = 5
+	shortIDMask    = 1<<shortIDBits - 1
+	shortIDPerNext = 63 / shortIDBits
+	ulidLen        = 26
+)
+
+// ShortID produces a lowercase Crockford base32 ID of the given length, meant for
+// human-readable correlation and request IDs, every character carries 5 random bits
+func (cg *CookieGen) ShortID(length int) string {
+	if length <= 0 {
+		return ""
+	}
+
+	b := make([]byte, length)
+	cg.withGenerator(func(gen generator) {
+		for i, cache, remain := 0, gen.getNext(), shortIDPerNext; i < length; i++ {
+			if remain == 0 {
+				cache, remain = gen.getNext(), shortIDPerNext
+			}
+			b[i] = crockfordLower[cache&shortIDMask]
+			cache >>= shortIDBits
+			remain--
+		}
+	})
+
+	return string(b)
+}
+
+// ULID produces a 26 character ULID: 48 bits of the current unix time in milliseconds
+// followed by 80 bits of the generator, so IDs sort by creation time
+func (cg *CookieGen) ULID() string {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(time.Now().UnixMilli())<<16)
+
+	cg.withGenerator(func(gen generator) {
+		// two 63 bit values cover the 80 random bits
+		hi, lo := uint64(gen.getNext()), uint64(gen.getNext())
+		binary.BigEndian.PutUint16(id[6:8], uint16(hi))
+		binary.BigEndian.PutUint64(id[8:], lo<<1|hi>>16&1)
+	})
+
+	return encodeULID(id)
+}
+
+// encodeULID encodes 128 bits as 26 Crockford base32 characters, the encoding
+// has two leading zero bits
+func encodeULID(id [16]byte) string {
+	var out [ulidLen]byte
+	for i := range out {
+		v := 0
+		for p := i*shortIDBits - 2; p < (i+1)*shortIDBits-2; p++ {
+			v <<= 1
+			if p >= 0 {
+				v |= int(id[p/8]>>(7-p%8)) & 1
+			}
+		}
+		out[i] = crockfordUpper[v]
+	}
+
+	return string(out[:])
+}
@@ -0,0 +1,84 @@
+package svcutil
+
+import (
+	"encoding/binary"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShortID(t *testing.T) {
+	cg := NewSeededCookieGen(7)
+
+	for _, length := range []int{0, 1, 8, 12, 13, 40} {
+		id := cg.ShortID(length)
+		if len(id) != length {
+			t.Fatalf("ShortID(%d) = %q has length %d", length, id, len(id))
+		}
+
+		for _, c := range id {
+			if !strings.ContainsRune(crockfordLower, c) {
+				t.Fatalf("ShortID(%d) = %q contains %q", length, id, c)
+			}
+		}
+	}
+
+	if a, b := NewSeededCookieGen(1).ShortID(10), NewSeededCookieGen(1).ShortID(10); a != b {
+		t.Errorf("same seed produced %q and %q", a, b)
+	}
+}
+
+func TestEncodeULID(t *testing.T) {
+	var ts [16]byte
+	binary.BigEndian.PutUint64(ts[:8], uint64(1469918176385)<<16)
+
+	var ones [16]byte
+	for i := range ones {
+		ones[i] = 0xff
+	}
+
+	tests := []struct {
+		name string
+		id   [16]byte
+		want string
+	}{
+		{name: "zero", want: "00000000000000000000000000"},
+		{name: "max", id: ones, want: "7ZZZZZZZZZZZZZZZZZZZZZZZZZ"},
+		{name: "timestamp", id: ts, want: "01ARYZ6S410000000000000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encodeULID(tt.id); got != tt.want {
+				t.Errorf("encodeULID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestULIDOrdered(t *testing.T) {
+	cg := NewCookieGen(CookieSourceCryptoRand, 0)
+
+	var ids []string
+	for range 5 {
+		id := cg.ULID()
+		if len(id) != ulidLen {
+			t.Fatalf("ULID() = %q has length %d", id, len(id))
+		}
+
+		for _, c := range id {
+			if !strings.ContainsRune(crockfordUpper, c) {
+				t.Fatalf("ULID() = %q contains %q", id, c)
+			}
+		}
+
+		ids = append(ids, id)
+		// IDs of the same millisecond are ordered randomly
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	if !slices.IsSorted(ids) {
+		t.Errorf("ULID() values %v do not sort in generation order", ids)
+	}
+}
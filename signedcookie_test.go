@@ -0,0 +1,66 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSignedCookie(t *testing.T) {
+	sg, err := NewSignedCookieGen([]byte("secret"), time.Minute)
+	if err != nil {
+		t.Fatalf("NewSignedCookieGen() error = %v", err)
+	}
+
+	now := time.UnixMilli(1700000000000)
+	sg.now = func() time.Time { return now }
+
+	cookie := sg.Cookie()
+	if len(cookie) != defaultCookieLenK {
+		t.Fatalf("Cookie() length = %d, want %d", len(cookie), defaultCookieLenK)
+	}
+
+	created, ok := sg.Verify(cookie)
+	if !ok {
+		t.Fatalf("Verify(%q) failed for fresh cookie", cookie)
+	}
+	if !created.Equal(now) {
+		t.Errorf("Verify(%q) time = %v, want %v", cookie, created, now)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := sg.Verify(cookie); ok {
+		t.Errorf("Verify(%q) succeeded for expired cookie", cookie)
+	}
+}
+
+func TestSignedCookieForged(t *testing.T) {
+	sg, _ := NewSignedCookieGen([]byte("secret"), 0)
+	other, _ := NewSignedCookieGen([]byte("other"), 0)
+
+	cookie := sg.Cookie()
+
+	tests := []struct {
+		name   string
+		cookie string
+	}{
+		{"different key", other.Cookie()},
+		{"tampered", string(cookie[0]^1) + cookie[1:]},
+		{"truncated", cookie[:len(cookie)-1]},
+		{"empty", ""},
+		{"invalid alphabet", "!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := sg.Verify(tt.cookie); ok {
+				t.Errorf("Verify(%q) succeeded, want failure", tt.cookie)
+			}
+		})
+	}
+}
+
+func TestSignedCookieEmptyKey(t *testing.T) {
+	if _, err := NewSignedCookieGen(nil, time.Minute); err != ErrInvalidCookieKey {
+		t.Errorf("NewSignedCookieGen(nil) error = %v, want %v", err, ErrInvalidCookieKey)
+	}
+}
@@ -96,17 +96,23 @@ type SnID int64
 // NewNode returns a new snowflake node that can be used to generate snowflake
 // IDs
 func NewSnowflakeNode(epoch int64, node int64) (*SnowflakeNode, error) {
-	if NodeBits+StepBits > 22 {
+	return NewSnowflakeNodeWithBits(epoch, node, NodeBits, StepBits)
+}
+
+// NewSnowflakeNodeWithBits returns a new snowflake node with a custom Node/Step
+// bit layout, so the node ID space can match an existing fleet numbering
+func NewSnowflakeNodeWithBits(epoch int64, node int64, nodeBits uint8, stepBits uint8) (*SnowflakeNode, error) {
+	if int(nodeBits)+int(stepBits) > 22 {
 		return nil, errors.New("remember, you have a total 22 bits to share between Node/Step")
 	}
 
 	n := SnowflakeNode{}
 	n.node = node
-	n.nodeMax = -1 ^ (-1 << NodeBits)
-	n.nodeMask = n.nodeMax << StepBits
-	n.stepMask = -1 ^ (-1 << StepBits)
-	n.timeShift = NodeBits + StepBits
-	n.nodeShift = StepBits
+	n.nodeMax = -1 ^ (-1 << nodeBits)
+	n.nodeMask = n.nodeMax << stepBits
+	n.stepMask = -1 ^ (-1 << stepBits)
+	n.timeShift = nodeBits + stepBits
+	n.nodeShift = stepBits
 
 	if n.node < 0 || n.node > n.nodeMax {
 		return nil, errors.New("Node number must be between 0 and " + strconv.FormatInt(n.nodeMax, 10))
@@ -152,6 +158,21 @@ func (n *SnowflakeNode) Generate() SnID {
 	return r
 }
 
+// Time returns the time the given snowflake ID has been generated at
+func (n *SnowflakeNode) Time(f SnID) time.Time {
+	return n.epoch.Add(time.Duration(int64(f)>>n.timeShift) * time.Millisecond)
+}
+
+// Node returns the node number of the given snowflake ID
+func (n *SnowflakeNode) Node(f SnID) int64 {
+	return (int64(f) & n.nodeMask) >> n.nodeShift
+}
+
+// Step returns the step number of the given snowflake ID
+func (n *SnowflakeNode) Step(f SnID) int64 {
+	return int64(f) & n.stepMask
+}
+
 // Int64 returns an int64 of the snowflake ID
 func (f SnID) Int64() int64 {
 	return int64(f)
@@ -0,0 +1,63 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewSnowflakeNodeWithBits(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     int64
+		nodeBits uint8
+		stepBits uint8
+		wantErr  bool
+	}{
+		{"default layout", 1023, 10, 12, false},
+		{"wide node layout", 4095, 12, 10, false},
+		{"node does not fit", 4096, 12, 10, true},
+		{"negative node", -1, 12, 10, true},
+		{"too many bits", 1, 12, 11, true},
+		{"no node bits", 0, 0, 22, false},
+		{"bits overflow uint8", 0, 200, 100, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSnowflakeNodeWithBits(1577836800000, tt.node, tt.nodeBits, tt.stepBits)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewSnowflakeNodeWithBits(%d, %d, %d) error = %v, wantErr %v", tt.node, tt.nodeBits, tt.stepBits, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSnowflakeLayout(t *testing.T) {
+	epoch := time.Now().Add(-time.Hour).UnixMilli()
+
+	n, err := NewSnowflakeNodeWithBits(epoch, 3000, 12, 10)
+	if err != nil {
+		t.Fatalf("NewSnowflakeNodeWithBits() error = %v", err)
+	}
+
+	prev := n.Generate()
+	for i := 0; i < 2000; i++ {
+		id := n.Generate()
+		if id <= prev {
+			t.Fatalf("Generate() = %d is not greater than previous %d", id, prev)
+		}
+		prev = id
+	}
+
+	if node := n.Node(prev); node != 3000 {
+		t.Errorf("Node() = %d, want 3000", node)
+	}
+
+	if step := n.Step(prev); step > 1023 {
+		t.Errorf("Step() = %d exceeds 10 bits", step)
+	}
+
+	if d := time.Since(n.Time(prev)); d < 0 || d > time.Minute {
+		t.Errorf("Time() = %v is too far from now", n.Time(prev))
+	}
+}
@@ -0,0 +1,88 @@
+package svcutil
+
+import (
+	"errors"
+	"reflect"
+
+	"golang.org/x/net/context"
+)
+
+// ConfigPolicy decides how Connect and Run treat a configuration which can't be loaded
+type ConfigPolicy int
+
+const (
+	// RequireConfig fails the startup
+	RequireConfig ConfigPolicy = iota
+	// PreferConfig starts with the defaults the config was initialized with, emitting
+	// EventTypeConfigFallback
+	PreferConfig
+	// CacheFallback starts with the config snapshot of OfflineConfig, emitting
+	// EventTypeConfigFallback, and fails the startup without a snapshot
+	CacheFallback
+)
+
+func (p ConfigPolicy) String() string {
+	switch p {
+	case RequireConfig:
+		return "require"
+	case PreferConfig:
+		return "prefer"
+	case CacheFallback:
+		return "cache"
+	}
+
+	return "unknown"
+}
+
+// Connect creates the service and loads the configuration of the given type into cfg,
+// a configuration which can't be loaded is handled as the StartupConfigPolicy option says
+func Connect(ctx context.Context, ct ConfigurationType, cfg any, opt ...ServiceOption) (*Service, error) {
+	svc, err := NewService(opt...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := svc.loadStartupConfig(ctx, ct, cfg); err != nil {
+		svc.Close()
+		return nil, err
+	}
+
+	return svc, nil
+}
+
+func (c *Service) loadStartupConfig(ctx context.Context, ct ConfigurationType, cfg any) error {
+	// fields loaded before a failure are reverted to the defaults
+	defaults := reflect.ValueOf(cfg)
+	if defaults.Kind() == reflect.Ptr && defaults.Elem().Kind() == reflect.Struct {
+		defaults = reflect.New(defaults.Elem().Type()).Elem()
+		defaults.Set(reflect.ValueOf(cfg).Elem())
+	}
+
+	err := c.LoadConfig(ctx, ct, cfg)
+	if err == nil || errors.Is(err, ErrInvalidConfigPointer) {
+		return err
+	}
+
+	path := c.configPath(ct)
+
+	switch c.options.configPolicy {
+	case PreferConfig:
+		reflect.ValueOf(cfg).Elem().Set(defaults)
+		c.emit(Event{Type: EventTypeConfigFallback, Key: path, Value: PreferConfig.String(), Err: err})
+		return nil
+	case CacheFallback:
+		if c.offline == nil || !c.offline.available() {
+			return wrapCause(ErrNoConfigSnapshot, err)
+		}
+
+		reflect.ValueOf(cfg).Elem().Set(defaults)
+		if serr := c.loadConfigFrom(ctx, cfg, path, true); serr != nil {
+			return serr
+		}
+
+		c.emit(Event{Type: EventTypeConfigFallback, Key: path, Value: CacheFallback.String(), Err: err})
+		return nil
+	}
+
+	return err
+}
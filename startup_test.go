@@ -0,0 +1,96 @@
+package svcutil
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+var errConfigUnavailable = errors.New("config unavailable")
+
+// failConfigReads fails reads of the configuration of the billing service
+func failConfigReads(next Operation) Operation {
+	return func(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+		if op.IsGet() && strings.HasPrefix(string(op.KeyBytes()), "/config/billing/") {
+			return clientv3.OpResponse{}, errConfigUnavailable
+		}
+
+		return next(ctx, op)
+	}
+}
+
+type startupConfig struct {
+	Level string `json:"level"`
+	Port  int    `json:"port"`
+}
+
+func TestConnectConfigPolicy(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cfg := startupConfig{Level: "info", Port: 80}
+	if _, err := Connect(ctx, ConfigurationTypeService, &cfg, Name("billing"), LocalBackend(dir), Middleware(failConfigReads)); !errors.Is(err, errConfigUnavailable) {
+		t.Errorf("Connect() with RequireConfig error = %v, want %v", err, errConfigUnavailable)
+	}
+
+	var events []Event
+	svc, err := Connect(ctx, ConfigurationTypeService, &cfg, Name("billing"), LocalBackend(dir), Middleware(failConfigReads),
+		StartupConfigPolicy(PreferConfig), OnEvents(EventsFunc(func(e Event) { events = append(events, e) })))
+	if err != nil {
+		t.Fatalf("Connect() with PreferConfig error = %v", err)
+	}
+	svc.Close()
+
+	if cfg != (startupConfig{Level: "info", Port: 80}) {
+		t.Errorf("config = %+v, want the defaults", cfg)
+	}
+
+	if len(events) != 1 || events[0].Type != EventTypeConfigFallback || events[0].Value != "prefer" || !errors.Is(events[0].Err, errConfigUnavailable) {
+		t.Errorf("events = %+v, want EventTypeConfigFallback", events)
+	}
+}
+
+func TestConnectCacheFallback(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(t.TempDir(), "config.json")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var cfg startupConfig
+	if _, err := Connect(ctx, ConfigurationTypeService, &cfg, Name("billing"), LocalBackend(dir), Middleware(failConfigReads),
+		OfflineConfig(file), StartupConfigPolicy(CacheFallback)); !errors.Is(err, ErrNoConfigSnapshot) {
+		t.Errorf("Connect() without a snapshot error = %v, want %v", err, ErrNoConfigSnapshot)
+	}
+
+	svc, err := Connect(ctx, ConfigurationTypeService, &cfg, Name("billing"), LocalBackend(dir), OfflineConfig(file))
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	if err := svc.SaveConfig(ctx, ConfigurationTypeService, &startupConfig{Level: "debug", Port: 8080}); err != nil {
+		t.Fatalf("SaveConfig() error = %v", err)
+	}
+
+	if err := svc.LoadConfig(ctx, ConfigurationTypeService, &cfg); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	svc.Close()
+
+	cfg = startupConfig{}
+	svc, err = Connect(ctx, ConfigurationTypeService, &cfg, Name("billing"), LocalBackend(dir), Middleware(failConfigReads),
+		OfflineConfig(file), StartupConfigPolicy(CacheFallback))
+	if err != nil {
+		t.Fatalf("Connect() with CacheFallback error = %v", err)
+	}
+	defer svc.Close()
+
+	if cfg != (startupConfig{Level: "debug", Port: 8080}) {
+		t.Errorf("config = %+v, want the snapshot", cfg)
+	}
+}
@@ -0,0 +1,83 @@
+package svcutil
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats are counters of the session and the range leases of the Service
+type Stats struct {
+	SessionRecreations int64
+	// KeepAlives counts keep-alive responses received for range leases
+	KeepAlives       int64
+	LastKeepAliveGap time.Duration
+	MaxKeepAliveGap  time.Duration
+	// LastRenewalTTL and MinRenewalTTL are the seconds remaining reported by etcd on renewal
+	LastRenewalTTL     int64
+	MinRenewalTTL      int64
+	ReacquireAttempts  int64
+	ReacquireSuccesses int64
+}
+
+type statsRecorder struct {
+	m sync.Mutex
+	s Stats
+}
+
+func (r *statsRecorder) sessionRecreated() {
+	r.m.Lock()
+	r.s.SessionRecreations++
+	r.m.Unlock()
+}
+
+func (r *statsRecorder) keepAlive(gap time.Duration, ttl int64) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.s.KeepAlives++
+	r.s.LastKeepAliveGap = gap
+	r.s.MaxKeepAliveGap = max(r.s.MaxKeepAliveGap, gap)
+
+	r.s.LastRenewalTTL = ttl
+	if r.s.MinRenewalTTL == 0 || ttl < r.s.MinRenewalTTL {
+		r.s.MinRenewalTTL = ttl
+	}
+}
+
+func (r *statsRecorder) reacquire(success bool) {
+	r.m.Lock()
+	r.s.ReacquireAttempts++
+	if success {
+		r.s.ReacquireSuccesses++
+	}
+	r.m.Unlock()
+}
+
+func (r *statsRecorder) snapshot() Stats {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.s
+}
+
+// Stats returns a snapshot of the service counters
+func (c *Service) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+// statsReporter emits the counters as EventTypeStats at the configured interval
+func (c *Service) statsReporter() {
+	defer c.wg.Done()
+
+	tk := time.NewTicker(c.options.statsInterval)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-c.stopper:
+			return
+		case <-tk.C:
+			stats := c.Stats()
+			c.emit(Event{Type: EventTypeStats, Stats: &stats})
+		}
+	}
+}
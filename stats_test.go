@@ -0,0 +1,32 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsRecorder(t *testing.T) {
+	var r statsRecorder
+
+	r.sessionRecreated()
+	r.keepAlive(10*time.Second, 30)
+	r.keepAlive(25*time.Second, 12)
+	r.keepAlive(5*time.Second, 29)
+	r.reacquire(false)
+	r.reacquire(true)
+
+	want := Stats{
+		SessionRecreations: 1,
+		KeepAlives:         3,
+		LastKeepAliveGap:   5 * time.Second,
+		MaxKeepAliveGap:    25 * time.Second,
+		LastRenewalTTL:     29,
+		MinRenewalTTL:      12,
+		ReacquireAttempts:  2,
+		ReacquireSuccesses: 1,
+	}
+
+	if got := r.snapshot(); got != want {
+		t.Errorf("snapshot() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,114 @@
+package svcutil
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// InstanceStatus is the state published by an instance with SetStatus,
+// e.g. "serving", "draining" or "rebalancing"
+type InstanceStatus struct {
+	Instance string            `json:"instance"`
+	Host     string            `json:"host"`
+	State    string            `json:"state"`
+	Detail   map[string]string `json:"detail,omitempty"`
+	Time     time.Time         `json:"time"`
+}
+
+// statusPrefix is the prefix of status keys of all instances of the service, they are kept
+// apart from the host config so config listings never see them
+func (c *Service) statusPrefix(serviceName string) string {
+	return c.options.statusPrefix + serviceName + "/"
+}
+
+func (c *Service) statusKey() string {
+	return c.statusPrefix(c.options.serviceName) + c.options.hostname + "/" + c.options.instance
+}
+
+// SetStatus publishes the state of the instance under its status key. The key is attached to
+// the service session, so it disappears when the instance dies, and it is published again
+// after the session is restored.
+func (c *Service) SetStatus(ctx context.Context, state string, detail map[string]string) error {
+	status := InstanceStatus{
+		Instance: c.options.instance,
+		Host:     c.options.hostname,
+		State:    state,
+		Detail:   detail,
+		Time:     time.Now(),
+	}
+
+	c.statusMu.Lock()
+	c.status = &status
+	c.statusMu.Unlock()
+
+	return c.publishStatus(ctx, status)
+}
+
+func (c *Service) publishStatus(ctx context.Context, status InstanceStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	session := c.session
+	c.lock.Unlock()
+
+	if session == nil {
+		return ErrSessionNotAvailable
+	}
+
+	_, err = c.etcd.Put(ctx, c.statusKey(), string(data), clientv3.WithLease(session.Lease()))
+	return etcdError(err)
+}
+
+// restoreStatus publishes the last status again once a lost session is recreated
+func (c *Service) restoreStatus() {
+	c.statusMu.Lock()
+	status := c.status
+	c.statusMu.Unlock()
+
+	if status == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.etcdDialTimeout)
+	defer cancel()
+	c.publishStatus(ctx, *status)
+}
+
+// isStatusKey reports whether the key under the status prefix of the service is a status
+// key, <host>/<instance>
+func isStatusKey(rest string) bool {
+	host, instance, ok := strings.Cut(rest, "/")
+	return ok && host != "" && instance != "" && !strings.Contains(instance, "/")
+}
+
+// FleetStatus returns the states of all live instances of the service, sorted by host and instance
+func (c *Service) FleetStatus(ctx context.Context) ([]InstanceStatus, error) {
+	prefix := c.statusPrefix(c.options.serviceName)
+	resp, err := c.etcd.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, etcdError(err)
+	}
+
+	var fleet []InstanceStatus
+	for _, kv := range resp.Kvs {
+		if !isStatusKey(strings.TrimPrefix(string(kv.Key), prefix)) {
+			continue
+		}
+
+		var status InstanceStatus
+		if err := json.Unmarshal(kv.Value, &status); err != nil {
+			continue
+		}
+
+		fleet = append(fleet, status)
+	}
+
+	return fleet, nil
+}
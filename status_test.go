@@ -0,0 +1,50 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestIsStatusKey(t *testing.T) {
+	tests := map[string]bool{
+		"host-a/host-a-billing-42": true,
+		"host-a":                   false,
+		"host-a/":                  false,
+		"/instance":                false,
+		"host-a/nested/instance":   false,
+	}
+
+	for key, want := range tests {
+		if got := isStatusKey(key); got != want {
+			t.Errorf("isStatusKey(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestStatusOutsideHostConfig(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("billing"), Instance("billing-1"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	if err := svc.SetStatus(ctx, "serving", nil); err != nil {
+		t.Fatalf("SetStatus() error = %v", err)
+	}
+
+	fleet, err := svc.FleetStatus(ctx)
+	if err != nil || len(fleet) != 1 || fleet[0].Instance != "billing-1" || fleet[0].State != "serving" {
+		t.Errorf("FleetStatus() = %+v, %v, want billing-1 serving", fleet, err)
+	}
+
+	// the status is not a config value of the host
+	values, err := svc.LoadConfigMap(ctx, ConfigurationTypeHost)
+	if err != nil || len(values) != 0 {
+		t.Errorf("LoadConfigMap() of the host = %v, %v, want no values", values, err)
+	}
+}
@@ -0,0 +1,171 @@
+package svcutil
+
+import (
+	"errors"
+	"math/big"
+	"net/netip"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+var ErrNoFreeSubnet = errors.New("no free subnet")
+var ErrSubnetNotAllocated = errors.New("subnet is not allocated")
+
+// defaultSubnetBits is the prefix length of allocated subnets unless SubnetWithBits is given
+const defaultSubnetBits = 28
+
+type subnetOptions struct {
+	bits int
+}
+
+// SubnetOption customizes a SubnetAllocator
+type SubnetOption func(*subnetOptions) *subnetOptions
+
+// SubnetWithBits sets the prefix length of allocated subnets, 28 by default
+func SubnetWithBits(bits int) SubnetOption {
+	return func(o *subnetOptions) *subnetOptions {
+		o.bits = bits
+		return o
+	}
+}
+
+// SubnetAllocator hands out subnets of a parent CIDR, e.g. a /28 per tenant network.
+// Allocations are stored under the subnets prefix of the service until released, they
+// are not bound to the session, so they survive restarts of the allocating instances.
+// Allocators sharing the prefix must use the same subnet size, subnets of different
+// sizes are not checked for overlaps.
+type SubnetAllocator struct {
+	client *Service
+	parent netip.Prefix
+	bits   int
+}
+
+// NewSubnetAllocator creates an allocator of subnets of the parent CIDR, IPv4 or IPv6
+func NewSubnetAllocator(svc *Service, parent string, opts ...SubnetOption) (*SubnetAllocator, error) {
+	o := &subnetOptions{bits: defaultSubnetBits}
+	for _, decorator := range opts {
+		o = decorator(o)
+	}
+
+	p, err := netip.ParsePrefix(strings.TrimSpace(parent))
+	if err != nil {
+		return nil, ErrInvalidRange
+	}
+	p = p.Masked()
+
+	if o.bits < p.Bits() || o.bits > p.Addr().BitLen() {
+		return nil, ErrInvalidRange
+	}
+
+	return &SubnetAllocator{
+		client: svc,
+		parent: p,
+		bits:   o.bits,
+	}, nil
+}
+
+func (a *SubnetAllocator) keyPrefix() string {
+	return a.client.options.locksPrefix + a.client.options.serviceName + a.client.options.subnetsPrefix
+}
+
+func (a *SubnetAllocator) key(subnet netip.Prefix) string {
+	return a.keyPrefix() + subnet.String()
+}
+
+// subnet returns the n-th subnet of the parent, ok is false past the last one
+func (a *SubnetAllocator) subnet(n *big.Int) (netip.Prefix, bool) {
+	if n.BitLen() > a.bits-a.parent.Bits() {
+		return netip.Prefix{}, false
+	}
+
+	addr := a.parent.Addr().AsSlice()
+	offset := new(big.Int).Lsh(n, uint(a.parent.Addr().BitLen()-a.bits))
+	new(big.Int).Add(new(big.Int).SetBytes(addr), offset).FillBytes(addr)
+
+	ip, _ := netip.AddrFromSlice(addr)
+	return netip.PrefixFrom(ip, a.bits), true
+}
+
+// contains reports whether the subnet is one handed out by the allocator
+func (a *SubnetAllocator) contains(subnet netip.Prefix) bool {
+	return subnet.Bits() == a.bits && subnet == subnet.Masked() && a.parent.Contains(subnet.Addr())
+}
+
+// Allocations returns the allocated subnets of the parent and their owners
+func (a *SubnetAllocator) Allocations(ctx context.Context) (map[netip.Prefix]string, error) {
+	prefix := a.keyPrefix()
+
+	resp, err := a.client.etcd.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, &LeaseError{Key: prefix, Op: "allocations", Err: etcdError(err)}
+	}
+
+	allocations := make(map[netip.Prefix]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		subnet, err := netip.ParsePrefix(strings.TrimPrefix(string(kv.Key), prefix))
+		if err != nil || !a.contains(subnet) {
+			continue
+		}
+
+		allocations[subnet] = string(kv.Value)
+	}
+
+	return allocations, nil
+}
+
+// Reserve allocates the first free subnet to the owner, e.g. a tenant, and returns it.
+// It fails with ErrNoFreeSubnet once the parent is used up.
+func (a *SubnetAllocator) Reserve(ctx context.Context, owner string) (netip.Prefix, error) {
+	taken, err := a.Allocations(ctx)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	one := big.NewInt(1)
+	for n := new(big.Int); ; n.Add(n, one) {
+		subnet, ok := a.subnet(n)
+		if !ok {
+			return netip.Prefix{}, &LeaseError{Key: a.keyPrefix(), Op: "reserve", Err: ErrNoFreeSubnet}
+		}
+
+		if _, ok := taken[subnet]; ok {
+			continue
+		}
+
+		key := a.key(subnet)
+		resp, err := a.client.etcd.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+			Then(clientv3.OpPut(key, owner)).
+			Commit()
+		if err != nil {
+			return netip.Prefix{}, &LeaseError{Key: key, Op: "reserve", Err: etcdError(err)}
+		}
+
+		// otherwise allocated concurrently, try the next one
+		if resp.Succeeded {
+			return subnet, nil
+		}
+	}
+}
+
+// Release returns the subnet to the parent, it fails with ErrSubnetNotAllocated if the
+// subnet is not allocated
+func (a *SubnetAllocator) Release(ctx context.Context, subnet netip.Prefix) error {
+	key := a.key(subnet)
+	if !a.contains(subnet) {
+		return &LeaseError{Key: key, Op: "release", Err: ErrSubnetNotAllocated}
+	}
+
+	resp, err := a.client.etcd.Delete(ctx, key)
+	if err != nil {
+		return &LeaseError{Key: key, Op: "release", Err: etcdError(err)}
+	}
+
+	if resp.Deleted == 0 {
+		return &LeaseError{Key: key, Op: "release", Err: ErrSubnetNotAllocated}
+	}
+
+	return nil
+}
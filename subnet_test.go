@@ -0,0 +1,106 @@
+package svcutil
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestSubnetAllocator(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("tenantnet"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	for _, parent := range []string{"10.0.0.0", "10.0.0.0/28", "10.0.0.0/24:x"} {
+		if _, err := NewSubnetAllocator(svc, parent, SubnetWithBits(24)); !errors.Is(err, ErrInvalidRange) {
+			t.Errorf("NewSubnetAllocator(%q) error = %v, want %v", parent, err, ErrInvalidRange)
+		}
+	}
+
+	a, err := NewSubnetAllocator(svc, "10.0.1.7/26")
+	if err != nil {
+		t.Fatalf("NewSubnetAllocator() error = %v", err)
+	}
+
+	want := []string{"10.0.1.0/28", "10.0.1.16/28", "10.0.1.32/28", "10.0.1.48/28"}
+	for n, w := range want {
+		subnet, err := a.Reserve(ctx, "tenant-"+w)
+		if err != nil || subnet.String() != w {
+			t.Fatalf("Reserve() #%d = %v, %v, want %s", n, subnet, err, w)
+		}
+	}
+
+	if _, err := a.Reserve(ctx, "tenant-x"); !errors.Is(err, ErrNoFreeSubnet) {
+		t.Fatalf("Reserve() of a full parent error = %v, want %v", err, ErrNoFreeSubnet)
+	}
+
+	released := netip.MustParsePrefix("10.0.1.16/28")
+	if err := a.Release(ctx, released); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if err := a.Release(ctx, released); !errors.Is(err, ErrSubnetNotAllocated) {
+		t.Errorf("second Release() error = %v, want %v", err, ErrSubnetNotAllocated)
+	}
+	if err := a.Release(ctx, netip.MustParsePrefix("10.0.2.0/28")); !errors.Is(err, ErrSubnetNotAllocated) {
+		t.Errorf("Release() of a foreign subnet error = %v, want %v", err, ErrSubnetNotAllocated)
+	}
+
+	// another allocator sees the allocations and reuses the released subnet
+	other, _ := NewSubnetAllocator(svc, "10.0.1.0/26")
+	subnet, err := other.Reserve(ctx, "tenant-y")
+	if err != nil || subnet != released {
+		t.Fatalf("Reserve() = %v, %v, want %v", subnet, err, released)
+	}
+
+	allocations, err := a.Allocations(ctx)
+	if err != nil || len(allocations) != 4 || allocations[released] != "tenant-y" {
+		t.Errorf("Allocations() = %v, %v", allocations, err)
+	}
+
+	v6, err := NewSubnetAllocator(svc, "2001:db8::/48", SubnetWithBits(64))
+	if err != nil {
+		t.Fatalf("NewSubnetAllocator() IPv6 error = %v", err)
+	}
+	v6.Reserve(ctx, "a")
+	if subnet, err := v6.Reserve(ctx, "b"); err != nil || subnet.String() != "2001:db8:0:1::/64" {
+		t.Errorf("Reserve() IPv6 = %v, %v", subnet, err)
+	}
+}
+
+func TestSubnetAllocationsSurviveGC(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("tenantnet"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	a, _ := NewSubnetAllocator(svc, "10.0.1.0/27")
+	reserved, err := a.Reserve(ctx, "tenant-a")
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+
+	// allocations are not leased, GC must not take them for orphans
+	if cleaned, err := svc.GC(ctx, 0, false); err != nil || len(cleaned) != 0 {
+		t.Fatalf("GC() = %v, %v, want nothing cleaned", cleaned, err)
+	}
+
+	allocations, err := a.Allocations(ctx)
+	if err != nil || allocations[reserved] != "tenant-a" {
+		t.Fatalf("Allocations() after GC = %v, %v", allocations, err)
+	}
+	if subnet, err := a.Reserve(ctx, "tenant-b"); err != nil || subnet == reserved {
+		t.Errorf("Reserve() after GC = %v, %v, want a subnet other than %v", subnet, err, reserved)
+	}
+}
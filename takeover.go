@@ -0,0 +1,136 @@
+package svcutil
+
+import (
+	"math"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+func (i *Lease) tombstoneKey(lockKey string) string {
+	return i.client.shadowKey(i.client.options.tombstonesPrefix, lockKey)
+}
+
+// takeoverGuard returns the compares preventing other instances from taking
+// a value while its previous holder's tombstone is still alive
+func (i *Lease) takeoverGuard(lockKey string) []clientv3.Cmp {
+	if i.client.options.takeoverDelay <= 0 {
+		return nil
+	}
+
+	return []clientv3.Cmp{clientv3.Compare(clientv3.CreateRevision(i.tombstoneKey(lockKey)), "=", 0)}
+}
+
+// grantTombstone grants the lease of the tombstone written together with the lease key.
+// Both leases are kept alive while the value is held, the tombstone one outlives the lease
+// key by the takeover delay once the holder crashes or loses etcd. Zero means no tombstone.
+func (i *Lease) grantTombstone(ctx context.Context) (clientv3.LeaseID, error) {
+	delay := i.client.options.takeoverDelay
+	if delay <= 0 {
+		return 0, nil
+	}
+
+	resp, err := i.client.etcd.Grant(ctx, int64(i.ttl())+int64(math.Ceil(delay.Seconds())))
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.ID, nil
+}
+
+// tombstoneOps returns the ops marking the value as held by this instance, they are
+// committed in the transaction taking the value
+func (i *Lease) tombstoneOps(lockKey string, tombstone clientv3.LeaseID) []clientv3.Op {
+	if tombstone == 0 {
+		return nil
+	}
+
+	return []clientv3.Op{clientv3.OpPut(i.tombstoneKey(lockKey), i.client.options.instance, clientv3.WithLease(tombstone))}
+}
+
+// keepTombstone keeps the tombstone lease alive in place of the previous one, a failed
+// keep alive only shortens the protection so it is not reported
+func (i *Lease) keepTombstone(tombstone clientv3.LeaseID) {
+	previous, closer := i.tombstone, i.tombstoneCloser
+	i.tombstone, i.tombstoneCloser = tombstone, nil
+
+	if closer != nil {
+		closer()
+	}
+	if previous != 0 && previous != tombstone {
+		i.client.revoke(previous)
+	}
+
+	if tombstone == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	kl, err := i.client.etcd.KeepAlive(ctx, tombstone)
+	if err != nil {
+		cancel()
+		return
+	}
+
+	i.tombstoneCloser = cancel
+	go func() {
+		for range kl {
+		}
+	}()
+}
+
+// releaseTombstone revokes the tombstone when the value is released on purpose,
+// other instances may take it right away
+func (i *Lease) releaseTombstone() {
+	i.keepTombstone(0)
+}
+
+// Revision returns the fencing revision of the obtained value. Every new holder of
+// a value gets a higher revision, so downstream systems can reject stale holders.
+// It is the revision the lease key was bound to the holder at, the key is only
+// modified afterwards when the value is transferred to another holder. A value taken
+// from the StatefulSet ordinal (see StatefulSetIDs) is not leased in etcd and has the
+// revision zero.
+func (i *Lease) Revision() int64 {
+	i.m.Lock()
+	defer i.m.Unlock()
+	return i.revision
+}
+
+// Verify checks that the value is still held under the same fencing revision, a value
+// taken from the StatefulSet ordinal can't be verified and fails with ErrOrdinalLease
+func (i *Lease) Verify(ctx context.Context) (bool, error) {
+	if i.value == "" {
+		return false, ErrLeaseNotObtained
+	}
+
+	if i.ordinal {
+		return false, ErrOrdinalLease
+	}
+
+	resp, err := i.client.etcd.Get(ctx, i.leaseKey)
+	if err != nil {
+		return false, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return false, nil
+	}
+
+	return resp.Kvs[0].ModRevision == i.Revision(), nil
+}
+
+// HolderRevision returns the fencing revision of the current holder of the value
+// or zero if the value is not held by anyone
+func (i *Lease) HolderRevision(ctx context.Context, value string) (int64, error) {
+	resp, err := i.client.etcd.Get(ctx, i.keyPrefix()+value)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return 0, nil
+	}
+
+	return resp.Kvs[0].ModRevision, nil
+}
@@ -0,0 +1,176 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+func TestTakeoverDelay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	newService := func(instance string) *Service {
+		svc, err := NewService(Name("billing"), Instance(instance), LocalBackend(dir), LeaseTTL(1), TakeoverDelay(time.Second), RetryInterval(50*time.Millisecond))
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		return svc
+	}
+
+	a, b := newService("a"), newService("b")
+	defer a.Close()
+	defer b.Close()
+
+	r, _ := NewIDRange("1-1")
+
+	t.Run("crashed holder", func(t *testing.T) {
+		// the holder writes the key and its tombstone and never keeps them alive
+		crashed := NewLeaseWithOptions(r, a)
+		key := crashed.keyPrefix() + "1"
+
+		grant, err := a.etcd.Grant(ctx, int64(crashed.ttl()))
+		if err != nil {
+			t.Fatalf("Grant() error = %v", err)
+		}
+		tombstone, err := crashed.grantTombstone(ctx)
+		if err != nil || tombstone == 0 {
+			t.Fatalf("grantTombstone() = %v, %v", tombstone, err)
+		}
+
+		cmps, thens, elses := crashed.candidateOps([]string{key}, "a", grant.ID, tombstone)
+		if resp, err := a.etcd.Txn(ctx).If(cmps...).Then(thens...).Else(elses...).Commit(); err != nil || !resp.Succeeded {
+			t.Fatalf("obtain transaction = %v, %v", resp, err)
+		}
+
+		successor := NewLeaseWithOptions(r, b)
+		started := time.Now()
+		if _, err := successor.Obtain(ctx); !errors.Is(err, ErrNoAvailableIDs) {
+			t.Fatalf("Obtain() while held error = %v, want %v", err, ErrNoAvailableIDs)
+		}
+
+		value, err := successor.Wait(ctx)
+		if err != nil || value != "1" {
+			t.Fatalf("Wait() = %q, %v", value, err)
+		}
+		defer successor.Close()
+
+		// the key expires after a second, the tombstone a second later
+		if elapsed := time.Since(started); elapsed < 1500*time.Millisecond {
+			t.Errorf("value taken over after %v, want the takeover delay to pass", elapsed)
+		}
+
+		// the new holder wrote its own tombstone taking the value over
+		resp, err := b.etcd.Get(ctx, successor.tombstoneKey(key))
+		if err != nil || len(resp.Kvs) != 1 || string(resp.Kvs[0].Value) != "b" || resp.Kvs[0].Lease == 0 {
+			t.Fatalf("tombstone after takeover = %v, %v", resp, err)
+		}
+	})
+
+	t.Run("expired holder reacquires", func(t *testing.T) {
+		holder := NewLeaseWithOptions(r, a)
+		if _, err := holder.Wait(ctx); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+		defer holder.Close()
+
+		revision := holder.Revision()
+
+		// the key expires while the holder is alive, the tombstone keeps others away
+		if _, err := a.etcd.Revoke(ctx, holder.currentLease()); err != nil {
+			t.Fatalf("Revoke() error = %v", err)
+		}
+
+		other := NewLeaseWithOptions(r, b)
+		if _, err := other.Obtain(ctx); !errors.Is(err, ErrNoAvailableIDs) {
+			t.Fatalf("Obtain() of the expired value error = %v, want %v", err, ErrNoAvailableIDs)
+		}
+
+		for holder.Revision() == revision {
+			select {
+			case <-ctx.Done():
+				t.Fatal("the holder did not reacquire the value")
+			case <-holder.Done():
+				t.Fatal("the holder lost the value")
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+
+		if ok, err := holder.Verify(ctx); err != nil || !ok {
+			t.Errorf("Verify() after reacquire = %v, %v", ok, err)
+		}
+	})
+
+	t.Run("released value", func(t *testing.T) {
+		holder := NewLeaseWithOptions(r, a)
+		if _, err := holder.Wait(ctx); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+		holder.Close()
+
+		// a value released on purpose is free right away
+		other := NewLeaseWithOptions(r, b)
+		if _, err := other.Obtain(ctx); err != nil {
+			t.Fatalf("Obtain() of a released value error = %v", err)
+		}
+		other.Close()
+
+		resp, err := b.etcd.Get(ctx, other.tombstoneKey(other.keyPrefix()+"1"), clientv3.WithCountOnly())
+		if err != nil || resp.Count != 0 {
+			t.Errorf("tombstone after Close = %v, %v", resp, err)
+		}
+	})
+}
+
+func TestTakeoverDelayWakesWaiter(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	newService := func(instance string, retry time.Duration) *Service {
+		svc, err := NewService(Name("billing"), Instance(instance), LocalBackend(dir), LeaseTTL(1), TakeoverDelay(time.Second), RetryInterval(retry))
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		t.Cleanup(svc.Close)
+		return svc
+	}
+
+	// the waiter never retries on its own within the test, only deletes wake it up
+	a, b := newService("a", 50*time.Millisecond), newService("b", time.Minute)
+
+	r, _ := NewIDRange("1-1")
+	crashed := NewLeaseWithOptions(r, a)
+	key := crashed.keyPrefix() + "1"
+
+	grant, err := a.etcd.Grant(ctx, int64(crashed.ttl()))
+	if err != nil {
+		t.Fatalf("Grant() error = %v", err)
+	}
+	tombstone, err := crashed.grantTombstone(ctx)
+	if err != nil || tombstone == 0 {
+		t.Fatalf("grantTombstone() = %v, %v", tombstone, err)
+	}
+
+	cmps, thens, elses := crashed.candidateOps([]string{key}, "a", grant.ID, tombstone)
+	if resp, err := a.etcd.Txn(ctx).If(cmps...).Then(thens...).Else(elses...).Commit(); err != nil || !resp.Succeeded {
+		t.Fatalf("obtain transaction = %v, %v", resp, err)
+	}
+
+	waiter := NewLeaseWithOptions(r, b)
+	defer waiter.Close()
+
+	started := time.Now()
+	if value, err := waiter.Wait(ctx); err != nil || value != "1" {
+		t.Fatalf("Wait() = %q, %v", value, err)
+	}
+
+	// the key expires after a second and the tombstone a second later
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("waiter woke up after %v, want the tombstone expiry to wake it", elapsed)
+	}
+}
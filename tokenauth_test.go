@@ -0,0 +1,34 @@
+package svcutil
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestTokenCredentials(t *testing.T) {
+	calls := 0
+	creds := tokenCredentials{provider: func(ctx context.Context) (string, error) {
+		calls++
+		return "jwt-token", nil
+	}}
+
+	md, err := creds.GetRequestMetadata(context.Background())
+	if err != nil || !reflect.DeepEqual(md, map[string]string{"token": "jwt-token"}) {
+		t.Errorf("GetRequestMetadata() = %v, %v", md, err)
+	}
+
+	if calls != 1 {
+		t.Errorf("provider called %d times, want 1", calls)
+	}
+
+	errExpired := errors.New("expired")
+	creds = tokenCredentials{provider: func(ctx context.Context) (string, error) {
+		return "", errExpired
+	}}
+	if _, err := creds.GetRequestMetadata(context.Background()); err != errExpired {
+		t.Errorf("GetRequestMetadata() error = %v, want %v", err, errExpired)
+	}
+}
@@ -0,0 +1,31 @@
+package svcutil
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/net/context"
+)
+
+const tracerName = "github.com/potakhov/svcutil"
+
+var noopTracer = noop.NewTracerProvider().Tracer(tracerName)
+
+// startSpan starts a client span as a child of the span carried by ctx
+func (c *Service) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("svcutil.service", c.options.serviceName))
+	return c.options.tracer.Start(ctx, "svcutil."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
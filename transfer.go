@@ -0,0 +1,204 @@
+package svcutil
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/context"
+)
+
+var ErrTransferTargetNotFound = errors.New("transfer target not found")
+
+// transferAnnouncement is the value of the announce key of a transfer target, the holder
+// value is encoded with the metadata and codec of the target lease
+type transferAnnouncement struct {
+	Lease  int64  `json:"lease"`
+	Holder []byte `json:"holder"`
+}
+
+func (i *Lease) transferKey(instance string) string {
+	return i.client.shadowKey(i.client.options.transfersPrefix, i.keyPrefix()) + instance
+}
+
+// AcceptTransfer announces this instance as a transfer target and blocks until the
+// holder of a value hands it over with TransferTo, the value is returned like Obtain does
+func (i *Lease) AcceptTransfer(ctx context.Context) (string, error) {
+	ctx, span := i.client.startSpan(ctx, "Lease.AcceptTransfer", attribute.String("svcutil.key", i.keyPrefix()))
+	id, err := i.acceptTransfer(ctx)
+	endSpan(span, err)
+
+	return id, err
+}
+
+func (i *Lease) acceptTransfer(ctx context.Context) (string, error) {
+	key := i.keyPrefix()
+
+	grant, err := i.client.etcd.Grant(ctx, int64(i.ttl()))
+	if err != nil {
+		return "", &LeaseError{Key: key, Op: "grant", Err: etcdError(err)}
+	}
+
+	// keeps the lease alive while waiting, the lease worker takes over once bound
+	waitContext, waitCancel := context.WithCancel(context.Background())
+	defer waitCancel()
+
+	kl, err := i.client.etcd.KeepAlive(waitContext, grant.ID)
+	if err != nil {
+		return "", &LeaseError{Key: key, Op: "keepalive", Err: etcdError(err)}
+	}
+
+	go func() {
+		for range kl {
+		}
+	}()
+
+	bound := false
+	defer func() {
+		if !bound {
+			i.client.revoke(grant.ID)
+		}
+	}()
+
+	announceKey := i.transferKey(i.client.options.instance)
+	holder, err := i.holderValue()
+	if err != nil {
+		return "", &LeaseError{Key: announceKey, Op: "encode", Err: err}
+	}
+
+	announcement, err := json.Marshal(transferAnnouncement{Lease: int64(grant.ID), Holder: []byte(holder)})
+	if err != nil {
+		return "", &LeaseError{Key: announceKey, Op: "announce", Err: err}
+	}
+
+	putResp, err := i.client.etcd.Put(ctx, announceKey, string(announcement), clientv3.WithLease(grant.ID))
+	if err != nil {
+		return "", &LeaseError{Key: announceKey, Op: "announce", Err: etcdError(err)}
+	}
+
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	watchChan := i.client.etcd.Watch(wctx, key, clientv3.WithPrefix(), clientv3.WithFilterDelete(), clientv3.WithRev(putResp.Header.Revision+1))
+	for resp := range watchChan {
+		if err := resp.Err(); err != nil {
+			return "", &LeaseError{Key: key, Op: "watch", Err: err}
+		}
+
+		for _, ev := range resp.Events {
+			if ev.Kv.Lease != int64(grant.ID) {
+				continue
+			}
+
+			keepAliveContext, keepAliveCancel := context.WithCancel(context.Background())
+			kl, err := i.client.etcd.KeepAlive(keepAliveContext, grant.ID)
+			if err != nil {
+				keepAliveCancel()
+				return "", &LeaseError{Key: string(ev.Kv.Key), Op: "keepalive", Err: etcdError(err)}
+			}
+
+			bound = true
+			go i.keepAliveWorker(kl)
+
+			i.value = string(ev.Kv.Key[len(key):])
+			i.closer = keepAliveCancel
+			i.setLease(grant.ID, ev.Kv.ModRevision)
+			i.leaseKey = string(ev.Kv.Key)
+
+			i.wg.Add(1)
+			go i.worker()
+
+			if i.options.process != nil {
+				i.attachProcess(i.options.process)
+			}
+
+			return i.value, nil
+		}
+	}
+
+	return "", ctx.Err()
+}
+
+// TransferTo hands the obtained value over to the target instance waiting in AcceptTransfer.
+// The lease key is rebound to the lease of the target in a single transaction, so the value
+// is never free in between, and this lease is closed afterwards. The key gets the holder
+// value announced by the target, encoded with its LeaseWithMetadata and LeaseWithCodec.
+func (i *Lease) TransferTo(ctx context.Context, target string) error {
+	ctx, span := i.client.startSpan(ctx, "Lease.TransferTo", attribute.String("svcutil.key", i.leaseKey), attribute.String("svcutil.target", target))
+	err := i.transferTo(ctx, target)
+	endSpan(span, err)
+
+	return err
+}
+
+func (i *Lease) transferTo(ctx context.Context, target string) error {
+	if i.value == "" {
+		return ErrLeaseNotObtained
+	}
+
+	if i.ordinal {
+		return ErrOrdinalLease
+	}
+
+	announceKey := i.transferKey(target)
+	resp, err := i.client.etcd.Get(ctx, announceKey)
+	if err != nil {
+		return &LeaseError{Key: announceKey, Op: "transfer", Err: etcdError(err)}
+	}
+
+	if len(resp.Kvs) == 0 {
+		return ErrTransferTargetNotFound
+	}
+
+	targetLease, holder, err := i.parseAnnouncement(resp.Kvs[0].Value, target)
+	if err != nil {
+		return err
+	}
+
+	txnResp, err := i.client.etcd.Txn(ctx).
+		If(
+			clientv3.Compare(clientv3.LeaseValue(i.leaseKey), "=", int64(i.currentLease())),
+			clientv3.Compare(clientv3.ModRevision(announceKey), "=", resp.Kvs[0].ModRevision),
+		).
+		Then(
+			clientv3.OpPut(i.leaseKey, holder, clientv3.WithLease(clientv3.LeaseID(targetLease))),
+			clientv3.OpDelete(announceKey),
+		).
+		Commit()
+	if err != nil {
+		return &LeaseError{Key: i.leaseKey, Op: "transfer", Err: etcdError(err)}
+	}
+
+	if !txnResp.Succeeded {
+		return ErrRevisionMismatch
+	}
+
+	// the key is bound to the target lease now, revoking ours does not affect it
+	i.Close()
+
+	return nil
+}
+
+// parseAnnouncement returns the lease and holder value announced by the target. Targets
+// of older versions announce only their lease in hex, they get the instance name encoded
+// with the codec of this lease.
+func (i *Lease) parseAnnouncement(data []byte, target string) (int64, string, error) {
+	var announcement transferAnnouncement
+	if err := json.Unmarshal(data, &announcement); err == nil {
+		return announcement.Lease, string(announcement.Holder), nil
+	}
+
+	lease, err := strconv.ParseInt(string(data), 16, 64)
+	if err != nil {
+		return 0, "", ErrTransferTargetNotFound
+	}
+
+	holder, err := i.encodeValue(target)
+	if err != nil {
+		return 0, "", &LeaseError{Key: i.leaseKey, Op: "encode", Err: err}
+	}
+
+	return lease, holder, nil
+}
@@ -0,0 +1,81 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestTransferTo(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	newService := func(instance string) *Service {
+		svc, err := NewService(Name("api"), Instance(instance), LocalBackend(dir))
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		t.Cleanup(svc.Close)
+		return svc
+	}
+
+	r, _ := NewIDRange("1")
+	old := NewLeaseWithOptions(r, newService("old"))
+	if _, err := old.Obtain(ctx); err != nil {
+		t.Fatalf("Obtain() error = %v", err)
+	}
+	defer old.Close()
+	revision := old.Revision()
+
+	if err := old.TransferTo(ctx, "new"); err != ErrTransferTargetNotFound {
+		t.Fatalf("TransferTo() before the target announced itself error = %v, want %v", err, ErrTransferTargetNotFound)
+	}
+
+	// the new holder is written with the metadata and codec of the accepting lease
+	next := NewLeaseWithOptions(r, newService("new"), LeaseWithMetadata("shard"), LeaseWithCodec(prefixCodec{}))
+	defer next.Close()
+
+	accepted := make(chan error, 1)
+	go func() {
+		_, err := next.AcceptTransfer(ctx)
+		accepted <- err
+	}()
+
+	for {
+		resp, err := old.client.etcd.Get(ctx, old.transferKey("new"))
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if len(resp.Kvs) == 1 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatal("the target did not announce itself")
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	if err := old.TransferTo(ctx, "new"); err != nil {
+		t.Fatalf("TransferTo() error = %v", err)
+	}
+	if err := <-accepted; err != nil {
+		t.Fatalf("AcceptTransfer() error = %v", err)
+	}
+
+	if next.Value() != "1" || next.Revision() <= revision {
+		t.Errorf("transferred value = %q at revision %d, want 1 after revision %d", next.Value(), next.Revision(), revision)
+	}
+
+	resp, err := next.client.etcd.Get(ctx, next.keyPrefix()+"1")
+	if err != nil || len(resp.Kvs) != 1 || string(resp.Kvs[0].Value) != "enc:shard" {
+		t.Fatalf("lease key after transfer = %v, %v, want enc:shard", resp, err)
+	}
+
+	if holder, err := next.Holder(ctx, "1"); err != nil || string(holder) != "shard" {
+		t.Errorf("Holder() = %q, %v, want shard", holder, err)
+	}
+}
@@ -0,0 +1,409 @@
+package svcutil
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+var ErrTransactionExists = errors.New("transaction already exists")
+var ErrTransactionNotFound = errors.New("transaction not found")
+var ErrTransactionDecided = errors.New("transaction is already decided")
+var ErrTransactionTimeout = errors.New("transaction timed out")
+var ErrInvalidTransaction = errors.New("invalid transaction id or participant")
+var ErrTooManyParticipants = errors.New("too many transaction participants")
+
+// Decision is the state of a two-phase commit transaction
+type Decision int
+
+const (
+	DecisionPending Decision = iota
+	DecisionCommit
+	DecisionAbort
+)
+
+func (d Decision) String() string {
+	switch d {
+	case DecisionCommit:
+		return "commit"
+	case DecisionAbort:
+		return "abort"
+	}
+
+	return "pending"
+}
+
+func parseDecision(v []byte) Decision {
+	switch string(v) {
+	case "commit":
+		return DecisionCommit
+	case "abort":
+		return DecisionAbort
+	}
+
+	return DecisionPending
+}
+
+type coordinatorOptions struct {
+	timeout time.Duration
+}
+
+// CoordinatorOption customizes a Coordinator
+type CoordinatorOption func(*coordinatorOptions) *coordinatorOptions
+
+// CoordinatorWithTimeout sets how long Propose waits for the votes and then for the acks
+// of the participants, 30 seconds by default
+func CoordinatorWithTimeout(d time.Duration) CoordinatorOption {
+	return func(o *coordinatorOptions) *coordinatorOptions {
+		o.timeout = d
+		return o
+	}
+}
+
+// Coordinator runs two-phase commit transactions across services: it proposes a
+// transaction, collects a vote of every participant and commits it only if all of them
+// voted to commit. Transactions are stored under the transactions prefix shared by all
+// services, so participants may run as other services.
+type Coordinator struct {
+	client  *Service
+	options *coordinatorOptions
+}
+
+// NewCoordinator creates a coordinator of transactions proposed by the service
+func NewCoordinator(svc *Service, opts ...CoordinatorOption) *Coordinator {
+	o := &coordinatorOptions{timeout: 30 * time.Second}
+	for _, decorator := range opts {
+		o = decorator(o)
+	}
+
+	return &Coordinator{client: svc, options: o}
+}
+
+func (c *Service) transactionKey(id string) string {
+	return c.options.transactionsPrefix + id + "/"
+}
+
+func (c *Service) transactionStateKey(id string) string {
+	return c.transactionKey(id) + "state"
+}
+
+func (c *Service) participantKey(id, kind, participant string) string {
+	return c.transactionKey(id) + kind + "/" + participant
+}
+
+// Propose starts the transaction, waits for the votes of the participants and commits it
+// if all of them voted to commit or aborts it otherwise, then waits for the participants
+// to acknowledge the decision. Keys of the transaction are deleted once everyone acked.
+//
+// The decision is returned along with an error if the votes timed out (the transaction
+// is aborted) or the acks did (the decision stands, participants that missed it still
+// get it with Await). If the coordinator goes away before deciding, Abort resolves the
+// transaction.
+//
+// The id and the participant names are parts of etcd keys and must not be empty or contain
+// "/", ErrInvalidTransaction is returned otherwise. The transaction is created in a single
+// etcd transaction, so up to maxTxnOps-1 (127) participants are accepted.
+func (co *Coordinator) Propose(ctx context.Context, id string, participants []string) (Decision, error) {
+	c := co.client
+	if len(participants) == 0 {
+		return DecisionAbort, &TransactionError{ID: id, Op: "propose", Err: ErrEmptyValue}
+	}
+
+	participants = slices.Clone(participants)
+	slices.Sort(participants)
+	participants = slices.Compact(participants)
+
+	invalid := func(name string) bool { return !validTransactionName(name) }
+	if invalid(id) || slices.ContainsFunc(participants, invalid) {
+		return DecisionAbort, &TransactionError{ID: id, Op: "propose", Err: ErrInvalidTransaction}
+	}
+
+	// the state key takes one operation
+	if len(participants) >= maxTxnOps {
+		return DecisionAbort, &TransactionError{ID: id, Op: "propose", Err: ErrTooManyParticipants}
+	}
+
+	state := c.transactionStateKey(id)
+	ops := []clientv3.Op{clientv3.OpPut(state, DecisionPending.String())}
+	for _, p := range participants {
+		ops = append(ops, clientv3.OpPut(c.participantKey(id, "participant", p), ""))
+	}
+
+	resp, err := c.etcd.Txn(ctx).If(clientv3.Compare(clientv3.CreateRevision(state), "=", 0)).Then(ops...).Commit()
+	if err != nil {
+		return DecisionAbort, &TransactionError{ID: id, Op: "propose", Err: etcdError(err)}
+	}
+
+	if !resp.Succeeded {
+		return DecisionAbort, &TransactionError{ID: id, Op: "propose", Err: ErrTransactionExists}
+	}
+
+	decision, voteErr := co.collectVotes(ctx, id, participants)
+
+	dctx := ctx
+	if ctx.Err() != nil {
+		// still abort the transaction the participants wait for
+		var cancel context.CancelFunc
+		dctx, cancel = context.WithTimeout(context.Background(), c.options.etcdDialTimeout)
+		defer cancel()
+	}
+
+	decision, err = c.decide(dctx, id, decision)
+	if err != nil {
+		return DecisionAbort, err
+	}
+
+	if voteErr != nil {
+		return decision, voteErr
+	}
+
+	return decision, co.collectAcks(ctx, id, participants)
+}
+
+// validTransactionName reports whether the id or participant name can be a key segment
+func validTransactionName(name string) bool {
+	return name != "" && !strings.Contains(name, "/")
+}
+
+// collectVotes waits until every participant voted to commit, any of them voted to abort
+// or the transaction was aborted with Abort
+func (co *Coordinator) collectVotes(ctx context.Context, id string, participants []string) (Decision, error) {
+	c := co.client
+
+	vctx, cancel := context.WithTimeout(ctx, co.options.timeout)
+	defer cancel()
+
+	prefix := c.transactionKey(id)
+	closed := 0
+	for {
+		resp, err := c.etcd.Get(vctx, prefix, clientv3.WithPrefix())
+		if err != nil {
+			return DecisionAbort, co.phaseError(ctx, id, "vote", err)
+		}
+
+		votes := make(map[string]Decision)
+		for _, kv := range resp.Kvs {
+			key := string(kv.Key)
+			switch {
+			case key == prefix+"state":
+				if d := parseDecision(kv.Value); d != DecisionPending {
+					return d, nil
+				}
+			case strings.HasPrefix(key, prefix+"vote/"):
+				votes[strings.TrimPrefix(key, prefix+"vote/")] = parseDecision(kv.Value)
+			}
+		}
+
+		decision := DecisionCommit
+		for _, p := range participants {
+			switch votes[p] {
+			case DecisionAbort:
+				return DecisionAbort, nil
+			case DecisionPending:
+				decision = DecisionPending
+			}
+		}
+
+		if decision == DecisionCommit {
+			return DecisionCommit, nil
+		}
+
+		err = c.waitChange(vctx, prefix, resp.Header.Revision, clientv3.WithPrefix())
+		if err := c.retryWatch(vctx, err, &closed); err != nil {
+			return DecisionAbort, co.phaseError(ctx, id, "vote", err)
+		}
+	}
+}
+
+// collectAcks waits until every participant acknowledged the decision and deletes the transaction
+func (co *Coordinator) collectAcks(ctx context.Context, id string, participants []string) error {
+	c := co.client
+
+	actx, cancel := context.WithTimeout(ctx, co.options.timeout)
+	defer cancel()
+
+	prefix := c.transactionKey(id) + "ack/"
+	closed := 0
+	for {
+		resp, err := c.etcd.Get(actx, prefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+		if err != nil {
+			return co.phaseError(ctx, id, "ack", err)
+		}
+
+		if resp.Count >= int64(len(participants)) {
+			break
+		}
+
+		err = c.waitChange(actx, prefix, resp.Header.Revision, clientv3.WithPrefix())
+		if err := c.retryWatch(actx, err, &closed); err != nil {
+			return co.phaseError(ctx, id, "ack", err)
+		}
+	}
+
+	if _, err := c.etcd.Delete(ctx, c.transactionKey(id), clientv3.WithPrefix()); err != nil {
+		return &TransactionError{ID: id, Op: "delete", Err: etcdError(err)}
+	}
+
+	return nil
+}
+
+// phaseError reports a phase that ran out of time as ErrTransactionTimeout, unless ctx is done
+func (co *Coordinator) phaseError(ctx context.Context, id, op string, err error) error {
+	if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		err = ErrTransactionTimeout
+	}
+
+	return &TransactionError{ID: id, Op: op, Err: etcdError(err)}
+}
+
+// decide sets the decision of a pending transaction and returns the decision it ended with
+func (c *Service) decide(ctx context.Context, id string, d Decision) (Decision, error) {
+	state := c.transactionStateKey(id)
+
+	resp, err := c.etcd.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(state), "=", DecisionPending.String())).
+		Then(clientv3.OpPut(state, d.String())).
+		Else(clientv3.OpGet(state)).
+		Commit()
+	if err != nil {
+		return DecisionAbort, &TransactionError{ID: id, Op: "decide", Err: etcdError(err)}
+	}
+
+	if resp.Succeeded {
+		return d, nil
+	}
+
+	kvs := resp.Responses[0].GetResponseRange().Kvs
+	if len(kvs) == 0 {
+		return DecisionAbort, &TransactionError{ID: id, Op: "decide", Err: ErrTransactionNotFound}
+	}
+
+	return parseDecision(kvs[0].Value), nil
+}
+
+// Abort aborts a pending transaction, e.g. one left by a coordinator that went away, and
+// returns the decision it ended with, DecisionCommit if it was committed already
+func (co *Coordinator) Abort(ctx context.Context, id string) (Decision, error) {
+	return co.client.decide(ctx, id, DecisionAbort)
+}
+
+// Participant votes on and applies transactions proposed by a Coordinator
+type Participant struct {
+	client *Service
+	name   string
+}
+
+// NewParticipant creates a participant named as in the participants of Propose
+func NewParticipant(svc *Service, name string) *Participant {
+	return &Participant{client: svc, name: name}
+}
+
+// Pending returns the ids of pending transactions waiting for the vote of the participant
+func (p *Participant) Pending(ctx context.Context) ([]string, error) {
+	c := p.client
+	prefix := c.options.transactionsPrefix
+
+	resp, err := c.etcd.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, &TransactionError{ID: prefix, Op: "pending", Err: etcdError(err)}
+	}
+
+	var member []string
+	pending := make(map[string]bool)
+	voted := make(map[string]bool)
+	for _, kv := range resp.Kvs {
+		key := strings.TrimPrefix(string(kv.Key), prefix)
+		if id, ok := strings.CutSuffix(key, "/state"); ok {
+			pending[id] = parseDecision(kv.Value) == DecisionPending
+		} else if id, ok := strings.CutSuffix(key, "/participant/"+p.name); ok {
+			member = append(member, id)
+		} else if id, ok := strings.CutSuffix(key, "/vote/"+p.name); ok {
+			voted[id] = true
+		}
+	}
+
+	var ids []string
+	for _, id := range member {
+		if pending[id] && !voted[id] {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// Vote casts the vote of the participant, to commit the transaction or to abort it. It
+// fails with ErrTransactionDecided once the transaction is decided, e.g. aborted after
+// the votes timed out, and with ErrTransactionNotFound if the participant is not part of it.
+func (p *Participant) Vote(ctx context.Context, id string, commit bool) error {
+	c := p.client
+
+	vote := DecisionAbort
+	if commit {
+		vote = DecisionCommit
+	}
+
+	state := c.transactionStateKey(id)
+	member := c.participantKey(id, "participant", p.name)
+
+	resp, err := c.etcd.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(state), "=", DecisionPending.String()),
+			clientv3.Compare(clientv3.CreateRevision(member), ">", 0)).
+		Then(clientv3.OpPut(c.participantKey(id, "vote", p.name), vote.String())).
+		Else(clientv3.OpGet(state), clientv3.OpGet(member)).
+		Commit()
+	if err != nil {
+		return &TransactionError{ID: id, Op: "vote", Err: etcdError(err)}
+	}
+
+	if resp.Succeeded {
+		return nil
+	}
+
+	if len(resp.Responses[0].GetResponseRange().Kvs) == 0 || len(resp.Responses[1].GetResponseRange().Kvs) == 0 {
+		return &TransactionError{ID: id, Op: "vote", Err: ErrTransactionNotFound}
+	}
+
+	return &TransactionError{ID: id, Op: "vote", Err: ErrTransactionDecided}
+}
+
+// Await blocks until the transaction is decided and returns the decision, the participant
+// applies it and calls Ack
+func (p *Participant) Await(ctx context.Context, id string) (Decision, error) {
+	value, err := p.client.waitForKey(ctx, p.client.transactionStateKey(id), func(v []byte) bool {
+		return parseDecision(v) != DecisionPending
+	})
+	if err != nil {
+		return DecisionPending, &TransactionError{ID: id, Op: "await", Err: etcdError(err)}
+	}
+
+	return parseDecision(value), nil
+}
+
+// Ack acknowledges that the participant applied the decision of the transaction, it fails
+// with ErrTransactionNotFound unless the transaction is decided and the participant is part of it
+func (p *Participant) Ack(ctx context.Context, id string) error {
+	c := p.client
+
+	state := c.transactionStateKey(id)
+	member := c.participantKey(id, "participant", p.name)
+
+	resp, err := c.etcd.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(state), "!=", DecisionPending.String()),
+			clientv3.Compare(clientv3.CreateRevision(member), ">", 0)).
+		Then(clientv3.OpPut(c.participantKey(id, "ack", p.name), "")).
+		Commit()
+	if err != nil {
+		return &TransactionError{ID: id, Op: "ack", Err: etcdError(err)}
+	}
+
+	if !resp.Succeeded {
+		return &TransactionError{ID: id, Op: "ack", Err: ErrTransactionNotFound}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package svcutil
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// participate waits for the transaction, votes and acks the decision
+func participate(ctx context.Context, t *testing.T, p *Participant, id string, commit bool) <-chan Decision {
+	decided := make(chan Decision, 1)
+
+	go func() {
+		for {
+			ids, err := p.Pending(ctx)
+			if err != nil {
+				t.Errorf("Pending() error = %v", err)
+				return
+			}
+			if len(ids) == 1 && ids[0] == id {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if err := p.Vote(ctx, id, commit); err != nil {
+			t.Errorf("Vote() error = %v", err)
+		}
+
+		d, err := p.Await(ctx, id)
+		if err != nil {
+			t.Errorf("Await() error = %v", err)
+		}
+
+		if err := p.Ack(ctx, id); err != nil {
+			t.Errorf("Ack() error = %v", err)
+		}
+		decided <- d
+	}()
+
+	return decided
+}
+
+func TestTwoPhaseCommit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	svcs := make(map[string]*Service)
+	for _, name := range []string{"orders", "billing", "ledger"} {
+		svc, err := NewService(Name(name), LocalBackend(dir))
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		defer svc.Close()
+		svcs[name] = svc
+	}
+
+	co := NewCoordinator(svcs["orders"], CoordinatorWithTimeout(2*time.Second))
+	billing := NewParticipant(svcs["billing"], "billing")
+	ledger := NewParticipant(svcs["ledger"], "ledger")
+
+	b, l := participate(ctx, t, billing, "move-1", true), participate(ctx, t, ledger, "move-1", true)
+	if d, err := co.Propose(ctx, "move-1", []string{"billing", "ledger"}); d != DecisionCommit || err != nil {
+		t.Fatalf("Propose() = %v, %v, want commit", d, err)
+	}
+	if <-b != DecisionCommit || <-l != DecisionCommit {
+		t.Errorf("participants did not get the commit")
+	}
+
+	resp, _ := svcs["orders"].etcd.Get(ctx, "/transaction/move-1/", clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if resp.Count != 0 {
+		t.Errorf("%d keys of an acked transaction are left", resp.Count)
+	}
+
+	// ledger votes to abort once billing voted, so billing gets to vote before the decision
+	b = participate(ctx, t, billing, "move-2", true)
+	aborted := make(chan (<-chan Decision), 1)
+	go func() {
+		svcs["ledger"].WaitForKey(ctx, "/transaction/move-2/vote/billing")
+		aborted <- participate(ctx, t, ledger, "move-2", false)
+	}()
+	if d, err := co.Propose(ctx, "move-2", []string{"billing", "ledger"}); d != DecisionAbort || err != nil {
+		t.Fatalf("Propose() = %v, %v, want abort", d, err)
+	}
+	if <-b != DecisionAbort || <-<-aborted != DecisionAbort {
+		t.Errorf("participants did not get the abort")
+	}
+
+	// ledger never votes
+	co = NewCoordinator(svcs["orders"], CoordinatorWithTimeout(100*time.Millisecond))
+	if d, err := co.Propose(ctx, "move-3", []string{"billing", "ledger"}); d != DecisionAbort || !errors.Is(err, ErrTransactionTimeout) {
+		t.Fatalf("Propose() = %v, %v, want abort on %v", d, err, ErrTransactionTimeout)
+	}
+	if err := ledger.Vote(ctx, "move-3", true); !errors.Is(err, ErrTransactionDecided) {
+		t.Errorf("Vote() after the timeout error = %v, want %v", err, ErrTransactionDecided)
+	}
+	if d, err := ledger.Await(ctx, "move-3"); d != DecisionAbort || err != nil {
+		t.Errorf("Await() = %v, %v, want abort", d, err)
+	}
+	if _, err := co.Propose(ctx, "move-3", []string{"billing"}); !errors.Is(err, ErrTransactionExists) {
+		t.Errorf("Propose() of an existing transaction error = %v, want %v", err, ErrTransactionExists)
+	}
+
+	if d, err := co.Abort(ctx, "move-3"); d != DecisionAbort || err != nil {
+		t.Errorf("Abort() = %v, %v", d, err)
+	}
+	if _, err := co.Abort(ctx, "move-4"); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("Abort() of a missing transaction error = %v, want %v", err, ErrTransactionNotFound)
+	}
+	if err := NewParticipant(svcs["ledger"], "audit").Vote(ctx, "move-3", true); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("Vote() of a stranger error = %v, want %v", err, ErrTransactionNotFound)
+	}
+}
+
+func TestProposeInvalid(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("orders"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	many := make([]string, maxTxnOps)
+	for n := range many {
+		many[n] = fmt.Sprintf("p%d", n)
+	}
+
+	co := NewCoordinator(svc, CoordinatorWithTimeout(100*time.Millisecond))
+	tests := []struct {
+		name         string
+		id           string
+		participants []string
+		want         error
+	}{
+		{"no participants", "move-1", nil, ErrEmptyValue},
+		{"slash in id", "move/1", []string{"billing"}, ErrInvalidTransaction},
+		{"empty id", "", []string{"billing"}, ErrInvalidTransaction},
+		{"slash in participant", "move-1", []string{"billing/eu"}, ErrInvalidTransaction},
+		{"empty participant", "move-1", []string{"billing", ""}, ErrInvalidTransaction},
+		{"too many participants", "move-1", many, ErrTooManyParticipants},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := co.Propose(ctx, tt.id, tt.participants); !errors.Is(err, tt.want) {
+				t.Errorf("Propose() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	resp, _ := svc.etcd.Get(ctx, svc.options.transactionsPrefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if resp.Count != 0 {
+		t.Errorf("%d keys of refused transactions were written", resp.Count)
+	}
+
+	// the largest accepted transaction, a participant listed twice counts once
+	if d, err := co.Propose(ctx, "move-2", append(many[1:], "p1")); d != DecisionAbort || !errors.Is(err, ErrTransactionTimeout) {
+		t.Errorf("Propose() of %d participants = %v, %v, want abort on %v", maxTxnOps-1, d, err, ErrTransactionTimeout)
+	}
+}
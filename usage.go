@@ -0,0 +1,95 @@
+package svcutil
+
+import (
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// PrefixUsage summarizes the keys stored under a prefix
+type PrefixUsage struct {
+	Prefix string
+	Keys   int64
+	// Bytes is the total size of keys and values
+	Bytes int64
+	// Unleased is the number of keys of this service which are always attached to a
+	// lease but are not (see GC), such keys are leaked by crashed instances
+	Unleased int64
+}
+
+// add counts the key, leased tells whether the key has to be attached to a lease
+func (u *PrefixUsage) add(kv KeyValue, leased bool) {
+	u.Keys++
+	u.Bytes += int64(len(kv.Key) + len(kv.Value))
+	if leased && kv.Lease == 0 {
+		u.Unleased++
+	}
+}
+
+// UsageReport summarizes the keys stored by svcutil, for capacity planning
+type UsageReport struct {
+	Locks         PrefixUsage
+	IDs           PrefixUsage
+	Config        PrefixUsage
+	ConfigHistory PrefixUsage
+	Hosts         PrefixUsage
+}
+
+// UsageReport counts keys and their sizes under the locks, config, config history and
+// hosts root prefixes shared by all services and under the ID range of this service.
+// Every key is counted once: keys of the ID range are not counted in Locks, nor keys of
+// any other prefix nested in a reported one. Keys are read page by page, so large
+// namespaces are never loaded at once.
+func (c *Service) UsageReport(ctx context.Context) (UsageReport, error) {
+	report := UsageReport{
+		Locks:         PrefixUsage{Prefix: c.options.locksPrefix},
+		IDs:           PrefixUsage{Prefix: c.rangeKeyPrefix(RangeTypeID)},
+		Config:        PrefixUsage{Prefix: c.options.configPrefix},
+		ConfigHistory: PrefixUsage{Prefix: c.options.configHistoryPrefix},
+		Hosts:         PrefixUsage{Prefix: c.options.hostConfigPrefix},
+	}
+
+	usages := []*PrefixUsage{&report.Locks, &report.IDs, &report.Config, &report.ConfigHistory, &report.Hosts}
+	leased := c.gcPrefixes()
+
+	for _, u := range usages {
+		nested := nestedPrefixes(u, usages)
+
+		err := c.WalkKeys(ctx, u.Prefix, ListOptions{}, func(kv KeyValue) error {
+			if hasAnyPrefix(kv.Key, nested) {
+				// counted by the nested prefix
+				return nil
+			}
+
+			u.add(kv, hasAnyPrefix(kv.Key, leased))
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// nestedPrefixes returns the prefixes of the other usages nested in the prefix of u
+func nestedPrefixes(u *PrefixUsage, usages []*PrefixUsage) []string {
+	var nested []string
+	for _, other := range usages {
+		if other != u && len(other.Prefix) > len(u.Prefix) && strings.HasPrefix(other.Prefix, u.Prefix) {
+			nested = append(nested, other.Prefix)
+		}
+	}
+
+	return nested
+}
+
+func hasAnyPrefix(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
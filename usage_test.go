@@ -0,0 +1,72 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestPrefixUsage(t *testing.T) {
+	var u PrefixUsage
+	u.add(KeyValue{Key: "/lock/a", Value: []byte("holder"), Lease: 1}, true)
+	u.add(KeyValue{Key: "/lock/b", Value: []byte("x")}, true)
+	u.add(KeyValue{Key: "/lock/c"}, false)
+
+	want := PrefixUsage{Keys: 3, Bytes: 7 + 6 + 7 + 1 + 7, Unleased: 1}
+	if u != want {
+		t.Errorf("PrefixUsage = %+v, want %+v", u, want)
+	}
+}
+
+func TestUsageReport(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("api"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	r, _ := NewIDRange("1-3")
+	l := NewLeaseWithOptions(r, svc)
+	defer l.Close()
+	if _, err := l.Obtain(ctx); err != nil {
+		t.Fatalf("Obtain() error = %v", err)
+	}
+
+	// a value left by a crashed instance and a reservation, which has no lease by design
+	if _, err := svc.etcd.Put(ctx, l.keyPrefix()+"leaked", "crashed"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	reserved, _ := NewIDRange("3")
+	if err := svc.ReserveIDs(ctx, reserved, "maintenance", 0); err != nil {
+		t.Fatalf("ReserveIDs() error = %v", err)
+	}
+
+	report, err := svc.UsageReport(ctx)
+	if err != nil {
+		t.Fatalf("UsageReport() error = %v", err)
+	}
+
+	if report.IDs.Keys != 2 || report.IDs.Unleased != 1 {
+		t.Errorf("IDs usage = %+v, want 2 keys with 1 unleased", report.IDs)
+	}
+	if report.Locks.Unleased != 0 {
+		t.Errorf("Locks usage = %+v, want the reservation not reported as unleased", report.Locks)
+	}
+
+	// keys of the ID range are not counted again under the locks prefix
+	var locks int64
+	err = svc.WalkKeys(ctx, svc.options.locksPrefix, ListOptions{KeysOnly: true}, func(KeyValue) error {
+		locks++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkKeys() error = %v", err)
+	}
+	if report.Locks.Keys+report.IDs.Keys != locks {
+		t.Errorf("Locks %d + IDs %d keys, want %d keys under the locks prefix", report.Locks.Keys, report.IDs.Keys, locks)
+	}
+}
@@ -1,6 +1,9 @@
 package svcutil
 
-import "reflect"
+import (
+	"reflect"
+	"strings"
+)
 
 func getJSONTags(v any) map[string]string {
 	tags := make(map[string]string)
@@ -24,3 +27,35 @@ func getJSONTags(v any) map[string]string {
 
 	return tags
 }
+
+// getConfigKeys maps struct fields to their configuration keys, an etcd tag overrides
+// the key derived from the json tag
+func getConfigKeys(v any) map[string]string {
+	keys := getJSONTags(v)
+	if keys == nil {
+		return nil
+	}
+
+	val := reflect.TypeOf(v)
+	if val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Field(i)
+		if etcdTag := field.Tag.Get("etcd"); etcdTag != "" {
+			keys[field.Name] = etcdTag
+		}
+	}
+
+	return keys
+}
+
+// configKey resolves a configuration key against the path, absolute keys are used as is
+func configKey(path, key string) string {
+	if strings.HasPrefix(key, "/") {
+		return key
+	}
+
+	return path + key
+}
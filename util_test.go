@@ -90,3 +90,41 @@ func TestGetJSONTags(t *testing.T) {
 		})
 	}
 }
+
+func TestGetConfigKeys(t *testing.T) {
+	type Legacy struct {
+		Name    string `json:"name"`
+		Port    int    `json:"port" etcd:"listen/port"`
+		Secret  string `etcd:"/shared/secret"`
+		Ignored bool
+	}
+
+	expected := map[string]string{
+		"Name":   "name",
+		"Port":   "listen/port",
+		"Secret": "/shared/secret",
+	}
+	if got := getConfigKeys(&Legacy{}); !reflect.DeepEqual(got, expected) {
+		t.Errorf("getConfigKeys() = %v, want %v", got, expected)
+	}
+
+	if got := getConfigKeys(42); got != nil {
+		t.Errorf("getConfigKeys() = %v, want nil", got)
+	}
+}
+
+func TestConfigKey(t *testing.T) {
+	tests := []struct {
+		path, key, want string
+	}{
+		{path: "/config/svc/", key: "name", want: "/config/svc/name"},
+		{path: "/config/svc/", key: "listen/port", want: "/config/svc/listen/port"},
+		{path: "/config/svc/", key: "/shared/secret", want: "/shared/secret"},
+	}
+
+	for _, tt := range tests {
+		if got := configKey(tt.path, tt.key); got != tt.want {
+			t.Errorf("configKey(%q, %q) = %q, want %q", tt.path, tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package svcutil
+
+import (
+	"bytes"
+
+	"golang.org/x/net/context"
+)
+
+// WaitForKey blocks until the key exists and returns its value. The key is watched, a
+// key that already exists is returned right away.
+func (c *Service) WaitForKey(ctx context.Context, key string) ([]byte, error) {
+	return c.waitForKey(ctx, key, func([]byte) bool { return true })
+}
+
+// WaitForValue blocks until the key holds the expected value, e.g. a migration step
+// waiting for "/migrations/v42" to become "done"
+func (c *Service) WaitForValue(ctx context.Context, key, expected string) error {
+	_, err := c.waitForKey(ctx, key, func(value []byte) bool {
+		return bytes.Equal(value, []byte(expected))
+	})
+
+	return err
+}
+
+// waitForKey reads the key and watches it until it exists with a value accepted by match
+func (c *Service) waitForKey(ctx context.Context, key string, match func([]byte) bool) ([]byte, error) {
+	closed := 0
+
+	for {
+		resp, err := c.etcd.Get(ctx, key)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, etcdError(err)
+		}
+
+		if len(resp.Kvs) > 0 && match(resp.Kvs[0].Value) {
+			return resp.Kvs[0].Value, nil
+		}
+
+		if err := c.retryWatch(ctx, c.waitChange(ctx, key, resp.Header.Revision), &closed); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package svcutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestWaitForKey(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("migrate"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	found := make(chan string, 1)
+	go func() {
+		value, err := svc.WaitForKey(ctx, "/migrations/v42")
+		if err != nil {
+			t.Errorf("WaitForKey() error = %v", err)
+		}
+		found <- string(value)
+	}()
+
+	done := make(chan error, 1)
+	go func() { done <- svc.WaitForValue(ctx, "/migrations/v42", "done") }()
+
+	time.Sleep(50 * time.Millisecond)
+	for _, value := range []string{"running", "failed", "done"} {
+		if _, err := svc.etcd.Put(ctx, "/migrations/v42", value); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	if value := <-found; value == "" {
+		t.Errorf("WaitForKey() returned an empty value")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("WaitForValue() error = %v", err)
+	}
+
+	// an existing value returns right away
+	if err := svc.WaitForValue(ctx, "/migrations/v42", "done"); err != nil {
+		t.Errorf("WaitForValue() of the current value error = %v", err)
+	}
+
+	short, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	if err := svc.WaitForValue(short, "/migrations/v42", "running"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitForValue() of an old value error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,141 @@
+package svcutil
+
+import (
+	"fmt"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/context"
+)
+
+// WaitFair waits for a value to become available like Wait, but waiting instances
+// line up in an etcd queue of ephemeral keys ordered by creation revision and only
+// the head of the queue attempts to obtain a value, so values are granted FIFO.
+// Plain Obtain and Wait callers do not participate in the queue.
+func (i *Lease) WaitFair(ctx context.Context) (string, error) {
+	ctx, span := i.client.startSpan(ctx, "Lease.WaitFair", attribute.String("svcutil.key", i.keyPrefix()))
+	id, err := i.waitFair(ctx)
+	endSpan(span, err)
+
+	return id, err
+}
+
+func (i *Lease) waitFair(ctx context.Context) (string, error) {
+	queuePrefix := i.client.shadowKey(i.client.options.waitersPrefix, i.keyPrefix())
+
+	var (
+		grant           clientv3.LeaseID
+		keepAliveCancel context.CancelFunc
+		myKey           string
+	)
+
+	leave := func() {
+		if grant == 0 {
+			return
+		}
+
+		keepAliveCancel()
+		rctx, cancel := context.WithTimeout(context.Background(), i.client.options.etcdDialTimeout)
+		defer cancel()
+		i.client.etcd.Revoke(rctx, grant)
+		grant = 0
+	}
+	defer leave()
+
+	// enqueue lines up at the tail of the queue under a new lease, the key of a lease which
+	// expired, e.g. while etcd was unreachable, is gone together with it and can't be put again
+	enqueue := func() error {
+		leave()
+
+		resp, err := i.client.etcd.Grant(ctx, int64(i.ttl()))
+		if err != nil {
+			return err
+		}
+
+		keepAliveContext, cancel := context.WithCancel(context.Background())
+		grant, keepAliveCancel = resp.ID, cancel
+
+		kl, err := i.client.etcd.KeepAlive(keepAliveContext, grant)
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			for range kl {
+			}
+		}()
+
+		myKey = fmt.Sprintf("%s%016x", queuePrefix, int64(grant))
+		_, err = i.client.etcd.Put(ctx, myKey, i.client.options.instance, clientv3.WithLease(grant))
+		return err
+	}
+
+	if err := enqueue(); err != nil {
+		return "", err
+	}
+
+	attempt := 0
+	var started time.Time
+
+	for {
+		queue, err := i.client.etcd.Get(ctx, queuePrefix, clientv3.WithPrefix(), clientv3.WithKeysOnly(),
+			clientv3.WithSort(clientv3.SortByCreateRevision, clientv3.SortAscend))
+		if err != nil {
+			return "", err
+		}
+
+		queued := false
+		for _, kv := range queue.Kvs {
+			if string(kv.Key) == myKey {
+				queued = true
+				break
+			}
+		}
+
+		if !queued {
+			// our waiter key is gone together with its lease, line up again at the tail
+			if err := enqueue(); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		head := string(queue.Kvs[0].Key) == myKey
+		if head {
+			attempt++
+			started = time.Now()
+
+			id, err := i.obtain(ctx)
+			if err == nil {
+				return id, nil
+			}
+
+			if err != ErrNoAvailableIDs {
+				return "", err
+			}
+		}
+
+		wctx, cancel := context.WithCancel(ctx)
+		rev := clientv3.WithRev(queue.Header.Revision + 1)
+		valuesChan := i.client.etcd.Watch(wctx, i.keyPrefix(), clientv3.WithPrefix(), rev)
+		queueChan := i.client.etcd.Watch(wctx, queuePrefix, clientv3.WithPrefix(), rev)
+
+		select {
+		case <-valuesChan:
+		case <-queueChan:
+		case <-time.After(i.client.options.retryInterval):
+		case <-ctx.Done():
+			cancel()
+			return "", ctx.Err()
+		}
+
+		cancel()
+
+		if head {
+			if err := i.sleepBackoff(ctx, attempt, started); err != nil {
+				return "", err
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// waitQueued waits until the queue of the lease has n waiters and returns their keys
+// oldest first
+func waitQueued(ctx context.Context, t *testing.T, l *Lease, n int) []*mvccpb.KeyValue {
+	t.Helper()
+
+	queuePrefix := l.client.shadowKey(l.client.options.waitersPrefix, l.keyPrefix())
+	for {
+		resp, err := l.client.etcd.Get(ctx, queuePrefix, clientv3.WithPrefix(),
+			clientv3.WithSort(clientv3.SortByCreateRevision, clientv3.SortAscend))
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if len(resp.Kvs) == n {
+			return resp.Kvs
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("%d waiters queued, want %d", len(resp.Kvs), n)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
+
+func TestWaitFairOrder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	newService := func(instance string) *Service {
+		svc, err := NewService(Name("api"), Instance(instance), LocalBackend(dir), RetryInterval(50*time.Millisecond))
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		t.Cleanup(svc.Close)
+		return svc
+	}
+
+	r, _ := NewIDRange("1")
+	holder := NewLeaseWithOptions(r, newService("holder"))
+	if _, err := holder.Obtain(ctx); err != nil {
+		t.Fatalf("Obtain() error = %v", err)
+	}
+
+	granted := make(chan string, 2)
+	var waiters []*Lease
+	for n, instance := range []string{"first", "second"} {
+		l := NewLeaseWithOptions(r, newService(instance))
+		t.Cleanup(l.Close)
+		waiters = append(waiters, l)
+
+		go func() {
+			if _, err := l.WaitFair(ctx); err != nil {
+				t.Errorf("WaitFair() of %s error = %v", instance, err)
+				return
+			}
+			granted <- instance
+		}()
+
+		waitQueued(ctx, t, l, n+1)
+	}
+
+	holder.Close()
+	if got := <-granted; got != "first" {
+		t.Fatalf("value granted to %s, want the first waiter", got)
+	}
+
+	waiters[0].Close()
+	if got := <-granted; got != "second" {
+		t.Fatalf("value granted to %s, want the second waiter", got)
+	}
+}
+
+func TestWaitFairLeaseExpired(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("api"), LocalBackend(t.TempDir()), RetryInterval(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	r, _ := NewIDRange("1")
+	holder := NewLeaseWithOptions(r, svc)
+	if _, err := holder.Obtain(ctx); err != nil {
+		t.Fatalf("Obtain() error = %v", err)
+	}
+
+	l := NewLeaseWithOptions(r, svc)
+	defer l.Close()
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := l.WaitFair(ctx)
+		result <- err
+	}()
+
+	// the waiter key goes away with its lease, the waiter lines up again under a new one
+	lost := waitQueued(ctx, t, l, 1)[0]
+	if _, err := svc.etcd.Revoke(ctx, clientv3.LeaseID(lost.Lease)); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+
+	for waitQueued(ctx, t, l, 1)[0].Lease == lost.Lease {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	holder.Close()
+	if err := <-result; err != nil {
+		t.Errorf("WaitFair() error = %v", err)
+	}
+	if l.Value() != "1" {
+		t.Errorf("Value() = %q, want 1", l.Value())
+	}
+}
@@ -0,0 +1,159 @@
+package svcutil
+
+import (
+	"errors"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// watchRetryBackoff is the delay before re-establishing a watch which failed or closed
+// the given number of times in a row, a watch failing at once must not spin
+var watchRetryBackoff = ExponentialBackoff(50*time.Millisecond, 5*time.Second)
+
+// sleepWatchRetry waits before the attempt to re-establish a watch, it returns false
+// if done is closed or the service is closed meanwhile
+func (c *Service) sleepWatchRetry(done <-chan struct{}, attempt int) bool {
+	t := time.NewTimer(watchRetryBackoff(attempt))
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-done:
+		return false
+	case <-c.stopper:
+		return false
+	}
+}
+
+// errWatchClosed means a watch failed or closed before a change was seen, the state has
+// to be read again
+var errWatchClosed = errors.New("watch closed")
+
+// retryWatch handles the result of waitChange or waitKeysChange: after a closed watch it
+// waits with a backoff growing with the closures in a row counted in closed, so a watch
+// closing at once doesn't spin, and returns nil to read the state again. Other errors are
+// returned as they are.
+func (c *Service) retryWatch(ctx context.Context, err error, closed *int) error {
+	if err == nil {
+		*closed = 0
+		return nil
+	}
+
+	if err != errWatchClosed {
+		return err
+	}
+
+	*closed++
+	if !c.sleepWatchRetry(ctx.Done(), *closed) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return context.Canceled
+	}
+
+	return nil
+}
+
+type watchOutcome int
+
+const (
+	// watchIdle means nothing was released, keep watching
+	watchIdle watchOutcome = iota
+	// watchWake means a value might have become available
+	watchWake
+	// watchRestart means the watch is gone and has to be re-established after a backoff
+	watchRestart
+)
+
+func classifyWatchResponse(resp clientv3.WatchResponse, ok bool) watchOutcome {
+	switch {
+	case !ok:
+		// closed channel without a cancel response, re-established after a backoff so a
+		// watch closing at once doesn't spin
+		return watchRestart
+	case resp.CompactRevision != 0:
+		// events we waited for may have been compacted away
+		return watchWake
+	case resp.Err() != nil:
+		return watchRestart
+	}
+
+	for _, ev := range resp.Events {
+		if ev.Type == clientv3.EventTypeDelete {
+			return watchWake
+		}
+	}
+
+	return watchIdle
+}
+
+// waitRelease blocks until a value, a reservation or a takeover tombstone of the range is
+// deleted after the given revision, the retry interval passes or the context is done
+func (i *Lease) waitRelease(ctx context.Context, rev int64) error {
+	timeout := time.NewTimer(i.client.options.retryInterval)
+	defer timeout.Stop()
+
+	prefix := i.keyPrefix()
+	reservationsPrefix := i.client.shadowKey(i.client.options.reservationsPrefix, prefix)
+
+	for failures := 1; ; failures++ {
+		wctx, cancel := context.WithCancel(ctx)
+		opts := []clientv3.OpOption{clientv3.WithPrefix(), clientv3.WithFilterPut()}
+		if rev > 0 {
+			opts = append(opts, clientv3.WithRev(rev))
+		}
+
+		valuesChan := i.client.etcd.Watch(wctx, prefix, opts...)
+		reservationsChan := i.client.etcd.Watch(wctx, reservationsPrefix, opts...)
+
+		// with a takeover delay a value only becomes free once its tombstone expires
+		var tombstonesChan clientv3.WatchChan
+		if i.client.options.takeoverDelay > 0 {
+			tombstonesChan = i.client.etcd.Watch(wctx, i.client.shadowKey(i.client.options.tombstonesPrefix, prefix), opts...)
+		}
+
+		outcome := watchIdle
+		for outcome == watchIdle {
+			var resp clientv3.WatchResponse
+			var ok bool
+
+			select {
+			case resp, ok = <-valuesChan:
+			case resp, ok = <-reservationsChan:
+			case resp, ok = <-tombstonesChan:
+			case <-timeout.C:
+				cancel()
+				return nil
+			case <-ctx.Done():
+				cancel()
+				return ctx.Err()
+			}
+
+			outcome = classifyWatchResponse(resp, ok)
+		}
+
+		cancel()
+
+		if outcome == watchWake {
+			return nil
+		}
+
+		backoff := time.NewTimer(watchRetryBackoff(failures))
+		select {
+		case <-backoff.C:
+		case <-timeout.C:
+			backoff.Stop()
+			return nil
+		case <-ctx.Done():
+			backoff.Stop()
+			return ctx.Err()
+		case <-i.client.stopper:
+			// the client is closing, let the next attempt surface the error
+			backoff.Stop()
+			return nil
+		}
+	}
+}
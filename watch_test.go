@@ -0,0 +1,35 @@
+package svcutil
+
+import (
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestClassifyWatchResponse(t *testing.T) {
+	put := &clientv3.Event{Type: mvccpb.PUT}
+	del := &clientv3.Event{Type: mvccpb.DELETE}
+
+	tests := []struct {
+		name string
+		resp clientv3.WatchResponse
+		ok   bool
+		want watchOutcome
+	}{
+		{name: "closed", ok: false, want: watchRestart},
+		{name: "compacted", resp: clientv3.WatchResponse{CompactRevision: 10}, ok: true, want: watchWake},
+		{name: "canceled", resp: clientv3.WatchResponse{Canceled: true}, ok: true, want: watchRestart},
+		{name: "created", resp: clientv3.WatchResponse{Created: true}, ok: true, want: watchIdle},
+		{name: "puts only", resp: clientv3.WatchResponse{Events: []*clientv3.Event{put, put}}, ok: true, want: watchIdle},
+		{name: "delete", resp: clientv3.WatchResponse{Events: []*clientv3.Event{put, del}}, ok: true, want: watchWake},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyWatchResponse(tt.resp, tt.ok); got != tt.want {
+				t.Errorf("classifyWatchResponse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package svcutil
+
+import (
+	"os"
+	"time"
+)
+
+// SessionLossAction is run by the watchdog of SessionLossPolicy
+type SessionLossAction func()
+
+// SessionLossCallback runs fn once the session stays lost for too long
+func SessionLossCallback(fn func()) SessionLossAction {
+	return fn
+}
+
+// SessionLossShutdown shuts the process context down once the session stays lost for too long
+func SessionLossShutdown(pc *ProcessContext) SessionLossAction {
+	return pc.Shutdown
+}
+
+// SessionLossExit exits the process with the code once the session stays lost for too long
+func SessionLossExit(code int) SessionLossAction {
+	return func() {
+		os.Exit(code)
+	}
+}
+
+// armSessionWatchdog starts the watchdog of SessionLossPolicy when the session is lost or
+// the service starts in degraded mode, the returned function stops it once the session is
+// restored or the service is closed
+func (c *Service) armSessionWatchdog() func() {
+	if c.options.sessionLossAction == nil || c.options.sessionLossMax <= 0 {
+		return func() {}
+	}
+
+	t := time.AfterFunc(c.options.sessionLossMax, c.options.sessionLossAction)
+	return func() {
+		t.Stop()
+	}
+}
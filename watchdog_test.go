@@ -0,0 +1,34 @@
+package svcutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionWatchdog(t *testing.T) {
+	pc := NewProcessContext()
+	c := &Service{options: SessionLossPolicy(20*time.Millisecond, SessionLossShutdown(pc))(NewOptions())}
+
+	disarm := c.armSessionWatchdog()
+	defer disarm()
+
+	select {
+	case <-pc.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("process context is not shut down after the session stayed lost")
+	}
+
+	fired := make(chan struct{}, 1)
+	c = &Service{options: SessionLossPolicy(50*time.Millisecond, SessionLossCallback(func() { fired <- struct{}{} }))(NewOptions())}
+
+	c.armSessionWatchdog()()
+
+	select {
+	case <-fired:
+		t.Errorf("callback ran after the session was restored")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// without a policy the watchdog does nothing
+	(&Service{options: NewOptions()}).armSessionWatchdog()()
+}
@@ -0,0 +1,131 @@
+package svcutil
+
+import (
+	"errors"
+	"sync/atomic"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// watchPool spreads watches over several etcd clients, so a single connection does not
+// multiplex hundreds of watch streams. It replaces the Watcher of the etcd client, so
+// watches made by sessions and leases are distributed as well. A watch whose client
+// fails is transparently moved to another client and resumed after the last delivered
+// revision.
+type watchPool struct {
+	watchers []clientv3.Watcher
+	active   []atomic.Int64
+	// clients are the additional clients owned by the pool
+	clients []*clientv3.Client
+	closed  atomic.Bool
+}
+
+func newWatchPool(main clientv3.Watcher, clients []*clientv3.Client) *watchPool {
+	watchers := []clientv3.Watcher{main}
+	for _, cli := range clients {
+		watchers = append(watchers, cli.Watcher)
+	}
+
+	return &watchPool{
+		watchers: watchers,
+		active:   make([]atomic.Int64, len(watchers)),
+		clients:  clients,
+	}
+}
+
+// pick returns the watcher with the fewest active watches, skipping the excluded one
+// unless it is the only watcher
+func (p *watchPool) pick(exclude int) int {
+	best := -1
+	for n := range p.watchers {
+		if n == exclude && len(p.watchers) > 1 {
+			continue
+		}
+
+		if best < 0 || p.active[n].Load() < p.active[best].Load() {
+			best = n
+		}
+	}
+
+	return best
+}
+
+func (p *watchPool) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	out := make(chan clientv3.WatchResponse)
+	go p.forward(ctx, key, opts, out)
+
+	return out
+}
+
+func (p *watchPool) forward(ctx context.Context, key string, opts []clientv3.OpOption, out chan<- clientv3.WatchResponse) {
+	defer close(out)
+
+	n := p.pick(-1)
+	var rev int64
+	failed := 0
+
+	for {
+		wopts := opts
+		if rev > 0 {
+			wopts = append(opts[:len(opts):len(opts)], clientv3.WithRev(rev+1))
+		}
+
+		p.active[n].Add(1)
+		wctx, cancel := context.WithCancel(ctx)
+		canceled := false
+		delivered := false
+
+		for resp := range p.watchers[n].Watch(wctx, key, wopts...) {
+			delivered = true
+			if len(resp.Events) > 0 {
+				rev = resp.Events[len(resp.Events)-1].Kv.ModRevision
+			}
+			canceled = canceled || resp.Canceled
+
+			select {
+			case out <- resp:
+			case <-ctx.Done():
+			}
+		}
+
+		cancel()
+		p.active[n].Add(-1)
+
+		// a watch canceled by the server (e.g. compacted) is reported to the caller as is
+		if ctx.Err() != nil || canceled || p.closed.Load() {
+			return
+		}
+
+		// give up once every client failed in a row, the caller sees a closed channel
+		if delivered {
+			failed = 0
+		}
+		failed++
+		if failed >= len(p.watchers) {
+			return
+		}
+
+		n = p.pick(n)
+	}
+}
+
+func (p *watchPool) RequestProgress(ctx context.Context) error {
+	var errs []error
+	for _, w := range p.watchers {
+		errs = append(errs, w.RequestProgress(ctx))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (p *watchPool) Close() error {
+	p.closed.Store(true)
+
+	errs := []error{p.watchers[0].Close()}
+	for _, cli := range p.clients {
+		errs = append(errs, cli.Close())
+	}
+
+	return errors.Join(errs...)
+}
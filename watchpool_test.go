@@ -0,0 +1,107 @@
+package svcutil
+
+import (
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// scriptedWatcher replays the given responses on the first watch and closes the channel,
+// later watches are closed immediately as if the client failed
+type scriptedWatcher struct {
+	responses []clientv3.WatchResponse
+	watches   int
+}
+
+func (w *scriptedWatcher) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	w.watches++
+	ch := make(chan clientv3.WatchResponse, len(w.responses))
+	if w.watches == 1 {
+		for _, resp := range w.responses {
+			ch <- resp
+		}
+	}
+	close(ch)
+
+	return ch
+}
+
+func (w *scriptedWatcher) RequestProgress(ctx context.Context) error { return nil }
+func (w *scriptedWatcher) Close() error                              { return nil }
+
+func putResponse(rev int64) clientv3.WatchResponse {
+	return clientv3.WatchResponse{Events: []*clientv3.Event{{Type: clientv3.EventTypePut, Kv: &mvccpb.KeyValue{ModRevision: rev}}}}
+}
+
+func TestWatchPoolPick(t *testing.T) {
+	p := &watchPool{
+		watchers: make([]clientv3.Watcher, 3),
+		active:   make([]atomic.Int64, 3),
+	}
+	p.active[0].Store(2)
+	p.active[1].Store(1)
+	p.active[2].Store(1)
+
+	if got := p.pick(-1); got != 1 {
+		t.Errorf("pick(-1) = %d, want 1", got)
+	}
+
+	if got := p.pick(1); got != 2 {
+		t.Errorf("pick(1) = %d, want 2", got)
+	}
+
+	single := &watchPool{watchers: make([]clientv3.Watcher, 1), active: make([]atomic.Int64, 1)}
+	if got := single.pick(0); got != 0 {
+		t.Errorf("pick(0) of a single watcher = %d, want 0", got)
+	}
+}
+
+func TestWatchPoolFailover(t *testing.T) {
+	first := &scriptedWatcher{responses: []clientv3.WatchResponse{putResponse(10), putResponse(11)}}
+	second := &scriptedWatcher{responses: []clientv3.WatchResponse{putResponse(12)}}
+	p := &watchPool{
+		watchers: []clientv3.Watcher{first, second},
+		active:   make([]atomic.Int64, 2),
+	}
+
+	var revs []int64
+	for resp := range p.Watch(context.Background(), "key") {
+		for _, ev := range resp.Events {
+			revs = append(revs, ev.Kv.ModRevision)
+		}
+	}
+
+	if !reflect.DeepEqual(revs, []int64{10, 11, 12}) {
+		t.Errorf("forwarded revisions = %v, want [10 11 12]", revs)
+	}
+
+	// the watch moved to the second watcher and gave up once both failed in a row
+	if first.watches != 2 || second.watches != 1 {
+		t.Errorf("watches = %d, %d, want 2, 1", first.watches, second.watches)
+	}
+}
+
+func TestWatchPoolCanceled(t *testing.T) {
+	first := &scriptedWatcher{responses: []clientv3.WatchResponse{{Canceled: true, CompactRevision: 5}}}
+	second := &scriptedWatcher{}
+	p := &watchPool{
+		watchers: []clientv3.Watcher{first, second},
+		active:   make([]atomic.Int64, 2),
+	}
+
+	n := 0
+	for resp := range p.Watch(context.Background(), "key") {
+		if !resp.Canceled {
+			t.Errorf("unexpected response %+v", resp)
+		}
+		n++
+	}
+
+	if n != 1 || second.watches != 0 {
+		t.Errorf("responses = %d, second watches = %d, want the cancellation forwarded without failover", n, second.watches)
+	}
+}
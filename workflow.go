@@ -0,0 +1,237 @@
+package svcutil
+
+import (
+	"encoding/json"
+	"errors"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+var ErrWorkflowCompensated = errors.New("workflow failed and was compensated")
+var ErrWorkflowChanged = errors.New("workflow steps changed since the checkpoint")
+
+// states of a workflow checkpoint
+const (
+	workflowRunning      = "running"
+	workflowCompensating = "compensating"
+	workflowCompensated  = "compensated"
+	workflowDone         = "done"
+)
+
+// WorkflowStep is a named step of a Workflow. Compensate undoes a completed step once a
+// later step fails, it may be nil for steps with nothing to undo. Both may run again
+// after a crash, so they should be idempotent.
+type WorkflowStep struct {
+	Name       string
+	Run        func(ctx context.Context) error
+	Compensate func(ctx context.Context) error
+}
+
+// workflowCheckpoint is the progress of a workflow stored in etcd
+type workflowCheckpoint struct {
+	State     string   `json:"state"`
+	Completed []string `json:"completed"`
+	Failed    string   `json:"failed,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+type workflowOptions struct {
+	lease *Lease
+}
+
+// WorkflowOption customizes a Workflow
+type WorkflowOption func(*workflowOptions) *workflowOptions
+
+// WorkflowWithLease ties the workflow to the value obtained by the lease: the checkpoint
+// is kept per value, so the successor obtaining the value of a crashed instance resumes
+// its workflow, and checkpoints are written only while the lease holds the value
+func WorkflowWithLease(l *Lease) WorkflowOption {
+	return func(o *workflowOptions) *workflowOptions {
+		o.lease = l
+		return o
+	}
+}
+
+// Workflow runs named steps in order and checkpoints its progress in etcd after every
+// step, so a run interrupted by a crash resumes from the last completed step. If a step
+// fails, the completed steps are compensated in reverse order (a saga).
+type Workflow struct {
+	client  *Service
+	name    string
+	steps   []WorkflowStep
+	options *workflowOptions
+}
+
+// NewWorkflow creates a workflow of the steps, the name identifies its checkpoint
+func NewWorkflow(svc *Service, name string, steps []WorkflowStep, opts ...WorkflowOption) *Workflow {
+	o := &workflowOptions{}
+	for _, decorator := range opts {
+		o = decorator(o)
+	}
+
+	return &Workflow{
+		client:  svc,
+		name:    name,
+		steps:   steps,
+		options: o,
+	}
+}
+
+func (w *Workflow) key() string {
+	key := w.client.options.locksPrefix + w.client.options.serviceName + w.client.options.workflowsPrefix + w.name
+	if w.options.lease != nil {
+		key += "/" + w.options.lease.value
+	}
+
+	return key
+}
+
+// Run runs the workflow from its checkpoint: the remaining steps of an interrupted run,
+// the remaining compensations of a failed one, nothing if the workflow completed already.
+// A failed step returns a WorkflowError matching ErrWorkflowCompensated and the step
+// error once the completed steps are compensated, a failed compensation is returned as is
+// and retried by the next Run. A step failing because ctx is done is not compensated,
+// the next Run retries it.
+func (w *Workflow) Run(ctx context.Context) error {
+	if w.options.lease != nil && w.options.lease.value == "" {
+		return &WorkflowError{Key: w.key(), Err: ErrLeaseNotObtained}
+	}
+
+	cp, err := w.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(cp.Completed) > len(w.steps) {
+		return &WorkflowError{Key: w.key(), Err: ErrWorkflowChanged}
+	}
+	for n, name := range cp.Completed {
+		if w.steps[n].Name != name {
+			return &WorkflowError{Key: w.key(), Step: name, Err: ErrWorkflowChanged}
+		}
+	}
+
+	switch cp.State {
+	case workflowDone:
+		return nil
+	case workflowCompensated:
+		return &WorkflowError{Key: w.key(), Step: cp.Failed, Err: wrapCause(ErrWorkflowCompensated, errors.New(cp.Error))}
+	case workflowCompensating:
+		return w.compensate(ctx, cp)
+	}
+
+	for _, step := range w.steps[len(cp.Completed):] {
+		if err := step.Run(ctx); err != nil {
+			if ctx.Err() != nil {
+				return &WorkflowError{Key: w.key(), Step: step.Name, Err: err}
+			}
+
+			cp.State, cp.Failed, cp.Error = workflowCompensating, step.Name, err.Error()
+			if err := w.save(ctx, step.Name, cp); err != nil {
+				return err
+			}
+
+			return w.compensate(ctx, cp)
+		}
+
+		cp.Completed = append(cp.Completed, step.Name)
+		if len(cp.Completed) == len(w.steps) {
+			cp.State = workflowDone
+		}
+
+		if err := w.save(ctx, step.Name, cp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compensate undoes the completed steps in reverse order
+func (w *Workflow) compensate(ctx context.Context, cp *workflowCheckpoint) error {
+	for len(cp.Completed) > 0 {
+		step := w.steps[len(cp.Completed)-1]
+		if step.Compensate != nil {
+			if err := step.Compensate(ctx); err != nil {
+				return &WorkflowError{Key: w.key(), Step: step.Name, Err: err}
+			}
+		}
+
+		cp.Completed = cp.Completed[:len(cp.Completed)-1]
+		if len(cp.Completed) == 0 {
+			cp.State = workflowCompensated
+		}
+
+		if err := w.save(ctx, step.Name, cp); err != nil {
+			return err
+		}
+	}
+
+	if cp.State != workflowCompensated {
+		// the first step failed, there is nothing to compensate
+		cp.State = workflowCompensated
+		if err := w.save(ctx, cp.Failed, cp); err != nil {
+			return err
+		}
+	}
+
+	return &WorkflowError{Key: w.key(), Step: cp.Failed, Err: wrapCause(ErrWorkflowCompensated, errors.New(cp.Error))}
+}
+
+func (w *Workflow) load(ctx context.Context) (*workflowCheckpoint, error) {
+	key := w.key()
+
+	resp, err := w.client.etcd.Get(ctx, key)
+	if err != nil {
+		return nil, &WorkflowError{Key: key, Err: etcdError(err)}
+	}
+
+	cp := &workflowCheckpoint{State: workflowRunning}
+	if len(resp.Kvs) == 0 {
+		return cp, nil
+	}
+
+	if err := json.Unmarshal(resp.Kvs[0].Value, cp); err != nil {
+		return nil, &WorkflowError{Key: key, Err: err}
+	}
+
+	return cp, nil
+}
+
+// save writes the checkpoint, only while the lease holds its value if the workflow is tied to one
+func (w *Workflow) save(ctx context.Context, step string, cp *workflowCheckpoint) error {
+	key := w.key()
+
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return &WorkflowError{Key: key, Step: step, Err: err}
+	}
+
+	var cmps []clientv3.Cmp
+	if l := w.options.lease; l != nil {
+		cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(l.leaseKey), "=", l.Revision()))
+	}
+
+	resp, err := w.client.etcd.Txn(ctx).If(cmps...).Then(clientv3.OpPut(key, string(data))).Commit()
+	if err != nil {
+		return &WorkflowError{Key: key, Step: step, Err: etcdError(err)}
+	}
+
+	if !resp.Succeeded {
+		return &WorkflowError{Key: key, Step: step, Err: ErrLeaseNotObtained}
+	}
+
+	return nil
+}
+
+// Reset deletes the checkpoint, so the next Run starts from the first step
+func (w *Workflow) Reset(ctx context.Context) error {
+	key := w.key()
+
+	if _, err := w.client.etcd.Delete(ctx, key); err != nil {
+		return &WorkflowError{Key: key, Err: etcdError(err)}
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package svcutil
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestWorkflow(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("migrate"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	var log []string
+	var fail string
+	step := func(name string) WorkflowStep {
+		return WorkflowStep{
+			Name: name,
+			Run: func(ctx context.Context) error {
+				log = append(log, name)
+				if name == fail {
+					return errors.New(name + " failed")
+				}
+				return nil
+			},
+			Compensate: func(ctx context.Context) error {
+				log = append(log, "undo "+name)
+				return nil
+			},
+		}
+	}
+
+	// the instance crashes during b
+	crashed, crash := context.WithCancel(ctx)
+	steps := []WorkflowStep{step("a"), step("b"), step("c")}
+	steps[1].Run = func(ctx context.Context) error {
+		crash()
+		return ctx.Err()
+	}
+
+	wf := NewWorkflow(svc, "v42", steps)
+	if err := wf.Run(crashed); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run() of a crashing workflow error = %v", err)
+	}
+
+	log = nil
+	steps[1] = step("b")
+	if err := NewWorkflow(svc, "v42", steps).Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !reflect.DeepEqual(log, []string{"b", "c"}) {
+		t.Errorf("resumed steps = %v, want b and c", log)
+	}
+
+	log = nil
+	if err := NewWorkflow(svc, "v42", steps).Run(ctx); err != nil || len(log) != 0 {
+		t.Errorf("Run() of a completed workflow = %v, ran %v", err, log)
+	}
+
+	if err := NewWorkflow(svc, "v42", []WorkflowStep{step("a"), step("x")}).Run(ctx); !errors.Is(err, ErrWorkflowChanged) {
+		t.Errorf("Run() of changed steps error = %v, want %v", err, ErrWorkflowChanged)
+	}
+
+	fail = "c"
+	err = NewWorkflow(svc, "v43", steps).Run(ctx)
+	if !errors.Is(err, ErrWorkflowCompensated) || !strings.Contains(err.Error(), "c failed") {
+		t.Errorf("Run() of a failing workflow error = %v, want %v", err, ErrWorkflowCompensated)
+	}
+	if !reflect.DeepEqual(log, []string{"a", "b", "c", "undo b", "undo a"}) {
+		t.Errorf("steps = %v, want compensation in reverse order", log)
+	}
+
+	log = nil
+	if err := NewWorkflow(svc, "v43", steps).Run(ctx); !errors.Is(err, ErrWorkflowCompensated) || len(log) != 0 {
+		t.Errorf("Run() of a compensated workflow = %v, ran %v", err, log)
+	}
+
+	if err := NewWorkflow(svc, "v43", steps).Reset(ctx); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	fail = ""
+	if err := NewWorkflow(svc, "v43", steps).Run(ctx); err != nil || len(log) != 3 {
+		t.Errorf("Run() after Reset() = %v, ran %v", err, log)
+	}
+}
+
+func TestWorkflowWithLease(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	r, _ := NewIDRange("1")
+
+	var ran []string
+	crashed, crash := context.WithCancel(ctx)
+	steps := func(instance string, crashAt string) []WorkflowStep {
+		var steps []WorkflowStep
+		for _, name := range []string{"copy", "verify", "switch"} {
+			steps = append(steps, WorkflowStep{Name: name, Run: func(ctx context.Context) error {
+				if name == crashAt {
+					crash()
+					return ctx.Err()
+				}
+				ran = append(ran, instance+" "+name)
+				return nil
+			}})
+		}
+		return steps
+	}
+
+	first, err := NewService(Name("shards"), Instance("first"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer first.Close()
+
+	l := NewLeaseWithOptions(r, first)
+	if err := NewWorkflow(first, "rebuild", steps("first", ""), WorkflowWithLease(l)).Run(ctx); !errors.Is(err, ErrLeaseNotObtained) {
+		t.Errorf("Run() without the value error = %v, want %v", err, ErrLeaseNotObtained)
+	}
+
+	if _, err := l.Obtain(ctx); err != nil {
+		t.Fatalf("Obtain() error = %v", err)
+	}
+
+	// a cancellation stands in for the crash of the first instance
+	if err := NewWorkflow(first, "rebuild", steps("first", "switch"), WorkflowWithLease(l)).Run(crashed); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run() of a crashing workflow error = %v", err)
+	}
+	l.Close()
+
+	second, err := NewService(Name("shards"), Instance("second"), LocalBackend(dir))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer second.Close()
+
+	successor := NewLeaseWithOptions(r, second)
+	defer successor.Close()
+	if _, err := successor.Obtain(ctx); err != nil {
+		t.Fatalf("Obtain() error = %v", err)
+	}
+
+	if err := NewWorkflow(second, "rebuild", steps("second", ""), WorkflowWithLease(successor)).Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if want := []string{"first copy", "first verify", "second switch"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("steps = %v, want %v", ran, want)
+	}
+}
+
+func TestWorkflowCheckpointSurvivesGC(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	svc, err := NewService(Name("migrate"), LocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer svc.Close()
+
+	runs := 0
+	steps := []WorkflowStep{{Name: "a", Run: func(ctx context.Context) error {
+		runs++
+		return nil
+	}}}
+
+	wf := NewWorkflow(svc, "v42", steps)
+	if err := wf.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if _, err := svc.GC(ctx, 0, false); err != nil {
+		t.Fatalf("GC() error = %v", err)
+	}
+
+	if resp, _ := svc.etcd.Get(ctx, wf.key()); len(resp.Kvs) != 1 {
+		t.Fatalf("GC() deleted the checkpoint of a finished workflow")
+	}
+
+	if err := NewWorkflow(svc, "v42", steps).Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if runs != 1 {
+		t.Errorf("steps ran %d times after GC, want once", runs)
+	}
+}